@@ -0,0 +1,196 @@
+// Package api defines the JSON documents exchanged between lunartlk
+// servers and clients. The server, the client library and the command-line
+// tools all use these types, so their fields can't drift apart.
+package api
+
+// Version is the version of the response schema. It changes when a field
+// is removed or changes meaning; new optional fields don't change it.
+// Servers still answer in versions down to MinVersion for the clients that
+// ask for them with VersionHeader.
+//
+// Version 2 moved the machine's architecture, SIMD and memory from the
+// model_selection of GET /info, missing when models aren't picked
+// automatically, to host.
+const (
+	Version    = 2
+	MinVersion = 1
+)
+
+// VersionHeader carries the schema version: in requests the one the
+// client understands, in responses the one the server answers in. Servers
+// that predate it answer in version 1.
+const VersionHeader = "Lunartlk-Api-Version"
+
+// TranscriptLine is a timed segment of a transcript. Only engines that
+// segment their output (Moonshine) return lines.
+type TranscriptLine struct {
+	Text      string  `json:"text"`
+	StartTime float64 `json:"start_time"`
+	Duration  float64 `json:"duration"`
+	Speaker   uint32  `json:"speaker"`
+	// SpeakerName is the enrolled speaker recognized in the line, when
+	// the server has voiceprints.
+	SpeakerName string `json:"speaker_name,omitempty"`
+	// Lang is the language the line is in, when the server tags the
+	// lines of recordings that switch languages.
+	Lang string `json:"lang,omitempty"`
+	// Sentiment (positive, neutral or negative) and Emotion are set by
+	// the sentiment post-processor.
+	Sentiment string `json:"sentiment,omitempty"`
+	Emotion   string `json:"emotion,omitempty"`
+}
+
+// Chapter is a titled section of a long transcript, added by the server's
+// chapters post-processor. StartTime is only set when the transcript has
+// lines.
+type Chapter struct {
+	Title     string  `json:"title"`
+	StartTime float64 `json:"start_time"`
+	Text      string  `json:"text"`
+}
+
+// TranscriptResponse is the result of a transcription, as returned by
+// POST /transcribe.
+type TranscriptResponse struct {
+	Text          string           `json:"text"`
+	Lines         []TranscriptLine `json:"lines"`
+	Chapters      []Chapter        `json:"chapters,omitempty"`
+	AudioDuration float64          `json:"audio_duration"`
+	ProcessingMs  int64            `json:"processing_ms"`
+	Model         string           `json:"model"`
+	Lang          string           `json:"lang"`
+	Engine        string           `json:"engine"`
+	// ID identifies the stored transcript, when the server keeps them.
+	ID string `json:"id,omitempty"`
+	// Cached is set when the server answered from its response cache.
+	Cached bool `json:"cached,omitempty"`
+	// Timings breaks ProcessingMs down by stage. The server only returns
+	// it when asked with ?timings=true.
+	Timings *Timings `json:"timings,omitempty"`
+	// AudioStats describes the quality of the uploaded audio, so clients
+	// can warn about clipping or noise that may explain errors.
+	AudioStats *AudioStats `json:"audio_stats,omitempty"`
+	// RawText is the text before fillers and repeated words were removed,
+	// with the rest of the post-processing applied. Only set with
+	// ?clean=true.
+	RawText string `json:"raw_text,omitempty"`
+	// Rewrite is the transcript polished by an LLM into an email, note or
+	// bullet list. Only set with ?rewrite=STYLE.
+	Rewrite string `json:"rewrite,omitempty"`
+	// Fields are custom values added by server scripts.
+	Fields map[string]any `json:"fields,omitempty"`
+	// Session is the session the dictation was sent in, with ?session=.
+	Session string `json:"session,omitempty"`
+	// Confidence is how sure the engine is of the transcript, from 0 to 1.
+	// Engines that don't report one get an estimate from the text.
+	Confidence float64 `json:"confidence,omitempty"`
+	// Escalated is set when the first model's result was below the
+	// server's confidence threshold and a more accurate model transcribed
+	// the audio again. EscalatedFrom is the first model.
+	Escalated     bool   `json:"escalated,omitempty"`
+	EscalatedFrom string `json:"escalated_from,omitempty"`
+}
+
+// Partial is the transcript of a chunk of a streamed upload, sent before
+// the final transcript with ?partials=true.
+type Partial struct {
+	// Partial is always true, telling partials from the final transcript
+	// in the response.
+	Partial bool             `json:"partial"`
+	Text    string           `json:"text"`
+	Lines   []TranscriptLine `json:"lines"`
+	// StartTime and Duration place the chunk in the upload, in seconds.
+	StartTime float64 `json:"start_time"`
+	Duration  float64 `json:"duration"`
+}
+
+// StreamError ends a ?partials=true response in place of the final
+// transcript when the request fails after partials were sent, and the
+// status can't change anymore.
+type StreamError struct {
+	// Message is set in every StreamError, telling them from partials and
+	// transcripts.
+	Message string `json:"stream_error"`
+	// Status is the HTTP status the request would have failed with.
+	Status int `json:"status"`
+}
+
+// AudioStats are quality metrics of the uploaded audio.
+type AudioStats struct {
+	// Peak and RMS are amplitudes from 0 to 1.
+	Peak float64 `json:"peak"`
+	RMS  float64 `json:"rms"`
+	// ClippingRatio is the fraction of samples at full scale.
+	ClippingRatio float64 `json:"clipping_ratio"`
+	// SNRDB estimates the signal-to-noise ratio in decibels, comparing
+	// the loudest and quietest parts of the recording.
+	SNRDB float64 `json:"snr_db"`
+}
+
+// Timings is the time a request spent in each stage, in milliseconds.
+// Stages an engine doesn't have, or doesn't report separately, are 0:
+// Moonshine runs its model in a single call, counted as encoder time.
+type Timings struct {
+	// DecodeMs is the time spent decoding the uploaded WAV or Opus file.
+	DecodeMs int64 `json:"decode_ms"`
+	// PreprocessMs covers feature extraction.
+	PreprocessMs int64 `json:"preprocess_ms"`
+	EncoderMs    int64 `json:"encoder_ms"`
+	// SearchMs is the decoder search over the encoder output.
+	SearchMs   int64 `json:"search_ms"`
+	PostprocMs int64 `json:"postproc_ms"`
+}
+
+// Info describes a server's capabilities, as returned by GET /info.
+type Info struct {
+	Version string `json:"version"`
+	// APIVersion is the schema version of the response, and APIVersions
+	// all those the server can answer in.
+	APIVersion    int             `json:"api_version"`
+	APIVersions   []int           `json:"api_versions"`
+	DefaultEngine string          `json:"default_engine"`
+	DefaultLang   string          `json:"default_lang"`
+	Engines       []EngineInfo    `json:"engines"`
+	Formats       []string        `json:"formats"`
+	Encodings     []string        `json:"encodings"`
+	Limits        Limits          `json:"limits"`
+	Features      map[string]bool `json:"features"`
+	Host          Host            `json:"host"`
+
+	// Aliases maps the names set with -alias to engine/model.
+	Aliases map[string]string `json:"aliases,omitempty"`
+	// ModelSelection is what -auto-select picked for the machine.
+	ModelSelection *ModelSelection `json:"model_selection,omitempty"`
+}
+
+// EngineInfo describes an engine available on the server.
+type EngineInfo struct {
+	Name   string   `json:"name"`
+	Model  string   `json:"model"`
+	Langs  []string `json:"langs"`
+	Loaded bool     `json:"loaded"`
+}
+
+// Limits are the server's limits on uploads.
+type Limits struct {
+	MaxUploadBytes int64 `json:"max_upload_bytes"`
+	// MaxAudioSeconds is 0 when audio duration isn't limited.
+	MaxAudioSeconds float64 `json:"max_audio_seconds"`
+}
+
+// Host describes the machine the server runs on.
+type Host struct {
+	OS   string `json:"os"`
+	Arch string `json:"arch"`
+	// SIMD is "avx2", "neon" or "" when the CPU has neither.
+	SIMD        string `json:"simd"`
+	MemoryBytes uint64 `json:"memory_bytes"`
+}
+
+// ModelSelection is the default engine and English Moonshine model the
+// server picked for its host, and why.
+type ModelSelection struct {
+	Engine      string `json:"engine"`
+	MoonshineEn string `json:"moonshine_en"`
+	Reason      string `json:"reason"`
+}
@@ -0,0 +1,58 @@
+package client
+
+import "math"
+
+// Calibration adjusts the level of the audio recorded from a device, as
+// measured for it by lunartlk-client calibrate.
+type Calibration struct {
+	// Gain multiplies the samples, e.g. to lift a quiet microphone above
+	// the speech detection threshold. Zero means 1.
+	Gain float64 `json:"gain"`
+	// Gate is the RMS level, after Gain, under which audio is treated as
+	// background noise and turned down. Zero disables the gate.
+	Gate float64 `json:"gate"`
+}
+
+// gateFloor is the gain of audio under the gate: turned down rather than
+// muted, so quiet syllables taken for noise remain audible.
+const gateFloor = 0.1
+
+// WithCalibration applies c to the recorded audio.
+func WithCalibration(c Calibration) RecorderOption {
+	return func(cfg *recorderConfig) { cfg.calibration = c }
+}
+
+// calibrate applies the recorder's calibration to a chunk in place. The
+// gate's gain moves across the chunk from its last value to the new one,
+// so opening and closing it doesn't click.
+func (r *Recorder) calibrate(chunk []float32) {
+	c := r.calibration
+	if c.Gain == 0 && c.Gate == 0 {
+		return
+	}
+	gain := c.Gain
+	if gain == 0 {
+		gain = 1
+	}
+	target := 1.0
+	if c.Gate > 0 && chunkRMS(chunk)*gain < c.Gate {
+		target = gateFloor
+	}
+	from := r.gateGain
+	for i := range chunk {
+		g := gain * (from + (target-from)*float64(i+1)/float64(len(chunk)))
+		chunk[i] = float32(max(-1, min(1, float64(chunk[i])*g)))
+	}
+	r.gateGain = target
+}
+
+func chunkRMS(chunk []float32) float64 {
+	if len(chunk) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range chunk {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum / float64(len(chunk)))
+}
@@ -2,32 +2,31 @@ package client
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"strings"
-)
+	"sync"
+	"sync/atomic"
 
-// TranscriptLine represents a single line of transcribed text with timing.
-type TranscriptLine struct {
-	Text      string  `json:"text"`
-	StartTime float64 `json:"start_time"`
-	Duration  float64 `json:"duration"`
-}
+	"github.com/klauspost/compress/zstd"
 
-// TranscriptResponse holds the server's transcription result.
-type TranscriptResponse struct {
-	Text          string           `json:"text"`
-	Lines         []TranscriptLine `json:"lines"`
-	AudioDuration float64          `json:"audio_duration"`
-	ProcessingMs  int64            `json:"processing_ms"`
-	Model         string           `json:"model"`
-	Lang          string           `json:"lang"`
-	Engine        string           `json:"engine"`
-	Arch          int              `json:"arch"`
-}
+	"github.com/rubiojr/lunartlk/api"
+)
+
+// TranscriptLine, Chapter and TranscriptResponse are the api package
+// types, kept under their previous names.
+type (
+	TranscriptLine     = api.TranscriptLine
+	Chapter            = api.Chapter
+	TranscriptResponse = api.TranscriptResponse
+)
 
 // Client communicates with a lunartlk transcription server.
 type Client struct {
@@ -35,7 +34,29 @@ type Client struct {
 	token     string
 	lang      string
 	engine    string
-	http      *http.Client
+	encoding  string
+	profanity string
+	clean     bool
+	rewrite   string
+	session   string
+	export    string
+	// chunkSize is the chunk size of resumable uploads, 0 when
+	// Transcribe sends audio in one request.
+	chunkSize int
+	// encryptionKey encrypts audio before it's sent; nil to send it as
+	// it is.
+	encryptionKey []byte
+	// rootCAs, when set, replaces the system's trusted certificates.
+	rootCAs *x509.CertPool
+	http    *http.Client
+	// onVersionMismatch is told the server's API version when it isn't
+	// the client's, the first time.
+	onVersionMismatch func(server int)
+	versionWarned     atomic.Bool
+	// features are those the server announces in GET /info, fetched
+	// when first needed.
+	features     map[string]bool
+	featuresOnce sync.Once
 }
 
 // Option configures a Client.
@@ -56,6 +77,49 @@ func WithEngine(engine string) Option {
 	return func(c *Client) { c.engine = engine }
 }
 
+// WithCompression compresses uploads with the given Content-Encoding
+// ("gzip" or "zstd"). Useful for WAV uploads; Opus is already compact.
+func WithCompression(encoding string) Option {
+	return func(c *Client) { c.encoding = encoding }
+}
+
+// WithProfanityFilter asks the server to mask swear words in transcripts
+// in the given style ("first", "stars" or "tag").
+func WithProfanityFilter(style string) Option {
+	return func(c *Client) { c.profanity = style }
+}
+
+// WithCleanup asks the server to remove filler words and repeated words
+// from transcripts. The text with them is kept in RawText.
+func WithCleanup() Option {
+	return func(c *Client) { c.clean = true }
+}
+
+// WithRewrite asks the server to also return the transcript polished in
+// the given style ("email", "note" or "bullet"), in Rewrite.
+func WithRewrite(style string) Option {
+	return func(c *Client) { c.rewrite = style }
+}
+
+// WithSession groups the transcriptions in a session, which the server
+// stores together and uses the earlier ones of to spell names the same
+// way.
+func WithSession(id string) Option {
+	return func(c *Client) { c.session = id }
+}
+
+// WithExport sends the transcripts to the server's export profile, e.g.
+// a Joplin notebook or a Notion database. "none" skips the default one.
+func WithExport(profile string) Option {
+	return func(c *Client) { c.export = profile }
+}
+
+// WithHTTPClient sets the HTTP client used for requests (default:
+// http.DefaultClient), e.g. to set a timeout.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
 // New creates a Client for the given server URL.
 func New(serverURL string, opts ...Option) *Client {
 	c := &Client{
@@ -65,11 +129,30 @@ func New(serverURL string, opts ...Option) *Client {
 	for _, opt := range opts {
 		opt(c)
 	}
+	hc := *c.http
+	if c.rootCAs != nil {
+		tr := http.DefaultTransport.(*http.Transport).Clone()
+		tr.TLSClientConfig = &tls.Config{RootCAs: c.rootCAs}
+		hc.Transport = tr
+	}
+	if hc.Transport == nil {
+		hc.Transport = http.DefaultTransport
+	}
+	hc.Transport = &versionTransport{next: hc.Transport, client: c}
+	c.http = &hc
 	return c
 }
 
 // Transcribe sends encoded audio to the server and returns the transcript.
 func (c *Client) Transcribe(audio []byte, filename string) (*TranscriptResponse, error) {
+	if c.chunkSize > 0 {
+		return c.TranscribeResumable(context.Background(), audio, filename)
+	}
+	audio = c.wireFormat(audio, filename)
+	audio, filename, err := c.seal(audio, filename)
+	if err != nil {
+		return nil, err
+	}
 	var body bytes.Buffer
 	writer := multipart.NewWriter(&body)
 
@@ -82,12 +165,20 @@ func (c *Client) Transcribe(audio []byte, filename string) (*TranscriptResponse,
 	}
 	writer.Close()
 
+	payload, err := compress(c.encoding, body.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
 	url := c.transcribeURL()
-	req, err := http.NewRequest("POST", url, &body)
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
 	if err != nil {
 		return nil, fmt.Errorf("create request: %w", err)
 	}
 	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if c.encoding != "" {
+		req.Header.Set("Content-Encoding", c.encoding)
+	}
 	if c.token != "" {
 		req.Header.Set("Authorization", "Bearer "+c.token)
 	}
@@ -110,6 +201,32 @@ func (c *Client) Transcribe(audio []byte, filename string) (*TranscriptResponse,
 	return &result, nil
 }
 
+func compress(encoding string, data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch encoding {
+	case "":
+		return data, nil
+	case "gzip":
+		zw := gzip.NewWriter(&buf)
+		zw.Write(data)
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+	case "zstd":
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		zw.Write(data)
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compression %q, use gzip or zstd", encoding)
+	}
+	return buf.Bytes(), nil
+}
+
 func (c *Client) transcribeURL() string {
 	url := c.serverURL + "/transcribe"
 	var params []string
@@ -119,6 +236,21 @@ func (c *Client) transcribeURL() string {
 	if c.engine != "" {
 		params = append(params, "engine="+c.engine)
 	}
+	if c.profanity != "" {
+		params = append(params, "profanity="+c.profanity)
+	}
+	if c.clean {
+		params = append(params, "clean=true")
+	}
+	if c.rewrite != "" {
+		params = append(params, "rewrite="+c.rewrite)
+	}
+	if c.session != "" {
+		params = append(params, "session="+c.session)
+	}
+	if c.export != "" {
+		params = append(params, "export="+c.export)
+	}
 	if len(params) > 0 {
 		url += "?" + strings.Join(params, "&")
 	}
@@ -0,0 +1,35 @@
+package client
+
+import (
+	"fmt"
+
+	"github.com/rubiojr/lunartlk/internal/seal"
+)
+
+// WithEncryption encrypts audio with key before sending it, for servers
+// reached through proxies or storage that shouldn't hear it. The server
+// must have the same key in its -encryption-key file; it decrypts the
+// audio in memory and never writes it to disk decrypted. The transcript
+// comes back unencrypted.
+func WithEncryption(key []byte) Option {
+	return func(c *Client) { c.encryptionKey = key }
+}
+
+// LoadEncryptionKey reads a key for WithEncryption from a file holding
+// 32 random bytes in base64, as written by "openssl rand -base64 32".
+func LoadEncryptionKey(path string) ([]byte, error) {
+	return seal.LoadKey(path)
+}
+
+// seal encrypts audio when the client has a key, naming it so the server
+// knows: recording.opus becomes recording.opus.enc.
+func (c *Client) seal(audio []byte, filename string) ([]byte, string, error) {
+	if c.encryptionKey == nil {
+		return audio, filename, nil
+	}
+	sealed, err := seal.Seal(c.encryptionKey, audio)
+	if err != nil {
+		return nil, "", fmt.Errorf("encrypt audio: %w", err)
+	}
+	return sealed, filename + seal.Ext, nil
+}
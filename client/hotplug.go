@@ -0,0 +1,159 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// Recorder event types.
+const (
+	// DeviceLost is sent when the input device stops delivering audio,
+	// e.g. a headset was unplugged. The recorder keeps trying to reopen it.
+	DeviceLost = "device-lost"
+	// DeviceChanged is sent when the default input changes while recording
+	// from it, before the stream is reopened on the new one.
+	DeviceChanged = "device-changed"
+	// DeviceReopened is sent when recording goes on after DeviceLost or
+	// DeviceChanged. The audio in between is missing.
+	DeviceReopened = "device-reopened"
+)
+
+// RecorderEvent reports a change of the input device.
+type RecorderEvent struct {
+	Type string
+	// Err is why the device was lost.
+	Err error
+}
+
+// reopenInterval is how often a lost device is looked for again, and how
+// often the default input is checked for changes.
+const reopenInterval = time.Second
+
+// WithEvents calls fn with the recorder's device events, from the
+// capture goroutine.
+func WithEvents(fn func(RecorderEvent)) RecorderOption {
+	return func(c *recorderConfig) { c.onEvent = fn }
+}
+
+// WithOnSamples calls fn with every chunk of audio as it's recorded, from
+// the capture goroutine, e.g. to stream it or draw a waveform. fn must
+// not keep chunk after returning.
+func WithOnSamples(fn func(chunk []float32)) RecorderOption {
+	return func(c *recorderConfig) { c.onSamples = fn }
+}
+
+func (r *Recorder) event(e RecorderEvent) {
+	if r.onEvent != nil {
+		r.onEvent(e)
+	}
+}
+
+// read waits for the next chunk of audio. When the device is lost or the
+// default input changes, it reopens the stream and goes on. It returns
+// false once the recording is stopped.
+func (r *Recorder) read(done <-chan struct{}) ([]float32, bool) {
+	for {
+		select {
+		case <-done:
+			return nil, false
+		default:
+		}
+
+		if r.defaultChanged.Swap(false) {
+			if !r.reopen(done, RecorderEvent{Type: DeviceChanged}) {
+				return nil, false
+			}
+			continue
+		}
+		if err := r.stream.Read(); err != nil {
+			select {
+			case <-done:
+				return nil, false
+			default:
+			}
+			if !r.reopen(done, RecorderEvent{Type: DeviceLost, Err: err}) {
+				return nil, false
+			}
+			continue
+		}
+		chunk := make([]float32, r.chunkSize)
+		copy(chunk, r.buf)
+		r.calibrate(chunk)
+		return chunk, true
+	}
+}
+
+// reopen closes the stream after e and opens it again, retrying until it
+// works or the recording is stopped.
+func (r *Recorder) reopen(done <-chan struct{}, e RecorderEvent) bool {
+	r.event(e)
+	r.mu.Lock()
+	old := r.stream
+	r.stream = nil
+	r.mu.Unlock()
+	old.Stop()
+	old.Close()
+
+	for {
+		stream, err := openInput(r.device, r.sampleRate, r.buf)
+		if err == nil {
+			if err = stream.Start(); err != nil {
+				stream.Close()
+			}
+		}
+		if err == nil {
+			r.mu.Lock()
+			r.stream = stream
+			r.mu.Unlock()
+			r.event(RecorderEvent{Type: DeviceReopened})
+			return true
+		}
+		select {
+		case <-done:
+			return false
+		case <-time.After(reopenInterval):
+		}
+	}
+}
+
+// input returns the stream, opening it again if it was lost for good.
+func (r *Recorder) input() (inputStream, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stream == nil {
+		stream, err := openInput(r.device, r.sampleRate, r.buf)
+		if err != nil {
+			return nil, fmt.Errorf("open mic: %w", err)
+		}
+		r.stream = stream
+	}
+	return r.stream, nil
+}
+
+// watchDefault flags the stream for reopening when the PulseAudio/PipeWire
+// default input changes, for recorders on the default device, until done
+// is closed. It does nothing without pactl.
+func (r *Recorder) watchDefault(done <-chan struct{}) {
+	if r.device != "" {
+		return
+	}
+	current, err := DefaultInputSource()
+	if err != nil {
+		return
+	}
+	t := time.NewTicker(reopenInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+		source, err := DefaultInputSource()
+		if err != nil || source == current {
+			continue
+		}
+		current = source
+		r.defaultChanged.Store(true)
+	}
+}
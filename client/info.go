@@ -0,0 +1,37 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/rubiojr/lunartlk/api"
+)
+
+// Info and EngineInfo are the api package types, kept under their
+// previous names.
+type (
+	Info       = api.Info
+	EngineInfo = api.EngineInfo
+)
+
+// Info returns the server's capabilities. It doesn't need authentication.
+func (c *Client) Info() (*Info, error) {
+	resp, err := c.http.Get(c.serverURL + "/info")
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, string(b))
+	}
+
+	var info Info
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &info, nil
+}
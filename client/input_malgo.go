@@ -0,0 +1,141 @@
+//go:build malgo
+
+package client
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/gen2brain/malgo"
+)
+
+// AudioBackend is the library the Recorder captures audio with.
+const AudioBackend = "malgo"
+
+var errStreamStopped = errors.New("stream stopped")
+
+// malgoStream buffers the samples miniaudio delivers to its callback until
+// Read takes them, a buffer at a time.
+type malgoStream struct {
+	ctx    *malgo.AllocatedContext
+	device *malgo.Device
+	buf    []float32
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []float32
+	running bool
+}
+
+// openInput opens the default capture device, or the first one whose name
+// contains device. "pulse" (see WithPulseSource) is the default device of
+// the PulseAudio backend, where libpulse picks the source from
+// $PULSE_SOURCE.
+func openInput(device string, sampleRate int, buf []float32) (inputStream, error) {
+	var backends []malgo.Backend
+	if device == "pulse" {
+		backends = []malgo.Backend{malgo.BackendPulseaudio}
+	}
+	ctx, err := malgo.InitContext(backends, malgo.ContextConfig{}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("malgo init: %w", err)
+	}
+
+	cfg := malgo.DefaultDeviceConfig(malgo.Capture)
+	cfg.Capture.Format = malgo.FormatF32
+	cfg.Capture.Channels = 1
+	cfg.SampleRate = uint32(sampleRate)
+	cfg.PeriodSizeInFrames = uint32(len(buf))
+	if device != "" && device != "pulse" {
+		id, err := findCaptureDevice(ctx, device)
+		if err != nil {
+			ctx.Uninit()
+			ctx.Free()
+			return nil, err
+		}
+		cfg.Capture.DeviceID = id.Pointer()
+	}
+
+	s := &malgoStream{ctx: ctx, buf: buf}
+	s.cond = sync.NewCond(&s.mu)
+	s.device, err = malgo.InitDevice(ctx.Context, cfg, malgo.DeviceCallbacks{Data: s.onData, Stop: s.onStop})
+	if err != nil {
+		ctx.Uninit()
+		ctx.Free()
+		return nil, fmt.Errorf("open mic: %w", err)
+	}
+	return s, nil
+}
+
+func findCaptureDevice(ctx *malgo.AllocatedContext, name string) (malgo.DeviceID, error) {
+	devices, err := ctx.Devices(malgo.Capture)
+	if err != nil {
+		return malgo.DeviceID{}, fmt.Errorf("list devices: %w", err)
+	}
+	for _, d := range devices {
+		if strings.Contains(strings.ToLower(d.Name()), strings.ToLower(name)) {
+			return d.ID, nil
+		}
+	}
+	return malgo.DeviceID{}, fmt.Errorf("no input device matching %q", name)
+}
+
+// onData receives interleaved float32 frames, one channel here.
+func (s *malgoStream) onData(_, in []byte, frames uint32) {
+	s.mu.Lock()
+	for i := 0; i+4 <= len(in); i += 4 {
+		s.pending = append(s.pending, math.Float32frombits(binary.LittleEndian.Uint32(in[i:])))
+	}
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// onStop wakes Read when the device stops, by Stop or because it was
+// unplugged.
+func (s *malgoStream) onStop() {
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+func (s *malgoStream) Start() error {
+	s.mu.Lock()
+	s.pending = s.pending[:0]
+	s.running = true
+	s.mu.Unlock()
+	return s.device.Start()
+}
+
+func (s *malgoStream) Read() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.running && len(s.pending) < len(s.buf) {
+		s.cond.Wait()
+	}
+	if !s.running {
+		return errStreamStopped
+	}
+	n := copy(s.buf, s.pending)
+	s.pending = append(s.pending[:0], s.pending[n:]...)
+	return nil
+}
+
+func (s *malgoStream) Stop() error {
+	s.mu.Lock()
+	s.running = false
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	return s.device.Stop()
+}
+
+func (s *malgoStream) Close() error {
+	s.device.Uninit()
+	err := s.ctx.Uninit()
+	s.ctx.Free()
+	return err
+}
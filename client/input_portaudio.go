@@ -0,0 +1,81 @@
+//go:build !malgo
+
+package client
+
+// #cgo pkg-config: portaudio-2.0 jack
+import "C"
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gordonklaus/portaudio"
+)
+
+// AudioBackend is the library the Recorder captures audio with.
+const AudioBackend = "portaudio"
+
+// portaudioStream terminates PortAudio when the stream is closed.
+type portaudioStream struct {
+	*portaudio.Stream
+}
+
+// Read ignores input overflows: the buffer is filled anyway, only some
+// audio before it was dropped.
+func (s portaudioStream) Read() error {
+	if err := s.Stream.Read(); err != nil && err != portaudio.InputOverflowed {
+		return err
+	}
+	return nil
+}
+
+func (s portaudioStream) Close() error {
+	s.Stream.Close()
+	return portaudio.Terminate()
+}
+
+func openInput(device string, sampleRate int, buf []float32) (inputStream, error) {
+	if err := portaudio.Initialize(); err != nil {
+		return nil, fmt.Errorf("portaudio init: %w", err)
+	}
+	stream, err := openPortaudio(device, sampleRate, buf)
+	if err != nil {
+		portaudio.Terminate()
+		return nil, err
+	}
+	return portaudioStream{stream}, nil
+}
+
+func openPortaudio(device string, sampleRate int, buf []float32) (*portaudio.Stream, error) {
+	if device == "" {
+		stream, err := portaudio.OpenDefaultStream(1, 0, float64(sampleRate), len(buf), buf)
+		if err != nil {
+			return nil, fmt.Errorf("open mic: %w", err)
+		}
+		return stream, nil
+	}
+
+	devices, err := portaudio.Devices()
+	if err != nil {
+		return nil, fmt.Errorf("list devices: %w", err)
+	}
+	for _, d := range devices {
+		if d.MaxInputChannels < 1 || !strings.Contains(strings.ToLower(d.Name), strings.ToLower(device)) {
+			continue
+		}
+		stream, err := portaudio.OpenStream(portaudio.StreamParameters{
+			Input: portaudio.StreamDeviceParameters{
+				Device:   d,
+				Channels: 1,
+				Latency:  d.DefaultLowInputLatency,
+			},
+			SampleRate:      float64(sampleRate),
+			FramesPerBuffer: len(buf),
+		}, buf)
+		if err != nil {
+			return nil, fmt.Errorf("open %s: %w", d.Name, err)
+		}
+		return stream, nil
+	}
+	return nil, fmt.Errorf("no input device matching %q", device)
+}
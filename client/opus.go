@@ -0,0 +1,35 @@
+package client
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// wireHeader is the start of the version 2 Opus wire format header the
+// audio package writes for 16kHz mono 20ms frames: magic "LTOP", version,
+// channels, sample rate and frame size (see audio.ParseWireHeader).
+var wireHeader = binary.LittleEndian.AppendUint16(
+	binary.LittleEndian.AppendUint32([]byte{'L', 'T', 'O', 'P', 2, 1}, 16000), 320)
+
+// wireFormat drops the version 2 header of Opus wire format audio when
+// the server doesn't announce the opus_v2 feature, as servers that
+// predate it only read version 1. The header only describes audio version
+// 1 implies, so the frames are left as they are.
+func (c *Client) wireFormat(data []byte, filename string) []byte {
+	if !strings.HasSuffix(filename, ".opus") || !bytes.HasPrefix(data, wireHeader) || c.hasFeature("opus_v2") {
+		return data
+	}
+	return data[len(wireHeader):]
+}
+
+// hasFeature reports whether the server announces a feature in GET /info.
+// The features are fetched once; servers that can't be asked have none.
+func (c *Client) hasFeature(name string) bool {
+	c.featuresOnce.Do(func() {
+		if info, err := c.Info(); err == nil {
+			c.features = info.Features
+		}
+	})
+	return c.features[name]
+}
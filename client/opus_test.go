@@ -0,0 +1,56 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rubiojr/lunartlk/internal/audio"
+)
+
+func TestWireFormatFallback(t *testing.T) {
+	frames := [][]byte{{1, 2, 3}, {4, 5}}
+	v2 := audio.WireFrames(frames)
+	v1 := v2[len(wireHeader):]
+	if _, got, err := audio.ParseWireHeader(v2); err != nil || !bytes.Equal(got, v1) {
+		t.Fatalf("wireHeader doesn't match the audio package's: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		features map[string]bool
+		want     []byte
+	}{
+		{"v2 server", map[string]bool{"opus_v2": true}, v2},
+		{"older server", map[string]bool{"opus": true}, v1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []byte
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Path {
+				case "/info":
+					json.NewEncoder(w).Encode(Info{Features: tt.features})
+				case "/transcribe":
+					f, _, err := r.FormFile("audio")
+					if err != nil {
+						t.Fatal(err)
+					}
+					got, _ = io.ReadAll(f)
+					json.NewEncoder(w).Encode(TranscriptResponse{Text: "ok"})
+				}
+			}))
+			defer ts.Close()
+
+			if _, err := New(ts.URL).Transcribe(v2, "recording.opus"); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("uploaded % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
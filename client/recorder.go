@@ -1,97 +1,293 @@
 package client
 
-// #cgo pkg-config: portaudio-2.0 jack
-import "C"
-
 import (
 	"fmt"
+	"os"
+	"os/exec"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/gordonklaus/portaudio"
 )
 
-// Recorder captures audio from the default input device via PortAudio.
+// Recorder captures audio from the default input device via PortAudio, or
+// miniaudio in builds with the malgo tag (see AudioBackend).
 type Recorder struct {
 	sampleRate int
 	chunkSize  int
-	stream     *portaudio.Stream
-	buf        []float32
-	recorded   []float32
-	mu         sync.Mutex
-	done       chan struct{}
-	stopped    chan struct{}
+	device     string
+	// stream is nil after the device was lost and couldn't be reopened.
+	stream   inputStream
+	buf      []float32
+	recorded []float32
+	level    float32
+	mu       sync.Mutex
+	done     chan struct{}
+	stopped  chan struct{}
+
+	// preRoll is the number of samples kept while listening, and ring
+	// holds them.
+	preRoll   int
+	ring      []float32
+	listening bool
+	recording bool
+
+	onEvent   func(RecorderEvent)
+	onSamples func([]float32)
+	// calibration adjusts every chunk; gateGain is the gain of its gate
+	// at the end of the last one.
+	calibration Calibration
+	gateGain    float64
+	// defaultChanged is set by watchDefault to reopen the stream.
+	defaultChanged atomic.Bool
 }
 
 // Segment is a chunk of recorded audio delivered by StartContinuous.
+// Segments follow each other without gaps, except for the audio missed
+// while a lost device is reopened.
 type Segment struct {
 	Samples []float32
+	// Start is the offset of the segment from the start of the recording.
+	Start time.Duration
+	// Speech reports whether the segment is an utterance, rather than the
+	// silence between them, so callers can skip the ones without.
+	Speech bool
 }
 
-// NewRecorder initializes PortAudio and opens the default input stream.
-// Call Close when finished to release PortAudio resources.
-func NewRecorder(sampleRate, chunkSize int) (*Recorder, error) {
-	if err := portaudio.Initialize(); err != nil {
-		return nil, fmt.Errorf("portaudio init: %w", err)
+// RecorderOption configures a Recorder.
+type RecorderOption func(*recorderConfig)
+
+type recorderConfig struct {
+	device      string
+	pulseSource string
+	preRoll     time.Duration
+	onEvent     func(RecorderEvent)
+	onSamples   func([]float32)
+	calibration Calibration
+}
+
+// WithDevice records from the first input device whose name contains name
+// (case-insensitive) instead of the default one.
+func WithDevice(name string) RecorderOption {
+	return func(c *recorderConfig) { c.device = name }
+}
+
+// WithPulseSource records from a PulseAudio/PipeWire source, such as a
+// monitor of an output ("alsa_output.pci-0000_00_1f.3.analog-stereo.monitor").
+// It goes through the ALSA "pulse" device, so it needs the PulseAudio ALSA
+// plugin (pipewire-alsa or pulseaudio-alsa).
+func WithPulseSource(source string) RecorderOption {
+	return func(c *recorderConfig) {
+		c.pulseSource = source
+		c.device = "pulse"
+	}
+}
+
+// WithPreRoll keeps the last d of audio while listening (see Listen), and
+// starts each recording with it, so words spoken just before the recording
+// is triggered aren't clipped.
+func WithPreRoll(d time.Duration) RecorderOption {
+	return func(c *recorderConfig) { c.preRoll = d }
+}
+
+// inputStream is a mono input stream of an audio backend. Read blocks until
+// the buffer it was opened with is full.
+type inputStream interface {
+	Start() error
+	Read() error
+	Stop() error
+	// Close releases the stream and the backend.
+	Close() error
+}
+
+// NewRecorder initializes the audio backend and opens the default input
+// stream, or the device selected by the options. Call Close when finished
+// to release the backend resources.
+func NewRecorder(sampleRate, chunkSize int, opts ...RecorderOption) (*Recorder, error) {
+	var cfg recorderConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.pulseSource != "" {
+		// Read by the ALSA pulse plugin when the stream is opened
+		os.Setenv("PULSE_SOURCE", cfg.pulseSource)
 	}
 
 	buf := make([]float32, chunkSize)
-	stream, err := portaudio.OpenDefaultStream(1, 0, float64(sampleRate), chunkSize, buf)
+	stream, err := openInput(cfg.device, sampleRate, buf)
 	if err != nil {
-		portaudio.Terminate()
-		return nil, fmt.Errorf("open mic: %w", err)
+		return nil, err
 	}
 
 	return &Recorder{
-		sampleRate: sampleRate,
-		chunkSize:  chunkSize,
-		stream:     stream,
-		buf:        buf,
-		done:       make(chan struct{}),
-		stopped:    make(chan struct{}),
+		sampleRate:  sampleRate,
+		chunkSize:   chunkSize,
+		device:      cfg.device,
+		stream:      stream,
+		buf:         buf,
+		onEvent:     cfg.onEvent,
+		onSamples:   cfg.onSamples,
+		calibration: cfg.calibration,
+		gateGain:    1,
+		preRoll:     int(cfg.preRoll.Seconds() * float64(sampleRate)),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
 	}, nil
 }
 
-// Start begins capturing audio in a background goroutine.
+// DefaultInputSource returns the PulseAudio/PipeWire default input source
+// (usually the microphone). It uses pactl.
+func DefaultInputSource() (string, error) {
+	out, err := exec.Command("pactl", "get-default-source").Output()
+	if err != nil {
+		return "", fmt.Errorf("pactl get-default-source: %w", err)
+	}
+	source := strings.TrimSpace(string(out))
+	if source == "" {
+		return "", fmt.Errorf("no default input")
+	}
+	return source, nil
+}
+
+// DefaultMonitorSource returns the PulseAudio/PipeWire monitor source of the
+// default output, i.e. whatever is playing on the machine. It uses pactl.
+func DefaultMonitorSource() (string, error) {
+	out, err := exec.Command("pactl", "get-default-sink").Output()
+	if err != nil {
+		return "", fmt.Errorf("pactl get-default-sink: %w", err)
+	}
+	sink := strings.TrimSpace(string(out))
+	if sink == "" {
+		return "", fmt.Errorf("no default output")
+	}
+	return sink + ".monitor", nil
+}
+
+// Start begins capturing audio in a background goroutine. When the
+// recorder is listening, the recording picks up the pre-roll audio.
 func (r *Recorder) Start() error {
-	if err := r.stream.Start(); err != nil {
+	r.mu.Lock()
+	if r.listening {
+		r.recorded = fadeIn(r.ring, r.sampleRate/100)
+		r.ring = nil
+		r.recording = true
+		r.mu.Unlock()
+		return nil
+	}
+	r.mu.Unlock()
+
+	stream, err := r.input()
+	if err != nil {
+		return err
+	}
+	if err := stream.Start(); err != nil {
 		return fmt.Errorf("start mic: %w", err)
 	}
+	r.mu.Lock()
+	r.recording = true
+	r.mu.Unlock()
+	go r.capture()
+	return nil
+}
+
+// Listen opens the microphone without recording, keeping the last
+// WithPreRoll worth of audio for the next Start. Stop then returns to
+// listening instead of closing the stream. It does nothing without a
+// pre-roll.
+func (r *Recorder) Listen() error {
+	if r.preRoll == 0 {
+		return nil
+	}
+	stream, err := r.input()
+	if err != nil {
+		return err
+	}
+	if err := stream.Start(); err != nil {
+		return fmt.Errorf("start mic: %w", err)
+	}
+	r.mu.Lock()
+	r.listening = true
+	r.mu.Unlock()
 	go r.capture()
 	return nil
 }
 
 func (r *Recorder) capture() {
 	defer close(r.stopped)
+	done := r.done
+	go r.watchDefault(done)
 	for {
-		select {
-		case <-r.done:
+		chunk, ok := r.read(done)
+		if !ok {
 			return
-		default:
 		}
-
-		if err := r.stream.Read(); err != nil {
-			return
-		}
-		chunk := make([]float32, r.chunkSize)
-		copy(chunk, r.buf)
 		r.mu.Lock()
-		r.recorded = append(r.recorded, chunk...)
+		if r.recording {
+			r.recorded = append(r.recorded, chunk...)
+			r.level = peakLevel(chunk)
+			if r.onSamples != nil {
+				r.onSamples(chunk)
+			}
+		} else {
+			r.ring = append(r.ring, chunk...)
+			if over := len(r.ring) - r.preRoll; over > 0 {
+				r.ring = append(r.ring[:0], r.ring[over:]...)
+			}
+		}
 		r.mu.Unlock()
 	}
 }
 
+// fadeIn ramps up the first n samples, so audio cut from the middle of a
+// waveform doesn't start with a click.
+func fadeIn(samples []float32, n int) []float32 {
+	n = min(n, len(samples))
+	for i := range n {
+		samples[i] *= float32(i) / float32(n)
+	}
+	return samples
+}
+
+// Level returns the peak amplitude (0–1) of the most recently captured
+// chunk, for level meters.
+func (r *Recorder) Level() float32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.level
+}
+
+func peakLevel(chunk []float32) float32 {
+	var peak float32
+	for _, s := range chunk {
+		if s < 0 {
+			s = -s
+		}
+		peak = max(peak, s)
+	}
+	return peak
+}
+
 // Stop ends the recording and returns the captured samples.
 // The recorder can be restarted by calling Start again.
 func (r *Recorder) Stop() []float32 {
-	close(r.done)
-	<-r.stopped
-	r.stream.Stop()
+	r.mu.Lock()
+	listening := r.listening
+	r.mu.Unlock()
+	if !listening {
+		close(r.done)
+		<-r.stopped
+		r.stopStream()
+	}
 
 	r.mu.Lock()
 	samples := r.recorded
 	r.recorded = nil
+	r.recording = false
+	r.level = 0
 	r.mu.Unlock()
+	if listening {
+		return samples
+	}
 
 	// Reset channels for reuse
 	r.done = make(chan struct{})
@@ -100,51 +296,72 @@ func (r *Recorder) Stop() []float32 {
 	return samples
 }
 
-// Close releases the PortAudio stream and terminates PortAudio.
+// Close releases the input stream and the audio backend.
 func (r *Recorder) Close() error {
-	r.stream.Close()
-	return portaudio.Terminate()
+	r.mu.Lock()
+	listening := r.listening
+	r.listening = false
+	r.mu.Unlock()
+	if listening {
+		close(r.done)
+		<-r.stopped
+		r.stopStream()
+	}
+	if r.stream == nil {
+		return nil
+	}
+	return r.stream.Close()
+}
+
+// stopStream stops the stream, unless it was lost.
+func (r *Recorder) stopStream() {
+	if r.stream != nil {
+		r.stream.Stop()
+	}
 }
 
-// StartContinuous begins recording and delivers audio segments of the given
-// duration to the returned channel. Recording continues until StopContinuous
-// is called. The stream stays open between segments (no gaps).
-func (r *Recorder) StartContinuous(segmentDuration time.Duration) (<-chan Segment, error) {
-	if err := r.stream.Start(); err != nil {
+// StartContinuous begins recording and delivers audio segments, cut at
+// pauses as set by cfg, to the returned channel. Recording continues until
+// StopContinuous is called. The stream stays open between segments (no
+// gaps).
+func (r *Recorder) StartContinuous(cfg SegmentConfig) (<-chan Segment, error) {
+	stream, err := r.input()
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Start(); err != nil {
 		return nil, fmt.Errorf("start mic: %w", err)
 	}
 
 	r.done = make(chan struct{})
 	r.stopped = make(chan struct{})
 	ch := make(chan Segment, 2)
-	samplesPerSegment := int(segmentDuration.Seconds()) * r.sampleRate
+	seg := newSegmenter(r.sampleRate, cfg)
 
+	done := r.done
+	go r.watchDefault(done)
 	go func() {
 		defer close(r.stopped)
 		defer close(ch)
 
-		var segment []float32
 		for {
-			select {
-			case <-r.done:
+			chunk, ok := r.read(done)
+			if !ok {
 				// Deliver any remaining audio
-				if len(segment) > 0 {
-					ch <- Segment{Samples: segment}
+				for _, s := range seg.flush() {
+					ch <- s
 				}
 				return
-			default:
 			}
-
-			if err := r.stream.Read(); err != nil {
-				return
+			r.mu.Lock()
+			r.level = peakLevel(chunk)
+			r.mu.Unlock()
+			if r.onSamples != nil {
+				r.onSamples(chunk)
 			}
-			chunk := make([]float32, r.chunkSize)
-			copy(chunk, r.buf)
-			segment = append(segment, chunk...)
 
-			if len(segment) >= samplesPerSegment {
-				ch <- Segment{Samples: segment}
-				segment = nil
+			for _, s := range seg.write(chunk) {
+				ch <- s
 			}
 		}
 	}()
@@ -156,5 +373,5 @@ func (r *Recorder) StartContinuous(segmentDuration time.Duration) (<-chan Segmen
 func (r *Recorder) StopContinuous() {
 	close(r.done)
 	<-r.stopped
-	r.stream.Stop()
+	r.stopStream()
 }
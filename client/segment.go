@@ -0,0 +1,128 @@
+package client
+
+import (
+	"time"
+
+	"github.com/rubiojr/lunartlk/internal/vad"
+)
+
+// SegmentConfig tunes where StartContinuous cuts the recording. Speech is
+// found with the voice activity detector used for uploads, whose threshold
+// rises above the noise floor, and each utterance is cut at the pause that
+// ends it, with some padding so word edges aren't clipped.
+type SegmentConfig struct {
+	// MinSpeech drops speech shorter than this, like a cough or a click
+	// (250ms if zero).
+	MinSpeech time.Duration
+	// MaxSegment cuts longer speech without waiting for a pause (30s if
+	// zero).
+	MaxSegment time.Duration
+	// MinSilence is the pause that ends an utterance (700ms if zero).
+	MinSilence time.Duration
+	// Padding is kept around each utterance (200ms if zero).
+	Padding time.Duration
+	// Threshold is the minimum RMS level counted as speech (0.01 if zero).
+	Threshold float64
+	// Fixed, when set, cuts the recording into segments of this length
+	// instead, wherever they fall.
+	Fixed time.Duration
+}
+
+// DefaultSegmentConfig returns settings that cut dictation and meetings
+// into utterances.
+func DefaultSegmentConfig() SegmentConfig {
+	cfg := vad.DefaultConfig()
+	return SegmentConfig{
+		MinSpeech:  cfg.MinSpeech,
+		MaxSegment: cfg.MaxSegment,
+		MinSilence: cfg.MinSilence,
+		Padding:    cfg.Padding,
+		Threshold:  cfg.Threshold,
+	}
+}
+
+// segmenter cuts a stream of audio chunks into Segments: the utterances
+// vad.Segmenter finds, and the silence between them.
+type segmenter struct {
+	sampleRate int
+	vad        *vad.Segmenter
+	cfg        vad.Config
+	fixed      int
+
+	buf []float32
+	// offset is the stream position of buf[0], in samples.
+	offset int
+}
+
+func newSegmenter(sampleRate int, cfg SegmentConfig) *segmenter {
+	vc := vad.DefaultConfig()
+	set := func(dst *time.Duration, d time.Duration) {
+		if d != 0 {
+			*dst = d
+		}
+	}
+	set(&vc.MinSpeech, cfg.MinSpeech)
+	set(&vc.MaxSegment, cfg.MaxSegment)
+	set(&vc.MinSilence, cfg.MinSilence)
+	set(&vc.Padding, cfg.Padding)
+	if cfg.Threshold != 0 {
+		vc.Threshold = cfg.Threshold
+	}
+	return &segmenter{
+		sampleRate: sampleRate,
+		vad:        vad.NewSegmenter(sampleRate, vc),
+		cfg:        vc,
+		fixed:      int(cfg.Fixed * time.Duration(sampleRate) / time.Second),
+	}
+}
+
+// write adds a chunk of audio and returns the segments it completes.
+func (s *segmenter) write(chunk []float32) []Segment {
+	s.buf = append(s.buf, chunk...)
+	if s.fixed > 0 {
+		if len(s.buf) < s.fixed {
+			return nil
+		}
+		return []Segment{s.cut(len(s.buf), vad.HasSpeech(s.buf, s.sampleRate, s.cfg))}
+	}
+	return s.deliver(s.vad.Write(chunk))
+}
+
+// flush returns the audio left, if any.
+func (s *segmenter) flush() []Segment {
+	if s.fixed > 0 {
+		if len(s.buf) == 0 {
+			return nil
+		}
+		return []Segment{s.cut(len(s.buf), vad.HasSpeech(s.buf, s.sampleRate, s.cfg))}
+	}
+	return s.deliver(s.vad.Flush())
+}
+
+// deliver returns the utterances found, each after the silence before it,
+// and then the silence the detector has dropped.
+func (s *segmenter) deliver(chunks []vad.Chunk) []Segment {
+	var segs []Segment
+	for _, c := range chunks {
+		if c.Offset > s.offset {
+			segs = append(segs, s.cut(c.Offset-s.offset, false))
+		}
+		segs = append(segs, s.cut(len(c.Samples), true))
+	}
+	if done := s.vad.Offset(); done > s.offset {
+		segs = append(segs, s.cut(done-s.offset, false))
+	}
+	return segs
+}
+
+// cut returns the first n samples as a segment and keeps the rest.
+func (s *segmenter) cut(n int, speech bool) Segment {
+	seg := Segment{
+		Samples: s.buf[:n:n],
+		Start:   time.Duration(s.offset) * time.Second / time.Duration(s.sampleRate),
+		Speech:  speech,
+	}
+	s.buf = append([]float32(nil), s.buf[n:]...)
+	s.offset += n
+	return seg
+}
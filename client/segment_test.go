@@ -0,0 +1,89 @@
+package client
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSegmenter(t *testing.T) {
+	const rate = 16000
+	tone := func(d time.Duration) []float32 {
+		s := make([]float32, int(d*rate/time.Second))
+		for i := range s {
+			if i%2 == 0 {
+				s[i] = 0.3
+			} else {
+				s[i] = -0.3
+			}
+		}
+		return s
+	}
+	silence := func(d time.Duration) []float32 { return make([]float32, int(d*rate/time.Second)) }
+
+	tests := []struct {
+		name   string
+		cfg    SegmentConfig
+		audio  [][]float32
+		speech []time.Duration
+	}{
+		{
+			name:   "utterances cut at pauses",
+			cfg:    DefaultSegmentConfig(),
+			audio:  [][]float32{silence(2 * time.Second), tone(time.Second), silence(2 * time.Second), tone(time.Second), silence(time.Second)},
+			speech: []time.Duration{1780 * time.Millisecond, 4800 * time.Millisecond},
+		},
+		{
+			name:  "clicks dropped",
+			cfg:   DefaultSegmentConfig(),
+			audio: [][]float32{silence(time.Second), tone(90 * time.Millisecond), silence(2 * time.Second)},
+		},
+		{
+			name:   "fixed length",
+			cfg:    SegmentConfig{Fixed: time.Second},
+			audio:  [][]float32{silence(1500 * time.Millisecond), tone(time.Second), silence(700 * time.Millisecond)},
+			speech: []time.Duration{time.Second, 2 * time.Second},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seg := newSegmenter(rate, tt.cfg)
+			var segs []Segment
+			var total int
+			for _, a := range tt.audio {
+				total += len(a)
+				// Write in 100ms chunks
+				for len(a) > 0 {
+					n := min(len(a), rate/10)
+					segs = append(segs, seg.write(a[:n])...)
+					a = a[n:]
+				}
+			}
+			segs = append(segs, seg.flush()...)
+
+			var speech []time.Duration
+			var at time.Duration
+			var got int
+			for _, s := range segs {
+				if s.Start != at {
+					t.Errorf("segment at %v, want %v: there's a gap or overlap", s.Start, at)
+				}
+				at += time.Duration(len(s.Samples)) * time.Second / rate
+				got += len(s.Samples)
+				if s.Speech {
+					speech = append(speech, s.Start)
+				}
+			}
+			if got != total {
+				t.Errorf("got %d samples, want %d", got, total)
+			}
+			if len(speech) != len(tt.speech) {
+				t.Fatalf("speech at %v, want %v", speech, tt.speech)
+			}
+			for i := range speech {
+				if speech[i] != tt.speech[i] {
+					t.Errorf("speech at %v, want %v", speech, tt.speech)
+				}
+			}
+		})
+	}
+}
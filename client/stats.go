@@ -0,0 +1,58 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Usage holds request counts and accumulated audio and processing time.
+type Usage struct {
+	Requests     int64            `json:"requests"`
+	AudioSeconds float64          `json:"audio_seconds"`
+	ProcessingMs int64            `json:"processing_ms"`
+	Engines      map[string]Usage `json:"engines,omitempty"`
+}
+
+// DayUsage is the usage of a single day.
+type DayUsage struct {
+	Date string `json:"date"`
+	Usage
+}
+
+// Stats is the server's usage report for the authenticated user.
+type Stats struct {
+	User  string     `json:"user"`
+	Since string     `json:"since"`
+	Total Usage      `json:"total"`
+	Days  []DayUsage `json:"days"`
+}
+
+// Stats returns the usage of the last days days, including today.
+func (c *Client) Stats(days int) (*Stats, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/stats?days=%d", c.serverURL, days), nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, string(b))
+	}
+
+	var stats Stats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &stats, nil
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/rubiojr/lunartlk/api"
+)
+
+// Partial is the api package type, for callers of TranscribeWithPartials.
+type Partial = api.Partial
+
+// TranscribeWithPartials streams WAV audio to the server while it's being
+// read, e.g. from a recording still going on, and calls fn with the
+// transcript of each chunk of speech as soon as the server has it. The
+// chunks are cut at pauses and come in order; appending their Text gives
+// the live transcript. It returns the final transcript, with the server's
+// post-processing applied, once audio ends.
+//
+// The WAV header may give an unknown length (0 or 0xFFFFFFFF). fn runs on
+// the goroutine that called TranscribeWithPartials. It fails with
+// WithEncryption, the server can't decode encrypted audio as it arrives.
+func (c *Client) TranscribeWithPartials(ctx context.Context, audio io.Reader, fn func(Partial)) (*TranscriptResponse, error) {
+	if c.encryptionKey != nil {
+		return nil, fmt.Errorf("streamed audio can't be encrypted")
+	}
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	go func() {
+		part, err := writer.CreateFormFile("audio", "stream.wav")
+		if err == nil {
+			_, err = io.Copy(part, audio)
+		}
+		if err == nil {
+			err = writer.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	url := c.transcribeURL()
+	if strings.Contains(url, "?") {
+		url += "&partials=true"
+	} else {
+		url += "?partials=true"
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", url, pr)
+	if err != nil {
+		pr.Close()
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		pr.Close()
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	defer pr.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server returned %d: %s", resp.StatusCode, string(b))
+	}
+
+	// Each line is a partial, until the final transcript. Errors after
+	// the first partial come as a stream error in its place.
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var p struct {
+			Partial
+			api.StreamError
+		}
+		if err := json.Unmarshal(line, &p); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+		if p.Message != "" {
+			return nil, fmt.Errorf("server returned %d: %s", p.Status, p.Message)
+		}
+		if p.Partial.Partial {
+			fn(p.Partial)
+			continue
+		}
+		var result TranscriptResponse
+		if err := json.Unmarshal(line, &result); err != nil {
+			return nil, fmt.Errorf("decode response: %w", err)
+		}
+		return &result, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	return nil, fmt.Errorf("server closed the stream without a transcript")
+}
@@ -0,0 +1,70 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTranscribeWithPartials(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "transcript",
+			body: `{"partial":true,"text":"hello","lines":[],"start_time":0,"duration":1.5}` + "\n" +
+				`{"text":"Hello there.","lang":"en"}` + "\n",
+			want: "Hello there.",
+		},
+		{
+			name: "error after a partial",
+			body: `{"partial":true,"text":"hello","lines":[],"start_time":0,"duration":1.5}` + "\n" +
+				`{"stream_error":"upload exceeds the 1MiB limit","status":413}` + "\n",
+			wantErr: "server returned 413: upload exceeds the 1MiB limit",
+		},
+		{
+			name:    "no transcript",
+			body:    `{"partial":true,"text":"hello","lines":[],"start_time":0,"duration":1.5}` + "\n",
+			wantErr: "without a transcript",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Query().Get("partials") != "true" {
+					t.Errorf("query %q without partials=true", r.URL.RawQuery)
+				}
+				io.Copy(io.Discard, r.Body)
+				w.Header().Set("Content-Type", "application/x-ndjson")
+				io.WriteString(w, tt.body)
+			}))
+			defer ts.Close()
+
+			var partials []string
+			resp, err := New(ts.URL).TranscribeWithPartials(context.Background(), strings.NewReader("RIFF"), func(p Partial) {
+				partials = append(partials, p.Text)
+			})
+			if len(partials) != 1 || partials[0] != "hello" {
+				t.Errorf("partials %q, want [hello]", partials)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Text != tt.want {
+				t.Errorf("text %q, want %q", resp.Text, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,31 @@
+package client
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// WithRootCAs trusts the certificates in pool for HTTPS servers, e.g. one
+// serving a self-signed certificate (lunartlk-server -tls-self-signed).
+// It replaces the transport of the HTTP client.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(c *Client) { c.rootCAs = pool }
+}
+
+// LoadCA returns the system's trusted certificates with those in a PEM
+// file added, for WithRootCAs.
+func LoadCA(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no PEM certificates", path)
+	}
+	return pool, nil
+}
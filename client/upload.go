@@ -0,0 +1,254 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultChunkSize is the size of the chunks resumable uploads are
+	// sent in.
+	DefaultChunkSize = 256 << 10
+	// uploadRetries is how many times in a row an upload chunk, or the
+	// transcription of the upload, is retried before giving up.
+	uploadRetries = 8
+)
+
+// WithResumableUpload makes Transcribe send audio in chunks of chunkSize
+// bytes (DefaultChunkSize if 0), resuming where it stopped when the
+// connection drops instead of sending it all again. Meant for long
+// recordings over unreliable networks.
+func WithResumableUpload(chunkSize int) Option {
+	return func(c *Client) {
+		if chunkSize <= 0 {
+			chunkSize = DefaultChunkSize
+		}
+		c.chunkSize = chunkSize
+	}
+}
+
+// permanentError is a server answer retrying won't change.
+type permanentError struct{ error }
+
+// TranscribeResumable uploads encoded audio in chunks, retrying the ones
+// that fail from the last byte the server got, and returns its transcript.
+// The upload is deleted from the server once transcribed.
+func (c *Client) TranscribeResumable(ctx context.Context, audio []byte, filename string) (*TranscriptResponse, error) {
+	audio = c.wireFormat(audio, filename)
+	audio, filename, err := c.seal(audio, filename)
+	if err != nil {
+		return nil, err
+	}
+	chunkSize := c.chunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	var id string
+	err = retry(ctx, func() (err error) {
+		id, err = c.createUpload(ctx, len(audio), filename)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer c.deleteUpload(id)
+
+	offset, failures := 0, 0
+	for offset < len(audio) {
+		chunk := audio[offset:min(offset+chunkSize, len(audio))]
+		n, err := c.sendChunk(ctx, id, offset, chunk)
+		if err == nil {
+			offset, failures = n, 0
+			continue
+		}
+		var pe *permanentError
+		if errors.As(err, &pe) || failures == uploadRetries {
+			return nil, err
+		}
+		failures++
+		if err := sleepCtx(ctx, backoff(failures)); err != nil {
+			return nil, err
+		}
+		// Part of the chunk may have made it
+		if n, err := c.uploadOffset(ctx, id); err == nil {
+			offset = n
+		}
+	}
+
+	var resp *TranscriptResponse
+	err = retry(ctx, func() (err error) {
+		resp, err = c.transcribeUpload(ctx, id)
+		return err
+	})
+	return resp, err
+}
+
+// retry calls fn until it succeeds, fails with a permanentError, or has
+// been retried uploadRetries times.
+func retry(ctx context.Context, fn func() error) error {
+	for failures := 0; ; failures++ {
+		err := fn()
+		var pe *permanentError
+		if err == nil || errors.As(err, &pe) || failures == uploadRetries {
+			return err
+		}
+		if err := sleepCtx(ctx, backoff(failures+1)); err != nil {
+			return err
+		}
+	}
+}
+
+// backoff is how long to wait before the nth retry: 1s, 2s, 4s... up to
+// 30s.
+func backoff(n int) time.Duration {
+	return min(time.Second<<(n-1), 30*time.Second)
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Client) uploadRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.serverURL+path, body)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// statusError returns the error for an unexpected response, permanent
+// unless the server or a proxy in front of it is temporarily unavailable.
+func statusError(resp *http.Response) error {
+	b, _ := io.ReadAll(resp.Body)
+	err := fmt.Errorf("server returned %d: %s", resp.StatusCode, strings.TrimSpace(string(b)))
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return err
+	}
+	return &permanentError{err}
+}
+
+func (c *Client) createUpload(ctx context.Context, length int, filename string) (string, error) {
+	req, err := c.uploadRequest(ctx, "POST", "/uploads?name="+url.QueryEscape(filename), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Upload-Length", strconv.Itoa(length))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("create upload: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return "", statusError(resp)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	return created.ID, nil
+}
+
+// sendChunk sends a chunk at offset, returning the server's new offset.
+// When another offset was expected, e.g. because a chunk the client
+// thought lost made it, that one is returned to resume from.
+func (c *Client) sendChunk(ctx context.Context, id string, offset int, chunk []byte) (int, error) {
+	req, err := c.uploadRequest(ctx, "PATCH", "/uploads/"+id, bytes.NewReader(chunk))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("upload chunk: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusNoContent, http.StatusConflict:
+		n, err := strconv.Atoi(resp.Header.Get("Upload-Offset"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid Upload-Offset %q", resp.Header.Get("Upload-Offset"))
+		}
+		return n, nil
+	default:
+		return 0, statusError(resp)
+	}
+}
+
+func (c *Client) uploadOffset(ctx context.Context, id string) (int, error) {
+	req, err := c.uploadRequest(ctx, "HEAD", "/uploads/"+id, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("server returned %d", resp.StatusCode)
+	}
+	return strconv.Atoi(resp.Header.Get("Upload-Offset"))
+}
+
+func (c *Client) transcribeUpload(ctx context.Context, id string) (*TranscriptResponse, error) {
+	u := c.transcribeURL()
+	if strings.Contains(u, "?") {
+		u += "&upload=" + id
+	} else {
+		u += "?upload=" + id
+	}
+	req, err := c.uploadRequest(ctx, "POST", strings.TrimPrefix(u, c.serverURL), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	var result TranscriptResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &result, nil
+}
+
+// deleteUpload frees the server's copy of an upload. Failing is harmless,
+// uploads expire.
+func (c *Client) deleteUpload(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := c.uploadRequest(ctx, "DELETE", "/uploads/"+id, nil)
+	if err != nil {
+		return
+	}
+	if resp, err := c.http.Do(req); err == nil {
+		resp.Body.Close()
+	}
+}
@@ -0,0 +1,46 @@
+package client
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/rubiojr/lunartlk/api"
+)
+
+// WithVersionMismatch calls fn, once, when the server answers in another
+// version of the API than the client's, e.g. an older server missing
+// fields the client reads. Servers that don't say answer in version 1.
+func WithVersionMismatch(fn func(server int)) Option {
+	return func(c *Client) { c.onVersionMismatch = fn }
+}
+
+// versionTransport asks for the client's API version in every request and
+// checks the version the server answers in.
+type versionTransport struct {
+	next   http.RoundTripper
+	client *Client
+}
+
+func (t *versionTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set(api.VersionHeader, strconv.Itoa(api.Version))
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	t.client.checkVersion(resp.Header.Get(api.VersionHeader))
+	return resp, nil
+}
+
+func (c *Client) checkVersion(header string) {
+	v := 1
+	if header != "" {
+		var err error
+		if v, err = strconv.Atoi(header); err != nil {
+			return
+		}
+	}
+	if v != api.Version && c.onVersionMismatch != nil && c.versionWarned.CompareAndSwap(false, true) {
+		c.onVersionMismatch(v)
+	}
+}
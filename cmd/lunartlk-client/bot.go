@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rubiojr/lunartlk/client"
+	"github.com/rubiojr/lunartlk/internal/audio"
+	"github.com/rubiojr/lunartlk/internal/chatbot"
+	"github.com/rubiojr/lunartlk/internal/cli"
+	"github.com/rubiojr/lunartlk/translate"
+)
+
+// botCommand answers voice messages sent to a Telegram or Matrix bot with
+// their transcript.
+func botCommand() *cli.Command {
+	fs := flag.NewFlagSet("bot", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:9765", "transcription server URL")
+	token := fs.String("token", "", "Bearer token for server authentication")
+	lang := fs.String("lang", "", "language for transcription (en, es)")
+	engineFlag := fs.String("engine", "", "transcription engine (moonshine, parakeet)")
+	telegramToken := fs.String("telegram-token", os.Getenv("TELEGRAM_BOT_TOKEN"), "Telegram bot token (default: $TELEGRAM_BOT_TOKEN)")
+	matrixServer := fs.String("matrix-homeserver", "", "Matrix homeserver URL, e.g. https://matrix.example.org")
+	matrixToken := fs.String("matrix-token", os.Getenv("MATRIX_ACCESS_TOKEN"), "Matrix access token (default: $MATRIX_ACCESS_TOKEN)")
+	allow := fs.String("allow", "", "comma-separated senders allowed to use the bot: Telegram user IDs or usernames, Matrix user IDs (required)")
+	translateTo := fs.String("translate", "", "also reply with a translation to this language (e.g. English)")
+	ollamaModel := fs.String("ollama-model", "lfm2", "Ollama model for translation")
+	ollamaHost := fs.String("ollama-host", "", "Ollama server URL (default: $OLLAMA_HOST or http://localhost:11434)")
+
+	return &cli.Command{
+		Name:     "bot",
+		Short:    "transcribe voice messages sent to a Telegram or Matrix bot",
+		Flags:    fs,
+		Complete: serverCompletions(server),
+		Run: func([]string) {
+			var bots []chatbot.Bot
+			if *telegramToken != "" {
+				bots = append(bots, chatbot.NewTelegram(*telegramToken))
+			}
+			if *matrixServer != "" {
+				if *matrixToken == "" {
+					log.Fatal("-matrix-homeserver needs -matrix-token")
+				}
+				bots = append(bots, chatbot.NewMatrix(*matrixServer, *matrixToken))
+			}
+			if len(bots) == 0 {
+				log.Fatal("Set -telegram-token or -matrix-homeserver")
+			}
+			// Anyone can message a bot, and every message costs server time
+			if *allow == "" {
+				log.Fatal("Set -allow to the senders who may use the bot")
+			}
+
+			b := &voiceBot{
+				tc:          newClient(*server, *token, *lang, *engineFlag),
+				allowed:     make(map[string]bool),
+				translateTo: *translateTo,
+			}
+			for _, s := range strings.Split(*allow, ",") {
+				b.allowed[strings.TrimPrefix(strings.TrimSpace(s), "@")] = true
+			}
+			if *translateTo != "" {
+				trOpts := []translate.OllamaOption{translate.WithModel(*ollamaModel)}
+				if *ollamaHost != "" {
+					trOpts = append(trOpts, translate.WithHost(*ollamaHost))
+				}
+				b.translator = translate.NewOllama(trOpts...)
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			fmt.Fprintln(os.Stderr, "🤖 Waiting for voice messages... press Ctrl+C to stop")
+
+			var wg sync.WaitGroup
+			for _, bot := range bots {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if err := bot.Run(ctx, b.handle); err != nil {
+						log.Printf("Bot: %v", err)
+						stop()
+					}
+				}()
+			}
+			wg.Wait()
+		},
+	}
+}
+
+type voiceBot struct {
+	tc          *client.Client
+	allowed     map[string]bool
+	translator  translate.Translator
+	translateTo string
+}
+
+// handle transcribes a voice message and returns the reply.
+func (b *voiceBot) handle(ctx context.Context, m *chatbot.Message) string {
+	// Entries are stored without the leading @ of usernames and Matrix IDs
+	sender := strings.TrimPrefix(m.Sender, "@")
+	if !b.allowed[sender] && (m.SenderName == "" || !b.allowed[m.SenderName]) {
+		log.Printf("Ignoring voice message from %s %s", m.Sender, m.SenderName)
+		return ""
+	}
+
+	// Telegram and Element record voice messages as Ogg Opus
+	frames, err := audio.ReadOggOpus(m.Audio)
+	if err != nil {
+		return fmt.Sprintf("⚠ Unsupported audio (%s), send an Ogg Opus voice message", m.MimeType)
+	}
+	start := time.Now()
+	resp, err := b.tc.Transcribe(audio.WireFrames(frames), "voice.opus")
+	if err != nil {
+		log.Printf("Transcription failed for %s: %v", m.Sender, err)
+		return "⚠ Transcription failed: " + err.Error()
+	}
+	log.Printf("Transcribed %.1fs voice message from %s in %s", resp.AudioDuration, m.Sender, time.Since(start).Truncate(time.Millisecond))
+	if resp.Text == "" {
+		return "(no speech detected)"
+	}
+	if b.translator == nil {
+		return resp.Text
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, 60*time.Second)
+	defer cancel()
+	translated, err := b.translator.Translate(tctx, resp.Text, b.translateTo)
+	if err != nil {
+		log.Printf("Translation failed: %v", err)
+		return resp.Text
+	}
+	return resp.Text + "\n\n🌐 " + translated
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/rubiojr/lunartlk/client"
+	"github.com/rubiojr/lunartlk/internal/cli"
+)
+
+// Calibration targets: speech is brought to about -20 dBFS RMS, without
+// amplifying a device by more than maxCalibrationGain.
+const (
+	targetSpeechRMS    = 0.1
+	minCalibrationGain = 0.25
+	maxCalibrationGain = 16
+)
+
+// deviceCalibration is the calibration of one device, with the levels it
+// was computed from.
+type deviceCalibration struct {
+	client.Calibration
+	NoiseFloor  float64   `json:"noise_floor"`
+	SpeechLevel float64   `json:"speech_level"`
+	Date        time.Time `json:"date"`
+}
+
+func calibrateCommand() *cli.Command {
+	fs := flag.NewFlagSet("calibrate", flag.ExitOnError)
+	source := fs.String("source", "", "audio source: empty for the default mic, or a PulseAudio/PipeWire source name")
+	quiet := fs.Duration("quiet", 3*time.Second, "how long to measure the background noise for")
+	speech := fs.Duration("speech", 6*time.Second, "how long to measure speech for")
+	noGate := fs.Bool("no-gate", false, "only set the gain, without turning down background noise")
+	reset := fs.Bool("reset", false, "forget the device's calibration")
+	show := fs.Bool("show", false, "print the stored calibrations")
+
+	return &cli.Command{
+		Name:  "calibrate",
+		Short: "measure a microphone's noise and speech levels and adjust its recordings",
+		Long: "Records a few seconds of silence and of speech from the microphone, and stores the gain " +
+			"and noise gate that bring its speech to a consistent level in ~/.config/lunartlk/calibration.json. " +
+			"Recordings from that device use them from then on.",
+		Flags: fs,
+		Run: func([]string) {
+			path := calibrationFile()
+			cals, err := loadCalibrations(path)
+			if err != nil {
+				log.Fatalf("Calibration: %v", err)
+			}
+			if *show {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				enc.Encode(cals)
+				return
+			}
+			device := calibrationDevice(*source)
+			if *reset {
+				delete(cals, device)
+				if err := saveCalibrations(path, cals); err != nil {
+					log.Fatalf("Calibration: %v", err)
+				}
+				fmt.Fprintf(os.Stderr, "🗑  Forgot the calibration of %s\n", device)
+				return
+			}
+
+			var recOpts []client.RecorderOption
+			if *source != "" {
+				recOpts = append(recOpts, client.WithPulseSource(*source))
+			}
+			rec, err := client.NewRecorder(sampleRate, 1024, recOpts...)
+			if err != nil {
+				log.Fatalf("Recorder init failed: %v", err)
+			}
+			defer rec.Close()
+
+			fmt.Fprintf(os.Stderr, "🤫 Calibrating %s. Stay quiet for %s...\n", device, *quiet)
+			noise, err := recordFor(rec, *quiet)
+			if err != nil {
+				log.Fatalf("Recording failed: %v", err)
+			}
+			fmt.Fprintf(os.Stderr, "🗣  Now talk as you usually do for %s, e.g. read this aloud:\n\n", *speech)
+			fmt.Fprintln(os.Stderr, "   \"The quick brown fox jumps over the lazy dog. I'm testing my microphone\n"+
+				"    so that my dictations are transcribed as well as they can be.\"")
+			fmt.Fprintln(os.Stderr)
+			talk, err := recordFor(rec, *speech)
+			if err != nil {
+				log.Fatalf("Recording failed: %v", err)
+			}
+
+			c, err := computeCalibration(noise, talk, !*noGate)
+			if err != nil {
+				log.Fatalf("Calibration: %v", err)
+			}
+			c.Date = time.Now()
+			cals[device] = c
+			if err := saveCalibrations(path, cals); err != nil {
+				log.Fatalf("Calibration: %v", err)
+			}
+
+			fmt.Fprintf(os.Stderr, "🔇 Noise floor: %.1f dBFS\n", dbfs(c.NoiseFloor))
+			fmt.Fprintf(os.Stderr, "🔊 Speech:      %.1f dBFS (%.0f dB above the noise)\n", dbfs(c.SpeechLevel), dbfs(c.SpeechLevel)-dbfs(c.NoiseFloor))
+			fmt.Fprintf(os.Stderr, "🎚  Gain:        %.2fx\n", c.Gain)
+			if c.Gate > 0 {
+				fmt.Fprintf(os.Stderr, "🚪 Noise gate:  %.1f dBFS\n", dbfs(c.Gate))
+			}
+			fmt.Fprintf(os.Stderr, "💾 Saved to %s\n", path)
+		},
+	}
+}
+
+// recordFor records from rec for d.
+func recordFor(rec *client.Recorder, d time.Duration) ([]float32, error) {
+	if err := rec.Start(); err != nil {
+		return nil, err
+	}
+	time.Sleep(d)
+	samples := rec.Stop()
+	if len(samples) == 0 {
+		return nil, errors.New("nothing recorded")
+	}
+	return samples, nil
+}
+
+// computeCalibration measures the background level of noise and the
+// speech level of talk, and picks the gain that brings the speech to
+// targetSpeechRMS without clipping, and a gate between noise and speech.
+func computeCalibration(noise, talk []float32, gate bool) (deviceCalibration, error) {
+	noiseLevels := frameLevels(noise)
+	talkLevels := frameLevels(talk)
+	if len(noiseLevels) == 0 || len(talkLevels) == 0 {
+		return deviceCalibration{}, errors.New("recording too short")
+	}
+	floor := percentile(noiseLevels, 0.5)
+	// The louder frames are the speech, the rest pauses between words
+	level := percentile(talkLevels, 0.9)
+	if level < floor*2 || level < 0.001 {
+		return deviceCalibration{}, errors.New("no speech heard; check the microphone and its input volume, and talk during the second recording")
+	}
+
+	var peak float64
+	for _, s := range talk {
+		peak = max(peak, math.Abs(float64(s)))
+	}
+	gain := min(max(targetSpeechRMS/level, minCalibrationGain), maxCalibrationGain)
+	if peak > 0 {
+		gain = min(gain, max(0.9/peak, minCalibrationGain))
+	}
+
+	c := deviceCalibration{
+		Calibration: client.Calibration{Gain: math.Round(gain*100) / 100},
+		NoiseFloor:  floor,
+		SpeechLevel: level,
+	}
+	// Too close to the speech, a gate would cut quiet words
+	if gate && level >= floor*4 {
+		c.Gate = floor * 2 * c.Gain
+	}
+	return c, nil
+}
+
+// frameLevels returns the RMS level of each 30 ms frame.
+func frameLevels(samples []float32) []float64 {
+	const frame = sampleRate * 30 / 1000
+	var levels []float64
+	for i := 0; i+frame <= len(samples); i += frame {
+		var sum float64
+		for _, s := range samples[i : i+frame] {
+			sum += float64(s) * float64(s)
+		}
+		levels = append(levels, math.Sqrt(sum/frame))
+	}
+	return levels
+}
+
+func percentile(values []float64, p float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	return sorted[min(int(float64(len(sorted))*p), len(sorted)-1)]
+}
+
+func dbfs(rms float64) float64 {
+	return 20 * math.Log10(max(rms, 1e-6))
+}
+
+// calibrationFile returns the calibration file in the user's config
+// directory, ~/.config/lunartlk/calibration.json.
+func calibrationFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "lunartlk", "calibration.json")
+}
+
+// calibrationDevice names the device recorded from with -source, by its
+// PulseAudio/PipeWire source name when possible, so a calibration follows
+// the microphone rather than whatever is the default.
+func calibrationDevice(source string) string {
+	if source != "" {
+		return source
+	}
+	if s, err := client.DefaultInputSource(); err == nil {
+		return s
+	}
+	return "default"
+}
+
+func loadCalibrations(path string) (map[string]deviceCalibration, error) {
+	cals := make(map[string]deviceCalibration)
+	if path == "" {
+		return cals, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cals, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cals); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return cals, nil
+}
+
+func saveCalibrations(path string, cals map[string]deviceCalibration) error {
+	if path == "" {
+		return errors.New("no config directory")
+	}
+	data, err := json.MarshalIndent(cals, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// calibrationOption returns the recorder option applying the stored
+// calibration of source's device, if it has one.
+func calibrationOption(source string) []client.RecorderOption {
+	cals, err := loadCalibrations(calibrationFile())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠  Calibration: %v\n", err)
+		return nil
+	}
+	if len(cals) == 0 {
+		return nil
+	}
+	c, ok := cals[calibrationDevice(source)]
+	if !ok {
+		return nil
+	}
+	return []client.RecorderOption{client.WithCalibration(c.Calibration)}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rubiojr/lunartlk/client"
+	"github.com/rubiojr/lunartlk/internal/cli"
+	"github.com/rubiojr/lunartlk/internal/vad"
+)
+
+// utterance is a transcribed speech segment from one side of a call.
+type utterance struct {
+	speaker string
+	start   time.Duration
+	text    string
+}
+
+// callCommand records the microphone and the system audio at the same time,
+// transcribes each speech segment and prints both sides interleaved.
+func callCommand() *cli.Command {
+	fs := flag.NewFlagSet("call", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:9765", "transcription server URL")
+	token := fs.String("token", "", "Bearer token for server authentication")
+	lang := fs.String("lang", "", "language for transcription (en, es)")
+	engineFlag := fs.String("engine", "", "transcription engine (moonshine, parakeet)")
+	mic := fs.String("mic", "", "microphone source (default: the PulseAudio/PipeWire default input)")
+	monitor := fs.String("monitor", "", "system audio source (default: monitor of the default output)")
+	me := fs.String("me", "me", "label for the microphone side")
+	them := fs.String("them", "them", "label for the system audio side")
+	output := fs.String("o", "", "also write the transcript to this file")
+
+	return &cli.Command{
+		Name:     "call",
+		Short:    "record the mic and system audio of a call with speaker labels",
+		Flags:    fs,
+		Complete: serverCompletions(server),
+		Run: func([]string) {
+			if *mic == "" {
+				src, err := client.DefaultInputSource()
+				if err != nil {
+					log.Fatalf("Microphone source: %v", err)
+				}
+				*mic = src
+			}
+			if *monitor == "" {
+				src, err := client.DefaultMonitorSource()
+				if err != nil {
+					log.Fatalf("Monitor source: %v", err)
+				}
+				*monitor = src
+			}
+
+			// Each recorder picks up PULSE_SOURCE when opened, so open them in turn
+			micRec, err := client.NewRecorder(sampleRate, 1024, client.WithPulseSource(*mic))
+			if err != nil {
+				log.Fatalf("Recorder init failed (%s): %v", *mic, err)
+			}
+			defer micRec.Close()
+			monRec, err := client.NewRecorder(sampleRate, 1024, client.WithPulseSource(*monitor))
+			if err != nil {
+				log.Fatalf("Recorder init failed (%s): %v", *monitor, err)
+			}
+			defer monRec.Close()
+
+			if err := micRec.Start(); err != nil {
+				log.Fatalf("Failed to start recording: %v", err)
+			}
+			if err := monRec.Start(); err != nil {
+				log.Fatalf("Failed to start recording: %v", err)
+			}
+			fmt.Fprintf(os.Stderr, "🎙  Recording %s (%s) and %s (%s)... press Ctrl+C to stop and transcribe\n", *me, *mic, *them, *monitor)
+
+			c := make(chan os.Signal, 1)
+			signal.Notify(c, os.Interrupt)
+			start := time.Now()
+			ticker := time.NewTicker(100 * time.Millisecond)
+		loop:
+			for {
+				select {
+				case <-c:
+					break loop
+				case <-ticker.C:
+					fmt.Fprintf(os.Stderr, "\r⏱  %s", time.Since(start).Truncate(100*time.Millisecond))
+				}
+			}
+			ticker.Stop()
+			signal.Stop(c)
+
+			channels := []struct {
+				speaker string
+				samples []float32
+			}{
+				{*me, micRec.Stop()},
+				{*them, monRec.Stop()},
+			}
+			fmt.Fprintf(os.Stderr, "\r⏹  Recorded %s\n", time.Since(start).Truncate(time.Millisecond))
+
+			tc := newClient(*server, *token, *lang, *engineFlag)
+
+			var utts []utterance
+			for _, ch := range channels {
+				segs := vad.Segments(ch.samples, sampleRate, vad.DefaultConfig())
+				fmt.Fprintf(os.Stderr, "📡 Transcribing %d segments from %s...\n", len(segs), ch.speaker)
+				for _, seg := range segs {
+					resp, err := transcribeRecording(tc, ch.samples[seg.Start:seg.End], false)
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "⚠  %s at %s: %v\n", ch.speaker, formatOffset(seg.StartTime(sampleRate)), err)
+						continue
+					}
+					if resp.Text == "" {
+						continue
+					}
+					utts = append(utts, utterance{ch.speaker, seg.StartTime(sampleRate), resp.Text})
+				}
+			}
+			sort.SliceStable(utts, func(i, j int) bool { return utts[i].start < utts[j].start })
+
+			var b strings.Builder
+			for _, u := range utts {
+				fmt.Fprintf(&b, "[%s] %s: %s\n", formatOffset(u.start), u.speaker, u.text)
+			}
+			if b.Len() == 0 {
+				fmt.Fprintln(os.Stderr, "No speech detected.")
+				return
+			}
+			fmt.Print(b.String())
+
+			if *output != "" {
+				if err := os.WriteFile(*output, []byte(b.String()), 0644); err != nil {
+					log.Fatalf("Write transcript: %v", err)
+				}
+				fmt.Fprintf(os.Stderr, "📝 Transcript saved to %s\n", *output)
+			}
+		},
+	}
+}
+
+// formatOffset formats an offset into a recording as mm:ss, or h:mm:ss.
+func formatOffset(d time.Duration) string {
+	s := int(d.Seconds())
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%02d:%02d", s/60, s%60)
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rubiojr/lunartlk/client"
+	"github.com/rubiojr/lunartlk/internal/cli"
+	"github.com/rubiojr/lunartlk/internal/obs"
+	"github.com/rubiojr/lunartlk/internal/vad"
+	"github.com/rubiojr/lunartlk/translate"
+)
+
+// captionSink shows the current caption text somewhere.
+type captionSink interface {
+	Show(text string) error
+}
+
+// fileSink writes captions to a text file, for an OBS Text source with
+// "Read from file" enabled. The file is replaced atomically so OBS never
+// reads it half-written.
+type fileSink struct{ path string }
+
+func (s fileSink) Show(text string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), ".captions-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(text); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
+
+// obsSink sets the text of an OBS text source through obs-websocket,
+// reconnecting after failures (e.g. OBS was restarted).
+type obsSink struct {
+	url, password, input string
+	conn                 *obs.Client
+}
+
+func (s *obsSink) Show(text string) error {
+	if s.conn == nil {
+		conn, err := obs.Dial(s.url, s.password)
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+	if err := s.conn.SetText(s.input, text); err != nil {
+		s.conn.Close()
+		s.conn = nil
+		return err
+	}
+	return nil
+}
+
+// captioner keeps the last finished lines and the partial transcript of
+// the speech in progress.
+type captioner struct {
+	tc       *client.Client
+	sinks    []captionSink
+	maxLines int
+	lines    []string
+	partial  string
+	// failed remembers sinks that reported an error, to log it only once
+	// until they recover.
+	failed map[captionSink]bool
+	// translator, when set, turns the captions into translateTo as they're
+	// transcribed. translateFailed, like failed, logs errors only once.
+	translator      translate.StreamTranslator
+	translateTo     string
+	translateFailed bool
+}
+
+// captionTranslateTimeout bounds the translation of a caption, so a stuck
+// Ollama doesn't hold the captions back.
+const captionTranslateTimeout = 30 * time.Second
+
+type captionJob struct {
+	samples []float32
+	final   bool
+}
+
+func captionsCommand() *cli.Command {
+	fs := flag.NewFlagSet("captions", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:9765", "transcription server URL")
+	token := fs.String("token", "", "Bearer token for server authentication")
+	lang := fs.String("lang", "", "language for transcription (en, es)")
+	engineFlag := fs.String("engine", "", "transcription engine (moonshine, parakeet)")
+	source := fs.String("source", "", "audio source: empty for the default mic, \"monitor\" for the system audio, or a PulseAudio/PipeWire source name")
+	output := fs.String("o", "", "write the captions to this text file")
+	obsURL := fs.String("obs", "", "obs-websocket URL to push captions to, e.g. ws://localhost:4455")
+	obsPassword := fs.String("obs-password", "", "obs-websocket password")
+	obsInput := fs.String("obs-source", "Captions", "name of the OBS text source to update")
+	maxLines := fs.Int("lines", 2, "number of caption lines to show")
+	translateTo := fs.String("translate", "", "show the captions translated to this language (e.g. English)")
+	ollamaModel := fs.String("ollama-model", "lfm2", "Ollama model for translation")
+	ollamaHost := fs.String("ollama-host", "", "Ollama server URL (default: $OLLAMA_HOST or http://localhost:11434)")
+
+	return &cli.Command{
+		Name:     "captions",
+		Short:    "live captions for OBS from the mic or system audio",
+		Flags:    fs,
+		Complete: serverCompletions(server),
+		Run: func([]string) {
+			c := &captioner{
+				tc:       newClient(*server, *token, *lang, *engineFlag),
+				maxLines: max(*maxLines, 1),
+				failed:   make(map[captionSink]bool),
+			}
+			if *output != "" {
+				c.sinks = append(c.sinks, fileSink{path: *output})
+			}
+			if *obsURL != "" {
+				c.sinks = append(c.sinks, &obsSink{url: *obsURL, password: *obsPassword, input: *obsInput})
+			}
+			if *translateTo != "" {
+				trOpts := []translate.OllamaOption{translate.WithModel(*ollamaModel)}
+				if *ollamaHost != "" {
+					trOpts = append(trOpts, translate.WithHost(*ollamaHost))
+				}
+				c.translator = translate.NewOllama(trOpts...)
+				c.translateTo = *translateTo
+			}
+
+			recOpts, err := sourceOptions(*source)
+			if err != nil {
+				log.Fatalf("Audio source: %v", err)
+			}
+			rec, err := client.NewRecorder(sampleRate, 1024, recOpts...)
+			if err != nil {
+				log.Fatalf("Recorder init failed: %v", err)
+			}
+			defer rec.Close()
+
+			if err := c.run(rec); err != nil {
+				log.Fatalf("Captions: %v", err)
+			}
+		},
+	}
+}
+
+// run records until Ctrl+C. Every second the speech in progress is
+// transcribed again as a partial caption; when the speaker pauses, the
+// whole utterance is transcribed once more and becomes a finished line.
+func (c *captioner) run(rec *client.Recorder) error {
+	// Fixed one-second segments, for a partial caption every second
+	segments, err := rec.StartContinuous(client.SegmentConfig{Fixed: time.Second})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "🎙  Captioning... press Ctrl+C to stop")
+
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt)
+		<-sig
+		signal.Stop(sig)
+		rec.StopContinuous()
+	}()
+
+	// A single worker keeps results in order. Partials are dropped while
+	// it's busy, so a slow server never falls behind the speaker.
+	jobs := make(chan captionJob, 16)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for j := range jobs {
+			c.transcribe(j)
+		}
+	}()
+
+	seg := vad.NewSegmenter(sampleRate, vad.DefaultConfig())
+	for s := range segments {
+		chunks := seg.Write(s.Samples)
+		for _, ch := range chunks {
+			jobs <- captionJob{samples: ch.Samples, final: true}
+		}
+		if len(chunks) == 0 && len(jobs) == 0 {
+			if pending := seg.Pending(); pending != nil {
+				jobs <- captionJob{samples: pending}
+			}
+		}
+	}
+	for _, ch := range seg.Flush() {
+		jobs <- captionJob{samples: ch.Samples, final: true}
+	}
+	close(jobs)
+	<-done
+
+	c.lines, c.partial = nil, ""
+	c.show()
+	fmt.Fprintln(os.Stderr, "⏹  Captions stopped")
+	return nil
+}
+
+func (c *captioner) transcribe(j captionJob) {
+	resp, err := transcribeRecording(c.tc, j.samples, false)
+	if err != nil {
+		if !errors.Is(err, errNoSpeech) {
+			fmt.Fprintf(os.Stderr, "⚠  %v\n", err)
+		}
+		return
+	}
+
+	text := c.translate(resp.Text)
+	if !j.final {
+		c.partial = text
+		c.show()
+		return
+	}
+	c.partial = ""
+	if text != "" {
+		fmt.Println(text)
+		c.lines = append(c.lines, text)
+		if len(c.lines) > c.maxLines {
+			c.lines = c.lines[len(c.lines)-c.maxLines:]
+		}
+	}
+	c.show()
+}
+
+// translate returns text in -translate's language, showing the
+// translation as the partial caption while it's generated. Without a
+// translator, or when translating fails, it returns text as is.
+func (c *captioner) translate(text string) string {
+	if c.translator == nil || text == "" {
+		return text
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), captionTranslateTimeout)
+	defer cancel()
+	translated, err := c.translator.TranslateStream(ctx, text, c.translateTo, func(sofar string) {
+		c.partial = sofar
+		c.show()
+	})
+	if err != nil {
+		if !c.translateFailed {
+			fmt.Fprintf(os.Stderr, "⚠  Translation: %v\n", err)
+			c.translateFailed = true
+		}
+		return text
+	}
+	c.translateFailed = false
+	if translated == "" {
+		return text
+	}
+	return translated
+}
+
+// show sends the latest lines to every sink. The partial caption takes the
+// place of the oldest line while the speaker talks.
+func (c *captioner) show() {
+	lines := c.lines
+	if c.partial != "" {
+		lines = append(lines[max(len(lines)-c.maxLines+1, 0):len(lines):len(lines)], c.partial)
+	}
+	text := strings.Join(lines, "\n")
+	for _, s := range c.sinks {
+		err := s.Show(text)
+		switch {
+		case err != nil && !c.failed[s]:
+			fmt.Fprintf(os.Stderr, "⚠  Captions: %v\n", err)
+			c.failed[s] = true
+		case err == nil:
+			c.failed[s] = false
+		}
+	}
+}
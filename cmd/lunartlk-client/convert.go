@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rubiojr/lunartlk/internal/audio"
+	"github.com/rubiojr/lunartlk/internal/cli"
+	"github.com/rubiojr/lunartlk/internal/resample"
+)
+
+func convertCommand() *cli.Command {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	rate := fs.Int("rate", 0, "sample rate of WAV output (default: the input's)")
+	bitrate := fs.Int("bitrate", 64000, "Opus bitrate of .opus/.ogg output, in bits per second")
+
+	return &cli.Command{
+		Name:  "convert",
+		Short: "convert recordings between WAV and Ogg Opus",
+		Long: "Converts in.opus to out.wav, or the other way around, without external tools. " +
+			"Inputs can be WAV, Ogg Opus or lunartlk's Opus wire format; Opus output is a " +
+			"16kHz mono Ogg Opus file, like the saved recordings.",
+		Args:  "<in> <out>",
+		Flags: fs,
+		Run: func(rest []string) {
+			if len(rest) != 2 {
+				log.Fatal("usage: lunartlk-client convert [-rate hz] [-bitrate bps] <in> <out>")
+			}
+			if err := convertAudio(rest[0], rest[1], *rate, *bitrate); err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+}
+
+// convertAudio decodes in and encodes it to out, the formats picked by the
+// file extensions.
+func convertAudio(in, out string, rate, bitrate int) error {
+	data, err := os.ReadFile(in)
+	if err != nil {
+		return err
+	}
+	var samples []float32
+	var inRate int32
+	switch ext := strings.ToLower(filepath.Ext(in)); ext {
+	case ".wav":
+		samples, inRate, err = audio.DecodeWAV(data)
+	case ".opus", ".ogg":
+		samples, inRate, err = audio.DecodeOpus(data)
+	default:
+		return fmt.Errorf("unsupported input format %q, use .wav, .opus or .ogg", ext)
+	}
+	if err != nil {
+		return fmt.Errorf("decode %s: %w", in, err)
+	}
+
+	var encoded []byte
+	switch ext := strings.ToLower(filepath.Ext(out)); ext {
+	case ".wav":
+		if rate == 0 {
+			rate = int(inRate)
+		}
+		encoded = audio.EncodeWAV(resample.Resample(samples, int(inRate), rate, resample.High), rate)
+	case ".opus", ".ogg":
+		enc, err := audio.NewStreamEncoder(bitrate)
+		if err != nil {
+			return fmt.Errorf("opus encoder: %w", err)
+		}
+		if err := enc.Write(resample.Resample(samples, int(inRate), audio.SampleRate, resample.High)); err != nil {
+			return err
+		}
+		if err := enc.Flush(); err != nil {
+			return err
+		}
+		encoded = enc.OggBytes()
+	default:
+		return fmt.Errorf("unsupported output format %q, use .wav, .opus or .ogg", ext)
+	}
+
+	if err := os.WriteFile(out, encoded, 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "🔁 %s → %s (%.1fs)\n", in, out, float64(len(samples))/float64(inRate))
+	return nil
+}
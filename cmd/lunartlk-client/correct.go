@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rubiojr/lunartlk/internal/cli"
+	"github.com/rubiojr/lunartlk/internal/postproc"
+	"github.com/rubiojr/lunartlk/internal/textdiff"
+)
+
+// maxCorrectionWords is the longest run of words a correction can replace
+// to be learned into the dictionary. Longer edits are rewrites, not
+// misrecognized words.
+const maxCorrectionWords = 3
+
+func historyCorrectCommand() *cli.Command {
+	fs := flag.NewFlagSet("history correct", flag.ExitOnError)
+	dictFile := fs.String("dictionary", defaultDictionaryFile(), "file the corrected words are added to")
+	noLearn := fs.Bool("no-dictionary", false, "don't add the corrected words to the dictionary")
+
+	return &cli.Command{
+		Name:  "correct",
+		Short: "fix a transcript in $EDITOR and learn the corrections",
+		Args:  "<id>",
+		Flags: fs,
+		Run: func(rest []string) {
+			if len(rest) != 1 {
+				log.Fatal("usage: lunartlk-client history correct [-no-dictionary] <id>")
+			}
+			historyCorrect(rest[0], *dictFile, !*noLearn)
+		},
+	}
+}
+
+func historyCorrect(id, dictFile string, learn bool) {
+	orig, err := loadTranscript(id, "")
+	if err != nil {
+		log.Fatalf("Load transcript: %v", err)
+	}
+	before := orig.Text
+	if corrected, err := loadCorrection(id); err == nil {
+		before = corrected
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		log.Fatalf("Load correction: %v", err)
+	}
+
+	after, err := editText(before)
+	if err != nil {
+		log.Fatalf("Edit transcript: %v", err)
+	}
+	if after == "" || after == before {
+		fmt.Fprintln(os.Stderr, "No changes.")
+		return
+	}
+
+	path := correctionPath(id)
+	if err := os.WriteFile(path, []byte(after+"\n"), 0644); err != nil {
+		log.Fatalf("Save correction: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "📝 Correction saved to %s\n", path)
+
+	if !learn || dictFile == "" {
+		return
+	}
+	// Learn from the engine's text, so words fixed in an earlier
+	// correction aren't lost
+	added, err := learnCorrections(dictFile, textdiff.Substitutions(orig.Text, after, maxCorrectionWords))
+	if err != nil {
+		log.Fatalf("Update dictionary: %v", err)
+	}
+	for _, s := range added {
+		fmt.Fprintf(os.Stderr, "📖 %s => %s\n", s.From, s.To)
+	}
+	if len(added) > 0 {
+		fmt.Fprintf(os.Stderr, "📖 Added %d entries to %s\n", len(added), dictFile)
+	}
+}
+
+// correctionPath returns where the corrected text of a transcript is kept.
+// It isn't a .json file, so it isn't taken for a re-transcription.
+func correctionPath(id string) string {
+	return filepath.Join(dataDir(), "transcripts", id+".corrected.txt")
+}
+
+// loadCorrection reads the corrected text of a transcript.
+func loadCorrection(id string) (string, error) {
+	data, err := os.ReadFile(correctionPath(id))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// editText opens text in $EDITOR (vi by default) and returns it edited.
+func editText(text string) (string, error) {
+	f, err := os.CreateTemp("", "lunartlk-correct-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(text + "\n"); err != nil {
+		f.Close()
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		return "", err
+	}
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+	// $EDITOR may carry arguments, like "code --wait"
+	args := append(strings.Fields(editor), f.Name())
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s: %w", editor, err)
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// learnCorrections appends the substitutions the dictionary doesn't have
+// yet to it, and returns them.
+func learnCorrections(path string, subs []textdiff.Substitution) ([]textdiff.Substitution, error) {
+	known := make(map[string]bool)
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for line := range strings.Lines(string(data)) {
+		if from, _, ok := strings.Cut(line, "=>"); ok {
+			known[strings.ToLower(strings.TrimSpace(from))] = true
+		}
+	}
+
+	var added []textdiff.Substitution
+	var b strings.Builder
+	for _, s := range subs {
+		key := strings.ToLower(s.From)
+		// Only case changed: the engine heard it right
+		if known[key] || key == strings.ToLower(s.To) {
+			continue
+		}
+		known[key] = true
+		added = append(added, s)
+		fmt.Fprintf(&b, "%s => %s\n", s.From, s.To)
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		fmt.Fprintln(f)
+	}
+	if _, err := f.WriteString(b.String()); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return added, f.Close()
+}
+
+// defaultDictionaryFile returns the user dictionary in the user's config
+// directory, ~/.config/lunartlk/dictionary.txt.
+func defaultDictionaryFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "lunartlk", "dictionary.txt")
+}
+
+// loadDictionary loads the -dictionary file, exiting when it's invalid. A
+// missing file has no entries.
+func loadDictionary(path string) *postproc.Dictionary {
+	if path == "" {
+		return &postproc.Dictionary{}
+	}
+	dict, err := postproc.LoadDictionary(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &postproc.Dictionary{}
+	}
+	if err != nil {
+		log.Fatalf("Dictionary: %v", err)
+	}
+	return dict
+}
+
+// datasetEntry is a line of a NeMo-style training manifest.
+type datasetEntry struct {
+	AudioFilepath string  `json:"audio_filepath"`
+	Duration      float64 `json:"duration"`
+	Text          string  `json:"text"`
+	Lang          string  `json:"lang,omitempty"`
+}
+
+func historyDatasetCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "dataset",
+		Short: "export corrected transcripts and their audio for fine-tuning",
+		Args:  "<dir>",
+		Run: func(rest []string) {
+			if len(rest) != 1 {
+				log.Fatal("usage: lunartlk-client history dataset <dir>")
+			}
+			historyDataset(rest[0])
+		},
+	}
+}
+
+// historyDataset writes the audio of every corrected transcript as 16kHz
+// WAV to dir/audio, and a manifest.jsonl pairing it with the corrected
+// text.
+func historyDataset(dir string) {
+	ids, err := historyIDs()
+	if err != nil {
+		log.Fatalf("List transcripts: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "audio"), 0755); err != nil {
+		log.Fatalf("Create dataset: %v", err)
+	}
+	manifest, err := os.Create(filepath.Join(dir, "manifest.jsonl"))
+	if err != nil {
+		log.Fatalf("Create manifest: %v", err)
+	}
+	enc := json.NewEncoder(manifest)
+
+	n := 0
+	for _, id := range ids {
+		text, err := loadCorrection(id)
+		if err != nil {
+			continue
+		}
+		resp, err := loadTranscript(id, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠  %s: %v\n", id, err)
+			continue
+		}
+		in := filepath.Join(dataDir(), "audio", id+".opus")
+		if _, err := os.Stat(in); err != nil {
+			in = filepath.Join(dataDir(), "audio", id+".wav")
+		}
+		out := filepath.Join(dir, "audio", id+".wav")
+		if err := convertAudio(in, out, sampleRate, 0); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠  %s: %v\n", id, err)
+			continue
+		}
+		abs, err := filepath.Abs(out)
+		if err != nil {
+			abs = out
+		}
+		if err := enc.Encode(datasetEntry{
+			AudioFilepath: abs,
+			Duration:      resp.AudioDuration,
+			Text:          text,
+			Lang:          resp.Lang,
+		}); err != nil {
+			log.Fatalf("Write manifest: %v", err)
+		}
+		n++
+	}
+	if err := manifest.Close(); err != nil {
+		log.Fatalf("Write manifest: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "📦 Exported %d corrected transcripts to %s\n", n, dir)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/client"
+	"github.com/rubiojr/lunartlk/internal/cli"
+	"github.com/rubiojr/lunartlk/internal/dictation"
+	"github.com/rubiojr/lunartlk/internal/postproc"
+)
+
+const (
+	maxDaemonEvents = 100
+	maxEventsWait   = 60 * time.Second
+)
+
+// daemonEvent is a state change reported by GET /events.
+type daemonEvent struct {
+	ID   int64     `json:"id"`
+	Type string    `json:"type"` // recording, transcribing, transcript, error or a client.RecorderEvent type
+	Time time.Time `json:"time"`
+	// Text is the dictated text of transcript events, after spoken
+	// commands when enabled.
+	Text       string                  `json:"text,omitempty"`
+	Transcript *api.TranscriptResponse `json:"transcript,omitempty"`
+	Error      string                  `json:"error,omitempty"`
+}
+
+// dictationDaemon drives a recorder from HTTP requests, for editor
+// plugins.
+type dictationDaemon struct {
+	rec      *client.Recorder
+	tc       *client.Client
+	save     bool
+	commands bool
+	mode     string
+	macros   *dictation.Macros
+	dict     *postproc.Dictionary
+
+	mu        sync.Mutex
+	recording bool
+	busy      bool
+	nextID    int64
+	events    []daemonEvent
+	last      *daemonEvent
+	// changed is closed and replaced whenever an event is added, waking
+	// the long polls.
+	changed chan struct{}
+}
+
+func daemonCommand() *cli.Command {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:9766", "address for the local HTTP API")
+	server := fs.String("server", "http://localhost:9765", "transcription server URL")
+	token := fs.String("token", "", "Bearer token for server authentication")
+	lang := fs.String("lang", "", "language for transcription (en, es)")
+	engineFlag := fs.String("engine", "", "transcription engine (moonshine, parakeet)")
+	source := fs.String("source", "", "audio source: empty for the default mic, \"monitor\" for the system audio, or a PulseAudio/PipeWire source name")
+	commands := fs.Bool("commands", false, "apply spoken formatting commands (\"new line\", \"comma\", \"undo that\", ...)")
+	mode := fs.String("mode", "", "dictation mode: code (spoken symbols, \"snake case ...\") or list (numbered items)")
+	dictFile := fs.String("dictionary", defaultDictionaryFile(), "file of \"from => to\" replacements for misrecognized words, learned by history correct")
+	macrosFile := fs.String("macros", defaultMacrosFile(), "JSON file of spoken phrases to expand into text snippets (\"insert signature\")")
+	sessionID := fs.String("session", "", "group the dictations in this server session, which stores them together and spells names in consistently")
+	noSave := fs.Bool("no-save", false, "don't save transcripts to disk")
+	preRoll := fs.Duration("pre-roll", 500*time.Millisecond, "audio kept from before /start, so first words aren't clipped (0 to only open the mic while recording)")
+
+	return &cli.Command{
+		Name:     "daemon",
+		Short:    "local HTTP API to drive dictation from editors",
+		Flags:    fs,
+		Complete: serverCompletions(server),
+		Run: func([]string) {
+			checkMode(*mode)
+			recOpts, err := sourceOptions(*source)
+			if err != nil {
+				log.Fatalf("Audio source: %v", err)
+			}
+			d := &dictationDaemon{
+				tc:       newClient(*server, *token, *lang, *engineFlag, requestOptions("", false, "", *sessionID)...),
+				save:     !*noSave,
+				commands: *commands,
+				mode:     *mode,
+				macros:   loadMacros(*macrosFile),
+				dict:     loadDictionary(*dictFile),
+				changed:  make(chan struct{}),
+			}
+			// Device events come from the capture goroutine, which
+			// handleStop waits for with d.mu held
+			devices := make(chan client.RecorderEvent, 16)
+			go func() {
+				for e := range devices {
+					d.deviceEvent(e)
+				}
+			}()
+			recOpts = append(recOpts, client.WithPreRoll(*preRoll), client.WithEvents(func(e client.RecorderEvent) {
+				select {
+				case devices <- e:
+				default:
+				}
+			}))
+			rec, err := client.NewRecorder(sampleRate, 1024, recOpts...)
+			if err != nil {
+				log.Fatalf("Recorder init failed: %v", err)
+			}
+			defer rec.Close()
+			d.rec = rec
+			if err := rec.Listen(); err != nil {
+				log.Fatalf("Recorder init failed: %v", err)
+			}
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /start", d.handleStart)
+			mux.HandleFunc("POST /stop", d.handleStop)
+			mux.HandleFunc("GET /last", d.handleLast)
+			mux.HandleFunc("GET /events", d.handleEvents)
+
+			log.Printf("Dictation API listening on %s", *listen)
+			log.Fatal(http.ListenAndServe(*listen, localOnly(mux)))
+		},
+	}
+}
+
+// localOnly rejects requests from web pages: cross-origin ones carry an
+// Origin header, and DNS rebinding ones a foreign Host. Editor plugins
+// send neither.
+func localOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		ip := net.ParseIP(host)
+		if r.Header.Get("Origin") != "" || (host != "localhost" && (ip == nil || !ip.IsLoopback())) {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleStart starts recording.
+func (d *dictationDaemon) handleStart(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.recording || d.busy {
+		http.Error(w, "already recording or transcribing", http.StatusConflict)
+		return
+	}
+	if err := d.rec.Start(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	d.recording = true
+	d.emit(daemonEvent{Type: "recording"})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleStop stops recording, transcribes and responds with the transcript
+// event.
+func (d *dictationDaemon) handleStop(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	if !d.recording {
+		d.mu.Unlock()
+		http.Error(w, "not recording", http.StatusConflict)
+		return
+	}
+	samples := d.rec.Stop()
+	d.recording, d.busy = false, true
+	d.emit(daemonEvent{Type: "transcribing"})
+	d.mu.Unlock()
+
+	resp, err := transcribeRecording(d.tc, samples, d.save)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.busy = false
+	if err != nil && resp == nil {
+		log.Printf("Transcription failed: %v", err)
+		d.emit(daemonEvent{Type: "error", Error: err.Error()})
+		code := http.StatusBadGateway
+		if errors.Is(err, errNoSpeech) {
+			code = http.StatusUnprocessableEntity
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	if err != nil {
+		// Transcribed, but saving it failed
+		log.Printf("%v", err)
+	}
+
+	text, err := dictate(d.dict.Replace(resp.Text), resp.Lang, d.commands, d.mode, d.macros)
+	if err != nil {
+		log.Printf("%v", err)
+	}
+	e := d.emit(daemonEvent{Type: "transcript", Text: text, Transcript: resp})
+	d.last = &e
+	writeJSON(w, e)
+}
+
+// handleLast responds with the last transcript event.
+func (d *dictationDaemon) handleLast(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	last := d.last
+	d.mu.Unlock()
+	if last == nil {
+		http.Error(w, "no transcript yet", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, last)
+}
+
+// handleEvents responds with the events after ?after=ID, waiting up to
+// ?wait= (default 30s) for one when there are none yet.
+func (d *dictationDaemon) handleEvents(w http.ResponseWriter, r *http.Request) {
+	var after int64
+	if v := r.URL.Query().Get("after"); v != "" {
+		var err error
+		if after, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, "invalid after", http.StatusBadRequest)
+			return
+		}
+	}
+	wait := 30 * time.Second
+	if v := r.URL.Query().Get("wait"); v != "" {
+		var err error
+		if wait, err = time.ParseDuration(v); err != nil {
+			http.Error(w, "invalid wait", http.StatusBadRequest)
+			return
+		}
+		wait = min(wait, maxEventsWait)
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		d.mu.Lock()
+		events := d.eventsAfter(after)
+		changed := d.changed
+		d.mu.Unlock()
+		if len(events) > 0 {
+			writeJSON(w, map[string]any{"events": events})
+			return
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			writeJSON(w, map[string]any{"events": []daemonEvent{}})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// deviceEvent reports the recorder's device changes as events, so plugins
+// can tell the user the microphone is gone.
+func (d *dictationDaemon) deviceEvent(e client.RecorderEvent) {
+	de := daemonEvent{Type: e.Type}
+	if e.Err != nil {
+		de.Error = e.Err.Error()
+	}
+	log.Printf("Audio: %s %s", e.Type, de.Error)
+	d.mu.Lock()
+	d.emit(de)
+	d.mu.Unlock()
+}
+
+// emit records an event and wakes the long polls. d.mu must be held.
+func (d *dictationDaemon) emit(e daemonEvent) daemonEvent {
+	d.nextID++
+	e.ID = d.nextID
+	e.Time = time.Now()
+	d.events = append(d.events, e)
+	if len(d.events) > maxDaemonEvents {
+		d.events = d.events[len(d.events)-maxDaemonEvents:]
+	}
+	close(d.changed)
+	d.changed = make(chan struct{})
+	return e
+}
+
+// eventsAfter returns the kept events newer than id. d.mu must be held.
+func (d *dictationDaemon) eventsAfter(id int64) []daemonEvent {
+	for i, e := range d.events {
+		if e.ID > id {
+			return append([]daemonEvent(nil), d.events[i:]...)
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/client"
+	"github.com/rubiojr/lunartlk/internal/audio"
+	"github.com/rubiojr/lunartlk/internal/cli"
+	"github.com/rubiojr/lunartlk/internal/semantic"
+)
+
+func historyCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "history",
+		Short: "browse, re-transcribe and correct saved transcripts",
+		Commands: []*cli.Command{
+			{
+				Name:  "list",
+				Short: "list saved transcripts",
+				Run:   func([]string) { historyList() },
+			},
+			{
+				Name:  "show",
+				Short: "print a transcript and any re-transcriptions",
+				Args:  "<id>",
+				Run: func(args []string) {
+					if len(args) != 1 {
+						log.Fatal("usage: lunartlk-client history show <id>")
+					}
+					historyShow(args[0])
+				},
+			},
+			historyRetranscribeCommand(),
+			historySearchCommand(),
+			historyCorrectCommand(),
+			historyDatasetCommand(),
+		},
+	}
+}
+
+func historyList() {
+	ids, err := historyIDs()
+	if err != nil {
+		log.Fatalf("List transcripts: %v", err)
+	}
+	for _, id := range ids {
+		resp, err := loadTranscript(id, "")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠  %s: %v\n", id, err)
+			continue
+		}
+		text := resp.Text
+		if len(text) > 60 {
+			text = text[:60] + "..."
+		}
+		fmt.Printf("%s  %-9s %6.1fs  %s\n", id, resp.Engine, resp.AudioDuration, text)
+	}
+}
+
+func historyShow(id string) {
+	resp, err := loadTranscript(id, "")
+	if err != nil {
+		log.Fatalf("Load transcript: %v", err)
+	}
+	printHistoryEntry(resp)
+
+	alts, _ := filepath.Glob(filepath.Join(dataDir(), "transcripts", id+".*.json"))
+	for _, path := range alts {
+		engine := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), id+"."), ".json")
+		alt, err := loadTranscript(id, engine)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠  %s: %v\n", path, err)
+			continue
+		}
+		fmt.Println()
+		printHistoryEntry(alt)
+	}
+
+	if corrected, err := loadCorrection(id); err == nil {
+		fmt.Println()
+		fmt.Println("[corrected]")
+		fmt.Println(corrected)
+	}
+}
+
+func printHistoryEntry(resp *api.TranscriptResponse) {
+	fmt.Printf("[%s/%s, lang=%s, %.1fs audio, %dms processing]\n",
+		resp.Engine, resp.Model, resp.Lang, resp.AudioDuration, resp.ProcessingMs)
+	fmt.Println(resp.Text)
+}
+
+func historyRetranscribeCommand() *cli.Command {
+	fs := flag.NewFlagSet("history retranscribe", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:9765", "transcription server URL")
+	token := fs.String("token", "", "Bearer token for server authentication")
+	lang := fs.String("lang", "", "language for transcription (en, es)")
+	engineFlag := fs.String("engine", "", "transcription engine (moonshine, parakeet)")
+
+	return &cli.Command{
+		Name:     "retranscribe",
+		Short:    "re-run saved audio through another engine",
+		Args:     "<id>",
+		Flags:    fs,
+		Complete: serverCompletions(server),
+		Run: func(rest []string) {
+			if len(rest) != 1 || *engineFlag == "" {
+				log.Fatal("usage: lunartlk-client history retranscribe <id> -engine <engine> [-lang <lang>]")
+			}
+			id := rest[0]
+
+			orig, err := loadTranscript(id, "")
+			if err != nil {
+				log.Fatalf("Load transcript: %v", err)
+			}
+			audioData, name, err := loadAudio(id)
+			if err != nil {
+				log.Fatalf("Load audio: %v", err)
+			}
+
+			opts := []client.Option{client.WithEngine(*engineFlag)}
+			if *token != "" {
+				opts = append(opts, client.WithToken(*token))
+			}
+			if *lang != "" {
+				opts = append(opts, client.WithLang(*lang))
+			} else if orig.Lang != "" {
+				opts = append(opts, client.WithLang(orig.Lang))
+			}
+			opts = append(opts, client.WithVersionMismatch(warnAPIVersion))
+			tc := client.New(*server, append(opts, caOptions()...)...)
+
+			fmt.Fprintf(os.Stderr, "📡 Re-transcribing %s with %s...\n", id, *engineFlag)
+			resp, err := tc.Transcribe(audioData, name)
+			if err != nil {
+				log.Fatalf("Server error: %v", err)
+			}
+
+			data, err := json.MarshalIndent(resp, "", "  ")
+			if err != nil {
+				log.Fatalf("Marshal transcript: %v", err)
+			}
+			path := filepath.Join(dataDir(), "transcripts", id+"."+resp.Engine+".json")
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				log.Fatalf("Save transcript: %v", err)
+			}
+			fmt.Fprintf(os.Stderr, "📝 Transcript saved to %s\n\n", path)
+
+			printHistoryEntry(orig)
+			fmt.Println()
+			printHistoryEntry(resp)
+		},
+	}
+}
+
+// loadAudio returns the saved audio of a recording ready to upload, and
+// its file name. Ogg Opus recordings are sent as their Opus frames, so
+// they aren't decoded; clients built without Opus save WAV instead.
+func loadAudio(id string) ([]byte, string, error) {
+	dir := filepath.Join(dataDir(), "audio")
+	oggData, err := os.ReadFile(filepath.Join(dir, id+".opus"))
+	if errors.Is(err, fs.ErrNotExist) {
+		data, wavErr := os.ReadFile(filepath.Join(dir, id+".wav"))
+		if wavErr == nil {
+			return data, "recording.wav", nil
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	frames, err := audio.ReadOggOpus(oggData)
+	if err != nil {
+		return nil, "", err
+	}
+	return audio.WireFrames(frames), "recording.opus", nil
+}
+
+func historySearchCommand() *cli.Command {
+	fs := flag.NewFlagSet("history search", flag.ExitOnError)
+	semanticFlag := fs.Bool("semantic", false, "search by meaning with an Ollama embedding model instead of by words")
+	limit := fs.Int("n", 10, "maximum number of results")
+	embedModel := fs.String("embed-model", "nomic-embed-text", "Ollama embedding model for -semantic")
+	ollamaHost := fs.String("ollama-host", "", "Ollama server URL (default: $OLLAMA_HOST or http://localhost:11434)")
+
+	return &cli.Command{
+		Name:  "search",
+		Short: "find saved transcripts by words or by meaning",
+		Args:  "<query>",
+		Flags: fs,
+		Run: func(rest []string) {
+			if len(rest) == 0 {
+				log.Fatal("usage: lunartlk-client history search [-semantic] <query>")
+			}
+			query := strings.Join(rest, " ")
+			if *semanticFlag {
+				historySemanticSearch(query, *limit, semantic.NewOllama(*embedModel, *ollamaHost))
+				return
+			}
+
+			ids, err := historyIDs()
+			if err != nil {
+				log.Fatalf("List transcripts: %v", err)
+			}
+			found := 0
+			for _, id := range ids {
+				resp, err := loadTranscript(id, "")
+				if err != nil || !strings.Contains(strings.ToLower(resp.Text), strings.ToLower(query)) {
+					continue
+				}
+				printSearchResult(id, resp.Text, "")
+				if found++; found == *limit {
+					break
+				}
+			}
+		},
+	}
+}
+
+// historySemanticSearch brings the embeddings index of saved transcripts
+// up to date and prints the transcripts closest in meaning to query.
+func historySemanticSearch(query string, limit int, e semantic.Embedder) {
+	ids, err := historyIDs()
+	if err != nil {
+		log.Fatalf("List transcripts: %v", err)
+	}
+	docs := make(map[string]string)
+	for _, id := range ids {
+		if resp, err := loadTranscript(id, ""); err == nil {
+			docs[id] = resp.Text
+		}
+	}
+
+	path := filepath.Join(dataDir(), "semantic-index.json")
+	idx, err := semantic.Load(path)
+	if err != nil {
+		log.Fatalf("Load index: %v", err)
+	}
+	ctx := context.Background()
+	changed, err := idx.Update(ctx, e, docs)
+	if changed {
+		// Keep the embeddings computed so far, even on failure
+		if err := idx.Save(path); err != nil {
+			log.Fatalf("Save index: %v", err)
+		}
+	}
+	if err != nil {
+		log.Fatalf("Index transcripts: %v", err)
+	}
+
+	results, err := idx.Search(ctx, e, query, limit)
+	if err != nil {
+		log.Fatalf("Search: %v", err)
+	}
+	for _, r := range results {
+		printSearchResult(r.ID, docs[r.ID], fmt.Sprintf("%.2f  ", r.Score))
+	}
+}
+
+func printSearchResult(id, text, prefix string) {
+	if len(text) > 60 {
+		text = text[:60] + "..."
+	}
+	fmt.Printf("%s%s  %s\n", prefix, id, text)
+}
+
+// historyIDs returns the IDs of saved transcripts, newest first.
+// Re-transcriptions (<id>.<engine>.json) are not listed separately.
+func historyIDs() ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dataDir(), "transcripts"))
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || strings.Contains(id, ".") {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(ids)))
+	return ids, nil
+}
+
+// loadTranscript reads a saved transcript. An empty engine loads the
+// original, otherwise the re-transcription made with that engine.
+func loadTranscript(id, engine string) (*api.TranscriptResponse, error) {
+	name := id + ".json"
+	if engine != "" {
+		name = id + "." + engine + ".json"
+	}
+	data, err := os.ReadFile(filepath.Join(dataDir(), "transcripts", name))
+	if err != nil {
+		return nil, err
+	}
+	var resp api.TranscriptResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", name, err)
+	}
+	return &resp, nil
+}
@@ -6,50 +6,166 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/rubiojr/lunartlk/api"
 	"github.com/rubiojr/lunartlk/client"
 	"github.com/rubiojr/lunartlk/internal/audio"
+	"github.com/rubiojr/lunartlk/internal/cli"
+	"github.com/rubiojr/lunartlk/internal/dictation"
 	"github.com/rubiojr/lunartlk/internal/doctor"
+	"github.com/rubiojr/lunartlk/internal/intent"
+	"github.com/rubiojr/lunartlk/internal/mpris"
+	"github.com/rubiojr/lunartlk/internal/vad"
 	"github.com/rubiojr/lunartlk/translate"
 )
 
 const sampleRate = 16000
 
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
 func main() {
 	doctorFlag := flag.Bool("doctor", false, "run preflight checks and exit")
 	server := flag.String("server", "http://localhost:9765", "transcription server URL")
 	token := flag.String("token", "", "Bearer token for server authentication")
 	lang := flag.String("lang", "", "language for transcription (en, es)")
 	engineFlag := flag.String("engine", "", "transcription engine (moonshine, parakeet)")
+	profanity := flag.String("profanity", "", "have the server mask swear words: first (f***), stars (****) or tag ([censored])")
+	clean := flag.Bool("clean", false, "have the server remove filler words (\"um\", \"eh\") and repeated words")
+	rewrite := flag.String("rewrite", "", "print the transcript polished by the server's LLM instead: email, note or bullet")
+	resumable := flag.Bool("resumable", false, "upload in chunks that resume after network errors instead of starting over, for unreliable connections")
+	encryptionKey := flag.String("encryption-key", "", "file with the base64 key shared with the server to encrypt the audio with before sending it")
+	exportProfile := flag.String("export", "", "have the server send the transcript to this export profile, e.g. a notes app (none skips the default one)")
+	sessionID := flag.String("session", "", "group the dictation with others sent in this session, which the server stores together and spells names in consistently")
+	commands := flag.Bool("commands", false, "apply spoken formatting commands (\"new line\", \"comma\", \"undo that\", ...)")
+	mode := flag.String("mode", "", "dictation mode: code (spoken symbols, \"snake case ...\") or list (numbered items)")
+	dictFile := flag.String("dictionary", defaultDictionaryFile(), "file of \"from => to\" replacements for misrecognized words, learned by history correct")
+	macrosFile := flag.String("macros", defaultMacrosFile(), "JSON file of spoken phrases to expand into text snippets (\"insert signature\")")
+	intentsFile := flag.String("intents", "", "command mode: run the intent from this file matching the transcript instead of printing it")
+	source := flag.String("source", "", "audio source: empty for the default mic, \"monitor\" for the system audio, or a PulseAudio/PipeWire source name")
 	clipboard := flag.Bool("clipboard", false, "copy result to clipboard via wl-copy")
+	appendFile := flag.String("append", "", "append each transcript to this file")
+	appendTime := flag.Bool("append-timestamp", false, "with -append, prefix each entry with the date and time")
+	noVAD := flag.Bool("no-vad", false, "send the recording even if no speech was detected")
 	noSave := flag.Bool("no-save", false, "don't save transcript to disk")
+	pauseMedia := flag.Bool("pause-media", false, "pause playing media players (MPRIS) while recording")
 	saveWav := flag.String("save-wav", "", "save recorded audio to this WAV file for debugging")
 	translateTo := flag.String("translate", "", "translate transcript to language (e.g. English, Spanish)")
-	ollamaModel := flag.String("ollama-model", "lfm2", "Ollama model for translation")
+	meetingFile := flag.String("meeting", "", "record continuously, appending timestamped notes to this file")
+	summaryEvery := flag.Duration("summary-every", 0, "with -meeting, add an Ollama summary of the new notes this often (e.g. 10m)")
+	ollamaModel := flag.String("ollama-model", "lfm2", "Ollama model for translation and summaries")
 	ollamaHost := flag.String("ollama-host", "", "Ollama server URL (default: $OLLAMA_HOST or http://localhost:11434)")
-	flag.Parse()
+
+	root := &cli.Command{
+		Name:  "lunartlk-client",
+		Short: "record speech and transcribe it with a lunartlk server",
+		Long: "Records from the microphone until Ctrl+C, sends the audio to a lunartlk-server " +
+			"and prints the transcript. Transcripts and audio are saved to ~/.local/share/lunartlk.",
+		Flags:    flag.CommandLine,
+		Complete: serverCompletions(server),
+		Commands: []*cli.Command{
+			historyCommand(),
+			statsCommand(),
+			convertCommand(),
+			tuiCommand(),
+			trayCommand(),
+			callCommand(),
+			captionsCommand(),
+			calibrateCommand(),
+			botCommand(),
+			daemonCommand(),
+			cli.CompletionCommand(),
+			cli.ManCommand(1, version),
+			cli.CompleteCommand(),
+		},
+	}
+	root.Execute(os.Args[1:])
 
 	if *doctorFlag {
 		fmt.Fprintln(os.Stderr, "lunartlk-client preflight checks:")
 		results := doctor.RunChecks("client")
+		if client.AudioBackend != "portaudio" {
+			// miniaudio is compiled in and loads the system audio libraries itself
+			results = slices.DeleteFunc(results, func(r doctor.CheckResult) bool {
+				return r.Name == "libportaudio" || r.Name == "libjack"
+			})
+		}
 		if doctor.PrintResults(results) {
 			os.Exit(0)
 		}
 		os.Exit(1)
 	}
 
-	rec, err := client.NewRecorder(sampleRate, 1024)
+	checkMode(*mode)
+	macros := loadMacros(*macrosFile)
+	var extraOpts []client.Option
+	if *exportProfile != "" {
+		extraOpts = append(extraOpts, client.WithExport(*exportProfile))
+	}
+	if *encryptionKey != "" {
+		key, err := client.LoadEncryptionKey(*encryptionKey)
+		if err != nil {
+			log.Fatalf("Encryption key: %v", err)
+		}
+		extraOpts = append(extraOpts, client.WithEncryption(key))
+	}
+	dict := loadDictionary(*dictFile)
+
+	var intents []*intent.Intent
+	if *intentsFile != "" {
+		var err error
+		if intents, err = intent.Load(*intentsFile); err != nil {
+			log.Fatalf("Intents: %v", err)
+		}
+	}
+
+	recOpts, err := sourceOptions(*source)
+	if err != nil {
+		log.Fatalf("Audio source: %v", err)
+	}
+	rec, err := client.NewRecorder(sampleRate, 1024, recOpts...)
 	if err != nil {
 		log.Fatalf("Recorder init failed: %v", err)
 	}
 	defer rec.Close()
 
+	if *meetingFile != "" {
+		m := &meeting{
+			tc:           newClient(*server, *token, *lang, *engineFlag, append(requestOptions(*profanity, *clean, "", *sessionID), extraOpts...)...),
+			summaryEvery: *summaryEvery,
+			wavPath:      *saveWav,
+		}
+		if *summaryEvery > 0 {
+			trOpts := []translate.OllamaOption{translate.WithModel(*ollamaModel), translate.WithPrompt(summaryPrompt)}
+			if *ollamaHost != "" {
+				trOpts = append(trOpts, translate.WithHost(*ollamaHost))
+			}
+			m.summarizer = translate.NewOllama(trOpts...)
+		}
+		if err := runMeeting(rec, m, *meetingFile); err != nil {
+			log.Fatalf("Meeting: %v", err)
+		}
+		return
+	}
+
+	var paused *mpris.Paused
+	if *pauseMedia {
+		paused, err = mpris.PausePlaying()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "⚠  Can't pause media players: %v\n", err)
+		} else if n := len(paused.Players()); n > 0 {
+			fmt.Fprintf(os.Stderr, "⏸  Paused %d media player(s)\n", n)
+		}
+	}
+
 	if err := rec.Start(); err != nil {
 		log.Fatalf("Failed to start recording: %v", err)
 	}
@@ -82,9 +198,11 @@ loop:
 
 	recorded := rec.Stop()
 
-	// Pad 1s of silence so the model doesn't clip the last word
-	pad := make([]float32, sampleRate)
-	recorded = append(recorded, pad...)
+	if paused != nil {
+		if err := paused.Resume(); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠  Can't resume media players: %v\n", err)
+		}
+	}
 
 	elapsed := time.Since(start).Truncate(time.Millisecond)
 	fmt.Fprintf(os.Stderr, "\r⏹  Recorded %s (%d samples)\n", elapsed, len(recorded))
@@ -94,16 +212,20 @@ loop:
 		return
 	}
 
+	// Skip the upload for takes without speech, like accidental hotkey presses
+	if !*noVAD && !vad.HasSpeech(recorded, sampleRate, vad.DefaultConfig()) {
+		fmt.Fprintln(os.Stderr, "No speech detected.")
+		return
+	}
+
 	peak, gain := client.NormalizeAudio(recorded)
 	fmt.Fprintf(os.Stderr, "🔈 Peak: %.3f, gain: %.1fx\n", peak, gain)
 
-	// Encode normalized audio as Opus
-	opusEnc, err := audio.NewStreamEncoder(64000)
+	// Encode normalized audio as Opus, or WAV without Opus support
+	enc, err := encodeRecording(recorded)
 	if err != nil {
-		log.Fatalf("Opus encoder init failed: %v", err)
+		log.Fatalf("Encoding failed: %v", err)
 	}
-	opusEnc.Write(recorded)
-	opusEnc.Flush()
 
 	// Save backup WAV before sending
 	wavData := audio.EncodeWAV(recorded, sampleRate)
@@ -120,24 +242,21 @@ loop:
 		}
 	}
 
-	opusData := opusEnc.Bytes()
-	oggData := opusEnc.OggBytes()
-	fmt.Fprintf(os.Stderr, "🔊 Encoded: %dKB WAV → %dKB Opus\n", len(wavData)/1024, len(opusData)/1024)
-
-	var opts []client.Option
-	if *token != "" {
-		opts = append(opts, client.WithToken(*token))
+	uploadData, uploadName := enc.upload()
+	if enc.opus != nil {
+		fmt.Fprintf(os.Stderr, "🔊 Encoded: %dKB WAV → %dKB Opus\n", len(wavData)/1024, len(uploadData)/1024)
+	} else {
+		fmt.Fprintf(os.Stderr, "🔊 Built without Opus, sending %dKB WAV\n", len(wavData)/1024)
 	}
-	if *lang != "" {
-		opts = append(opts, client.WithLang(*lang))
-	}
-	if *engineFlag != "" {
-		opts = append(opts, client.WithEngine(*engineFlag))
+
+	opts := append(requestOptions(*profanity, *clean, *rewrite, *sessionID), extraOpts...)
+	if *resumable {
+		opts = append(opts, client.WithResumableUpload(0))
 	}
-	tc := client.New(*server, opts...)
+	tc := newClient(*server, *token, *lang, *engineFlag, opts...)
 
 	fmt.Fprintln(os.Stderr, "📡 Sending to server...")
-	resp, err := tc.Transcribe(opusData, "recording.opus")
+	resp, err := tc.Transcribe(uploadData, uploadName)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "⚠  Server error: %v\n", err)
 		fmt.Fprintf(os.Stderr, "💾 Audio saved at: %s\n", backupPath)
@@ -149,19 +268,38 @@ loop:
 
 	// Save transcript and audio
 	if !*noSave {
-		saveTranscript(resp)
-		saveAudio(oggData)
+		id := time.Now().Format("2006-01-02T15-04-05")
+		saveTranscript(id, resp)
+		saveAudio(id, enc, audioTags(resp, *source))
 	}
 
 	if resp.Text == "" {
 		fmt.Fprintln(os.Stderr, "No speech detected.")
 		return
 	}
+	// After saving, so corrections are made against what the engine heard
+	resp.Text = dict.Replace(resp.Text)
 
 	fmt.Fprintf(os.Stderr, "\n[%s/%s, lang=%s, %.1fs audio, %dms processing]\n",
 		resp.Engine, resp.Model, resp.Lang, resp.AudioDuration, resp.ProcessingMs)
+	if warning := audioWarning(resp.AudioStats); warning != "" {
+		fmt.Fprintf(os.Stderr, "⚠  %s\n", warning)
+	}
+
+	if intents != nil {
+		runIntent(intents, resp.Text)
+		return
+	}
 
 	output := resp.Text
+	if resp.Rewrite != "" {
+		output = resp.Rewrite
+	} else {
+		var err error
+		if output, err = dictate(output, resp.Lang, *commands, *mode, macros); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠  %v\n", err)
+		}
+	}
 	if *translateTo != "" {
 		fmt.Fprintf(os.Stderr, "🌐 Translating to %s...\n", *translateTo)
 		var trOpts []translate.OllamaOption
@@ -185,6 +323,186 @@ loop:
 	if *clipboard {
 		copyToClipboard(output)
 	}
+
+	if *appendFile != "" {
+		appendToFile(*appendFile, output, *appendTime)
+	}
+}
+
+// checkMode exits when the -mode flag isn't a dictation mode.
+func checkMode(mode string) {
+	if mode != "" && !slices.Contains(dictation.Modes(), mode) {
+		log.Fatalf("Unknown mode %q (available: %s)", mode, strings.Join(dictation.Modes(), ", "))
+	}
+}
+
+// defaultMacrosFile returns the macros file in the user's config
+// directory, ~/.config/lunartlk/macros.json.
+func defaultMacrosFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "lunartlk", "macros.json")
+}
+
+// loadMacros loads the -macros file, exiting when it's invalid.
+func loadMacros(path string) *dictation.Macros {
+	if path == "" {
+		return &dictation.Macros{}
+	}
+	macros, err := dictation.LoadMacros(path)
+	if err != nil {
+		log.Fatalf("Macros: %v", err)
+	}
+	return macros
+}
+
+// dictate applies the spoken commands of lang, the dictation mode and the
+// macros to text. Code mode has its own symbols, so the commands only
+// apply to the other modes. Macros expand last, so their snippets aren't
+// taken for commands. When lang has no commands or mode, the error says
+// so and the text is returned as far as it could be formatted.
+func dictate(text, lang string, commands bool, mode string, macros *dictation.Macros) (string, error) {
+	if commands && mode != "code" {
+		g, ok := dictation.ForLang(lang)
+		if !ok {
+			return macros.Apply(text), fmt.Errorf("no spoken commands for lang '%s' (available: %s)", lang, strings.Join(dictation.Langs(), ", "))
+		}
+		text = g.Apply(text)
+	}
+	if mode != "" {
+		f, err := dictation.ForMode(mode, lang)
+		if err != nil {
+			return macros.Apply(text), err
+		}
+		text = f.Apply(text)
+	}
+	return macros.Apply(text), nil
+}
+
+// runIntent dispatches the intent matching text, exiting with an error
+// when none does or its action fails.
+func runIntent(intents []*intent.Intent, text string) {
+	fmt.Fprintf(os.Stderr, "🗣  %s\n", text)
+	m := intent.Find(intents, text)
+	if m == nil {
+		fmt.Fprintln(os.Stderr, "🤷 No intent matched.")
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "▶  %s %v\n", m.Intent.Name, m.Slots)
+	if err := m.Dispatch(context.Background()); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠  %s: %v\n", m.Intent.Name, err)
+		os.Exit(1)
+	}
+}
+
+// newClient creates a server client, leaving empty settings to the server.
+func newClient(server, token, lang, engine string, extra ...client.Option) *client.Client {
+	opts := extra
+	if token != "" {
+		opts = append(opts, client.WithToken(token))
+	}
+	if lang != "" {
+		opts = append(opts, client.WithLang(lang))
+	}
+	if engine != "" {
+		opts = append(opts, client.WithEngine(engine))
+	}
+	opts = append(opts, client.WithVersionMismatch(warnAPIVersion))
+	return client.New(server, append(opts, caOptions()...)...)
+}
+
+// warnAPIVersion tells the user the server answers in another version of
+// the API than the client's, so missing results aren't taken for bugs.
+func warnAPIVersion(server int) {
+	fmt.Fprintf(os.Stderr, "⚠  The server answers in API version %d, this client expects %d; some results may be missing until both are updated\n", server, api.Version)
+}
+
+// caOptions returns the client option trusting the certificate in
+// $LUNARTLK_CA, e.g. the server's self-signed one, if set.
+func caOptions() []client.Option {
+	path := os.Getenv("LUNARTLK_CA")
+	if path == "" {
+		return nil
+	}
+	pool, err := client.LoadCA(path)
+	if err != nil {
+		log.Fatalf("LUNARTLK_CA: %v", err)
+	}
+	return []client.Option{client.WithRootCAs(pool)}
+}
+
+// requestOptions returns the client options for the -profanity, -clean,
+// -rewrite and -session flags.
+func requestOptions(profanity string, clean bool, rewrite, session string) []client.Option {
+	var opts []client.Option
+	if profanity != "" {
+		opts = append(opts, client.WithProfanityFilter(profanity))
+	}
+	if clean {
+		opts = append(opts, client.WithCleanup())
+	}
+	if rewrite != "" {
+		opts = append(opts, client.WithRewrite(rewrite))
+	}
+	if session != "" {
+		opts = append(opts, client.WithSession(session))
+	}
+	return opts
+}
+
+// serverCompletions completes -engine and -lang with what the server
+// reports in /info.
+func serverCompletions(server *string) map[string]func() []string {
+	info := func() *client.Info {
+		tc := client.New(*server, append(caOptions(), client.WithHTTPClient(&http.Client{Timeout: 2 * time.Second}))...)
+		info, err := tc.Info()
+		if err != nil {
+			return &client.Info{}
+		}
+		return info
+	}
+	return map[string]func() []string{
+		"engine": func() []string {
+			var engines []string
+			for _, e := range info().Engines {
+				engines = append(engines, e.Name)
+			}
+			return engines
+		},
+		"lang": func() []string {
+			seen := make(map[string]bool)
+			var langs []string
+			for _, e := range info().Engines {
+				for _, l := range e.Langs {
+					if !seen[l] {
+						seen[l] = true
+						langs = append(langs, l)
+					}
+				}
+			}
+			return langs
+		},
+	}
+}
+
+// sourceOptions returns the recorder options for the -source flag, with
+// the device's calibration (see calibrate).
+func sourceOptions(source string) ([]client.RecorderOption, error) {
+	switch source {
+	case "":
+		return calibrationOption(""), nil
+	case "monitor":
+		monitor, err := client.DefaultMonitorSource()
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(os.Stderr, "🔉 Recording system audio from %s\n", monitor)
+		return []client.RecorderOption{client.WithPulseSource(monitor)}, nil
+	default:
+		return append([]client.RecorderOption{client.WithPulseSource(source)}, calibrationOption(source)...), nil
+	}
 }
 
 func copyToClipboard(text string) {
@@ -197,6 +515,25 @@ func copyToClipboard(text string) {
 	fmt.Fprintln(os.Stderr, "📋 Copied to clipboard")
 }
 
+// appendToFile adds text as a new line at the end of path, creating it if
+// needed.
+func appendToFile(path, text string, timestamp bool) {
+	if timestamp {
+		text = time.Now().Format("2006-01-02 15:04") + " " + text
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠  Failed to append: %v\n", err)
+		return
+	}
+	defer f.Close()
+	if _, err := fmt.Fprintln(f, text); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠  Failed to append: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "📓 Appended to %s\n", path)
+}
+
 func dataDir() string {
 	if d := os.Getenv("XDG_DATA_HOME"); d != "" {
 		return filepath.Join(d, "lunartlk")
@@ -205,42 +542,49 @@ func dataDir() string {
 	return filepath.Join(home, ".local", "share", "lunartlk")
 }
 
-func saveTranscript(resp *client.TranscriptResponse) {
+func saveTranscript(id string, resp *api.TranscriptResponse) {
+	path, err := writeTranscript(id, resp)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠  Failed to save transcript: %v\n", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "📝 Transcript saved to %s\n", path)
+}
+
+// writeTranscript stores resp as transcripts/<id>.json in the data dir.
+func writeTranscript(id string, resp *api.TranscriptResponse) (string, error) {
 	dir := filepath.Join(dataDir(), "transcripts")
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "⚠  Failed to create transcript dir: %v\n", err)
-		return
+		return "", err
 	}
 
-	filename := time.Now().Format("2006-01-02T15-04-05") + ".json"
-	path := filepath.Join(dir, filename)
+	path := filepath.Join(dir, id+".json")
 
 	data, err := json.MarshalIndent(resp, "", "  ")
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "⚠  Failed to marshal transcript: %v\n", err)
-		return
+		return "", err
 	}
+	return path, os.WriteFile(path, data, 0644)
+}
 
-	if err := os.WriteFile(path, data, 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "⚠  Failed to save transcript: %v\n", err)
+func saveAudio(id string, enc *encodedAudio, tags []audio.OggOption) {
+	data, ext := enc.archive(tags...)
+	path, err := writeAudio(id, ext, data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠  Failed to save audio: %v\n", err)
 		return
 	}
-	fmt.Fprintf(os.Stderr, "📝 Transcript saved to %s\n", path)
+	fmt.Fprintf(os.Stderr, "🔊 Audio saved to %s\n", path)
 }
 
-func saveAudio(opusData []byte) {
+// writeAudio stores audio as audio/<id><ext> in the data dir: <id>.opus
+// for Ogg Opus, or <id>.wav from clients built without Opus.
+func writeAudio(id, ext string, data []byte) (string, error) {
 	dir := filepath.Join(dataDir(), "audio")
 	if err := os.MkdirAll(dir, 0755); err != nil {
-		fmt.Fprintf(os.Stderr, "⚠  Failed to create audio dir: %v\n", err)
-		return
+		return "", err
 	}
 
-	filename := time.Now().Format("2006-01-02T15-04-05") + ".opus"
-	path := filepath.Join(dir, filename)
-
-	if err := os.WriteFile(path, opusData, 0644); err != nil {
-		fmt.Fprintf(os.Stderr, "⚠  Failed to save audio: %v\n", err)
-		return
-	}
-	fmt.Fprintf(os.Stderr, "🔊 Audio saved to %s\n", path)
+	path := filepath.Join(dir, id+ext)
+	return path, os.WriteFile(path, data, 0644)
 }
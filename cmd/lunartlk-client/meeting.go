@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rubiojr/lunartlk/client"
+	"github.com/rubiojr/lunartlk/internal/audio"
+	"github.com/rubiojr/lunartlk/internal/vad"
+	"github.com/rubiojr/lunartlk/translate"
+)
+
+const summaryPrompt = "Summarize this part of a meeting transcript as a few short bullet points, written in %s. Return only the bullet points.\n\n%s"
+
+// meeting appends transcribed speech to a notes file while recording runs.
+type meeting struct {
+	tc   *client.Client
+	file *os.File
+	// summarizer, when set, adds a summary of the new notes every
+	// summaryEvery.
+	summarizer   translate.Translator
+	summaryEvery time.Duration
+	// wavPath, when set, is a WAV file the audio is streamed to.
+	wavPath string
+
+	start       time.Time
+	pending     []string
+	lastSummary time.Time
+}
+
+// runMeeting records continuously until Ctrl+C, cutting the audio at pauses
+// and appending each transcribed segment to path with its time of day.
+func runMeeting(rec *client.Recorder, m *meeting, path string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	m.file = f
+	m.start = time.Now()
+	m.lastSummary = m.start
+	fmt.Fprintf(f, "\n## Meeting %s\n\n", m.start.Format("2006-01-02 15:04"))
+
+	// The audio goes straight to disk, however long the meeting
+	var wav *audio.WAVWriter
+	if m.wavPath != "" {
+		wf, err := os.Create(m.wavPath)
+		if err != nil {
+			return err
+		}
+		defer wf.Close()
+		wav = audio.NewWAVWriter(wf, sampleRate)
+	}
+
+	segments, err := rec.StartContinuous(client.DefaultSegmentConfig())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "🎙  Taking notes in %s... press Ctrl+C to stop\n", path)
+
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt)
+		<-c
+		signal.Stop(c)
+		rec.StopContinuous()
+	}()
+
+	// Transcribe in the background so capture never waits for the server
+	chunks := make(chan vad.Chunk, 64)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for c := range chunks {
+			m.transcribe(c)
+		}
+	}()
+
+	// Segments are utterances, cut at pauses, or the silence between them
+	for s := range segments {
+		if wav != nil {
+			if err := wav.Write(s.Samples); err != nil {
+				fmt.Fprintf(os.Stderr, "⚠  Failed to save WAV: %v\n", err)
+				wav = nil
+			}
+		}
+		if s.Speech {
+			chunks <- vad.Chunk{Start: s.Start, Samples: s.Samples}
+		}
+	}
+	close(chunks)
+	wg.Wait()
+
+	if m.summarizer != nil {
+		m.summarize()
+	}
+	if wav != nil {
+		if err := wav.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "⚠  Failed to save WAV: %v\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "💾 Saved audio to %s\n", m.wavPath)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "⏹  Meeting notes saved to %s (%s)\n", path, time.Since(m.start).Truncate(time.Second))
+	return nil
+}
+
+func (m *meeting) transcribe(c vad.Chunk) {
+	at := m.start.Add(c.Start)
+	resp, err := transcribeRecording(m.tc, c.Samples, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠  %s: %v\n", at.Format("15:04:05"), err)
+		return
+	}
+	if resp.Text == "" {
+		return
+	}
+
+	fmt.Printf("[%s] %s\n", at.Format("15:04:05"), resp.Text)
+	fmt.Fprintf(m.file, "- **%s** %s\n", at.Format("15:04:05"), resp.Text)
+	m.pending = append(m.pending, resp.Text)
+
+	if m.summarizer != nil && m.summaryEvery > 0 && time.Since(m.lastSummary) >= m.summaryEvery {
+		m.summarize()
+	}
+}
+
+// summarize appends a summary of the notes taken since the last one.
+func (m *meeting) summarize() {
+	if len(m.pending) == 0 {
+		return
+	}
+	from, to := m.lastSummary, time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	summary, err := m.summarizer.Translate(ctx, strings.Join(m.pending, "\n"), "the same language as the transcript")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "⚠  Summary failed: %v\n", err)
+		return
+	}
+	fmt.Fprintf(m.file, "\n### Summary %s–%s\n\n%s\n\n", from.Format("15:04"), to.Format("15:04"), strings.TrimSpace(summary))
+	m.pending = nil
+	m.lastSummary = to
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/client"
+	"github.com/rubiojr/lunartlk/internal/audio"
+	"github.com/rubiojr/lunartlk/internal/vad"
+)
+
+var errNoSpeech = errors.New("no speech detected")
+
+// encodedAudio is a recording encoded for upload: as Opus, or as WAV when
+// the client was built without Opus support.
+type encodedAudio struct {
+	opus *audio.StreamEncoder
+	wav  []byte
+}
+
+// encodeRecording encodes normalized samples for upload.
+func encodeRecording(samples []float32) (*encodedAudio, error) {
+	if !audio.OpusSupported {
+		return &encodedAudio{wav: audio.EncodeWAV(samples, sampleRate)}, nil
+	}
+	enc, err := audio.NewStreamEncoder(64000)
+	if err != nil {
+		return nil, fmt.Errorf("opus encoder: %w", err)
+	}
+	enc.Write(samples)
+	enc.Flush()
+	return &encodedAudio{opus: enc}, nil
+}
+
+// upload returns the data to send to the server and its file name.
+func (a *encodedAudio) upload() ([]byte, string) {
+	if a.opus == nil {
+		return a.wav, "recording.wav"
+	}
+	return a.opus.Bytes(), "recording.opus"
+}
+
+// archive returns the audio to keep in the history, an Ogg Opus file
+// described by tags or a WAV file, and its extension.
+func (a *encodedAudio) archive(tags ...audio.OggOption) ([]byte, string) {
+	if a.opus == nil {
+		return a.wav, ".wav"
+	}
+	return a.opus.OggBytes(tags...), ".opus"
+}
+
+// transcribeRecording normalizes and encodes a recording, sends
+// it to the server and, if save is set, stores the transcript and audio in
+// the history. Recordings without speech aren't sent and return
+// errNoSpeech. It prints nothing, for the interactive front-ends.
+func transcribeRecording(tc *client.Client, samples []float32, save bool) (*api.TranscriptResponse, error) {
+	if len(samples) == 0 {
+		return nil, fmt.Errorf("nothing recorded")
+	}
+	if !vad.HasSpeech(samples, sampleRate, vad.DefaultConfig()) {
+		return nil, errNoSpeech
+	}
+	client.NormalizeAudio(samples)
+
+	enc, err := encodeRecording(samples)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := tc.Transcribe(enc.upload())
+	if err != nil {
+		return nil, err
+	}
+	if save {
+		if err := saveRecording(resp, enc); err != nil {
+			return resp, err
+		}
+	}
+	return resp, nil
+}
+
+// saveRecording stores a transcript and its audio in the history.
+func saveRecording(resp *api.TranscriptResponse, enc *encodedAudio) error {
+	id := time.Now().Format("2006-01-02T15-04-05")
+	if _, err := writeTranscript(id, resp); err != nil {
+		return fmt.Errorf("save transcript: %w", err)
+	}
+	data, ext := enc.archive(audioTags(resp, "")...)
+	if _, err := writeAudio(id, ext, data); err != nil {
+		return fmt.Errorf("save audio: %w", err)
+	}
+	return nil
+}
+
+// audioTags describes a saved recording in the comments of its Ogg file:
+// when it was made, how it was transcribed and the audio source, if not
+// the default one.
+func audioTags(resp *api.TranscriptResponse, source string) []audio.OggOption {
+	return []audio.OggOption{
+		audio.WithComment("DATE", time.Now().Format(time.RFC3339)),
+		audio.WithComment("ENGINE", resp.Engine),
+		audio.WithComment("MODEL", resp.Model),
+		audio.WithComment("LANGUAGE", resp.Lang),
+		audio.WithComment("DEVICE", source),
+	}
+}
+
+// audioWarning explains audio quality problems the server found that may
+// cause transcription errors, or returns "" when there are none.
+func audioWarning(st *api.AudioStats) string {
+	switch {
+	case st == nil:
+		return ""
+	case st.ClippingRatio > 0.01:
+		return fmt.Sprintf("Your mic was clipping (%.1f%% of the audio), which may explain errors. Lower the input volume.", st.ClippingRatio*100)
+	case st.SNRDB > 0 && st.SNRDB < 10:
+		return fmt.Sprintf("The recording is noisy (SNR %.0fdB), which may explain errors.", st.SNRDB)
+	}
+	return ""
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/rubiojr/lunartlk/client"
+	"github.com/rubiojr/lunartlk/internal/cli"
+)
+
+func statsCommand() *cli.Command {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:9765", "transcription server URL")
+	token := fs.String("token", "", "Bearer token for server authentication")
+	days := fs.Int("days", 7, "number of days to report, including today")
+
+	return &cli.Command{
+		Name:  "stats",
+		Short: "print your daily usage from the server",
+		Flags: fs,
+		Run: func([]string) {
+			tc := newClient(*server, *token, "", "")
+
+			stats, err := tc.Stats(*days)
+			if err != nil {
+				log.Fatalf("Server error: %v", err)
+			}
+
+			header := "Usage since " + stats.Since
+			if stats.User != "" {
+				header += " (" + stats.User + ")"
+			}
+			fmt.Println(header)
+			fmt.Println()
+			for _, d := range stats.Days {
+				printUsage(d.Date, d.Usage)
+			}
+			if len(stats.Days) > 0 {
+				fmt.Println()
+			}
+			printUsage("Total", stats.Total)
+
+			var engines []string
+			for name := range stats.Total.Engines {
+				engines = append(engines, name)
+			}
+			sort.Strings(engines)
+			for _, name := range engines {
+				printUsage("  "+name, stats.Total.Engines[name])
+			}
+		},
+	}
+}
+
+func printUsage(label string, u client.Usage) {
+	audio := time.Duration(u.AudioSeconds * float64(time.Second)).Round(time.Second)
+	proc := (time.Duration(u.ProcessingMs) * time.Millisecond).Round(100 * time.Millisecond)
+	fmt.Printf("%-12s %5d requests  %9s audio  %8s processing\n", label, u.Requests, audio, proc)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"os"
+
+	"fyne.io/systray"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/client"
+	"github.com/rubiojr/lunartlk/internal/cli"
+)
+
+var (
+	iconIdle         = trayIcon(color.RGBA{0x9e, 0x9e, 0x9e, 0xff})
+	iconRecording    = trayIcon(color.RGBA{0xe5, 0x39, 0x35, 0xff})
+	iconTranscribing = trayIcon(color.RGBA{0xfb, 0x8c, 0x00, 0xff})
+)
+
+// trayEngines are the engine choices in the settings menu; the empty name
+// leaves the choice to the server.
+var trayEngines = []struct{ name, title string }{
+	{"", "Server default"},
+	{"parakeet", "Parakeet"},
+	{"moonshine", "Moonshine"},
+}
+
+type trayResult struct {
+	resp *api.TranscriptResponse
+	err  error
+}
+
+func trayCommand() *cli.Command {
+	fs := flag.NewFlagSet("tray", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:9765", "transcription server URL")
+	token := fs.String("token", "", "Bearer token for server authentication")
+	lang := fs.String("lang", "", "language for transcription (en, es)")
+	engineFlag := fs.String("engine", "", "transcription engine (moonshine, parakeet)")
+	source := fs.String("source", "", "audio source: empty for the default mic, \"monitor\" for the system audio, or a PulseAudio/PipeWire source name")
+	clipboard := fs.Bool("clipboard", true, "copy each transcript to the clipboard via wl-copy")
+	noSave := fs.Bool("no-save", false, "don't save transcripts to disk")
+
+	return &cli.Command{
+		Name:     "tray",
+		Short:    "system tray icon for dictation",
+		Flags:    fs,
+		Complete: serverCompletions(server),
+		Run: func([]string) {
+			recOpts, err := sourceOptions(*source)
+			if err != nil {
+				log.Fatalf("Audio source: %v", err)
+			}
+			rec, err := client.NewRecorder(sampleRate, 1024, recOpts...)
+			if err != nil {
+				log.Fatalf("Recorder init failed: %v", err)
+			}
+			defer rec.Close()
+
+			engineClient := func(engine string) *client.Client {
+				return newClient(*server, *token, *lang, engine)
+			}
+
+			systray.Run(func() {
+				systray.SetIcon(iconIdle)
+				systray.SetTitle("lunartlk")
+				systray.SetTooltip("lunartlk: idle")
+
+				toggle := systray.AddMenuItem("Start recording", "Record and transcribe")
+				systray.AddSeparator()
+				last := systray.AddMenuItem("No transcript yet", "Copy the last transcript")
+				last.Disable()
+				systray.AddSeparator()
+				settings := systray.AddMenuItem("Settings", "")
+				var engineItems []*systray.MenuItem
+				for _, e := range trayEngines {
+					engineItems = append(engineItems, settings.AddSubMenuItemCheckbox(e.title, "Transcription engine", e.name == *engineFlag))
+				}
+				settings.AddSeparator()
+				clipItem := settings.AddSubMenuItemCheckbox("Copy to clipboard", "Copy each transcript via wl-copy", *clipboard)
+				quit := systray.AddMenuItem("Quit", "")
+
+				go trayLoop(rec, engineClient, *engineFlag, !*noSave, toggle, last, engineItems, clipItem, quit)
+			}, func() {})
+		},
+	}
+}
+
+// trayLoop handles menu clicks and transcription results until Quit.
+func trayLoop(rec *client.Recorder, newClient func(string) *client.Client, engine string, save bool,
+	toggle, last *systray.MenuItem, engineItems []*systray.MenuItem, clipItem, quit *systray.MenuItem) {
+	tc := newClient(engine)
+	recording, busy := false, false
+	var lastText string
+	results := make(chan trayResult, 1)
+
+	// Fan the engine items' clicks into a single channel
+	engineClicks := make(chan int)
+	for i, item := range engineItems {
+		go func() {
+			for range item.ClickedCh {
+				engineClicks <- i
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-toggle.ClickedCh:
+			switch {
+			case busy:
+				// Still transcribing the previous recording
+			case !recording:
+				if err := rec.Start(); err != nil {
+					fmt.Fprintf(os.Stderr, "⚠  Failed to start recording: %v\n", err)
+					continue
+				}
+				recording = true
+				toggle.SetTitle("Stop recording")
+				systray.SetIcon(iconRecording)
+				systray.SetTooltip("lunartlk: recording")
+			default:
+				samples := rec.Stop()
+				recording, busy = false, true
+				toggle.SetTitle("Transcribing...")
+				toggle.Disable()
+				systray.SetIcon(iconTranscribing)
+				systray.SetTooltip("lunartlk: transcribing")
+				go func() {
+					resp, err := transcribeRecording(tc, samples, save)
+					results <- trayResult{resp, err}
+				}()
+			}
+
+		case res := <-results:
+			busy = false
+			toggle.SetTitle("Start recording")
+			toggle.Enable()
+			systray.SetIcon(iconIdle)
+			systray.SetTooltip("lunartlk: idle")
+			if res.err != nil {
+				fmt.Fprintf(os.Stderr, "⚠  %v\n", res.err)
+				systray.SetTooltip("lunartlk: " + res.err.Error())
+			}
+			if res.resp == nil || res.resp.Text == "" {
+				continue
+			}
+			lastText = res.resp.Text
+			last.SetTitle(menuLabel(lastText))
+			last.Enable()
+			fmt.Println(lastText)
+			if clipItem.Checked() {
+				copyToClipboard(lastText)
+			}
+
+		case <-last.ClickedCh:
+			copyToClipboard(lastText)
+
+		case i := <-engineClicks:
+			for j, item := range engineItems {
+				if j == i {
+					item.Check()
+				} else {
+					item.Uncheck()
+				}
+			}
+			tc = newClient(trayEngines[i].name)
+
+		case <-clipItem.ClickedCh:
+			if clipItem.Checked() {
+				clipItem.Uncheck()
+			} else {
+				clipItem.Check()
+			}
+
+		case <-quit.ClickedCh:
+			if recording {
+				rec.Stop()
+			}
+			systray.Quit()
+			return
+		}
+	}
+}
+
+// menuLabel shortens a transcript to fit in a menu entry.
+func menuLabel(text string) string {
+	r := []rune(text)
+	if len(r) > 40 {
+		return string(r[:40]) + "..."
+	}
+	return text
+}
+
+// trayIcon draws a filled circle of the given color as a 32x32 PNG.
+func trayIcon(c color.RGBA) []byte {
+	const size = 32
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := range size {
+		for x := range size {
+			dx, dy := x-size/2, y-size/2
+			if dx*dx+dy*dy <= (size/2-2)*(size/2-2) {
+				img.Set(x, y, c)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
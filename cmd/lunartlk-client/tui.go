@@ -0,0 +1,486 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/client"
+	"github.com/rubiojr/lunartlk/internal/audio"
+	"github.com/rubiojr/lunartlk/internal/cli"
+	"github.com/rubiojr/lunartlk/translate"
+)
+
+const (
+	levelWidth     = 40
+	historyEntries = 5
+)
+
+type tuiState int
+
+const (
+	tuiIdle tuiState = iota
+	tuiRecording
+	tuiTranscribing
+)
+
+type (
+	tickMsg        time.Time
+	transcribedMsg struct {
+		resp *api.TranscriptResponse
+		err  error
+	}
+	translatedMsg struct {
+		text string
+		err  error
+	}
+	copiedMsg  struct{ err error }
+	partialMsg struct {
+		p  client.Partial
+		ch <-chan client.Partial
+	}
+	deviceMsg client.RecorderEvent
+)
+
+type historyEntry struct {
+	id   string
+	text string
+}
+
+type tuiModel struct {
+	rec         *client.Recorder
+	tc          *client.Client
+	translator  translate.Translator
+	translateTo string
+	save        bool
+
+	// live is the stream of the recording going on, which the
+	// recorder's capture goroutine feeds.
+	live *atomic.Pointer[liveStream]
+	// partials are those of the last recording, and partial their text.
+	partials <-chan client.Partial
+	partial  string
+
+	state      tuiState
+	start      time.Time
+	elapsed    time.Duration
+	level      float32
+	last       *api.TranscriptResponse
+	translated string
+	status     string
+	history    []historyEntry
+}
+
+func tuiCommand() *cli.Command {
+	fs := flag.NewFlagSet("tui", flag.ExitOnError)
+	server := fs.String("server", "http://localhost:9765", "transcription server URL")
+	token := fs.String("token", "", "Bearer token for server authentication")
+	lang := fs.String("lang", "", "language for transcription (en, es)")
+	engineFlag := fs.String("engine", "", "transcription engine (moonshine, parakeet)")
+	source := fs.String("source", "", "audio source: empty for the default mic, \"monitor\" for the system audio, or a PulseAudio/PipeWire source name")
+	noSave := fs.Bool("no-save", false, "don't save transcripts to disk")
+	translateTo := fs.String("translate", "", "language to translate to with 't' (e.g. English, Spanish)")
+	ollamaModel := fs.String("ollama-model", "lfm2", "Ollama model for translation")
+	ollamaHost := fs.String("ollama-host", "", "Ollama server URL (default: $OLLAMA_HOST or http://localhost:11434)")
+
+	return &cli.Command{
+		Name:     "tui",
+		Short:    "interactive terminal session",
+		Flags:    fs,
+		Complete: serverCompletions(server),
+		Run: func([]string) {
+			recOpts, err := sourceOptions(*source)
+			if err != nil {
+				log.Fatalf("Audio source: %v", err)
+			}
+			// Device events are passed on by a goroutine: the capture
+			// goroutine sends them, and Stop waits for it from Update
+			devices := make(chan client.RecorderEvent, 16)
+			recOpts = append(recOpts, client.WithEvents(func(e client.RecorderEvent) {
+				select {
+				case devices <- e:
+				default:
+				}
+			}))
+			var live atomic.Pointer[liveStream]
+			recOpts = append(recOpts, client.WithOnSamples(func(chunk []float32) {
+				if ls := live.Load(); ls != nil {
+					ls.write(chunk)
+				}
+			}))
+			rec, err := client.NewRecorder(sampleRate, 1024, recOpts...)
+			if err != nil {
+				log.Fatalf("Recorder init failed: %v", err)
+			}
+			defer rec.Close()
+
+			m := &tuiModel{
+				rec:         rec,
+				tc:          newClient(*server, *token, *lang, *engineFlag),
+				live:        &live,
+				translateTo: *translateTo,
+				save:        !*noSave,
+				status:      "Ready",
+			}
+			if *translateTo != "" {
+				trOpts := []translate.OllamaOption{translate.WithModel(*ollamaModel)}
+				if *ollamaHost != "" {
+					trOpts = append(trOpts, translate.WithHost(*ollamaHost))
+				}
+				m.translator = translate.NewOllama(trOpts...)
+			}
+			m.loadHistory()
+
+			p := tea.NewProgram(m, tea.WithAltScreen())
+			go func() {
+				for e := range devices {
+					p.Send(deviceMsg(e))
+				}
+			}()
+			if _, err := p.Run(); err != nil {
+				log.Fatalf("TUI: %v", err)
+			}
+			if m.state == tuiRecording {
+				rec.Stop()
+			}
+		},
+	}
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "q", "ctrl+c":
+			return m, tea.Quit
+		case " ", "enter":
+			switch m.state {
+			case tuiIdle:
+				ls := startLive(m.tc)
+				m.live.Store(ls)
+				if err := m.rec.Start(); err != nil {
+					m.live.Store(nil)
+					ls.close()
+					ls.cancel()
+					m.status = "⚠  " + err.Error()
+					return m, nil
+				}
+				m.state = tuiRecording
+				m.start = time.Now()
+				m.elapsed = 0
+				m.status = "Recording"
+				m.partials, m.partial = ls.partials, ""
+				return m, tea.Batch(tick(), waitPartial(ls.partials))
+			case tuiRecording:
+				samples := m.rec.Stop()
+				ls := m.live.Swap(nil)
+				ls.close()
+				m.state = tuiTranscribing
+				m.level = 0
+				m.status = "Transcribing"
+				return m, m.finish(ls, samples)
+			}
+		case "c":
+			if text := m.output(); text != "" {
+				return m, copyCmd(text)
+			}
+		case "t":
+			if m.translator == nil {
+				m.status = "Start with -translate <language> to enable translation"
+				return m, nil
+			}
+			if m.last != nil && m.last.Text != "" && m.state == tuiIdle {
+				m.status = "Translating to " + m.translateTo
+				return m, m.translate(m.last.Text)
+			}
+		}
+
+	case tickMsg:
+		if m.state != tuiRecording {
+			return m, nil
+		}
+		m.elapsed = time.Since(m.start)
+		m.level = m.rec.Level()
+		return m, tick()
+
+	case partialMsg:
+		if msg.ch == m.partials && msg.p.Text != "" {
+			m.partial = strings.TrimSpace(m.partial + " " + msg.p.Text)
+		}
+		return m, waitPartial(msg.ch)
+
+	case transcribedMsg:
+		m.state = tuiIdle
+		m.partial = ""
+		if msg.err != nil {
+			m.status = "⚠  " + msg.err.Error()
+			return m, nil
+		}
+		m.last = msg.resp
+		m.translated = ""
+		m.status = fmt.Sprintf("Done: %s, %.1fs audio, %dms", msg.resp.Engine, msg.resp.AudioDuration, msg.resp.ProcessingMs)
+		if msg.resp.Text == "" {
+			m.status = "No speech detected"
+		}
+		m.loadHistory()
+
+	case translatedMsg:
+		if msg.err != nil {
+			m.status = "⚠  Translation failed: " + msg.err.Error()
+			return m, nil
+		}
+		m.translated = msg.text
+		m.status = "Translated to " + m.translateTo
+
+	case deviceMsg:
+		switch msg.Type {
+		case client.DeviceLost:
+			m.status = "⚠  Audio device lost, waiting for it: " + msg.Err.Error()
+		case client.DeviceChanged:
+			m.status = "Switching to the new default audio device"
+		case client.DeviceReopened:
+			m.status = "Audio device back, recording"
+		}
+
+	case copiedMsg:
+		if msg.err != nil {
+			m.status = "⚠  wl-copy failed: " + msg.err.Error()
+		} else {
+			m.status = "📋 Copied to clipboard"
+		}
+	}
+	return m, nil
+}
+
+func (m *tuiModel) View() string {
+	var b strings.Builder
+
+	b.WriteString("lunartlk  ")
+	switch m.state {
+	case tuiIdle:
+		b.WriteString("⏹  idle")
+	case tuiRecording:
+		b.WriteString("🎙  recording")
+	case tuiTranscribing:
+		b.WriteString("📡 transcribing")
+	}
+	fmt.Fprintf(&b, "  %s\n\n", m.elapsed.Truncate(100*time.Millisecond))
+	b.WriteString(levelBar(m.level) + "\n\n")
+
+	if m.partial != "" {
+		fmt.Fprintf(&b, "Live\n%s\n\n", m.partial)
+	} else if m.last != nil && m.last.Text != "" {
+		fmt.Fprintf(&b, "Transcript [%s, lang=%s]\n%s\n\n", m.last.Engine, m.last.Lang, m.last.Text)
+	}
+	if m.translated != "" {
+		fmt.Fprintf(&b, "Translation [%s]\n%s\n\n", m.translateTo, m.translated)
+	}
+
+	if len(m.history) > 0 {
+		b.WriteString("Recent\n")
+		for _, h := range m.history {
+			fmt.Fprintf(&b, "  %s  %s\n", h.id, h.text)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString(m.status + "\n\n")
+	b.WriteString("space start/stop · c copy · t translate · q quit\n")
+	return b.String()
+}
+
+// output returns the translation if there is one, otherwise the transcript.
+func (m *tuiModel) output() string {
+	if m.translated != "" {
+		return m.translated
+	}
+	if m.last != nil {
+		return m.last.Text
+	}
+	return ""
+}
+
+func (m *tuiModel) loadHistory() {
+	ids, err := historyIDs()
+	if err != nil {
+		return
+	}
+	m.history = m.history[:0]
+	for _, id := range ids[:min(len(ids), historyEntries)] {
+		resp, err := loadTranscript(id, "")
+		if err != nil {
+			continue
+		}
+		text := resp.Text
+		if len(text) > 60 {
+			text = text[:60] + "..."
+		}
+		m.history = append(m.history, historyEntry{id: id, text: text})
+	}
+}
+
+// finish returns the transcript of a recording: the final one of its
+// live stream, or, when the stream failed or couldn't keep up, that of
+// the whole recording sent now.
+func (m *tuiModel) finish(ls *liveStream, samples []float32) tea.Cmd {
+	return func() tea.Msg {
+		defer ls.cancel()
+		if !ls.isBehind() {
+			res := <-ls.result
+			if res.err == nil {
+				if m.save && res.resp.Text != "" {
+					client.NormalizeAudio(samples)
+					enc, err := encodeRecording(samples)
+					if err == nil {
+						err = saveRecording(res.resp, enc)
+					}
+					res.err = err
+				}
+				return res
+			}
+		}
+		// The live request may still be going
+		ls.cancel()
+		resp, err := transcribeRecording(m.tc, samples, m.save)
+		return transcribedMsg{resp: resp, err: err}
+	}
+}
+
+// waitPartial returns the next partial transcript of a live stream.
+func waitPartial(ch <-chan client.Partial) tea.Cmd {
+	return func() tea.Msg {
+		p, ok := <-ch
+		if !ok {
+			return nil
+		}
+		return partialMsg{p: p, ch: ch}
+	}
+}
+
+// liveStream sends a recording to the server as a WAV stream while it's
+// captured, so the transcript of each phrase shows up before the
+// recording ends.
+type liveStream struct {
+	mu     sync.Mutex
+	chunks chan []float32
+	closed bool
+	// behind is set when the upload can't keep up with the recording,
+	// which is then sent whole once it stops.
+	behind bool
+
+	partials chan client.Partial
+	result   chan transcribedMsg
+	cancel   context.CancelFunc
+}
+
+func startLive(tc *client.Client) *liveStream {
+	ctx, cancel := context.WithCancel(context.Background())
+	ls := &liveStream{
+		chunks:   make(chan []float32, 256),
+		partials: make(chan client.Partial, 64),
+		result:   make(chan transcribedMsg, 1),
+		cancel:   cancel,
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		wav := audio.NewWAVWriter(pw, sampleRate)
+		var err error
+		for chunk := range ls.chunks {
+			if err == nil {
+				err = wav.Write(chunk)
+			}
+		}
+		if err == nil {
+			err = wav.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	go func() {
+		resp, err := tc.TranscribeWithPartials(ctx, pr, func(p client.Partial) {
+			// Partials are only shown, so a slow screen drops them
+			select {
+			case ls.partials <- p:
+			default:
+			}
+		})
+		// Stops the writer when the request ended early
+		pr.CloseWithError(io.ErrClosedPipe)
+		close(ls.partials)
+		ls.result <- transcribedMsg{resp: resp, err: err}
+	}()
+	return ls
+}
+
+// write queues a chunk of the recording, from the capture goroutine.
+func (ls *liveStream) write(chunk []float32) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.closed || ls.behind {
+		return
+	}
+	select {
+	case ls.chunks <- slices.Clone(chunk):
+	default:
+		ls.behind = true
+	}
+}
+
+// close ends the audio once the recording stops.
+func (ls *liveStream) close() {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if !ls.closed {
+		ls.closed = true
+		close(ls.chunks)
+	}
+}
+
+func (ls *liveStream) isBehind() bool {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	return ls.behind
+}
+
+func (m *tuiModel) translate(text string) tea.Cmd {
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		translated, err := m.translator.Translate(ctx, text, m.translateTo)
+		return translatedMsg{text: translated, err: err}
+	}
+}
+
+func copyCmd(text string) tea.Cmd {
+	return func() tea.Msg {
+		cmd := exec.Command("wl-copy")
+		cmd.Stdin = strings.NewReader(text)
+		return copiedMsg{err: cmd.Run()}
+	}
+}
+
+func tick() tea.Cmd {
+	return tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg { return tickMsg(t) })
+}
+
+// levelBar renders a peak level as a bar. The square root spreads quiet
+// speech over more of the bar.
+func levelBar(level float32) string {
+	n := int(math.Sqrt(float64(min(level, 1))) * levelWidth)
+	return "[" + strings.Repeat("█", n) + strings.Repeat("░", levelWidth-n) + "]"
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/cli"
+	"github.com/rubiojr/lunartlk/internal/engine"
+	"github.com/rubiojr/lunartlk/internal/postproc"
+	"github.com/rubiojr/lunartlk/internal/textdiff"
+)
+
+// durationTolerance is how far the duration the server reports may be from
+// the clip's. Decoding that skips or repeats chunks shows up here even when
+// the words survive.
+const durationTolerance = 0.1
+
+// accuracyClip is a recording of a corpus with its reference transcript.
+type accuracyClip struct {
+	lang, path, reference string
+	seconds               float64
+}
+
+// accuracyCommand runs a corpus of clips with reference transcripts through
+// the /transcribe handler with each engine, and fails when an engine's word
+// error rate is above -max-wer.
+func accuracyCommand() *cli.Command {
+	fs := flag.NewFlagSet("accuracy", flag.ExitOnError)
+	engines := fs.String("engines", "moonshine,parakeet", "comma-separated engines to check")
+	maxWER := fs.Float64("max-wer", 0.2, "highest word error rate an engine may have over the corpus")
+	cacheDir := fs.String("cache", "", "cache directory for models (default: ~/.cache/lunartlk)")
+	ortLib := fs.String("ort", "", "ONNX Runtime library path (default: auto-detect)")
+
+	return &cli.Command{
+		Name:  "accuracy",
+		Short: "check the word error rate of each engine against a corpus",
+		Args:  "<corpus-dir>",
+		Long: "The corpus has a directory per language code, with .wav or .opus clips " +
+			"and, next to each, a .txt file with what is said in it.",
+		Flags: fs,
+		Complete: map[string]func() []string{
+			"engines": func() []string { return []string{"moonshine", "parakeet"} },
+		},
+		Run: func(args []string) {
+			if len(args) != 1 {
+				log.Fatal("usage: lunartlk-server accuracy [-engines list] [-max-wer rate] <corpus-dir>")
+			}
+			clips, err := loadCorpus(args[0])
+			if err != nil {
+				log.Fatalf("corpus: %v", err)
+			}
+			if len(clips) == 0 {
+				log.Fatalf("corpus: no clips with a reference transcript in %s", args[0])
+			}
+			srv, cleanup, err := accuracyServer(modelCacheDir(*cacheDir), *ortLib)
+			if err != nil {
+				log.Fatal(err)
+			}
+			results, err := checkAccuracy(os.Stdout, srv, clips, strings.Split(*engines, ","), *maxWER)
+			cleanup()
+			if err != nil {
+				log.Fatal(err)
+			}
+			for _, r := range results {
+				if r.failed {
+					os.Exit(1)
+				}
+			}
+		},
+	}
+}
+
+// accuracyResult is how an engine did over the clips in its languages.
+type accuracyResult struct {
+	engine string
+	// wer is the word error rate over words, the words of the references.
+	wer, words float64
+	// failed is set when wer is above the limit, or the duration reported
+	// for a clip is off.
+	failed bool
+}
+
+// checkAccuracy runs the clips through each engine, writing a line per
+// clip and the WER of each engine to w. Engines with no clips in their
+// languages are left out of the results.
+func checkAccuracy(w io.Writer, srv *serverInfo, clips []accuracyClip, engines []string, maxWER float64) ([]accuracyResult, error) {
+	var results []accuracyResult
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ENGINE\tLANG\tFILE\tAUDIO\tREPORTED\tWER")
+	for _, name := range engines {
+		r := accuracyResult{engine: strings.TrimSpace(name)}
+		var errs float64
+		for _, c := range clips {
+			if !srv.engines.Has(r.engine, c.lang) {
+				continue
+			}
+			resp, err := accuracyTranscribe(srv, r.engine, c)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", r.engine, c.path, err)
+			}
+			wer := textdiff.WER(c.reference, resp.Text)
+			n := float64(len(strings.Fields(c.reference)))
+			errs += wer * n
+			r.words += n
+			mark := ""
+			if math.Abs(resp.AudioDuration-c.seconds) > durationTolerance {
+				mark = "  duration mismatch"
+				r.failed = true
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%.2fs\t%.2fs\t%.1f%%%s\n",
+				r.engine, c.lang, filepath.Base(c.path), c.seconds, resp.AudioDuration, wer*100, mark)
+		}
+		tw.Flush()
+		if r.words == 0 {
+			fmt.Fprintf(w, "%s: no clips in its languages\n\n", r.engine)
+			continue
+		}
+		r.wer = errs / r.words
+		result := "ok"
+		if r.wer > maxWER {
+			result = fmt.Sprintf("FAIL, above %.1f%%", maxWER*100)
+			r.failed = true
+		}
+		fmt.Fprintf(w, "%s: WER %.1f%% over %.0f words (%s)\n\n", r.engine, r.wer*100, r.words, result)
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// loadCorpus reads the clips of a corpus directory, <lang>/<name>.wav or
+// .opus with the reference in <lang>/<name>.txt. Clips without a
+// reference are skipped.
+func loadCorpus(dir string) ([]accuracyClip, error) {
+	var clips []accuracyClip
+	for _, pattern := range []string{"*/*.wav", "*/*.opus"} {
+		paths, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			ref, err := os.ReadFile(strings.TrimSuffix(path, filepath.Ext(path)) + ".txt")
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			samples, rate, err := decodeAudio(path, data)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			clips = append(clips, accuracyClip{
+				lang:      filepath.Base(filepath.Dir(path)),
+				path:      path,
+				reference: strings.TrimSpace(string(ref)),
+				seconds:   float64(len(samples)) / float64(rate),
+			})
+		}
+	}
+	slices.SortFunc(clips, func(a, b accuracyClip) int { return strings.Compare(a.path, b.path) })
+	return clips, nil
+}
+
+// accuracyServer returns a server with the engines registered as the
+// server command would, keeping its usage in a temporary directory that
+// cleanup removes.
+func accuracyServer(cache, ortLib string) (*serverInfo, func(), error) {
+	tmp, err := os.MkdirTemp("", "lunartlk-accuracy-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	usage, err := newUsageTracker(filepath.Join(tmp, "usage.json"))
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	srv := &serverInfo{
+		engines:     engine.NewRegistry[transcriber](engine.Hooks{}),
+		defaultLang: "en",
+		defaultEng:  "parakeet",
+		usage:       usage,
+		maxUpload:   1 << 30,
+		streamChunk: 30 * time.Second,
+		redactor:    postproc.NewRedact(""),
+	}
+
+	for _, langCode := range slices.Sorted(maps.Keys(moonshineModels)) {
+		modelName := moonshineModels[langCode]
+		spec := engine.Spec{Engine: "moonshine", Model: modelName, Langs: []string{langCode}}
+		if err := srv.engines.Register(spec, &lazyMoonshine{modelName: modelName, cacheDir: cache, pad: defaultPadding["moonshine"]}); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+	}
+	if ortPath := findORT(ortLib, cache); ortPath != "" {
+		spec := engine.Spec{Engine: "parakeet", Model: "parakeet-tdt-0.6b-v3", Langs: parakeetLangs, Multilingual: true}
+		if err := srv.engines.Register(spec, &lazyParakeet{cacheDir: cache, ortPath: ortPath, pad: defaultPadding["parakeet"]}); err != nil {
+			cleanup()
+			return nil, nil, err
+		}
+	} else {
+		log.Printf("[parakeet] No ONNX Runtime found, skipping (use -ort)")
+	}
+	srv.ready.Store(true)
+	return srv, cleanup, nil
+}
+
+// accuracyTranscribe uploads a clip to the /transcribe handler, the way a
+// client would.
+func accuracyTranscribe(srv *serverInfo, engineName string, c accuracyClip) (*api.TranscriptResponse, error) {
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("audio", filepath.Base(c.path))
+	if err != nil {
+		return nil, err
+	}
+	part.Write(data)
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/transcribe?engine="+engineName+"&lang="+c.lang, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rec := httptest.NewRecorder()
+	handleTranscribe(rec, req, srv)
+	if rec.Code != http.StatusOK {
+		return nil, fmt.Errorf("%d: %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+	var resp api.TranscriptResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &resp, nil
+}
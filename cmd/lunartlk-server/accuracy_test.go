@@ -0,0 +1,51 @@
+//go:build accuracy
+
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// TestAccuracy runs testdata/corpus through the /transcribe handler with
+// both engines, downloading their models on first use:
+//
+//	go test -tags accuracy -run TestAccuracy ./cmd/lunartlk-server/
+func TestAccuracy(t *testing.T) {
+	clips, err := loadCorpus("../../testdata/corpus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(clips) == 0 {
+		t.Skip("no clips with a reference transcript in testdata/corpus")
+	}
+	srv, cleanup, err := accuracyServer(modelCacheDir(""), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	engines := []string{"moonshine", "parakeet"}
+	var out strings.Builder
+	results, err := checkAccuracy(&out, srv, clips, engines, 0.2)
+	t.Log("\n" + out.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked := map[string]bool{}
+	for _, r := range results {
+		checked[r.engine] = true
+		if r.failed {
+			t.Errorf("%s: WER %.1f%% over %.0f words, or a duration mismatch", r.engine, r.wer*100, r.words)
+		}
+	}
+	for _, name := range engines {
+		switch {
+		case !slices.Contains(srv.engines.Engines(), name):
+			t.Logf("%s: not available, skipped", name)
+		case !checked[name]:
+			t.Errorf("%s: no clips in its languages", name)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/align"
+	"github.com/rubiojr/lunartlk/internal/parakeet"
+)
+
+// wordTranscriber is implemented by engines that report word timings.
+type wordTranscriber interface {
+	TranscribeWords(ctx context.Context, samples []float32) ([]parakeet.Word, error)
+}
+
+// alignResponse is returned by POST /align.
+type alignResponse struct {
+	Text          string       `json:"text"`
+	Words         []align.Word `json:"words"`
+	Recognized    string       `json:"recognized"`
+	AudioDuration float64      `json:"audio_duration"`
+	ProcessingMs  int64        `json:"processing_ms"`
+}
+
+// handleAlign returns word timings for a transcript of the uploaded audio,
+// e.g. a manually edited one. The audio is transcribed with Parakeet and
+// the transcript's words take the timings of the matching recognized
+// words.
+func handleAlign(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	u, ok := srv.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if srv.shed(w) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, srv.maxUpload)
+	if !srv.decompressBody(w, r) {
+		return
+	}
+
+	e, err := srv.engines.Lookup("parakeet", "", "")
+	wt, ok := e.Engine.(wordTranscriber)
+	if err != nil || !ok {
+		http.Error(w, "alignment needs the parakeet engine, which is not loaded", http.StatusBadRequest)
+		return
+	}
+	prio, err := srv.requestPriority(r, u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	up, ok := srv.readUpload(w, r)
+	if !ok {
+		return
+	}
+	text := strings.TrimSpace(r.FormValue("text"))
+	if text == "" {
+		http.Error(w, "missing 'text' field", http.StatusBadRequest)
+		return
+	}
+	if err := srv.checkQuota(u, up.duration()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	release, ok := srv.enter(w, r, u)
+	if !ok {
+		return
+	}
+	defer release()
+
+	ctx, cancel := srv.requestContext(r, prio)
+	defer cancel()
+
+	start := time.Now()
+	recognized, err := wt.TranscribeWords(ctx, up.samples)
+	if err != nil {
+		srv.auditRequest(r, u, "parakeet", "", "", up, nil, err)
+		transcriptionError(w, r, err)
+		return
+	}
+
+	words := make([]align.Word, len(recognized))
+	texts := make([]string, len(recognized))
+	for i, rw := range recognized {
+		words[i] = align.Word{Text: rw.Text, Start: rw.Start, End: rw.End}
+		texts[i] = rw.Text
+	}
+	resp := &alignResponse{
+		Text:          text,
+		Words:         align.Words(text, words, up.duration()),
+		Recognized:    strings.Join(texts, " "),
+		AudioDuration: math.Round(up.duration()*1000) / 1000,
+		ProcessingMs:  time.Since(start).Milliseconds(),
+	}
+	for i := range resp.Words {
+		resp.Words[i].Start = math.Round(resp.Words[i].Start*1000) / 1000
+		resp.Words[i].End = math.Round(resp.Words[i].End*1000) / 1000
+	}
+
+	name := ""
+	if u != nil {
+		name = u.Name
+	}
+	srv.usage.Record(name, "parakeet", resp.AudioDuration, resp.ProcessingMs)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+
+	srv.auditRequest(r, u, "parakeet", "", "", up, &api.TranscriptResponse{Text: resp.Recognized, AudioDuration: resp.AudioDuration}, nil)
+	log.Printf("%s align words=%d audio=%.1fs proc=%dms", r.RemoteAddr, len(resp.Words), resp.AudioDuration, resp.ProcessingMs)
+}
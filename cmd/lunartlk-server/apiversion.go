@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/rubiojr/lunartlk/api"
+)
+
+// apiVersion returns the schema version to answer r in: the one asked for
+// with the Lunartlk-Api-Version header, or the latest. Clients newer than
+// the server get its latest, and find out from the response header.
+func apiVersion(r *http.Request) (int, error) {
+	h := r.Header.Get(api.VersionHeader)
+	if h == "" {
+		return api.Version, nil
+	}
+	v, err := strconv.Atoi(h)
+	if err != nil || v < 1 {
+		return 0, fmt.Errorf("invalid %s %q", api.VersionHeader, h)
+	}
+	if v < api.MinVersion {
+		return 0, fmt.Errorf("API version %d is no longer supported, this server answers in versions %d to %d", v, api.MinVersion, api.Version)
+	}
+	return min(v, api.Version), nil
+}
+
+// apiVersions returns the schema versions the server can answer in.
+func apiVersions() []int {
+	var vs []int
+	for v := api.MinVersion; v <= api.Version; v++ {
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+// versioned tells clients the schema version responses are in, and
+// rejects requests for versions the server no longer answers in.
+func versioned(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, err := apiVersion(r)
+		if err != nil {
+			jsonError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set(api.VersionHeader, strconv.Itoa(v))
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/audit"
+)
+
+// auditRequest records a transcription in the -audit-log: resp when it
+// succeeded, err when it failed. r is nil for the files of the -watch
+// directory, logged with the path "watch".
+func (srv *serverInfo) auditRequest(r *http.Request, u *user, engineName, model, langCode string, up *upload, resp *api.TranscriptResponse, err error) {
+	if srv.auditLog == nil {
+		return
+	}
+	e := audit.Entry{
+		Path:          "watch",
+		UploadBytes:   len(up.data),
+		AudioDuration: up.duration(),
+		Engine:        engineName,
+		Model:         model,
+		Lang:          langCode,
+	}
+	if u != nil {
+		e.User = u.Name
+	}
+	if r != nil {
+		e.ClientIP, e.Path = clientIP(r), r.URL.Path
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			e.TokenID = audit.TokenID(token)
+		}
+	}
+	srv.audit(e, resp, err)
+}
+
+// auditWyoming records the transcription of a Wyoming session in the
+// -audit-log, with the path "wyoming". Wyoming has no users or tokens.
+func (srv *serverInfo) auditWyoming(remote string, s *wyomingSession, resp *api.TranscriptResponse, err error) {
+	if srv.auditLog == nil {
+		return
+	}
+	ip, _, splitErr := net.SplitHostPort(remote)
+	if splitErr != nil {
+		ip = remote
+	}
+	srv.audit(audit.Entry{
+		ClientIP:      ip,
+		Path:          "wyoming",
+		UploadBytes:   int(s.received),
+		AudioDuration: float64(len(s.samples)) / wyomingRate,
+		Engine:        s.engine,
+		Lang:          s.lang,
+	}, resp, err)
+}
+
+// audit completes e with the outcome of a transcription and writes it.
+func (srv *serverInfo) audit(e audit.Entry, resp *api.TranscriptResponse, err error) {
+	e.Time = time.Now().UTC()
+	e.Status = "ok"
+	if err != nil {
+		e.Status, e.Error = "error", err.Error()
+	} else {
+		e.Model = resp.Model
+		e.AudioDuration = resp.AudioDuration
+		e.ResultHash = audit.Hash(resp.Text)
+		e.TranscriptID = resp.ID
+	}
+	if err := srv.auditLog.Write(e); err != nil {
+		log.Printf("audit log: %v", err)
+	}
+}
+
+// clientIP returns the address a request came from, without the port.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
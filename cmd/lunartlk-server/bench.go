@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/cli"
+)
+
+// benchCommand transcribes audio files with each engine and reports
+// latency, where the median run spent it, real-time factor and memory use.
+func benchCommand() *cli.Command {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	runs := fs.Int("n", 3, "timed runs per engine and file, after a warm-up run")
+	engines := fs.String("engines", "moonshine,parakeet", "comma-separated engines to benchmark")
+	lang := fs.String("lang", "es", "language (en, es)")
+	cacheDir := fs.String("cache", "", "cache directory for models (default: ~/.cache/lunartlk)")
+	ortLib := fs.String("ort", "", "ONNX Runtime library path (default: auto-detect)")
+
+	return &cli.Command{
+		Name:  "bench",
+		Short: "measure transcription latency, real-time factor and memory",
+		Args:  "<audio.wav|audio.opus>...",
+		Flags: fs,
+		Complete: map[string]func() []string{
+			"engines": func() []string { return []string{"moonshine", "parakeet"} },
+			"lang":    func() []string { return parakeetLangs },
+		},
+		Run: func(files []string) {
+			if len(files) == 0 {
+				log.Fatal("usage: lunartlk-server bench [-n runs] [-engines list] <audio.wav|audio.opus>...")
+			}
+			if *runs < 1 {
+				log.Fatal("-n must be at least 1")
+			}
+			cache := modelCacheDir(*cacheDir)
+
+			tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(tw, "ENGINE\tFILE\tAUDIO\tLOAD\tMIN\tMEDIAN\tMAX\tPREPROCESS\tENCODER\tSEARCH\tRTF\tRSS")
+			for _, name := range strings.Split(*engines, ",") {
+				name = strings.TrimSpace(name)
+				t, err := benchTranscriber(name, *lang, cache, *ortLib)
+				if err != nil {
+					log.Fatalf("%s: %v", name, err)
+				}
+				for i, file := range files {
+					res, err := benchFile(t, file, *lang, *runs)
+					if err != nil {
+						log.Fatalf("%s: %s: %v", name, file, err)
+					}
+					load := ""
+					if i == 0 {
+						// The warm-up run of the first file loads the model
+						load = res.warmup.Round(time.Millisecond).String()
+					}
+					tm := res.runs[len(res.runs)/2].timings
+					fmt.Fprintf(tw, "%s\t%s\t%.1fs\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%.3f\t%s\n",
+						name, filepath.Base(file), res.audioSeconds, load,
+						res.min().Round(time.Millisecond), res.median().Round(time.Millisecond), res.max().Round(time.Millisecond),
+						stageTime(tm.PreprocessMs), stageTime(tm.EncoderMs), stageTime(tm.SearchMs),
+						res.median().Seconds()/res.audioSeconds, formatMiB(residentBytes()))
+				}
+				tw.Flush()
+			}
+
+			var ms runtime.MemStats
+			runtime.ReadMemStats(&ms)
+			fmt.Printf("\nPeak RSS %s, Go heap %s (models run in native memory outside the Go heap)\n",
+				formatMiB(peakResidentBytes()), formatMiB(ms.HeapAlloc))
+		},
+	}
+}
+
+// benchTranscriber returns an engine as the server would load it.
+func benchTranscriber(name, lang, cache, ortLib string) (transcriber, error) {
+	switch name {
+	case "moonshine":
+		modelName, ok := moonshineModels[lang]
+		if !ok {
+			return nil, fmt.Errorf("no moonshine model for language %q", lang)
+		}
+		return &lazyMoonshine{modelName: modelName, cacheDir: cache, pad: defaultPadding["moonshine"]}, nil
+	case "parakeet":
+		ortPath := findORT(ortLib, cache)
+		if ortPath == "" {
+			return nil, fmt.Errorf("no ONNX Runtime found, use -ort")
+		}
+		return &lazyParakeet{cacheDir: cache, ortPath: ortPath, pad: defaultPadding["parakeet"]}, nil
+	}
+	return nil, fmt.Errorf("unknown engine %q", name)
+}
+
+type benchResult struct {
+	audioSeconds float64
+	warmup       time.Duration
+	runs         []benchRun // sorted by duration
+}
+
+type benchRun struct {
+	duration time.Duration
+	timings  api.Timings
+}
+
+func (b *benchResult) min() time.Duration    { return b.runs[0].duration }
+func (b *benchResult) max() time.Duration    { return b.runs[len(b.runs)-1].duration }
+func (b *benchResult) median() time.Duration { return b.runs[len(b.runs)/2].duration }
+
+// stageTime formats a stage's milliseconds, or "-" for stages the engine
+// doesn't report.
+func stageTime(ms int64) string {
+	if ms == 0 {
+		return "-"
+	}
+	return (time.Duration(ms) * time.Millisecond).String()
+}
+
+// benchFile transcribes a file once to warm up, then runs times.
+func benchFile(t transcriber, path, lang string, runs int) (*benchResult, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	samples, sampleRate, err := decodeAudio(path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &benchResult{audioSeconds: float64(len(samples)) / float64(sampleRate)}
+	for i := 0; i <= runs; i++ {
+		start := time.Now()
+		resp, err := runTranscriber(context.Background(), t, samples, sampleRate, lang)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			res.warmup = time.Since(start)
+		} else {
+			res.runs = append(res.runs, benchRun{duration: time.Since(start), timings: *resp.Timings})
+		}
+	}
+	slices.SortFunc(res.runs, func(a, b benchRun) int { return cmp.Compare(a.duration, b.duration) })
+	return res, nil
+}
+
+// residentBytes returns the process's current resident set size.
+func residentBytes() uint64 { return procStatus("VmRSS") }
+
+// peakResidentBytes returns the process's peak resident set size.
+func peakResidentBytes() uint64 { return procStatus("VmHWM") }
+
+// procStatus reads a kB field from /proc/self/status, or 0 when it's
+// unavailable.
+func procStatus(field string) uint64 {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		value, ok := strings.CutPrefix(scanner.Text(), field+":")
+		if !ok {
+			continue
+		}
+		var kb uint64
+		fmt.Sscanf(strings.TrimSpace(value), "%d kB", &kb)
+		return kb * 1024
+	}
+	return 0
+}
+
+func formatMiB(b uint64) string {
+	if b == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.0fMiB", math.Round(float64(b)/(1<<20)))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"math"
+	"sync"
+
+	"github.com/rubiojr/lunartlk/api"
+)
+
+// responseCache is a fixed-size LRU of transcription results keyed by a hash
+// of the decoded audio and the parameters that affect inference.
+type responseCache struct {
+	max   int
+	mu    sync.Mutex
+	order *list.List // front = most recently used
+	items map[[32]byte]*list.Element
+}
+
+type cacheEntry struct {
+	key  [32]byte
+	resp *api.TranscriptResponse
+}
+
+func newResponseCache(max int) *responseCache {
+	return &responseCache{
+		max:   max,
+		order: list.New(),
+		items: make(map[[32]byte]*list.Element),
+	}
+}
+
+// cacheKey hashes the samples together with the engine, language and rate.
+func cacheKey(engine, lang string, samples []float32, sampleRate int32) [32]byte {
+	h := sha256.New()
+	h.Write([]byte(engine + "\x00" + lang + "\x00"))
+	binary.Write(h, binary.LittleEndian, sampleRate)
+	buf := make([]byte, 4*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint32(buf[i*4:], math.Float32bits(s))
+	}
+	h.Write(buf)
+	var key [32]byte
+	copy(key[:], h.Sum(nil))
+	return key
+}
+
+// Get returns a copy of the cached response for key.
+func (c *responseCache) Get(key [32]byte) (*api.TranscriptResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return copyResponse(el.Value.(*cacheEntry).resp), true
+}
+
+// Put stores a copy of resp, evicting the least recently used entry when full.
+func (c *responseCache) Put(key [32]byte, resp *api.TranscriptResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		el.Value.(*cacheEntry).resp = copyResponse(resp)
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&cacheEntry{key: key, resp: copyResponse(resp)})
+	if c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+func copyResponse(resp *api.TranscriptResponse) *api.TranscriptResponse {
+	cp := *resp
+	cp.Lines = append([]api.TranscriptLine(nil), resp.Lines...)
+	if resp.Timings != nil {
+		tm := *resp.Timings
+		cp.Timings = &tm
+	}
+	return &cp
+}
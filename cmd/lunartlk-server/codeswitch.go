@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/postproc"
+)
+
+// minRouteSeconds is the shortest line routed to another engine. Shorter
+// ones are mostly a name or a word, which both engines get about as right.
+const minRouteSeconds = 0.5
+
+// langsParam returns the languages of ?langs=, spoken in a recording that
+// switches between them, or an error naming one that can't be tagged.
+func langsParam(r *http.Request) ([]string, error) {
+	param := r.URL.Query().Get("langs")
+	if param == "" {
+		if r.URL.Query().Get("route") == "true" {
+			return nil, fmt.Errorf("?route=true needs ?langs=, e.g. langs=es,en")
+		}
+		return nil, nil
+	}
+	var langs []string
+	for lang := range strings.SplitSeq(param, ",") {
+		lang = strings.TrimSpace(lang)
+		if !slices.Contains(postproc.TaggedLangs(), lang) {
+			return nil, fmt.Errorf("can't tag language %q (available: %s)", lang, strings.Join(postproc.TaggedLangs(), ", "))
+		}
+		langs = append(langs, lang)
+	}
+	return langs, nil
+}
+
+// tagLines sets the language of resp's lines to the one of ?langs= they're
+// in.
+func tagLines(r *http.Request, langCode string, resp *api.TranscriptResponse) {
+	langs, _ := langsParam(r)
+	if len(langs) == 0 {
+		return
+	}
+	lines := make([]postproc.Line, len(resp.Lines))
+	for i, l := range resp.Lines {
+		lines[i] = postproc.Line(l)
+	}
+	postproc.TagLines(lines, langs, langCode)
+	for i := range resp.Lines {
+		resp.Lines[i].Lang = lines[i].Lang
+	}
+}
+
+// routeLines transcribes again, with the default model for their language,
+// the lines of resp in another language than the request's, for
+// ?route=true. Lines whose language has no model of its own, or whose model
+// is t, keep the text t gave them.
+func (srv *serverInfo) routeLines(ctx context.Context, r *http.Request, t transcriber, langCode string, up *upload, resp *api.TranscriptResponse) error {
+	if r.URL.Query().Get("route") != "true" || len(resp.Lines) == 0 {
+		return nil
+	}
+	tagLines(r, langCode, resp)
+
+	routed := 0
+	for i, l := range resp.Lines {
+		if l.Lang == langCode || l.Duration < minRouteSeconds {
+			continue
+		}
+		engineName, model, err := srv.resolveModel("", "", l.Lang)
+		if err != nil {
+			continue
+		}
+		lt, err := srv.selectTranscriber(engineName, l.Lang, model)
+		if err != nil || lt == t {
+			continue
+		}
+		start := min(int(l.StartTime*float64(up.sampleRate)), len(up.samples))
+		end := min(int((l.StartTime+l.Duration)*float64(up.sampleRate)), len(up.samples))
+		if start == end {
+			continue
+		}
+		out, err := runTranscriber(ctx, lt, up.samples[start:end], up.sampleRate, l.Lang)
+		if err != nil {
+			return fmt.Errorf("%s line at %.1fs: %w", l.Lang, l.StartTime, err)
+		}
+		resp.Lines[i].Text = strings.TrimSpace(out.Text)
+		routed++
+	}
+	if routed == 0 {
+		return nil
+	}
+	var texts []string
+	for _, l := range resp.Lines {
+		if l.Text != "" {
+			texts = append(texts, l.Text)
+		}
+	}
+	resp.Text = strings.Join(texts, " ")
+	if srv.debug {
+		log.Printf("Routed %d of %d lines to other languages' models", routed, len(resp.Lines))
+	}
+	return nil
+}
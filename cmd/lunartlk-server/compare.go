@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"math"
+	"net/http"
+	"path/filepath"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/textdiff"
+)
+
+// compareResponse holds the transcripts of the same audio from every engine
+// available for the requested language.
+type compareResponse struct {
+	AudioDuration float64                   `json:"audio_duration"`
+	Lang          string                    `json:"lang"`
+	Results       []*api.TranscriptResponse `json:"results"`
+	Errors        map[string]string         `json:"errors,omitempty"`
+	// Diff is a word-level diff from the first result to the second.
+	Diff []textdiff.Op `json:"diff,omitempty"`
+}
+
+func handleCompare(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	u, ok := srv.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if srv.shed(w) {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, srv.maxUpload)
+	if !srv.decompressBody(w, r) {
+		return
+	}
+
+	langCode := r.URL.Query().Get("lang")
+	if langCode == "" {
+		langCode = srv.defaultLang
+	}
+	handleCompareUpload(w, r, srv, u, langCode)
+}
+
+// handleCompareUpload runs the uploaded audio through Moonshine and Parakeet
+// one after the other, so timings aren't skewed by running concurrently.
+func handleCompareUpload(w http.ResponseWriter, r *http.Request, srv *serverInfo, u *user, langCode string) {
+	var engines []string
+	for _, name := range []string{"moonshine", "parakeet"} {
+		if srv.engines.Has(name, langCode) {
+			engines = append(engines, name)
+		}
+	}
+	if len(engines) == 0 {
+		http.Error(w, "no engines available for lang '"+langCode+"'", http.StatusBadRequest)
+		return
+	}
+	prio, err := srv.requestPriority(r, u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	up, ok := srv.readUpload(w, r)
+	if !ok {
+		return
+	}
+	// Every engine run counts against the quota
+	if err := srv.checkQuota(u, up.duration()*float64(len(engines))); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	release, ok := srv.enter(w, r, u)
+	if !ok {
+		return
+	}
+	defer release()
+
+	ctx, cancel := srv.requestContext(r, prio)
+	defer cancel()
+
+	cmp := &compareResponse{
+		AudioDuration: math.Round(up.duration()*1000) / 1000,
+		Lang:          langCode,
+	}
+	for _, engineName := range engines {
+		t, err := srv.selectTranscriber(engineName, langCode, "")
+		if err == nil {
+			var resp *api.TranscriptResponse
+			if resp, err = runTranscriber(ctx, t, up.samples, up.sampleRate, langCode); err == nil {
+				if r.URL.Query().Get("timings") == "true" {
+					resp.Timings.DecodeMs = up.decodeTime.Milliseconds()
+				} else {
+					resp.Timings = nil
+				}
+				srv.recordUsage(u, resp)
+				srv.auditRequest(r, u, engineName, "", langCode, up, resp, nil)
+				cmp.Results = append(cmp.Results, resp)
+				continue
+			}
+			srv.auditRequest(r, u, engineName, "", langCode, up, nil, err)
+		}
+		if cmp.Errors == nil {
+			cmp.Errors = make(map[string]string)
+		}
+		cmp.Errors[engineName] = err.Error()
+	}
+	if r.Context().Err() != nil {
+		log.Printf("%s client disconnected, comparison cancelled", r.RemoteAddr)
+		return
+	}
+	if len(cmp.Results) == 2 {
+		cmp.Diff = textdiff.Words(cmp.Results[0].Text, cmp.Results[1].Text)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cmp)
+
+	for _, resp := range cmp.Results {
+		log.Printf("%s compare engine=%s lang=%s fmt=%s audio=%.1fs proc=%dms",
+			r.RemoteAddr, resp.Engine, langCode, filepath.Ext(up.name), resp.AudioDuration, resp.ProcessingMs)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rubiojr/lunartlk/internal/queue"
+)
+
+// errNoSlot is returned by acquire when no transcription slot freed up
+// within -queue-timeout.
+var errNoSlot = errors.New("server busy, no transcription slot freed up")
+
+// acquire waits for one of the -max-concurrent transcription slots, by the
+// priority in ctx, and returns the function giving it back. It fails with
+// queue.ErrQueueFull when -max-queue callers are already waiting, and with
+// errNoSlot when no slot frees up within -queue-timeout. Callers acquire
+// after the audio is read and decoded, so slow uploads don't hold a slot.
+func (srv *serverInfo) acquire(ctx context.Context) (func(), error) {
+	if srv.slots == nil {
+		return func() {}, nil
+	}
+	wait := ctx
+	if srv.queueTimeout > 0 {
+		var cancel context.CancelFunc
+		wait, cancel = context.WithTimeout(ctx, srv.queueTimeout)
+		defer cancel()
+	}
+	err := srv.slots.Acquire(wait)
+	switch {
+	case err == nil:
+		return srv.slots.Release, nil
+	case errors.Is(err, queue.ErrQueueFull), ctx.Err() != nil:
+		return nil, err
+	default:
+		return nil, fmt.Errorf("%w within %s", errNoSlot, srv.queueTimeout)
+	}
+}
+
+// enter acquires a transcription slot for an HTTP request, by the
+// request's priority. Requests are rejected with 429 when the queue is
+// full and with 503 when no slot frees up in time.
+func (srv *serverInfo) enter(w http.ResponseWriter, r *http.Request, u *user) (func(), bool) {
+	// An invalid ?priority= is rejected by the handler
+	prio, _ := srv.requestPriority(r, u)
+	release, err := srv.acquire(queue.WithPriority(r.Context(), prio))
+	switch {
+	case err == nil:
+		return release, true
+	case errors.Is(err, queue.ErrQueueFull):
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "server busy, too many requests queued", http.StatusTooManyRequests)
+	case r.Context().Err() != nil:
+		// The client gave up waiting
+	default:
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	}
+	return nil, false
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+)
+
+const backendPollInterval = 5 * time.Second
+
+// backend is a lunartlk-server the coordinator dispatches requests to.
+type backend struct {
+	url   *url.URL
+	proxy *httputil.ReverseProxy
+	// inFlight counts the requests the coordinator sent and are running.
+	inFlight atomic.Int64
+	// load is the number of requests the backend reported running at the
+	// last poll, including other clients'.
+	load atomic.Int64
+	up   atomic.Bool
+}
+
+// coordinator spreads transcription requests across backend servers,
+// round-robin or to the least loaded one. Backends that are down or
+// shedding load are skipped until a poll finds them healthy again, so
+// extra instances can be kept as warm standbys.
+type coordinator struct {
+	backends    []*backend
+	leastLoaded bool
+	next        atomic.Uint64
+	client      *http.Client
+}
+
+func newCoordinator(urls []string, balance string) (*coordinator, error) {
+	c := &coordinator{client: &http.Client{Timeout: backendPollInterval}}
+	switch balance {
+	case "least-loaded":
+		c.leastLoaded = true
+	case "round-robin":
+	default:
+		return nil, fmt.Errorf("unknown balance strategy %q, use round-robin or least-loaded", balance)
+	}
+	for _, raw := range urls {
+		u, err := url.Parse(strings.TrimSuffix(raw, "/"))
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid backend URL %q", raw)
+		}
+		b := &backend{url: u}
+		b.proxy = httputil.NewSingleHostReverseProxy(u)
+		b.proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			if r.Context().Err() == nil && b.up.Swap(false) {
+				log.Printf("[coordinator] %s is down: %v", u, err)
+			}
+			http.Error(w, "backend unavailable", http.StatusBadGateway)
+		}
+		c.backends = append(c.backends, b)
+	}
+	return c, nil
+}
+
+// watch polls the backends' /metrics until ctx is done, after a first
+// synchronous poll so requests are dispatched right away.
+func (c *coordinator) watch(ctx context.Context) {
+	c.poll(ctx)
+	go func() {
+		ticker := time.NewTicker(backendPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				c.poll(ctx)
+			}
+		}
+	}()
+}
+
+func (c *coordinator) poll(ctx context.Context) {
+	for _, b := range c.backends {
+		load, err := c.fetchLoad(ctx, b)
+		if err != nil {
+			if b.up.Swap(false) {
+				log.Printf("[coordinator] %s is down: %v", b.url, err)
+			}
+			continue
+		}
+		b.load.Store(load)
+		if !b.up.Swap(true) {
+			log.Printf("[coordinator] %s is up", b.url)
+		}
+	}
+}
+
+// fetchLoad returns the number of requests a backend is running. A backend
+// shedding load under memory pressure counts as down.
+func (c *coordinator) fetchLoad(ctx context.Context, b *backend) (int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.url.String()+"/metrics", nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("metrics: %s", resp.Status)
+	}
+
+	var load int64
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		name, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "lunartlk_requests_in_flight":
+			load = n
+		case "lunartlk_memory_shedding":
+			if n != 0 {
+				return 0, fmt.Errorf("shedding load under memory pressure")
+			}
+		}
+	}
+	return load, scanner.Err()
+}
+
+// pick returns the backend for the next request, or nil when none is up.
+func (c *coordinator) pick() *backend {
+	var up []*backend
+	for _, b := range c.backends {
+		if b.up.Load() {
+			up = append(up, b)
+		}
+	}
+	if len(up) == 0 {
+		return nil
+	}
+	if !c.leastLoaded {
+		return up[c.next.Add(1)%uint64(len(up))]
+	}
+
+	// The reported load lags up to a poll interval behind, so requests
+	// dispatched since then count too.
+	var best *backend
+	var bestLoad int64
+	for _, b := range up {
+		load := max(b.load.Load(), b.inFlight.Load())
+		if best == nil || load < bestLoad {
+			best, bestLoad = b, load
+		}
+	}
+	return best
+}
+
+// ServeHTTP forwards the request, Authorization header included, to a
+// backend.
+func (c *coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := c.pick()
+	if b == nil {
+		w.Header().Set("Retry-After", "10")
+		http.Error(w, "no backend available", http.StatusServiceUnavailable)
+		return
+	}
+	b.inFlight.Add(1)
+	defer b.inFlight.Add(-1)
+	// The backend writes the response, so it says which API version
+	// it's in.
+	w.Header().Del(api.VersionHeader)
+	b.proxy.ServeHTTP(w, r)
+}
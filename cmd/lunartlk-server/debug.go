@@ -0,0 +1,47 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	_ "net/http/pprof" // registers /debug/pprof/ on the default mux
+	"runtime"
+	"strings"
+	"time"
+)
+
+var startTime = time.Now()
+
+// guardDebug protects the /debug/ endpoints net/http/pprof and expvar
+// register on the default mux: they are only served with
+// -debug-endpoints, and need the admin token like /admin.
+func (srv *serverInfo) guardDebug(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/debug/") {
+			if !srv.debugEndpoints {
+				http.NotFound(w, r)
+				return
+			}
+			if !srv.authorizeAdmin(w, r) {
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// publishVars adds the server's state to /debug/vars, next to the memory
+// statistics expvar reports by default.
+func (srv *serverInfo) publishVars() {
+	expvar.Publish("lunartlk", expvar.Func(func() any {
+		loaded := make(map[string]bool)
+		for _, e := range srv.engines.Entries() {
+			loaded[e.Spec.Model] = e.Loaded()
+		}
+		return map[string]any{
+			"version":        version,
+			"uptime_seconds": int64(time.Since(startTime).Seconds()),
+			"goroutines":     runtime.NumGoroutine(),
+			"loaded":         loaded,
+		}
+	}))
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// contentEncodings lists the supported Content-Encoding values for uploads.
+var contentEncodings = []string{"gzip", "zstd"}
+
+// decompressBody replaces r.Body with a decompressing reader when the
+// request declares a Content-Encoding. The decompressed body is limited to
+// the same size as uploads, so small compressed bodies can't expand without
+// bound. It writes an error response and returns false on failure.
+func (srv *serverInfo) decompressBody(w http.ResponseWriter, r *http.Request) bool {
+	enc := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	var body io.ReadCloser
+	switch enc {
+	case "", "identity":
+		return true
+	case "gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "gzip: "+err.Error(), http.StatusBadRequest)
+			return false
+		}
+		body = zr
+	case "zstd":
+		zr, err := zstd.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "zstd: "+err.Error(), http.StatusBadRequest)
+			return false
+		}
+		body = zr.IOReadCloser()
+	default:
+		http.Error(w, fmt.Sprintf("unsupported Content-Encoding '%s', use %s", enc, strings.Join(contentEncodings, " or ")),
+			http.StatusUnsupportedMediaType)
+		return false
+	}
+	r.Body = http.MaxBytesReader(w, body, srv.maxUpload)
+	r.Header.Del("Content-Encoding")
+	return true
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/rubiojr/lunartlk/internal/seal"
+)
+
+var errNoEncryptionKey = errors.New("encrypted upload, but the server has no -encryption-key")
+
+// unseal decrypts audio the client encrypted with the shared key, in
+// memory, returning the name and content of the plain audio. Files that
+// aren't encrypted are returned as they are.
+func (srv *serverInfo) unseal(name string, data []byte) (string, []byte, error) {
+	if !seal.IsSealed(name) {
+		return name, data, nil
+	}
+	if srv.encryptionKey == nil {
+		return "", nil, errNoEncryptionKey
+	}
+	plain, err := seal.Open(srv.encryptionKey, data)
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.TrimSuffix(name, seal.Ext), plain, nil
+}
+
+// audioExt returns the extension to store an upload named name with,
+// keeping the format of encrypted audio: .opus.enc.
+func audioExt(name string) string {
+	if seal.IsSealed(name) {
+		return filepath.Ext(strings.TrimSuffix(name, seal.Ext)) + seal.Ext
+	}
+	return filepath.Ext(name)
+}
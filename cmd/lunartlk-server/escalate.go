@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/rubiojr/lunartlk/api"
+)
+
+// escalation transcribes audio again with a more accurate model when a
+// fast one isn't confident of its result.
+type escalation struct {
+	// below is the confidence under which results are escalated.
+	below float64
+	// to is the engine, engine/model or alias escalated to.
+	to string
+}
+
+// runEscalating runs t over samples and, when the result's confidence is
+// under -escalate-below, runs the -escalate-to model too and returns its
+// result instead.
+func (srv *serverInfo) runEscalating(ctx context.Context, t transcriber, samples []float32, sampleRate int32, langCode string) (*api.TranscriptResponse, error) {
+	resp, err := runTranscriber(ctx, t, samples, sampleRate, langCode)
+	if err != nil || srv.escalation == nil || resp.Confidence >= srv.escalation.below {
+		return resp, err
+	}
+
+	engineName, model := srv.escalation.to, ""
+	if _, ok := srv.engines.Alias(engineName); ok || strings.Contains(engineName, "/") {
+		if engineName, model, err = srv.resolveModel("", srv.escalation.to, langCode); err != nil {
+			log.Printf("[escalate] %v", err)
+			return resp, nil
+		}
+	}
+	et, err := srv.selectTranscriber(engineName, langCode, model)
+	if err != nil {
+		// e.g. a language the better model doesn't have
+		log.Printf("[escalate] %s: %v", srv.escalation.to, err)
+		return resp, nil
+	}
+	if et == t {
+		return resp, nil
+	}
+
+	better, err := runTranscriber(ctx, et, samples, sampleRate, langCode)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		log.Printf("[escalate] %s: %v", srv.escalation.to, err)
+		return resp, nil
+	}
+	log.Printf("[escalate] %s confidence %.3f below %.3f, transcribed again with %s (%.3f)",
+		resp.Model, resp.Confidence, srv.escalation.below, better.Model, better.Confidence)
+	better.ProcessingMs += resp.ProcessingMs
+	better.Escalated = true
+	better.EscalatedFrom = resp.Model
+	return better, nil
+}
+
+// estimateConfidence guesses how reliable a transcript of seconds of audio
+// is, from 0 to 1, for engines that don't report a confidence. It looks
+// for the ways small models fail: no text at all, more words than anybody
+// says in that time, and the same words over and over.
+func estimateConfidence(text string, seconds float64) float64 {
+	words := strings.Fields(strings.ToLower(text))
+	if len(words) == 0 {
+		return 0
+	}
+	conf := 1.0
+	// Fast speech is around 4 words per second
+	if seconds > 0 {
+		if rate := float64(len(words)) / seconds; rate > 5 {
+			conf *= 5 / rate
+		}
+	}
+	if len(words) >= 8 {
+		distinct := make(map[string]bool, len(words))
+		for _, w := range words {
+			distinct[strings.Trim(w, ".,;:!?¿¡\"'")] = true
+		}
+		// Even repetitive speech uses more than half of its words once
+		if ratio := float64(len(distinct)) / float64(len(words)); ratio < 0.5 {
+			conf *= ratio / 0.5
+		}
+	}
+	return conf
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+)
+
+// writeMarkdown renders a transcript as Markdown, with a section per
+// chapter when it has them, and one listing the lines that aren't neutral
+// when they have sentiment tags.
+func writeMarkdown(w io.Writer, created time.Time, resp *api.TranscriptResponse) {
+	fmt.Fprintf(w, "# Transcript %s\n\n", created.Format("2006-01-02 15:04"))
+	if len(resp.Chapters) == 0 {
+		fmt.Fprintf(w, "%s\n", resp.Text)
+	}
+	for i, c := range resp.Chapters {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		if len(resp.Lines) > 0 {
+			fmt.Fprintf(w, "## %s (%s)\n\n%s\n", c.Title, clockTime(c.StartTime), c.Text)
+		} else {
+			fmt.Fprintf(w, "## %s\n\n%s\n", c.Title, c.Text)
+		}
+	}
+	writeSentiment(w, resp.Lines)
+}
+
+// writeSentiment writes the sentiment counts of tagged lines, followed by
+// the positive and negative lines.
+func writeSentiment(w io.Writer, lines []api.TranscriptLine) {
+	counts := map[string]int{}
+	for _, l := range lines {
+		if l.Sentiment != "" {
+			counts[l.Sentiment]++
+		}
+	}
+	if len(counts) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "\n## Sentiment\n\nPositive: %d, neutral: %d, negative: %d\n\n",
+		counts["positive"], counts["neutral"], counts["negative"])
+	for _, l := range lines {
+		if l.Sentiment == "" || l.Sentiment == "neutral" {
+			continue
+		}
+		tag := l.Sentiment
+		if l.Emotion != "" {
+			tag += ", " + l.Emotion
+		}
+		fmt.Fprintf(w, "- %s **%s**: %s\n", clockTime(l.StartTime), tag, strings.TrimSpace(l.Text))
+	}
+}
+
+// transcriptFormats are the ?format= values /transcribe responds in.
+var transcriptFormats = []string{"json", "text", "srt", "vtt"}
+
+// transcriptFormat returns the ?format= of a /transcribe request, "json"
+// when missing.
+func transcriptFormat(r *http.Request) (string, error) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		return "json", nil
+	}
+	if !slices.Contains(transcriptFormats, format) {
+		return "", fmt.Errorf("unsupported format %s (%s)", format, strings.Join(transcriptFormats, ", "))
+	}
+	return format, nil
+}
+
+// writeTranscript writes resp as the response, in one of
+// transcriptFormats.
+func writeTranscript(w http.ResponseWriter, format string, resp *api.TranscriptResponse) {
+	switch format {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprintln(w, resp.Text)
+	case "srt":
+		w.Header().Set("Content-Type", "application/x-subrip; charset=utf-8")
+		writeSRT(w, resp)
+	case "vtt":
+		w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+		writeVTT(w, resp)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// writeSRT renders the transcript lines as SubRip subtitles. The first cue
+// of every chapter starts with the chapter title in brackets. Transcripts
+// without line timings become a single cue.
+func writeSRT(w io.Writer, resp *api.TranscriptResponse) {
+	for i, c := range subtitleCues(resp) {
+		fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", i+1, srtTime(c.StartTime), srtTime(c.StartTime+c.Duration), c.Text)
+	}
+}
+
+// writeVTT renders the transcript lines as WebVTT subtitles, with the same
+// cues as writeSRT.
+func writeVTT(w io.Writer, resp *api.TranscriptResponse) {
+	fmt.Fprint(w, "WEBVTT\n\n")
+	for i, c := range subtitleCues(resp) {
+		fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", i+1, vttTime(c.StartTime), vttTime(c.StartTime+c.Duration), vttEscape.Replace(c.Text))
+	}
+}
+
+// vttEscape escapes the characters WebVTT cue text can't have raw: & and <
+// start entities and tags, and > keeps "-->" out of the text.
+var vttEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// subtitleCues returns the lines of resp to show as subtitles, trimmed and
+// with chapter titles. Lines without text are left out.
+func subtitleCues(resp *api.TranscriptResponse) []api.TranscriptLine {
+	lines := resp.Lines
+	if len(lines) == 0 {
+		lines = []api.TranscriptLine{{Text: resp.Text, Duration: resp.AudioDuration}}
+	}
+	chapters := make(map[float64]string)
+	for _, c := range resp.Chapters {
+		chapters[c.StartTime] = c.Title
+	}
+	cues := make([]api.TranscriptLine, 0, len(lines))
+	for _, l := range lines {
+		text := strings.TrimSpace(l.Text)
+		if title, ok := chapters[l.StartTime]; ok && len(resp.Lines) > 0 {
+			text = strings.TrimSpace("[" + title + "]\n" + text)
+			delete(chapters, l.StartTime)
+		}
+		if text == "" {
+			continue
+		}
+		cues = append(cues, api.TranscriptLine{Text: text, StartTime: l.StartTime, Duration: l.Duration})
+	}
+	return cues
+}
+
+// srtTime formats seconds as HH:MM:SS,mmm.
+func srtTime(secs float64) string {
+	ms := int64(secs*1000 + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d,%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+// vttTime formats seconds as HH:MM:SS.mmm.
+func vttTime(secs float64) string {
+	return strings.Replace(srtTime(secs), ",", ".", 1)
+}
+
+// clockTime formats seconds as M:SS, or H:MM:SS past an hour.
+func clockTime(secs float64) string {
+	s := int64(secs)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// stringList is a flag.Value collecting repeated flag occurrences.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// IsRepeatable tells the cli package the flag's environment variable can
+// hold several values.
+func (l *stringList) IsRepeatable() bool { return true }
+
+// Reset empties the list, so a config file's values are replaced, not
+// added to, by the environment or the command line.
+func (l *stringList) Reset() { *l = nil }
+
+// byteSize is a flag.Value accepting sizes like 500KB, 20MB or 1GB
+// (powers of 1024). A plain number is a count of bytes.
+type byteSize int64
+
+func (b *byteSize) String() string { return formatSize(int64(*b)) }
+
+func (b *byteSize) Set(v string) error {
+	n, err := parseSize(v)
+	if err != nil {
+		return err
+	}
+	*b = byteSize(n)
+	return nil
+}
+
+// byteRate is a flag.Value accepting transfer rates like 500KB/s or 2MB/s.
+type byteRate int64
+
+func (b *byteRate) String() string { return formatSize(int64(*b)) + "/s" }
+
+func (b *byteRate) Set(v string) error {
+	n, err := parseSize(strings.TrimSuffix(strings.ToLower(strings.TrimSpace(v)), "/s"))
+	if err != nil {
+		return fmt.Errorf("invalid rate %q, use e.g. 500KB/s or 2MB/s", v)
+	}
+	*b = byteRate(n)
+	return nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	mult   int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+func parseSize(v string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(v))
+	mult := int64(1)
+	for _, u := range sizeUnits {
+		if num, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, mult = strings.TrimSpace(num), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, use e.g. 512KB, 20MB or 1GB", v)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+func formatSize(n int64) string {
+	for _, u := range sizeUnits {
+		if n >= u.mult && n%u.mult == 0 {
+			return strconv.FormatInt(n/u.mult, 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(n, 10) + "B"
+}
+
+// defaultPadding is the silence appended to the audio before each engine
+// transcribes it, so the last word isn't clipped. Moonshine drops the end
+// of an utterance without a full second; Parakeet needs much less.
+var defaultPadding = padding{"moonshine": time.Second, "parakeet": 300 * time.Millisecond}
+
+// padding is a flag.Value with the silence padding per engine, set as
+// comma-separated engine=duration pairs, e.g. moonshine=1s,parakeet=0.
+type padding map[string]time.Duration
+
+func (p padding) String() string {
+	var pairs []string
+	for _, name := range slices.Sorted(maps.Keys(p)) {
+		pairs = append(pairs, name+"="+p[name].String())
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (p padding) Set(v string) error {
+	for pair := range strings.SplitSeq(v, ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return fmt.Errorf("invalid padding %q, use engine=duration", pair)
+		}
+		if _, ok := defaultPadding[name]; !ok {
+			return fmt.Errorf("unknown engine %q in padding, use moonshine or parakeet", name)
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid padding duration %q", value)
+		}
+		p[name] = d
+	}
+	return nil
+}
+
+// Reset goes back to the default padding before the environment or the
+// command line set the flag, dropping the config file's.
+func (p padding) Reset() {
+	clear(p)
+	maps.Copy(p, defaultPadding)
+}
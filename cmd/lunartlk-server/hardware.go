@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/doctor"
+)
+
+// smallMemory is the total RAM below which even Moonshine base-en is
+// swapped for tiny-en.
+const smallMemory = 2 << 30
+
+// modelSelection is the default engine and English Moonshine model picked
+// for the machine, reported by GET /info.
+type modelSelection struct {
+	Arch string `json:"arch"`
+	// SIMD is "avx2", "neon" or "" when the CPU has neither.
+	SIMD        string `json:"simd"`
+	MemoryBytes uint64 `json:"memory_bytes"`
+	Engine      string `json:"engine"`
+	MoonshineEn string `json:"moonshine_en"`
+	Reason      string `json:"reason"`
+}
+
+// hostInfo describes the machine for GET /info.
+func hostInfo() api.Host {
+	total, _ := doctor.MemoryInfo()
+	return api.Host{
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		SIMD:        doctor.SIMD(),
+		MemoryBytes: total,
+	}
+}
+
+// selectModels picks the default engine and English Moonshine model for
+// the CPU and RAM. Parakeet is the most accurate but needs over 1GB and is
+// slow without vector instructions; Moonshine tiny-en fits where base-en
+// doesn't. Only quantized weights are published for the models served, so
+// there's no choice of precision to make.
+func selectModels() modelSelection {
+	total, _ := doctor.MemoryInfo()
+	sel := modelSelection{
+		Arch:        runtime.GOARCH,
+		SIMD:        doctor.SIMD(),
+		MemoryBytes: total,
+		Engine:      "parakeet",
+		MoonshineEn: "base-en",
+		Reason:      "enough RAM and vector instructions for every model",
+	}
+	switch {
+	case total == 0:
+		sel.Reason = "RAM unknown, keeping the defaults"
+		return sel
+	case sel.SIMD == "":
+		sel.Engine, sel.MoonshineEn = "moonshine", "tiny-en"
+		sel.Reason = "no AVX2 or NEON"
+	case total < smallMemory:
+		sel.Engine, sel.MoonshineEn = "moonshine", "tiny-en"
+		sel.Reason = fmt.Sprintf("under %s of RAM", formatSize(smallMemory))
+	case total < doctor.LowMemory:
+		sel.Engine = "moonshine"
+		sel.Reason = fmt.Sprintf("under %s of RAM", formatSize(doctor.LowMemory))
+	}
+	return sel
+}
+
+// applySelection makes the selection the server's defaults. The engine is
+// only changed when -engine wasn't given.
+func (srv *serverInfo) applySelection(sel modelSelection, enginePinned bool) {
+	if enginePinned {
+		sel.Engine = srv.defaultEng
+		sel.Reason += ", -engine given"
+	}
+	srv.defaultEng = sel.Engine
+	moonshineModels["en"] = sel.MoonshineEn
+	srv.selection = &sel
+
+	simd := sel.SIMD
+	if simd == "" {
+		simd = "no SIMD"
+	}
+	log.Printf("Model selection: %s with %s, %s RAM: engine %s, moonshine/%s for English (%s)",
+		sel.Arch, simd, formatMiB(sel.MemoryBytes), sel.Engine, sel.MoonshineEn, sel.Reason)
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/engine"
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// parakeetLangs are the languages supported by Parakeet TDT 0.6B v3.
+var parakeetLangs = []string{
+	"bg", "cs", "da", "de", "el", "en", "es", "et", "fi", "fr", "hr", "hu", "it",
+	"lt", "lv", "mt", "nl", "pl", "pt", "ro", "ru", "sk", "sl", "sv", "uk",
+}
+
+// infoResponseV1 is GET /info in version 1 of the API, with the machine's
+// architecture, SIMD and memory in model_selection.
+type infoResponseV1 struct {
+	Version       string           `json:"version"`
+	APIVersion    int              `json:"api_version"`
+	APIVersions   []int            `json:"api_versions"`
+	DefaultEngine string           `json:"default_engine"`
+	DefaultLang   string           `json:"default_lang"`
+	Engines       []api.EngineInfo `json:"engines"`
+	Formats       []string         `json:"formats"`
+	Encodings     []string         `json:"encodings"`
+	Limits        api.Limits       `json:"limits"`
+	Features      map[string]bool  `json:"features"`
+
+	Aliases        map[string]string `json:"aliases,omitempty"`
+	ModelSelection *modelSelection   `json:"model_selection,omitempty"`
+}
+
+// handleInfo describes the server's capabilities so clients can adapt to
+// them. Like /health it doesn't require authentication.
+func handleInfo(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	resp := api.Info{
+		Version:       version,
+		APIVersion:    api.Version,
+		APIVersions:   apiVersions(),
+		DefaultEngine: srv.defaultEng,
+		DefaultLang:   srv.defaultLang,
+		Engines:       []api.EngineInfo{},
+		Formats:       []string{"wav", "opus"},
+		Encodings:     contentEncodings,
+		Host:          hostInfo(),
+		Limits: api.Limits{
+			MaxUploadBytes:  srv.maxUpload,
+			MaxAudioSeconds: srv.maxDuration.Seconds(),
+		},
+		Features: map[string]bool{
+			"compare":    true,
+			"align":      srv.engines.Has("parakeet", ""),
+			"streaming":  true,
+			"translate":  false,
+			"punctuate":  srv.hasPostProcessor("punctuate"),
+			"store":      srv.store != nil,
+			"users":      srv.hasUsers(),
+			"webhooks":   srv.webhooks != nil,
+			"mqtt":       srv.mqtt != nil,
+			"alerts":     srv.hasAlerts(),
+			"search":     srv.embedder != nil,
+			"cache":      srv.cache != nil,
+			"opus_v2":    true,
+			"uploads":    srv.uploads != nil,
+			"encryption": srv.encryptionKey != nil,
+		},
+	}
+
+	if aliases := srv.engines.Aliases(); len(aliases) > 0 {
+		resp.Aliases = map[string]string{}
+		for name, a := range aliases {
+			resp.Aliases[name] = a.String()
+		}
+	}
+	for _, e := range srv.engines.Entries() {
+		resp.Engines = append(resp.Engines, api.EngineInfo{
+			Name:   e.Spec.Engine,
+			Model:  e.Spec.Model,
+			Langs:  e.Spec.Langs,
+			Loaded: e.Loaded(),
+		})
+	}
+	if sel := srv.selection; sel != nil {
+		resp.ModelSelection = &api.ModelSelection{Engine: sel.Engine, MoonshineEn: sel.MoonshineEn, Reason: sel.Reason}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if v, _ := apiVersion(r); v == 1 {
+		json.NewEncoder(w).Encode(infoResponseV1{
+			Version:        resp.Version,
+			APIVersion:     1,
+			APIVersions:    resp.APIVersions,
+			DefaultEngine:  resp.DefaultEngine,
+			DefaultLang:    resp.DefaultLang,
+			Engines:        resp.Engines,
+			Formats:        resp.Formats,
+			Encodings:      resp.Encodings,
+			Limits:         resp.Limits,
+			Features:       resp.Features,
+			Aliases:        resp.Aliases,
+			ModelSelection: srv.selection,
+		})
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (srv *serverInfo) hasAlerts() bool {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	return srv.alertsFile != ""
+}
+
+func (srv *serverInfo) hasPostProcessor(name string) bool {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	for _, p := range srv.postproc {
+		if p.Name() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// handleMetrics reports the server's load in the Prometheus text format.
+// Coordinators poll it to pick the least loaded backend. Like /health it
+// doesn't require authentication.
+func handleMetrics(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	shedding := 0
+	if srv.shedding.Load() {
+		shedding = 1
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP lunartlk_requests_in_flight Transcription requests being processed.\n")
+	fmt.Fprintf(w, "# TYPE lunartlk_requests_in_flight gauge\n")
+	fmt.Fprintf(w, "lunartlk_requests_in_flight %d\n", srv.inFlight.Load())
+	fmt.Fprintf(w, "# HELP lunartlk_requests_queued Transcription requests waiting for a busy model.\n")
+	fmt.Fprintf(w, "# TYPE lunartlk_requests_queued gauge\n")
+	fmt.Fprintf(w, "lunartlk_requests_queued %d\n", srv.health().Queued)
+	fmt.Fprintf(w, "# HELP lunartlk_memory_shedding Whether new requests are rejected under memory pressure.\n")
+	fmt.Fprintf(w, "# TYPE lunartlk_memory_shedding gauge\n")
+	fmt.Fprintf(w, "lunartlk_memory_shedding %d\n", shedding)
+	fmt.Fprintf(w, "# HELP lunartlk_resident_memory_bytes Resident memory of the server process.\n")
+	fmt.Fprintf(w, "# TYPE lunartlk_resident_memory_bytes gauge\n")
+	fmt.Fprintf(w, "lunartlk_resident_memory_bytes %d\n", memoryInUse())
+}
+
+// healthWaitMax caps how long /health?wait=ready waits.
+const healthWaitMax = 5 * time.Minute
+
+type engineHealth struct {
+	Name   string        `json:"name"`
+	Model  string        `json:"model"`
+	Status engine.Status `json:"status"`
+	// Error is why the model last failed to load.
+	Error  string `json:"error,omitempty"`
+	Queued int    `json:"queued"`
+}
+
+// healthResponse is returned by GET /health.
+type healthResponse struct {
+	// Status is "ok", or "degraded" when a model failed to load.
+	Status string `json:"status"`
+	// Ready is what /readyz answers: the -preload models are loaded and
+	// requests aren't rejected under memory pressure.
+	Ready    bool           `json:"ready"`
+	InFlight int64          `json:"in_flight"`
+	Queued   int            `json:"queued"`
+	Engines  []engineHealth `json:"engines"`
+}
+
+func (srv *serverInfo) health() healthResponse {
+	h := healthResponse{
+		Status:   "ok",
+		Ready:    srv.ready.Load() && !srv.shedding.Load(),
+		InFlight: srv.inFlight.Load(),
+		Engines:  []engineHealth{},
+	}
+	for _, e := range srv.engines.Entries() {
+		status, err := e.Status()
+		eh := engineHealth{Name: e.Spec.Engine, Model: e.Spec.Model, Status: status, Queued: e.Waiting()}
+		if err != nil {
+			eh.Error = err.Error()
+			h.Status = "degraded"
+		}
+		h.Queued += eh.Queued
+		h.Engines = append(h.Engines, eh)
+	}
+	if srv.slots != nil {
+		h.Queued += srv.slots.Waiting()
+	}
+	return h
+}
+
+// healthSummary is what GET /health returns to unauthenticated requests:
+// the engines' load errors and queues are only shown with a token.
+type healthSummary struct {
+	Status string `json:"status"`
+	Ready  bool   `json:"ready"`
+}
+
+// handleHealth reports the status of the server and of each engine's
+// model. The server answers 200 while it's up, even with models that
+// failed to load: the next request tries loading them again. Without a
+// valid token, when authentication is on, it only says whether the server
+// is up and ready.
+//
+// With ?wait=ready the response waits until the server is ready, or
+// ?timeout= (30s by default) passes, when it's 503; orchestration can
+// hold traffic back until the models are warm. Since it holds the
+// connection, it requires authentication.
+func handleHealth(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	_, authorized := srv.authenticate(r)
+	code := http.StatusOK
+	switch wait := r.URL.Query().Get("wait"); wait {
+	case "":
+	case "ready":
+		if !authorized {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		timeout := 30 * time.Second
+		if t := r.URL.Query().Get("timeout"); t != "" {
+			d, err := time.ParseDuration(t)
+			if err != nil || d < 0 {
+				http.Error(w, "invalid timeout, use a duration like 30s", http.StatusBadRequest)
+				return
+			}
+			timeout = min(d, healthWaitMax)
+		}
+		if !srv.waitReady(r.Context(), timeout) {
+			code = http.StatusServiceUnavailable
+		}
+	default:
+		http.Error(w, "unsupported wait "+wait+" (ready)", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	h := srv.health()
+	if !authorized {
+		json.NewEncoder(w).Encode(healthSummary{Status: h.Status, Ready: h.Ready})
+		return
+	}
+	json.NewEncoder(w).Encode(h)
+}
+
+// waitReady waits until the server is ready, as /readyz tells, for up to
+// timeout, and reports whether it is.
+func (srv *serverInfo) waitReady(ctx context.Context, timeout time.Duration) bool {
+	ready := func() bool { return srv.ready.Load() && !srv.shedding.Load() }
+	if ready() {
+		return true
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	tick := time.NewTicker(200 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if ready() {
+				return true
+			}
+		case <-ctx.Done():
+			return ready()
+		}
+	}
+}
+
+// handleReady answers 200 once the server can take transcriptions: the
+// -preload models are loaded and it isn't rejecting requests under memory
+// pressure. Unlike /health, which only says the process is up, it's meant
+// for readiness probes. It doesn't require authentication.
+func handleReady(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	switch {
+	case !srv.ready.Load():
+		http.Error(w, "loading models", http.StatusServiceUnavailable)
+	case srv.shedding.Load():
+		http.Error(w, errMemoryPressure.Error(), http.StatusServiceUnavailable)
+	default:
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// track counts the requests in flight for /metrics, and records the
+// activity for -idle-unload.
+func (srv *serverInfo) track(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		srv.touch()
+		srv.inFlight.Add(1)
+		defer srv.touch()
+		defer srv.inFlight.Add(-1)
+		next(w, r)
+	}
+}
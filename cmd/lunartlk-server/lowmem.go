@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// lowMemoryFlags are the flag values -low-memory stands for. Flags given
+// on the command line keep their value.
+var lowMemoryFlags = map[string]string{
+	// Parakeet takes over 1GB loaded: it's only used when asked for
+	"engine":         "moonshine",
+	"ort-threads":    "1",
+	"idle-unload":    "2m",
+	"max-upload":     "10MB",
+	"max-duration":   "5m",
+	"stream-chunk":   "15s",
+	"response-cache": "8",
+}
+
+// applyLowMemory sets the -low-memory flags the user didn't set, and
+// serves English with the tiny Moonshine model. There's no tiny Spanish
+// model, so Spanish keeps base-es.
+func applyLowMemory() {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+
+	var applied []string
+	for _, name := range slices.Sorted(maps.Keys(lowMemoryFlags)) {
+		if given[name] {
+			continue
+		}
+		value := lowMemoryFlags[name]
+		if err := flag.Set(name, value); err != nil {
+			log.Fatalf("-low-memory: %s: %v", name, err)
+		}
+		applied = append(applied, name+"="+value)
+	}
+	moonshineModels["en"] = "tiny-en"
+	log.Printf("Low-memory mode: %s, moonshine/tiny-en for English", strings.Join(applied, " "))
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	mdl "github.com/rubiojr/lunartlk/internal/models"
+)
+
+const memoryCheckInterval = 2 * time.Second
+
+// errMemoryPressure rejects requests while memory use is over -max-memory.
+var errMemoryPressure = errors.New("server is low on memory, try again later")
+
+// errModelMemory rejects requests for a model that doesn't fit in
+// -max-memory.
+var errModelMemory = errors.New("not enough memory to load the model")
+
+// watchMemory checks the process's memory use every few seconds. Above
+// -max-memory it unloads idle models and, while that isn't enough, rejects
+// new transcriptions, so the server degrades instead of being killed. It
+// recovers below 90% of the limit.
+func (srv *serverInfo) watchMemory() {
+	limit := uint64(srv.maxMemory)
+	go func() {
+		for range time.Tick(memoryCheckInterval) {
+			used := memoryInUse()
+			if used <= limit {
+				if srv.shedding.Load() && used < limit/10*9 {
+					srv.shedding.Store(false)
+					log.Printf("[memory] %s in use, accepting requests again", formatMiB(used))
+				}
+				continue
+			}
+
+			if srv.engines.UnloadIdle() {
+				debug.FreeOSMemory()
+				if used = memoryInUse(); used <= limit {
+					continue
+				}
+			}
+			if !srv.shedding.Swap(true) {
+				log.Printf("[memory] %s in use, over the %s limit: rejecting new requests", formatMiB(used), formatMiB(limit))
+			}
+		}
+	}()
+}
+
+// memoryInUse returns the resident set size, falling back to the memory
+// the Go runtime got from the OS where /proc isn't available.
+func memoryInUse() uint64 {
+	if rss := residentBytes(); rss > 0 {
+		return rss
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.Sys
+}
+
+// shed rejects the request with 503 while the server is under memory
+// pressure, and reports whether it did.
+func (srv *serverInfo) shed(w http.ResponseWriter) bool {
+	if !srv.shedding.Load() {
+		return false
+	}
+	w.Header().Set("Retry-After", "10")
+	http.Error(w, errMemoryPressure.Error(), http.StatusServiceUnavailable)
+	return true
+}
+
+// admit checks that loading a model keeps memory use under -max-memory,
+// going by the model's estimated size. When it wouldn't, it unloads the
+// idle models first, and fails if that still isn't enough, so a request
+// gets an error instead of the server being killed while loading. The
+// model's size stays reserved until the returned function is called, once
+// the load is over, so concurrent loads of other models count it before
+// it shows in the memory in use.
+func (srv *serverInfo) admit(info mdl.ModelInfo) (func(), error) {
+	if srv.maxMemory <= 0 || info.Memory <= 0 {
+		return func() {}, nil
+	}
+	srv.admitMu.Lock()
+	defer srv.admitMu.Unlock()
+
+	// Requests waiting for the same model share its reservation
+	if r := srv.loading[info.Name]; r != nil {
+		r.waiters++
+		return func() { srv.endLoad(info.Name) }, nil
+	}
+	var pending uint64
+	for _, r := range srv.loading {
+		pending += r.bytes
+	}
+	limit, need := uint64(srv.maxMemory), uint64(info.Memory)
+	used := memoryInUse()
+	if used+pending+need > limit && srv.engines.UnloadIdle() {
+		debug.FreeOSMemory()
+		used = memoryInUse()
+	}
+	if used+pending+need > limit {
+		log.Printf("[memory] Not loading %s: it needs about %s, with %s of the %s limit in use and %s reserved by other loads",
+			info.Name, formatMiB(need), formatMiB(used), formatMiB(limit), formatMiB(pending))
+		return nil, fmt.Errorf("%w: %s needs about %s, %s of %s in use and %s being loaded", errModelMemory,
+			info.Name, formatMiB(need), formatMiB(used), formatMiB(limit), formatMiB(pending))
+	}
+	if srv.loading == nil {
+		srv.loading = make(map[string]*loadReservation)
+	}
+	srv.loading[info.Name] = &loadReservation{bytes: need, waiters: 1}
+	return func() { srv.endLoad(info.Name) }, nil
+}
+
+// loadReservation is the memory reserved for a model being loaded.
+type loadReservation struct {
+	bytes uint64
+	// waiters is the number of requests waiting for the load.
+	waiters int
+}
+
+// endLoad ends a request's wait for a model's load, releasing its
+// reservation after the last one.
+func (srv *serverInfo) endLoad(name string) {
+	srv.admitMu.Lock()
+	defer srv.admitMu.Unlock()
+	if r := srv.loading[name]; r != nil {
+		if r.waiters--; r.waiters == 0 {
+			delete(srv.loading, name)
+		}
+	}
+}
+
+// touch records that the server is busy, for unloadWhenIdle.
+func (srv *serverInfo) touch() {
+	srv.lastActive.Store(time.Now().UnixNano())
+}
+
+// unloadWhenIdle unloads the models once no request has started or
+// finished for d, and returns the memory to the OS. The next request loads
+// them again, so d trades memory for that request's latency.
+func (srv *serverInfo) unloadWhenIdle(d time.Duration) {
+	srv.touch()
+	go func() {
+		for range time.Tick(max(d/4, time.Second)) {
+			idle := time.Since(time.Unix(0, srv.lastActive.Load()))
+			if idle < d || srv.inFlight.Load() > 0 {
+				continue
+			}
+			if srv.engines.UnloadIdle() {
+				debug.FreeOSMemory()
+				log.Printf("[memory] Idle for %s, unloaded models (%s in use)", idle.Round(time.Second), formatMiB(memoryInUse()))
+			}
+		}
+	}()
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+
+	"github.com/rubiojr/lunartlk/internal/cli"
+	mdl "github.com/rubiojr/lunartlk/internal/models"
+)
+
+// modelsCommand manages the model files in the cache.
+func modelsCommand() *cli.Command {
+	return &cli.Command{
+		Name:     "models",
+		Short:    "manage downloaded models",
+		Commands: []*cli.Command{modelsUpdateCommand(), modelsExportCommand(), modelsImportCommand(), modelsVerifyCommand()},
+	}
+}
+
+func modelsUpdateCommand() *cli.Command {
+	fs := flag.NewFlagSet("update", flag.ExitOnError)
+	cacheDir := fs.String("cache", "", "cache directory for models (default: ~/.cache/lunartlk)")
+
+	return &cli.Command{
+		Name:  "update",
+		Short: "download the model files that changed upstream",
+		Long: "Checks the files of every downloaded model upstream and downloads the ones that " +
+			"changed or are missing, comparing the ETag and Last-Modified headers recorded at download time. " +
+			"Restart the server to use the new files.",
+		Flags: fs,
+		Run: func([]string) {
+			cache := modelCacheDir(*cacheDir)
+			var failed bool
+			for _, info := range knownModels() {
+				updated, err := mdl.Update(cache, info)
+				for _, f := range updated {
+					fmt.Printf("updated %s/%s\n", info.Name, f)
+				}
+				if err != nil {
+					log.Printf("%s: %v", info.Name, err)
+					failed = true
+				}
+			}
+			if failed {
+				log.Fatal("some models couldn't be updated")
+			}
+		},
+	}
+}
+
+func modelsExportCommand() *cli.Command {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	cacheDir := fs.String("cache", "", "cache directory for models (default: ~/.cache/lunartlk)")
+
+	return &cli.Command{
+		Name:  "export",
+		Short: "package the models and libraries for an offline machine",
+		Long: "Writes the downloaded models and the shared libraries, ONNX Runtime included, " +
+			"to a zstd-compressed tar bundle. Use - to write to stdout.",
+		Args:  "<bundle.tar.zst>",
+		Flags: fs,
+		Run: func(args []string) {
+			if len(args) != 1 {
+				log.Fatal("usage: lunartlk-server models export [-cache dir] <bundle.tar.zst>")
+			}
+			w := os.Stdout
+			if args[0] != "-" {
+				f, err := os.Create(args[0])
+				if err != nil {
+					log.Fatal(err)
+				}
+				w = f
+			}
+			if err := mdl.Export(w, modelCacheDir(*cacheDir)); err != nil {
+				log.Fatalf("export: %v", err)
+			}
+			if err := w.Close(); err != nil {
+				log.Fatalf("export: %v", err)
+			}
+		},
+	}
+}
+
+func modelsImportCommand() *cli.Command {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	cacheDir := fs.String("cache", "", "cache directory for models (default: ~/.cache/lunartlk)")
+
+	return &cli.Command{
+		Name:  "import",
+		Short: "install models and libraries from an exported bundle",
+		Long:  "Extracts a bundle written by models export into the cache. Use - to read from stdin.",
+		Args:  "<bundle.tar.zst>",
+		Flags: fs,
+		Run: func(args []string) {
+			if len(args) != 1 {
+				log.Fatal("usage: lunartlk-server models import [-cache dir] <bundle.tar.zst>")
+			}
+			r := os.Stdin
+			if args[0] != "-" {
+				f, err := os.Open(args[0])
+				if err != nil {
+					log.Fatal(err)
+				}
+				defer f.Close()
+				r = f
+			}
+			cache := modelCacheDir(*cacheDir)
+			n, err := mdl.Import(r, cache)
+			if err != nil {
+				log.Fatalf("import: %v", err)
+			}
+			fmt.Printf("Imported %d files into %s\n", n, cache)
+		},
+	}
+}
+
+func modelsVerifyCommand() *cli.Command {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	cacheDir := fs.String("cache", "", "cache directory for models (default: ~/.cache/lunartlk)")
+	all := fs.Bool("all", false, "verify every downloaded model and look for orphaned model directories")
+	repair := fs.Bool("repair", false, "download corrupt and missing files again and remove orphaned ones")
+
+	return &cli.Command{
+		Name:  "verify",
+		Short: "check the cached model files against their checksums",
+		Long: "Hashes the cached files of the given models, or of every model with -all, and compares them " +
+			"to the checksums in the registry or recorded at download time. Reports corrupt, missing and " +
+			"orphaned files, and exits with an error when problems remain, so it can run from cron.",
+		Args:  "[model...]",
+		Flags: fs,
+		Run: func(args []string) {
+			if *all == (len(args) > 0) {
+				log.Fatal("usage: lunartlk-server models verify [-cache dir] [-repair] -all | <model>...")
+			}
+			infos := knownModels()
+			if !*all {
+				infos = slices.DeleteFunc(infos, func(m mdl.ModelInfo) bool { return !slices.Contains(args, m.Name) })
+				for _, name := range args {
+					if !slices.ContainsFunc(infos, func(m mdl.ModelInfo) bool { return m.Name == name }) {
+						log.Fatalf("unknown model %q", name)
+					}
+				}
+			}
+
+			cache := modelCacheDir(*cacheDir)
+			issues, err := mdl.Verify(cache, infos, *repair)
+			if err == nil && *all {
+				var dirs []mdl.Issue
+				dirs, err = mdl.OrphanedDirs(cache, infos, *repair)
+				issues = append(issues, dirs...)
+			}
+			var failed bool
+			for _, issue := range issues {
+				switch {
+				case issue.Repaired:
+					fmt.Printf("%s: %s, repaired\n", issue.Path, issue.Problem)
+				case issue.Err != nil:
+					fmt.Printf("%s: %s, repair failed: %v\n", issue.Path, issue.Problem, issue.Err)
+					failed = true
+				default:
+					fmt.Printf("%s: %s\n", issue.Path, issue.Problem)
+					failed = failed || issue.Problem != mdl.Unverified
+				}
+			}
+			if err != nil {
+				log.Fatalf("verify: %v", err)
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+// knownModels returns the models the server can load.
+func knownModels() []mdl.ModelInfo {
+	var infos []mdl.ModelInfo
+	for _, name := range slices.Sorted(maps.Keys(mdl.MoonshineModels)) {
+		infos = append(infos, mdl.MoonshineModels[name])
+	}
+	return append(infos, mdl.ParakeetModel, mdl.ParakeetPreprocessor)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/notes"
+)
+
+// noteExportRetries is how many times a failed note export is retried.
+const noteExportRetries = 3
+
+var noteClient = &http.Client{Timeout: 30 * time.Second}
+
+// exportProfile returns the -exports profile a transcript goes to: the
+// one asked for with ?export=, else u's, else the one named "default".
+// It's empty when there's none or ?export=none. Named users can only ask
+// for their own profile or "default".
+func (srv *serverInfo) exportProfile(param string, u *user) (string, error) {
+	srv.mu.RLock()
+	profiles := srv.exports
+	srv.mu.RUnlock()
+
+	switch {
+	case param == "none":
+		return "", nil
+	case param != "":
+		if _, ok := profiles[param]; !ok {
+			return "", fmt.Errorf("unknown export profile '%s'", param)
+		}
+		// Profiles hold their owner's credentials
+		if u != nil && param != u.Export && param != "default" {
+			return "", fmt.Errorf("export profile '%s' isn't yours", param)
+		}
+		return param, nil
+	case u != nil && u.Export != "":
+		return u.Export, nil
+	}
+	if _, ok := profiles["default"]; ok {
+		return "default", nil
+	}
+	return "", nil
+}
+
+// exportNote sends a transcript to the targets of an export profile, in
+// the background. Network errors and 5xx responses are retried, then
+// logged; other failures are logged right away.
+func (srv *serverInfo) exportNote(profile string, resp *api.TranscriptResponse) {
+	if profile == "" {
+		return
+	}
+	srv.mu.RLock()
+	targets, ok := srv.exports[profile]
+	srv.mu.RUnlock()
+	if !ok {
+		log.Printf("[export] unknown profile %q", profile)
+		return
+	}
+	n := noteFor(resp, time.Now())
+	for _, t := range targets {
+		go func() {
+			var err error
+			for attempt := range noteExportRetries + 1 {
+				if attempt > 0 {
+					time.Sleep(time.Second << (attempt - 1))
+				}
+				if err = t.Export(context.Background(), noteClient, n); err == nil || !notes.Retryable(err) {
+					break
+				}
+			}
+			if err != nil {
+				log.Printf("[export] %s: %v", t, err)
+			}
+		}()
+	}
+}
+
+// noteFor makes a note of a transcript, titled with its first words.
+func noteFor(resp *api.TranscriptResponse, created time.Time) notes.Note {
+	n := notes.Note{Title: noteTitle(resp.Text, created), Text: resp.Text, Created: created}
+	if len(resp.Chapters) == 0 {
+		n.Body = resp.Text
+		return n
+	}
+	var sb strings.Builder
+	for i, c := range resp.Chapters {
+		if i > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "## %s\n\n%s\n", c.Title, c.Text)
+	}
+	n.Body = sb.String()
+	return n
+}
+
+// noteTitle returns the first words of text, or the date for a transcript
+// without any.
+func noteTitle(text string, created time.Time) string {
+	words := strings.Fields(text)
+	if len(words) == 0 {
+		return "Transcript " + created.Format("2006-01-02 15:04")
+	}
+	if len(words) > 8 {
+		return strings.Join(words[:8], " ") + "…"
+	}
+	return strings.TrimRight(strings.Join(words, " "), ".")
+}
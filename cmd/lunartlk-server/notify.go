@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/alert"
+	"github.com/rubiojr/lunartlk/internal/mqtt"
+	"github.com/rubiojr/lunartlk/internal/webhook"
+)
+
+// notify announces a completed transcript to the configured webhooks and
+// MQTT broker, and fires the alerts it matches. Deliveries happen in the
+// background.
+func (srv *serverInfo) notify(resp *api.TranscriptResponse) {
+	srv.checkAlerts(resp)
+
+	if srv.webhooks != nil {
+		srv.webhooks.Notify("transcript", resp)
+	}
+	if srv.mqtt != nil {
+		body, err := json.Marshal(resp)
+		if err != nil {
+			log.Printf("[mqtt] marshal transcript: %v", err)
+			return
+		}
+		srv.publish(srv.mqttTopic, body)
+	}
+}
+
+// publish sends body to an MQTT topic in the background.
+func (srv *serverInfo) publish(topic string, body []byte) {
+	go func() {
+		if err := srv.mqtt.Publish(topic, body); err != nil {
+			log.Printf("[mqtt] %v", err)
+		}
+	}()
+}
+
+// alertPayload is delivered by the webhook and MQTT alert actions.
+type alertPayload struct {
+	Rule       string                  `json:"rule"`
+	Matches    []string                `json:"matches"`
+	Transcript *api.TranscriptResponse `json:"transcript"`
+}
+
+// checkAlerts runs the actions of every alert rule matching resp.
+func (srv *serverInfo) checkAlerts(resp *api.TranscriptResponse) {
+	srv.mu.RLock()
+	rules := srv.alerts
+	srv.mu.RUnlock()
+
+	for _, m := range alert.Check(rules, resp.Text) {
+		r := m.Rule
+		log.Printf("[alert] %s: %q", r.Name, m.Matches)
+		payload := alertPayload{Rule: r.Name, Matches: m.Matches, Transcript: resp}
+		if r.Webhook != "" {
+			webhook.New([]string{r.Webhook}, webhook.WithSecret(srv.webhookSecret)).Notify("alert", payload)
+		}
+		if r.MQTTTopic != "" {
+			if srv.mqtt == nil {
+				log.Printf("[alert] %s: mqtt_topic needs the server started with -mqtt", r.Name)
+			} else if body, err := json.Marshal(payload); err == nil {
+				srv.publish(r.MQTTTopic, body)
+			}
+		}
+		if r.Notify {
+			go desktopNotify("lunartlk: "+r.Name, resp.Text)
+		}
+	}
+}
+
+// desktopNotify shows a desktop notification with notify-send, for servers
+// running on the user's machine.
+func desktopNotify(title, body string) {
+	if err := exec.Command("notify-send", "--app-name=lunartlk", title, body).Run(); err != nil {
+		log.Printf("[alert] notify-send: %v", err)
+	}
+}
+
+// newMQTTPublisher creates the publisher for -mqtt, trusting caFile in
+// addition to the system roots when given.
+func newMQTTPublisher(brokerURL, caFile string) (*mqtt.Publisher, error) {
+	var opts []mqtt.Option
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", caFile)
+		}
+		opts = append(opts, mqtt.WithTLSConfig(&tls.Config{RootCAs: pool}))
+	}
+	return mqtt.New(brokerURL, opts...)
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/postproc"
+)
+
+// postprocess runs the configured post-processing pipeline over resp.
+func (srv *serverInfo) postprocess(ctx context.Context, resp *api.TranscriptResponse) error {
+	srv.mu.RLock()
+	pipeline := srv.postproc
+	srv.mu.RUnlock()
+	return runProcessors(ctx, pipeline, resp)
+}
+
+// runScripts runs the user scripts over resp, and reports whether the
+// transcript should be stored.
+func (srv *serverInfo) runScripts(ctx context.Context, resp *api.TranscriptResponse) (bool, error) {
+	srv.mu.RLock()
+	scripts := srv.scripts
+	srv.mu.RUnlock()
+	return scripts.Run(ctx, resp)
+}
+
+// defaultScriptsDir returns the scripts directory in the user's config
+// directory, ~/.config/lunartlk/scripts.
+func defaultScriptsDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "lunartlk", "scripts")
+}
+
+// requestProcessors returns the processors a /transcribe request asks for
+// with ?clean=true, ?profanity=STYLE and ?redact=pii. They run after the
+// pipeline, so its processors can't put back what they masked.
+func (srv *serverInfo) requestProcessors(r *http.Request) (postproc.Pipeline, error) {
+	var p postproc.Pipeline
+	if r.URL.Query().Get("clean") == "true" {
+		p = append(p, postproc.Disfluency{})
+	}
+	if style := r.URL.Query().Get("profanity"); style != "" {
+		f, err := postproc.NewProfanity(style)
+		if err != nil {
+			return nil, fmt.Errorf("profanity: %w", err)
+		}
+		p = append(p, f)
+	}
+	switch v := r.URL.Query().Get("redact"); v {
+	case "":
+	case "pii":
+		p = append(p, srv.redactor)
+	default:
+		return nil, fmt.Errorf("unknown redact mode %q, use pii", v)
+	}
+	return p, nil
+}
+
+// withoutCleaning returns the processors of p but ?clean=true's.
+func withoutCleaning(p postproc.Pipeline) postproc.Pipeline {
+	var out postproc.Pipeline
+	for _, proc := range p {
+		if _, ok := proc.(postproc.Disfluency); !ok {
+			out = append(out, proc)
+		}
+	}
+	return out
+}
+
+// processPartial runs a streamed chunk through the pipeline and the
+// request's processors before it's sent as a partial, so ?redact=pii
+// masks partials like the final transcript.
+func (srv *serverInfo) processPartial(ctx context.Context, r *http.Request, p *api.TranscriptResponse) error {
+	if err := srv.postprocess(ctx, p); err != nil {
+		return err
+	}
+	extra, err := srv.requestProcessors(r)
+	if err != nil {
+		return err
+	}
+	return runProcessors(ctx, extra, p)
+}
+
+// checkRewrite validates the ?rewrite=STYLE of a /transcribe request.
+func (srv *serverInfo) checkRewrite(r *http.Request) error {
+	style := r.URL.Query().Get("rewrite")
+	if style == "" {
+		return nil
+	}
+	if srv.rewriter == nil {
+		return fmt.Errorf("rewriting is disabled, start the server with -rewrite-model")
+	}
+	return postproc.CheckRewriteStyle(style)
+}
+
+// rewrite sets resp.Rewrite to the transcript polished in the style the
+// request asks for with ?rewrite=STYLE, leaving the text as it is.
+func (srv *serverInfo) rewrite(ctx context.Context, r *http.Request, resp *api.TranscriptResponse) error {
+	style := r.URL.Query().Get("rewrite")
+	if style == "" || strings.TrimSpace(resp.Text) == "" {
+		return nil
+	}
+	if err := srv.checkRewrite(r); err != nil {
+		return err
+	}
+	out, err := srv.rewriter.Rewrite(ctx, style, resp.Text)
+	if err != nil {
+		return err
+	}
+	resp.Rewrite = out
+	return nil
+}
+
+func runProcessors(ctx context.Context, pipeline postproc.Pipeline, resp *api.TranscriptResponse) error {
+	if len(pipeline) == 0 {
+		return nil
+	}
+	t := &postproc.Transcript{
+		Text:   resp.Text,
+		Lang:   resp.Lang,
+		Engine: resp.Engine,
+		Model:  resp.Model,
+	}
+	for _, l := range resp.Lines {
+		t.Lines = append(t.Lines, postproc.Line(l))
+	}
+	for _, c := range resp.Chapters {
+		t.Chapters = append(t.Chapters, postproc.Chapter(c))
+	}
+
+	if err := pipeline.Run(ctx, t); err != nil {
+		return err
+	}
+
+	resp.Text = t.Text
+	resp.Lines = resp.Lines[:0]
+	for _, l := range t.Lines {
+		resp.Lines = append(resp.Lines, api.TranscriptLine(l))
+	}
+	resp.Chapters = nil
+	for _, c := range t.Chapters {
+		resp.Chapters = append(resp.Chapters, api.Chapter(c))
+	}
+	return nil
+}
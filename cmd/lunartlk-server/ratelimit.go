@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimiter holds a token bucket per user: a user can make their
+// requests per minute in a burst, then one every minute/limit.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*rateBucket
+}
+
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: make(map[string]*rateBucket)}
+}
+
+// allow takes a request from name's bucket, refilled with perMinute
+// requests a minute. When it's empty, it returns how long until the next
+// request is allowed.
+func (l *rateLimiter) allow(name string, perMinute int, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	limit := float64(perMinute)
+	b := l.buckets[name]
+	if b == nil {
+		b = &rateBucket{tokens: limit, last: now}
+		l.buckets[name] = b
+	}
+	b.tokens = min(limit, b.tokens+now.Sub(b.last).Minutes()*limit)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / limit * float64(time.Minute))
+}
+
+// unmetered are the endpoints open without authentication, which don't
+// count against rate limits. /health only shows its details and waits
+// with a token.
+var unmetered = map[string]bool{
+	"/health":  true,
+	"/readyz":  true,
+	"/info":    true,
+	"/metrics": true,
+}
+
+// limitRate rejects the requests of users over their requests per minute
+// with 429, telling them when to retry.
+func (srv *serverInfo) limitRate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := srv.tokenUser(r)
+		if u == nil || unmetered[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limit := u.RequestsPerMinute
+		if limit == 0 {
+			limit = srv.rateLimit
+		}
+		if limit > 0 {
+			if ok, wait := srv.limiter.allow(u.Name, limit, time.Now()); !ok {
+				srv.usage.RecordRateLimited(u.Name)
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, fmt.Sprintf("rate limit of %d requests per minute exceeded", limit), http.StatusTooManyRequests)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
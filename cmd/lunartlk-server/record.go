@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rubiojr/lunartlk/internal/cli"
+	mdl "github.com/rubiojr/lunartlk/internal/models"
+)
+
+// recordedRequest describes a failed transcription saved by
+// -record-requests, next to its decoded audio.
+type recordedRequest struct {
+	Time   time.Time `json:"time"`
+	Engine string    `json:"engine"`
+	// Model is the model the request asked for, if any, aliases resolved.
+	Model      string  `json:"model,omitempty"`
+	Lang       string  `json:"lang"`
+	Query      string  `json:"query,omitempty"`
+	Upload     string  `json:"upload"`
+	SampleRate int32   `json:"sample_rate"`
+	Duration   float64 `json:"duration"`
+	Error      string  `json:"error"`
+}
+
+const (
+	recordedRequestFile = "request.json"
+	// recordedSamplesFile holds the samples as little-endian float32, as
+	// the engine got them, so a replay sees exactly the same audio.
+	recordedSamplesFile = "samples.f32"
+)
+
+// recordFailure saves a failed transcription to -record-requests for the
+// replay command. Requests the client cancelled aren't saved, nor encrypted
+// ones, whose audio must not reach the disk decrypted.
+func (srv *serverInfo) recordFailure(r *http.Request, engineName, model, langCode string, up *upload, err error) {
+	if srv.recordDir == "" || up.sealed || r.Context().Err() != nil || errors.Is(err, errModelMemory) {
+		return
+	}
+	req := recordedRequest{
+		Time:       time.Now(),
+		Engine:     engineName,
+		Model:      model,
+		Lang:       langCode,
+		Query:      r.URL.RawQuery,
+		Upload:     up.name,
+		SampleRate: up.sampleRate,
+		Duration:   up.duration(),
+		Error:      err.Error(),
+	}
+	dir, saveErr := saveRecordedRequest(srv.recordDir, req, up.samples)
+	if saveErr != nil {
+		log.Printf("[record] Can't save failed request: %v", saveErr)
+		return
+	}
+	log.Printf("[record] Saved failed request to %s", dir)
+}
+
+func saveRecordedRequest(root string, req recordedRequest, samples []float32) (string, error) {
+	id, err := newTranscriptID()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(root, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(req, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, recordedRequestFile), data, 0644); err != nil {
+		return "", err
+	}
+	pcm := make([]byte, 4*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint32(pcm[4*i:], math.Float32bits(s))
+	}
+	if err := os.WriteFile(filepath.Join(dir, recordedSamplesFile), pcm, 0644); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+func loadRecordedRequest(dir string) (*recordedRequest, []float32, error) {
+	data, err := os.ReadFile(filepath.Join(dir, recordedRequestFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	var req recordedRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return nil, nil, fmt.Errorf("decode %s: %w", recordedRequestFile, err)
+	}
+	pcm, err := os.ReadFile(filepath.Join(dir, recordedSamplesFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	samples := make([]float32, len(pcm)/4)
+	for i := range samples {
+		samples[i] = math.Float32frombits(binary.LittleEndian.Uint32(pcm[4*i:]))
+	}
+	return &req, samples, nil
+}
+
+// replayCommand re-runs the transcriptions saved by -record-requests with
+// the engines loaded locally, as bench does.
+func replayCommand() *cli.Command {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	engineFlag := fs.String("engine", "", "engine to use instead of the recorded one")
+	lang := fs.String("lang", "", "language to use instead of the recorded one")
+	timeout := fs.Duration("timeout", 0, "maximum processing time per request, e.g. 2m (0 means no limit)")
+	cacheDir := fs.String("cache", "", "cache directory for models (default: ~/.cache/lunartlk)")
+	ortLib := fs.String("ort", "", "ONNX Runtime library path (default: auto-detect)")
+
+	return &cli.Command{
+		Name:  "replay",
+		Short: "re-run failed requests saved with -record-requests",
+		Args:  "<dir>...",
+		Flags: fs,
+		Complete: map[string]func() []string{
+			"engine": func() []string { return []string{"moonshine", "parakeet"} },
+			"lang":   func() []string { return parakeetLangs },
+		},
+		Run: func(dirs []string) {
+			if len(dirs) == 0 {
+				log.Fatal("usage: lunartlk-server replay [-engine name] [-lang code] <dir>...")
+			}
+			cache := modelCacheDir(*cacheDir)
+			failed := false
+			for _, dir := range dirs {
+				if err := replay(dir, *engineFlag, *lang, cache, *ortLib, *timeout); err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", dir, err)
+					failed = true
+				}
+			}
+			if failed {
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func replay(dir, engineName, lang, cache, ortLib string, timeout time.Duration) error {
+	req, samples, err := loadRecordedRequest(dir)
+	if err != nil {
+		return err
+	}
+	if engineName == "" {
+		engineName = req.Engine
+	}
+	if lang == "" {
+		lang = req.Lang
+	}
+	fmt.Printf("%s: %s/%s, %.1fs of %s at %dHz, failed on %s with: %s\n",
+		dir, engineName, lang, req.Duration, req.Upload, req.SampleRate,
+		req.Time.Format(time.DateTime), req.Error)
+	if req.Query != "" {
+		fmt.Printf("  query: %s\n", req.Query)
+	}
+
+	t, err := benchTranscriber(engineName, lang, cache, ortLib)
+	if err != nil {
+		return err
+	}
+	// A Moonshine model asked for by name, e.g. tiny-en
+	if l, ok := t.(*lazyMoonshine); ok && engineName == req.Engine {
+		if _, known := mdl.MoonshineModels[req.Model]; known {
+			l.modelName = req.Model
+		}
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	resp, err := runTranscriber(ctx, t, samples, req.SampleRate, lang)
+	if err != nil {
+		return fmt.Errorf("transcription failed again: %w", err)
+	}
+	fmt.Printf("  %dms: %s\n", resp.ProcessingMs, resp.Text)
+	return nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/rubiojr/lunartlk/internal/alert"
+	"github.com/rubiojr/lunartlk/internal/notes"
+	"github.com/rubiojr/lunartlk/internal/postproc"
+	"github.com/rubiojr/lunartlk/internal/script"
+)
+
+// reloadResponse is returned by POST /admin/reload.
+type reloadResponse struct {
+	Users    int    `json:"users"`
+	Postproc string `json:"postproc,omitempty"`
+	Alerts   int    `json:"alerts"`
+	Scripts  int    `json:"scripts"`
+}
+
+// reloadFlags are the flags a reload reads again from the config file,
+// the environment and the command line.
+type reloadFlags struct {
+	users    string
+	user     stringList
+	postproc string
+	alerts   string
+	exports  string
+	scripts  string
+}
+
+func (f *reloadFlags) define(fs *flag.FlagSet) {
+	fs.StringVar(&f.users, "users", "", "JSON file with named users, their tokens and quotas")
+	fs.Var(&f.user, "user", "named user authenticated by a token, as name=token (repeatable), added to the -users file's")
+	fs.StringVar(&f.alerts, "alerts", "", "JSON file with keyword alert rules to check every transcript against")
+	fs.StringVar(&f.exports, "exports", "", "JSON file of profiles exporting transcripts to Joplin, Notion or CalDAV journals, picked with ?export=")
+	fs.StringVar(&f.scripts, "scripts", defaultScriptsDir(), "directory with Starlark scripts (*.star) run over every transcript")
+	fs.StringVar(&f.postproc, "postproc", "", "comma-separated post-processors to apply in order (e.g. punctuate,dictionary:words.txt,exec:./plugin)")
+}
+
+// reload reads the reloadFlags again, re-reads the users and alerts files,
+// the scripts and the TLS certificate, and rebuilds the post-processing
+// pipeline (re-reading dictionary files). Nothing changes unless all
+// succeed, and loaded models are left alone.
+func (srv *serverInfo) reload() (*reloadResponse, error) {
+	srv.reloadMu.Lock()
+	defer srv.reloadMu.Unlock()
+
+	f := reloadFlags{users: srv.usersFile, postproc: srv.postprocSpec, alerts: srv.alertsFile, exports: srv.exportsFile, scripts: srv.scriptsDir}
+	flagUsers := srv.flagUsers
+	if srv.reparse != nil {
+		f = reloadFlags{}
+		fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		f.define(fs)
+		if err := srv.reparse(fs); err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+		flagUsers = nil
+		for _, v := range f.user {
+			u, err := parseUserFlag(v)
+			if err != nil {
+				return nil, fmt.Errorf("users: %w", err)
+			}
+			flagUsers = append(flagUsers, u)
+		}
+	}
+
+	var users map[string]*user
+	if f.users != "" || len(flagUsers) > 0 {
+		var err error
+		if users, err = loadUsers(f.users, flagUsers); err != nil {
+			return nil, fmt.Errorf("users: %w", err)
+		}
+	}
+	pipeline, err := postproc.Parse(f.postproc)
+	if err != nil {
+		return nil, fmt.Errorf("postproc: %w", err)
+	}
+	var alerts []*alert.Rule
+	if f.alerts != "" {
+		if alerts, err = alert.Load(f.alerts); err != nil {
+			return nil, fmt.Errorf("alerts: %w", err)
+		}
+	}
+
+	var exports notes.Profiles
+	if f.exports != "" {
+		if exports, err = notes.Load(f.exports); err != nil {
+			return nil, fmt.Errorf("exports: %w", err)
+		}
+	}
+
+	var scripts script.Set
+	if f.scripts != "" {
+		if scripts, err = script.LoadDir(f.scripts); err != nil {
+			return nil, fmt.Errorf("scripts: %w", err)
+		}
+	}
+
+	var cert *tls.Certificate
+	if srv.tlsCert != nil {
+		if cert, err = srv.tlsCert.load(); err != nil {
+			return nil, fmt.Errorf("tls: %w", err)
+		}
+	}
+
+	srv.mu.Lock()
+	srv.usersFile, srv.flagUsers = f.users, flagUsers
+	srv.postprocSpec, srv.alertsFile = f.postproc, f.alerts
+	srv.exportsFile, srv.scriptsDir = f.exports, f.scripts
+	srv.users = users
+	srv.postproc = pipeline
+	srv.alerts = alerts
+	srv.exports = exports
+	srv.scripts = scripts
+	srv.mu.Unlock()
+	if cert != nil {
+		srv.tlsCert.cert.Store(cert)
+	}
+
+	return &reloadResponse{Users: len(users), Postproc: f.postproc, Alerts: len(alerts), Scripts: len(scripts)}, nil
+}
+
+// reloadOnSignal reloads the configuration every time the process gets SIGHUP.
+func (srv *serverInfo) reloadOnSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if res, err := srv.reload(); err != nil {
+				log.Printf("reload failed, keeping current configuration: %v", err)
+			} else {
+				log.Printf("Reloaded configuration (%d users)", res.Users)
+			}
+		}
+	}()
+}
+
+// handleReload reloads the configuration on request. It needs the -token
+// secret; named users can't trigger it.
+func handleReload(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	if !srv.authorizeAdmin(w, r) {
+		return
+	}
+	res, err := srv.reload()
+	if err != nil {
+		log.Printf("reload failed, keeping current configuration: %v", err)
+		http.Error(w, "reload failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("%s reloaded configuration (%d users)", r.RemoteAddr, res.Users)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// authorizeAdmin checks that r may use the /admin endpoints: with -token
+// set it must carry that token, otherwise admin access is only open when
+// the server has no authentication at all.
+func (srv *serverInfo) authorizeAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	switch {
+	case srv.token != "":
+		if token != srv.token {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return false
+		}
+	case srv.hasUsers():
+		http.Error(w, "admin endpoints need the server started with -token", http.StatusForbidden)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/rubiojr/lunartlk/internal/semantic"
+)
+
+// searchResult is a stored transcript matching a semantic search.
+type searchResult struct {
+	ID      string    `json:"id"`
+	Score   float64   `json:"score"`
+	Created time.Time `json:"created"`
+	Text    string    `json:"text"`
+}
+
+// handleSemanticSearch finds the stored transcripts closest in meaning to
+// ?q=. The caller's embeddings index is brought up to date first, so the
+// first search after many new transcripts is slower.
+func handleSemanticSearch(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	u, ok := srv.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if srv.embedder == nil {
+		http.Error(w, "semantic search disabled, start the server with -embed-model", http.StatusNotFound)
+		return
+	}
+	st, ok := userStore(w, srv, u)
+	if !ok {
+		return
+	}
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		http.Error(w, "missing q", http.StatusBadRequest)
+		return
+	}
+	limit := 10
+	if v := r.URL.Query().Get("n"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid n", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	recs, err := st.List()
+	if err != nil {
+		http.Error(w, "list transcripts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	byID := make(map[string]*storedTranscript)
+	docs := make(map[string]string)
+	for _, rec := range recs {
+		byID[rec.ID] = rec
+		docs[rec.ID] = rec.Results[len(rec.Results)-1].Text
+	}
+
+	// One update at a time, so concurrent searches don't embed the same
+	// transcripts twice
+	srv.searchMu.Lock()
+	path := filepath.Join(st.dir, "semantic-index.json")
+	idx, err := semantic.Load(path)
+	if err == nil {
+		var changed bool
+		changed, err = idx.Update(r.Context(), srv.embedder, docs)
+		if changed {
+			if err := idx.Save(path); err != nil {
+				log.Printf("[search] save index: %v", err)
+			}
+		}
+	}
+	srv.searchMu.Unlock()
+	if err != nil {
+		http.Error(w, "index transcripts: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	hits, err := idx.Search(r.Context(), srv.embedder, query, limit)
+	if err != nil {
+		http.Error(w, "search: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	results := []searchResult{}
+	for _, h := range hits {
+		rec := byID[h.ID]
+		results = append(results, searchResult{ID: h.ID, Score: h.Score, Created: rec.Created, Text: docs[h.ID]})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/postproc"
+)
+
+const (
+	// sessionIdle is how long a session's context is kept without
+	// dictations.
+	sessionIdle = time.Hour
+	// sessionContextWords is how many of the last words of a session are
+	// kept as its context.
+	sessionContextWords = 200
+	// sessionMaxTerms caps the spellings learned per session.
+	sessionMaxTerms = 500
+)
+
+// sessionTracker keeps the rolling context of the sessions clients group
+// their dictations in, so each one can be transcribed like the ones before
+// it.
+type sessionTracker struct {
+	mu       sync.Mutex
+	sessions map[string]*session // by user name and session ID
+}
+
+type session struct {
+	lastUsed time.Time
+	// context holds the last words said in the session.
+	context []string
+	// terms maps the lowercase form of names and acronyms said in the
+	// session to how they were written.
+	terms map[string]string
+}
+
+func newSessionTracker() *sessionTracker {
+	return &sessionTracker{sessions: make(map[string]*session)}
+}
+
+// validSessionID reports whether id can name a session: up to 64 letters,
+// digits, dashes, underscores and dots, not starting with a dot.
+func validSessionID(id string) bool {
+	if id == "" || len(id) > 64 || id[0] == '.' {
+		return false
+	}
+	for _, r := range id {
+		if !(r == '-' || r == '_' || r == '.' || r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return true
+}
+
+// sessionParam returns the ?session= of a request, or an error when it
+// isn't a valid session ID.
+func sessionParam(r *http.Request) (string, error) {
+	id := r.URL.Query().Get("session")
+	if id != "" && !validSessionID(id) {
+		return "", fmt.Errorf("invalid session %q, use up to 64 letters, digits, '-', '_' and '.'", id)
+	}
+	return id, nil
+}
+
+func sessionKey(u *user, id string) string {
+	if u == nil {
+		return "/" + id
+	}
+	return u.Name + "/" + id
+}
+
+// Apply writes the names and acronyms said earlier in the session the way
+// they were written then, and adds resp to the session's context.
+func (t *sessionTracker) Apply(u *user, id string, resp *api.TranscriptResponse) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for key, s := range t.sessions {
+		if now.Sub(s.lastUsed) > sessionIdle {
+			delete(t.sessions, key)
+		}
+	}
+	key := sessionKey(u, id)
+	s := t.sessions[key]
+	if s == nil {
+		s = &session{terms: make(map[string]string)}
+		t.sessions[key] = s
+	}
+	s.lastUsed = now
+
+	if len(s.terms) > 0 {
+		dict := &postproc.Dictionary{}
+		for lower, term := range s.terms {
+			dict.Add(lower, term)
+		}
+		resp.Text = dict.Replace(resp.Text)
+		for i := range resp.Lines {
+			resp.Lines[i].Text = dict.Replace(resp.Lines[i].Text)
+		}
+	}
+
+	words := strings.Fields(resp.Text)
+	for i, w := range words {
+		// Sentence starts are capitalized whatever the word
+		if i == 0 || strings.ContainsAny(words[i-1][len(words[i-1])-1:], ".?!") {
+			continue
+		}
+		if term := strings.TrimFunc(w, unicode.IsPunct); hasUpper(term) && len(s.terms) < sessionMaxTerms {
+			s.terms[strings.ToLower(term)] = term
+		}
+	}
+	s.context = append(s.context, words...)
+	if n := len(s.context) - sessionContextWords; n > 0 {
+		s.context = slices.Delete(s.context, 0, n)
+	}
+}
+
+// Context returns the last words said in a session and the spellings
+// learned in it, or false when the session isn't active.
+func (t *sessionTracker) Context(u *user, id string) (string, map[string]string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s, ok := t.sessions[sessionKey(u, id)]
+	if !ok || time.Since(s.lastUsed) > sessionIdle {
+		return "", nil, false
+	}
+	terms := make(map[string]string, len(s.terms))
+	for k, v := range s.terms {
+		terms[k] = v
+	}
+	return strings.Join(s.context, " "), terms, true
+}
+
+func hasUpper(s string) bool {
+	return strings.IndexFunc(s, unicode.IsUpper) >= 0
+}
+
+// sessionResponse is a session with its stored transcripts, oldest first.
+type sessionResponse struct {
+	ID          string              `json:"id"`
+	Active      bool                `json:"active"`
+	Context     string              `json:"context,omitempty"`
+	Terms       map[string]string   `json:"terms,omitempty"`
+	Transcripts []*storedTranscript `json:"transcripts"`
+}
+
+// handleGetSession responds with a session's transcripts as JSON, or
+// exports them as one document with ?format=md, txt or srt.
+func handleGetSession(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	u, ok := srv.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	id := r.PathValue("id")
+	if !validSessionID(id) {
+		http.Error(w, "invalid session id", http.StatusBadRequest)
+		return
+	}
+	st, ok := userStore(w, srv, u)
+	if !ok {
+		return
+	}
+	recs, err := st.List()
+	if err != nil {
+		http.Error(w, "list transcripts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recs = slices.DeleteFunc(recs, func(rec *storedTranscript) bool { return rec.Session != id })
+	slices.Reverse(recs)
+
+	resp := sessionResponse{ID: id, Transcripts: recs}
+	resp.Context, resp.Terms, resp.Active = srv.sessions.Context(u, id)
+	if len(recs) == 0 && !resp.Active {
+		http.Error(w, "session not found", http.StatusNotFound)
+		return
+	}
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(resp)
+	case "md":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		writeSessionMarkdown(w, id, recs)
+	case "txt":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for i, rec := range recs {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintln(w, rec.Results[len(rec.Results)-1].Text)
+		}
+	case "srt":
+		w.Header().Set("Content-Type", "application/x-subrip; charset=utf-8")
+		writeSRT(w, joinSession(recs))
+	default:
+		http.Error(w, "unsupported format "+format+" (json, md, txt, srt)", http.StatusBadRequest)
+	}
+}
+
+// writeSessionMarkdown renders a session as Markdown, with a section per
+// dictation.
+func writeSessionMarkdown(w io.Writer, id string, recs []*storedTranscript) {
+	fmt.Fprintf(w, "# Session %s\n", id)
+	for _, rec := range recs {
+		fmt.Fprintf(w, "\n## %s\n\n%s\n", rec.Created.Format("2006-01-02 15:04:05"), rec.Results[len(rec.Results)-1].Text)
+	}
+}
+
+// joinSession returns the latest results of a session's transcripts as one
+// transcript, with the lines of each dictation after those of the ones
+// before it.
+func joinSession(recs []*storedTranscript) *api.TranscriptResponse {
+	joined := &api.TranscriptResponse{}
+	var texts []string
+	for _, rec := range recs {
+		res := rec.Results[len(rec.Results)-1]
+		lines := res.Lines
+		if len(lines) == 0 {
+			lines = []api.TranscriptLine{{Text: res.Text, Duration: res.AudioDuration}}
+		}
+		for _, l := range lines {
+			l.StartTime += joined.AudioDuration
+			joined.Lines = append(joined.Lines, l)
+		}
+		joined.AudioDuration += res.AudioDuration
+		texts = append(texts, res.Text)
+	}
+	joined.Text = strings.Join(texts, " ")
+	return joined
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/audio"
+	"github.com/rubiojr/lunartlk/internal/resample"
+	"github.com/rubiojr/lunartlk/internal/speaker"
+)
+
+// speakerRecognizer labels transcript lines with the names of enrolled
+// speakers, whose voiceprints each user keeps in the state directory.
+type speakerRecognizer struct {
+	model     *speaker.Model
+	threshold float64
+	dir       string
+
+	mu       sync.Mutex
+	profiles map[string]*speaker.Profiles // by user name
+}
+
+func newSpeakerRecognizer(model *speaker.Model, threshold float64) *speakerRecognizer {
+	return &speakerRecognizer{
+		model:     model,
+		threshold: threshold,
+		dir:       filepath.Join(stateDir(), "speakers"),
+		profiles:  make(map[string]*speaker.Profiles),
+	}
+}
+
+// profilesFor returns the speakers u enrolled. Requests without a user
+// share the default profiles.
+func (sr *speakerRecognizer) profilesFor(u *user) (*speaker.Profiles, error) {
+	name := "default"
+	if u != nil {
+		name = "user-" + u.Name
+	}
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if p, ok := sr.profiles[name]; ok {
+		return p, nil
+	}
+	p, err := speaker.LoadProfiles(filepath.Join(sr.dir, name+".json"))
+	if err != nil {
+		return nil, err
+	}
+	sr.profiles[name] = p
+	return p, nil
+}
+
+// label names the speakers of resp's lines that match one of u's enrolled
+// voiceprints. Each diarized speaker is matched on all of their lines
+// together, and a name goes to the best match only.
+func (sr *speakerRecognizer) label(u *user, up *upload, resp *api.TranscriptResponse) {
+	if len(resp.Lines) == 0 || len(up.samples) == 0 {
+		return
+	}
+	profiles, err := sr.profilesFor(u)
+	if err != nil {
+		log.Printf("speakers: %v", err)
+		return
+	}
+	if profiles.Len() == 0 {
+		return
+	}
+
+	samples := up.samples
+	if up.sampleRate != audio.SampleRate {
+		samples = resample.Resample(samples, int(up.sampleRate), audio.SampleRate, resampleQuality)
+	}
+	bySpeaker := make(map[uint32][]float32)
+	for _, l := range resp.Lines {
+		start := min(int(l.StartTime*audio.SampleRate), len(samples))
+		end := min(int((l.StartTime+l.Duration)*audio.SampleRate), len(samples))
+		bySpeaker[l.Speaker] = append(bySpeaker[l.Speaker], samples[start:end]...)
+	}
+
+	type match struct {
+		speaker uint32
+		score   float64
+	}
+	best := make(map[string]match)
+	for spk, s := range bySpeaker {
+		if len(s) < speaker.MinSamples {
+			continue
+		}
+		emb, err := sr.model.Embed(s)
+		if err != nil {
+			log.Printf("speakers: %v", err)
+			continue
+		}
+		name, score, ok := profiles.Identify(emb, sr.threshold)
+		if ok && (best[name] == match{} || score > best[name].score) {
+			best[name] = match{spk, score}
+		}
+	}
+	names := make(map[uint32]string)
+	for name, m := range best {
+		names[m.speaker] = name
+	}
+	for i := range resp.Lines {
+		resp.Lines[i].SpeakerName = names[resp.Lines[i].Speaker]
+	}
+}
+
+// validSpeakerName reports whether name can name an enrolled speaker: up
+// to 64 characters, no control characters or slashes.
+func validSpeakerName(name string) bool {
+	if strings.TrimSpace(name) == "" || len(name) > 64 || strings.ContainsRune(name, '/') {
+		return false
+	}
+	return strings.IndexFunc(name, unicode.IsControl) < 0
+}
+
+// handleListSpeakers responds with the names of the caller's enrolled
+// speakers and how many clips each has.
+func handleListSpeakers(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	profiles, ok := speakerProfiles(w, r, srv)
+	if !ok {
+		return
+	}
+	type entry struct {
+		Name    string `json:"name"`
+		Clips   int    `json:"clips"`
+		Updated string `json:"updated"`
+	}
+	list := []entry{}
+	for _, p := range profiles.List() {
+		list = append(list, entry{p.Name, p.Clips, p.Updated.Format(time.RFC3339)})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// handleEnrollSpeaker adds the voiceprint of an uploaded clip to the named
+// speaker. Enrolling several clips of the same person makes recognizing
+// them more reliable.
+func handleEnrollSpeaker(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	profiles, ok := speakerProfiles(w, r, srv)
+	if !ok {
+		return
+	}
+	name := r.PathValue("name")
+	if !validSpeakerName(name) {
+		http.Error(w, "invalid speaker name", http.StatusBadRequest)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, srv.maxUpload)
+	if !srv.decompressBody(w, r) {
+		return
+	}
+	up, ok := srv.readUpload(w, r)
+	if !ok {
+		return
+	}
+	samples := up.samples
+	if up.sampleRate != audio.SampleRate {
+		samples = resample.Resample(samples, int(up.sampleRate), audio.SampleRate, resampleQuality)
+	}
+	emb, err := srv.speakers.model.Embed(samples)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	p, err := profiles.Enroll(name, emb)
+	if err != nil {
+		http.Error(w, "enroll: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.Printf("[speakers] Enrolled %s (%d clips)", name, p.Clips)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"name": p.Name, "clips": p.Clips})
+}
+
+// handleRemoveSpeaker deletes an enrolled speaker.
+func handleRemoveSpeaker(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	profiles, ok := speakerProfiles(w, r, srv)
+	if !ok {
+		return
+	}
+	found, err := profiles.Remove(r.PathValue("name"))
+	if err != nil {
+		http.Error(w, "remove: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "speaker not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// speakerProfiles authenticates the request and returns the caller's
+// enrolled speakers.
+func speakerProfiles(w http.ResponseWriter, r *http.Request, srv *serverInfo) (*speaker.Profiles, bool) {
+	u, ok := srv.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	if srv.speakers == nil {
+		http.Error(w, "speaker recognition disabled, start the server with -speaker-model", http.StatusNotFound)
+		return nil, false
+	}
+	profiles, err := srv.speakers.profilesFor(u)
+	if err != nil {
+		http.Error(w, "load speakers: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return profiles, true
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+)
+
+// storedTranscript is a saved upload together with every transcription
+// produced for it. The first result is the original request; later results
+// come from re-transcriptions with other engines.
+type storedTranscript struct {
+	ID      string    `json:"id"`
+	Created time.Time `json:"created"`
+	Audio   string    `json:"audio"`
+	// Session groups the dictations a client sent with ?session=.
+	Session string                    `json:"session,omitempty"`
+	Results []*api.TranscriptResponse `json:"results"`
+}
+
+// transcriptStore keeps uploaded audio and transcripts on disk, one
+// directory per upload.
+type transcriptStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func newTranscriptStore(dir string) (*transcriptStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create store dir %s: %w", dir, err)
+	}
+	return &transcriptStore{dir: dir}, nil
+}
+
+// sub returns a store rooted at a subdirectory of s.
+func (s *transcriptStore) sub(name string) (*transcriptStore, error) {
+	return newTranscriptStore(filepath.Join(s.dir, name))
+}
+
+// Save stores the uploaded audio and its first transcript, returning the new ID.
+func (s *transcriptStore) Save(audioName string, data []byte, resp *api.TranscriptResponse) (string, error) {
+	id, err := newTranscriptID()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(s.dir, id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("create %s: %w", dir, err)
+	}
+
+	audioFile := "audio" + audioExt(audioName)
+	if err := os.WriteFile(filepath.Join(dir, audioFile), data, 0644); err != nil {
+		return "", fmt.Errorf("write audio: %w", err)
+	}
+
+	rec := &storedTranscript{
+		ID:      id,
+		Created: time.Now(),
+		Audio:   audioFile,
+		Session: resp.Session,
+		Results: []*api.TranscriptResponse{resp},
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return id, s.write(rec)
+}
+
+// Load returns the stored record for id.
+func (s *transcriptStore) Load(id string) (*storedTranscript, error) {
+	if !validTranscriptID(id) {
+		return nil, fmt.Errorf("invalid transcript id %q", id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.read(id)
+}
+
+// Audio returns the stored audio bytes and original file name for a record.
+func (s *transcriptStore) Audio(rec *storedTranscript) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.dir, rec.ID, rec.Audio))
+}
+
+// Append adds a new transcription result to an existing record.
+func (s *transcriptStore) Append(id string, resp *api.TranscriptResponse) (*storedTranscript, error) {
+	if !validTranscriptID(id) {
+		return nil, fmt.Errorf("invalid transcript id %q", id)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, err := s.read(id)
+	if err != nil {
+		return nil, err
+	}
+	rec.Results = append(rec.Results, resp)
+	return rec, s.write(rec)
+}
+
+// List returns all stored records, newest first.
+func (s *transcriptStore) List() ([]*storedTranscript, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var recs []*storedTranscript
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		rec, err := s.read(e.Name())
+		if err != nil {
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].Created.After(recs[j].Created) })
+	return recs, nil
+}
+
+func (s *transcriptStore) read(id string) (*storedTranscript, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, id, "record.json"))
+	if err != nil {
+		return nil, err
+	}
+	var rec storedTranscript
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("decode record %s: %w", id, err)
+	}
+	return &rec, nil
+}
+
+func (s *transcriptStore) write(rec *storedTranscript) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, rec.ID, "record.json")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func newTranscriptID() (string, error) {
+	var b [4]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return time.Now().Format("2006-01-02T15-04-05") + "-" + hex.EncodeToString(b[:]), nil
+}
+
+func validTranscriptID(id string) bool {
+	return id != "" && id != "." && id != ".." && filepath.Base(id) == id
+}
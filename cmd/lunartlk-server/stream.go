@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/audio"
+	"github.com/rubiojr/lunartlk/internal/queue"
+	"github.com/rubiojr/lunartlk/internal/vad"
+)
+
+// uploadError ends a streamed upload with an HTTP status.
+type uploadError struct {
+	status int
+	err    error
+}
+
+func (e *uploadError) Error() string { return e.err.Error() }
+
+// handleStreamingUpload transcribes a WAV upload while it's still
+// arriving: the audio is cut into speech chunks at pauses, no longer than
+// -stream-chunk, and each chunk is transcribed as soon as it's complete,
+// so network and compute time overlap on long uploads over slow links.
+// With ?partials=true the transcript of each chunk is sent as soon as it's
+// ready, as a line of newline-delimited JSON, before the final transcript.
+// Chunks go through the response cache, escalation and routing like whole
+// uploads.
+func handleStreamingUpload(w http.ResponseWriter, r *http.Request, srv *serverInfo, u *user, t transcriber, engineName, model, langCode string, prio queue.Priority) {
+	part, err := audioPart(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer part.Close()
+	name := strings.ToLower(part.FileName())
+	if !strings.HasSuffix(name, ".wav") {
+		http.Error(w, "streaming needs a .wav upload", http.StatusBadRequest)
+		return
+	}
+
+	// The original upload is only kept when it's stored
+	var data bytes.Buffer
+	body := io.Reader(part)
+	if st, _ := srv.storeFor(u); st != nil {
+		body = io.TeeReader(part, &data)
+	}
+	wav, err := audio.NewWAVReader(body)
+	if err != nil {
+		http.Error(w, "failed to decode audio: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	rate := wav.SampleRate()
+	// Streamed WAVs may not announce their length, so the limits are also
+	// checked as the audio arrives
+	if err := srv.checkQuota(u, wav.Duration()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	ctx, cancel := srv.requestContext(r, prio)
+	defer cancel()
+
+	rc := http.NewResponseController(w)
+	partials := r.URL.Query().Get("partials") == "true"
+	var pw *partialWriter
+	if partials {
+		// HTTP/1.1 responses can't start before the request body is read
+		// otherwise. HTTP/2 is always full duplex.
+		rc.EnableFullDuplex()
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		pw = &partialWriter{ResponseWriter: w}
+		w = pw
+	}
+
+	cfg := vad.DefaultConfig()
+	cfg.MaxSegment = srv.streamChunk
+	seg := vad.NewSegmenter(int(rate), cfg)
+
+	cacheName := engineName
+	if model != "" {
+		cacheName += "/" + model
+	}
+
+	// Chunks are transcribed in order by a single worker while the upload
+	// goes on. failed is the chunk the transcription failed at.
+	chunks := make(chan vad.Chunk, 16)
+	done := make(chan error, 1)
+	var failed *upload
+	resp := &api.TranscriptResponse{Lang: langCode, Timings: &api.Timings{}}
+	go func() {
+		var texts []string
+		for c := range chunks {
+			chunk := &upload{name: name, samples: c.Samples, sampleRate: rate}
+			// A slot is only held while a chunk is transcribed, not while
+			// the rest of the upload arrives
+			var cr *api.TranscriptResponse
+			release, err := srv.acquire(ctx)
+			if err == nil {
+				cr, err = srv.transcribe(withoutPadding(ctx), t, cacheName, c.Samples, rate, langCode)
+				if err == nil {
+					err = srv.routeLines(ctx, r, t, langCode, chunk, cr)
+				}
+				release()
+			}
+			if err != nil {
+				failed = chunk
+				cancel()
+				done <- err
+				return
+			}
+			if cr.Text != "" {
+				texts = append(texts, cr.Text)
+			}
+			offset := c.Start.Seconds()
+			first := len(resp.Lines)
+			for _, l := range cr.Lines {
+				l.StartTime = math.Round((l.StartTime+offset)*1000) / 1000
+				resp.Lines = append(resp.Lines, l)
+			}
+			if partials {
+				p := &api.TranscriptResponse{Text: cr.Text, Lines: slices.Clone(resp.Lines[first:]), Lang: langCode, Engine: cr.Engine, Model: cr.Model}
+				if err := srv.processPartial(ctx, r, p); err != nil {
+					failed = chunk
+					cancel()
+					done <- fmt.Errorf("post-processing failed: %w", err)
+					return
+				}
+				pw.send(api.Partial{
+					Partial:   true,
+					Text:      p.Text,
+					Lines:     p.Lines,
+					StartTime: offset,
+					Duration:  float64(len(c.Samples)) / float64(rate),
+				})
+				rc.Flush()
+			}
+			resp.Model, resp.Engine = cr.Model, cr.Engine
+			resp.ProcessingMs += cr.ProcessingMs
+			resp.Timings.PreprocessMs += cr.Timings.PreprocessMs
+			resp.Timings.EncoderMs += cr.Timings.EncoderMs
+			resp.Timings.SearchMs += cr.Timings.SearchMs
+		}
+		resp.Text = strings.Join(texts, " ")
+		done <- nil
+	}()
+	send := func(cs []vad.Chunk) {
+		for _, c := range cs {
+			select {
+			case chunks <- c:
+			case <-ctx.Done():
+			}
+		}
+	}
+
+	var total int
+	var decodeTime time.Duration
+	stats := audio.NewStats(int(rate))
+	var readErr *uploadError
+	for ctx.Err() == nil {
+		start := time.Now()
+		samples, err := wav.Read(int(rate))
+		decodeTime += time.Since(start)
+		total += len(samples)
+		stats.Add(samples)
+		secs := float64(total) / float64(rate)
+		if srv.maxDuration > 0 && secs > srv.maxDuration.Seconds() {
+			readErr = &uploadError{http.StatusUnprocessableEntity, fmt.Errorf("audio is over %.1fs long, the limit is %s", secs, srv.maxDuration)}
+			break
+		}
+		if err := srv.checkQuota(u, secs); err != nil {
+			readErr = &uploadError{http.StatusForbidden, err}
+			break
+		}
+		send(seg.Write(samples))
+		if errors.Is(err, io.EOF) {
+			send(seg.Flush())
+			break
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			readErr = &uploadError{http.StatusRequestEntityTooLarge, fmt.Errorf("upload exceeds the %s limit", formatSize(tooLarge.Limit))}
+			break
+		}
+		if err != nil {
+			readErr = &uploadError{http.StatusBadRequest, fmt.Errorf("failed to read upload: %w", err)}
+			break
+		}
+	}
+	if readErr != nil {
+		cancel()
+	}
+	close(chunks)
+
+	err = <-done
+	switch {
+	case readErr != nil && (readErr.status == http.StatusRequestEntityTooLarge || readErr.status == http.StatusUnprocessableEntity):
+		jsonError(w, readErr.Error(), readErr.status)
+		return
+	case readErr != nil:
+		http.Error(w, readErr.Error(), readErr.status)
+		return
+	case err != nil:
+		srv.recordFailure(r, engineName, model, langCode, failed, err)
+		srv.auditRequest(r, u, engineName, model, langCode, &upload{name: name, data: data.Bytes(), sampleRate: rate, seconds: float64(total) / float64(rate)}, nil, err)
+		transcriptionError(w, r, err)
+		return
+	}
+
+	up := &upload{name: name, data: data.Bytes(), sampleRate: rate, decodeTime: decodeTime, stats: stats}
+	resp.AudioDuration = math.Round(float64(total)/float64(rate)*1000) / 1000
+	srv.finishTranscription(ctx, w, r, u, engineName, langCode, up, resp)
+}
+
+// partialWriter is the response of a ?partials=true upload. Once the
+// first partial is sent the status can't change, so error responses
+// written after it become a last line, an api.StreamError, in place of
+// the final transcript.
+type partialWriter struct {
+	http.ResponseWriter
+	started bool
+	// status is that of the error response being written after the
+	// first partial.
+	status int
+}
+
+// send writes a partial, starting the response.
+func (pw *partialWriter) send(p api.Partial) {
+	pw.started = true
+	json.NewEncoder(pw.ResponseWriter).Encode(p)
+}
+
+func (pw *partialWriter) WriteHeader(code int) {
+	switch {
+	case !pw.started:
+		pw.ResponseWriter.WriteHeader(code)
+	case code >= http.StatusBadRequest:
+		pw.status = code
+	}
+}
+
+func (pw *partialWriter) Write(b []byte) (int, error) {
+	if pw.status == 0 {
+		return pw.ResponseWriter.Write(b)
+	}
+	// The error is plain text from http.Error, or JSON from jsonError
+	msg := strings.TrimSpace(string(b))
+	var je struct {
+		Error string `json:"error"`
+	}
+	if json.Unmarshal(b, &je) == nil && je.Error != "" {
+		msg = je.Error
+	}
+	if err := json.NewEncoder(pw.ResponseWriter).Encode(api.StreamError{Message: msg, Status: pw.status}); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (pw *partialWriter) Unwrap() http.ResponseWriter { return pw.ResponseWriter }
+
+// audioPart returns the 'audio' file of a multipart request without
+// reading the rest of the body.
+func audioPart(r *http.Request) (*multipart.Part, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("missing 'audio' form file: %w", err)
+	}
+	for {
+		p, err := mr.NextPart()
+		if err != nil {
+			return nil, fmt.Errorf("missing 'audio' form file: %w", err)
+		}
+		if p.FormName() == "audio" && p.FileName() != "" {
+			return p, nil
+		}
+		p.Close()
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// selfSignedValidity is how long generated certificates are valid, and
+// selfSignedRenew how long before they expire they're replaced.
+const (
+	selfSignedValidity = 365 * 24 * time.Hour
+	selfSignedRenew    = 30 * 24 * time.Hour
+)
+
+// serverCert is the certificate served over TLS, replaced when its files
+// are reloaded.
+type serverCert struct {
+	certFile, keyFile string
+	cert              atomic.Pointer[tls.Certificate]
+}
+
+func loadServerCert(certFile, keyFile string) (*serverCert, error) {
+	sc := &serverCert{certFile: certFile, keyFile: keyFile}
+	cert, err := sc.load()
+	if err != nil {
+		return nil, err
+	}
+	sc.cert.Store(cert)
+	return sc, nil
+}
+
+// load reads the certificate and key files, e.g. again after a renewal.
+func (sc *serverCert) load() (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(sc.certFile, sc.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", sc.certFile, err)
+	}
+	return &cert, nil
+}
+
+func (sc *serverCert) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return sc.cert.Load(), nil
+		},
+	}
+}
+
+// fingerprint returns the SHA-256 digest of the certificate, as browsers
+// and openssl show it, for users to check what they're trusting.
+func (sc *serverCert) fingerprint() string {
+	return certFingerprint(sc.cert.Load().Certificate[0])
+}
+
+// certFingerprint returns the SHA-256 digest of a DER certificate, as
+// colon-separated hex.
+func certFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// selfSignedCert returns the certificate and key files of a self-signed
+// certificate in dir, generating them when missing, about to expire, or
+// not valid for one of the machine's current names and addresses. A new
+// certificate keeps the key in key.pem, if there's one.
+func selfSignedCert(dir string) (certFile, keyFile string, err error) {
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	hosts, ips := localNames()
+	if selfSignedValid(certFile, hosts, ips) {
+		return certFile, keyFile, nil
+	}
+
+	key, err := loadECKey(keyFile)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[tls] Generating a new key: %v", err)
+		}
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			return "", "", err
+		}
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"lunartlk"}, CommonName: hosts[0]},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(selfSignedValidity),
+		// Its own CA, so clients can trust it as a root
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:              hosts,
+		IPAddresses:           ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return "", "", err
+	}
+	_, statErr := os.Stat(certFile)
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return "", "", err
+	}
+	if statErr == nil {
+		log.Printf("[tls] *** Replaced the self-signed certificate %s: clients must trust the new one ***", certFile)
+	} else {
+		log.Printf("[tls] *** Generated a self-signed certificate in %s ***", certFile)
+	}
+	log.Printf("[tls] *** New SHA-256 fingerprint %s ***", certFingerprint(der))
+	return certFile, keyFile, nil
+}
+
+// loadECKey reads the ECDSA key a previous certificate was issued with.
+func loadECKey(keyFile string) (*ecdsa.PrivateKey, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data", keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", keyFile, err)
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: not an ECDSA key", keyFile)
+	}
+	return key, nil
+}
+
+// selfSignedValid reports whether the certificate in certFile can still be
+// used for hosts and ips.
+func selfSignedValid(certFile string, hosts []string, ips []net.IP) bool {
+	data, err := os.ReadFile(certFile)
+	if err != nil {
+		return false
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil || time.Until(cert.NotAfter) < selfSignedRenew {
+		return false
+	}
+	for _, h := range hosts {
+		if !slices.Contains(cert.DNSNames, h) {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+			return false
+		}
+	}
+	return true
+}
+
+// localNames returns the names and addresses the server can be reached
+// at: the hostname, localhost, and the addresses of the network
+// interfaces.
+func localNames() ([]string, []net.IP) {
+	var hosts []string
+	if h, err := os.Hostname(); err == nil && h != "" && h != "localhost" {
+		hosts = append(hosts, h)
+		if !strings.Contains(h, ".") {
+			// mDNS
+			hosts = append(hosts, h+".local")
+		}
+	}
+	hosts = append(hosts, "localhost")
+
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		ipnet, ok := a.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		ips = append(ips, ipnet.IP)
+	}
+	return hosts, ips
+}
+
+// tlsFlags checks the TLS flags and returns the certificate to serve, or
+// nil to serve plain HTTP.
+func tlsFlags(certFile, keyFile string, selfSigned bool) (*serverCert, error) {
+	switch {
+	case selfSigned && (certFile != "" || keyFile != ""):
+		return nil, errors.New("-tls-self-signed can't be combined with -tls-cert and -tls-key")
+	case selfSigned:
+		var err error
+		if certFile, keyFile, err = selfSignedCert(filepath.Join(stateDir(), "tls")); err != nil {
+			return nil, fmt.Errorf("self-signed certificate: %w", err)
+		}
+	case certFile == "" && keyFile == "":
+		return nil, nil
+	case certFile == "" || keyFile == "":
+		return nil, errors.New("-tls-cert and -tls-key go together")
+	}
+	return loadServerCert(certFile, keyFile)
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+)
+
+func handleListTranscripts(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	u, ok := srv.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	st, ok := userStore(w, srv, u)
+	if !ok {
+		return
+	}
+	recs, err := st.List()
+	if err != nil {
+		http.Error(w, "list transcripts: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if recs == nil {
+		recs = []*storedTranscript{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recs)
+}
+
+// handleGetTranscript responds with a stored transcript as JSON, or its
+// latest result as Markdown or SubRip with ?format=md or ?format=srt.
+func handleGetTranscript(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	_, _, rec, ok := loadStoredTranscript(w, r, srv)
+	if !ok {
+		return
+	}
+	latest := rec.Results[len(rec.Results)-1]
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rec)
+	case "md":
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		writeMarkdown(w, rec.Created, latest)
+	case "srt":
+		w.Header().Set("Content-Type", "application/x-subrip; charset=utf-8")
+		writeSRT(w, latest)
+	default:
+		http.Error(w, "unsupported format "+format+" (json, md, srt)", http.StatusBadRequest)
+	}
+}
+
+// handleRetranscribe re-runs the stored audio of a transcript through the
+// engine/lang given in the query and appends the result to the record.
+func handleRetranscribe(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	u, st, rec, ok := loadStoredTranscript(w, r, srv)
+	if !ok || srv.shed(w) {
+		return
+	}
+
+	langCode := r.URL.Query().Get("lang")
+	if langCode == "" {
+		langCode = rec.Results[0].Lang
+	}
+	engineName := r.URL.Query().Get("engine")
+	if engineName == "" {
+		engineName = srv.defaultEng
+	}
+
+	t, err := srv.selectTranscriber(engineName, langCode, "")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	prio, err := srv.requestPriority(r, u)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := st.Audio(rec)
+	if err != nil {
+		http.Error(w, "read stored audio: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	name, data, err := srv.unseal(rec.Audio, data)
+	if err != nil {
+		http.Error(w, "failed to decrypt stored audio: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	samples, sampleRate, err := decodeAudio(name, data)
+	if err != nil {
+		http.Error(w, "failed to decode stored audio: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	audioSeconds := float64(len(samples)) / float64(sampleRate)
+	if err := srv.checkQuota(u, audioSeconds); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	release, ok := srv.enter(w, r, u)
+	if !ok {
+		return
+	}
+	defer release()
+
+	ctx, cancel := srv.requestContext(r, prio)
+	defer cancel()
+
+	up := &upload{name: name, data: data, samples: samples, sampleRate: sampleRate}
+	resp, err := srv.transcribe(ctx, t, engineName, samples, sampleRate, langCode)
+	if err != nil {
+		srv.auditRequest(r, u, engineName, "", langCode, up, nil, err)
+		transcriptionError(w, r, err)
+		return
+	}
+	if err := srv.postprocess(ctx, resp); err != nil {
+		srv.auditRequest(r, u, engineName, "", langCode, up, nil, err)
+		http.Error(w, "post-processing failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	save, err := srv.runScripts(ctx, resp)
+	if err != nil {
+		srv.auditRequest(r, u, engineName, "", langCode, up, nil, err)
+		http.Error(w, "script failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.ID = rec.ID
+	resp.Timings = nil
+	srv.recordUsage(u, resp)
+
+	// A script vetoing the result leaves the record as it was
+	if save {
+		rec, err = st.Append(rec.ID, resp)
+		if err != nil {
+			http.Error(w, "store transcript: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rec)
+
+	srv.notify(resp)
+
+	srv.logRequest(r, engineName, langCode, rec.Audio, resp)
+	srv.auditRequest(r, u, engineName, "", langCode, up, resp, nil)
+}
+
+// loadStoredTranscript authenticates the request and loads the transcript
+// named in the path from the caller's store.
+func loadStoredTranscript(w http.ResponseWriter, r *http.Request, srv *serverInfo) (*user, *transcriptStore, *storedTranscript, bool) {
+	u, ok := srv.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, nil, nil, false
+	}
+	st, ok := userStore(w, srv, u)
+	if !ok {
+		return nil, nil, nil, false
+	}
+	rec, err := st.Load(r.PathValue("id"))
+	if os.IsNotExist(err) {
+		http.Error(w, "transcript not found", http.StatusNotFound)
+		return nil, nil, nil, false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, nil, nil, false
+	}
+	return u, st, rec, true
+}
+
+func userStore(w http.ResponseWriter, srv *serverInfo, u *user) (*transcriptStore, bool) {
+	st, err := srv.storeFor(u)
+	if err != nil {
+		http.Error(w, "open store: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if st == nil {
+		http.Error(w, "transcript storage disabled, start the server with -store", http.StatusNotFound)
+		return nil, false
+	}
+	return st, true
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rubiojr/lunartlk/internal/seal"
+)
+
+// uploadExpiry is how long a resumable upload is kept after its last
+// chunk.
+const uploadExpiry = 24 * time.Hour
+
+// maxOpenUploads is how many resumable uploads each user may keep at a
+// time.
+const maxOpenUploads = 10
+
+// resumableUploads keeps the audio clients upload in chunks, so an upload
+// interrupted by a flaky network resumes where it stopped instead of
+// starting over. The audio is transcribed with /transcribe?upload=ID once
+// it's complete.
+type resumableUploads struct {
+	dir string
+
+	mu      sync.Mutex
+	uploads map[string]*resumableUpload
+}
+
+type resumableUpload struct {
+	mu     sync.Mutex // held while a chunk is written
+	user   string
+	name   string
+	length int64
+	// offset is how many bytes were received, updated as they arrive.
+	offset atomic.Int64
+	path   string
+	// updated is when the last chunk was written.
+	updated time.Time
+
+	// interrupt stops the chunk being written, so a client that lost its
+	// connection and resumes doesn't wait for the server to notice.
+	imu       sync.Mutex
+	interrupt func()
+}
+
+// newResumableUploads keeps uploads in dir. Uploads are only known to
+// the process that started them, so those left by a previous run are
+// removed.
+func newResumableUploads(dir string) *resumableUploads {
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		os.Remove(filepath.Join(dir, e.Name()))
+	}
+	if len(entries) > 0 {
+		log.Printf("Removed %d resumable uploads left by a previous run", len(entries))
+	}
+	return &resumableUploads{dir: dir, uploads: make(map[string]*resumableUpload)}
+}
+
+func uploadOwner(u *user) string {
+	if u == nil {
+		return ""
+	}
+	return u.Name
+}
+
+// create starts an upload of length bytes, removing the expired ones. A
+// user can have maxOpenUploads at a time.
+func (ru *resumableUploads) create(u *user, name string, length int64) (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b[:])
+
+	ru.mu.Lock()
+	defer ru.mu.Unlock()
+	open := 0
+	for id, up := range ru.uploads {
+		// Uploads being written aren't idle
+		if up.mu.TryLock() {
+			expired := time.Since(up.updated) > uploadExpiry
+			up.mu.Unlock()
+			if expired {
+				os.Remove(up.path)
+				delete(ru.uploads, id)
+				continue
+			}
+		}
+		if up.user == uploadOwner(u) {
+			open++
+		}
+	}
+	if open >= maxOpenUploads {
+		return "", errTooManyUploads
+	}
+
+	if err := os.MkdirAll(ru.dir, 0700); err != nil {
+		return "", err
+	}
+	path := filepath.Join(ru.dir, id)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	ru.uploads[id] = &resumableUpload{user: uploadOwner(u), name: name, length: length, path: path, updated: time.Now()}
+	return id, nil
+}
+
+// get returns u's upload id, or nil.
+func (ru *resumableUploads) get(u *user, id string) *resumableUpload {
+	ru.mu.Lock()
+	defer ru.mu.Unlock()
+	up := ru.uploads[id]
+	if up == nil || up.user != uploadOwner(u) {
+		return nil
+	}
+	return up
+}
+
+// remove deletes u's upload id, reporting whether it existed.
+func (ru *resumableUploads) remove(u *user, id string) bool {
+	ru.mu.Lock()
+	defer ru.mu.Unlock()
+	up := ru.uploads[id]
+	if up == nil || up.user != uploadOwner(u) {
+		return false
+	}
+	delete(ru.uploads, id)
+	os.Remove(up.path)
+	return true
+}
+
+// write appends the body of r to the upload, which must be at offset.
+// What was received is kept even when the body fails partway, so the
+// client can resume from there. A chunk still being written is
+// interrupted.
+func (up *resumableUpload) write(offset int64, w http.ResponseWriter, r *http.Request) (int64, error) {
+	up.imu.Lock()
+	if up.interrupt != nil {
+		up.interrupt()
+	}
+	up.imu.Unlock()
+
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if offset != up.offset.Load() {
+		return up.offset.Load(), errOffsetMismatch
+	}
+	rc := http.NewResponseController(w)
+	up.imu.Lock()
+	up.interrupt = func() { rc.SetReadDeadline(time.Now()) }
+	up.imu.Unlock()
+	defer func() {
+		up.imu.Lock()
+		up.interrupt = nil
+		up.imu.Unlock()
+	}()
+
+	f, err := os.OpenFile(up.path, os.O_WRONLY, 0600)
+	if err != nil {
+		return offset, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return offset, err
+	}
+	defer func() { up.updated = time.Now() }()
+	// A byte more than fits tells a client sending too much apart
+	body := io.LimitReader(r.Body, up.length-offset+1)
+	buf := make([]byte, 32*1024)
+	for {
+		n, rerr := body.Read(buf)
+		if rest := up.length - up.offset.Load(); int64(n) > rest {
+			f.Write(buf[:rest])
+			up.offset.Add(rest)
+			return up.offset.Load(), errUploadTooLong
+		}
+		if n > 0 {
+			if _, err := f.Write(buf[:n]); err != nil {
+				return up.offset.Load(), err
+			}
+			up.offset.Add(int64(n))
+		}
+		if rerr == io.EOF {
+			return up.offset.Load(), nil
+		}
+		if rerr != nil {
+			return up.offset.Load(), rerr
+		}
+	}
+}
+
+// data returns the name and content of a complete upload.
+func (up *resumableUpload) data() (string, []byte, error) {
+	up.mu.Lock()
+	defer up.mu.Unlock()
+	if offset := up.offset.Load(); offset < up.length {
+		return "", nil, fmt.Errorf("upload incomplete: %d of %d bytes received", offset, up.length)
+	}
+	data, err := os.ReadFile(up.path)
+	return up.name, data, err
+}
+
+var (
+	errOffsetMismatch = errors.New("Upload-Offset doesn't match the bytes received")
+	errUploadTooLong  = errors.New("chunk goes past Upload-Length")
+	errTooManyUploads = fmt.Errorf("too many uploads, at most %d are kept per user; delete one first", maxOpenUploads)
+)
+
+// handleCreateUpload starts a resumable upload of the Upload-Length bytes
+// of a file named by ?name=.
+func handleCreateUpload(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	u, ok := srv.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "missing or invalid Upload-Length header", http.StatusBadRequest)
+		return
+	}
+	if length > srv.maxUpload {
+		jsonError(w, fmt.Sprintf("upload exceeds the %s limit", formatSize(srv.maxUpload)), http.StatusRequestEntityTooLarge)
+		return
+	}
+	name := strings.ToLower(filepath.Base(r.URL.Query().Get("name")))
+	if plain := strings.TrimSuffix(name, seal.Ext); !strings.HasSuffix(plain, ".wav") && !strings.HasSuffix(plain, ".opus") && !strings.HasSuffix(plain, ".ogg") {
+		http.Error(w, "?name= must be a file name ending in .wav, .opus or .ogg, and .enc when encrypted", http.StatusBadRequest)
+		return
+	}
+	id, err := srv.uploads.create(u, name, length)
+	if errors.Is(err, errTooManyUploads) {
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		http.Error(w, "create upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Location", "/uploads/"+id)
+	w.Header().Set("Upload-Offset", "0")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"id": id, "offset": 0, "length": length})
+}
+
+// handleUploadChunk appends the request body to an upload, at the
+// Upload-Offset the client thinks it's at.
+func handleUploadChunk(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	up, ok := uploadFor(w, r, srv)
+	if !ok {
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "missing or invalid Upload-Offset header", http.StatusBadRequest)
+		return
+	}
+	n, err := up.write(offset, w, r)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(n, 10))
+	switch {
+	case errors.Is(err, errOffsetMismatch):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errUploadTooLong):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case err != nil:
+		// Most likely the client went away; it resumes from n
+		log.Printf("upload %s: %v at %d bytes", r.PathValue("id"), err, n)
+		http.Error(w, "write upload: "+err.Error(), http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// handleUploadOffset tells a client resuming an upload how much of it the
+// server has.
+func handleUploadOffset(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	up, ok := uploadFor(w, r, srv)
+	if !ok {
+		return
+	}
+	w.Header().Set("Upload-Offset", strconv.FormatInt(up.offset.Load(), 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(up.length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleDeleteUpload discards an upload, e.g. once it's been transcribed.
+func handleDeleteUpload(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	u, ok := srv.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !srv.uploads.remove(u, r.PathValue("id")) {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func uploadFor(w http.ResponseWriter, r *http.Request, srv *serverInfo) (*resumableUpload, bool) {
+	u, ok := srv.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+	up := srv.uploads.get(u, r.PathValue("id"))
+	if up == nil {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return nil, false
+	}
+	return up, true
+}
+
+// readResumable decodes the complete upload of ?upload=, writing an error
+// response and returning false when it can't.
+func (srv *serverInfo) readResumable(w http.ResponseWriter, u *user, id string) (*upload, bool) {
+	ru := srv.uploads.get(u, id)
+	if ru == nil {
+		http.Error(w, "upload not found", http.StatusNotFound)
+		return nil, false
+	}
+	name, data, err := ru.data()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return nil, false
+	}
+	return srv.decodeUpload(w, name, data)
+}
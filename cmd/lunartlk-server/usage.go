@@ -0,0 +1,360 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+)
+
+// usageTotals accumulates transcription usage.
+type usageTotals struct {
+	Requests     int64   `json:"requests"`
+	AudioSeconds float64 `json:"audio_seconds"`
+	ProcessingMs int64   `json:"processing_ms"`
+	// RateLimited counts the requests rejected for going over the user's
+	// requests per minute.
+	RateLimited int64 `json:"rate_limited,omitempty"`
+	// RTF is the real-time factor of the totals, only filled in for
+	// responses.
+	RTF float64 `json:"rtf,omitempty"`
+	// Engines breaks the totals down by engine name.
+	Engines map[string]*usageTotals `json:"engines,omitempty"`
+}
+
+// setRTF fills in the real-time factor of t and its engines.
+func (t *usageTotals) setRTF() {
+	t.RTF = math.Round(realTimeFactor(t.AudioSeconds, t.ProcessingMs)*1000) / 1000
+	for _, e := range t.Engines {
+		e.setRTF()
+	}
+}
+
+func (t *usageTotals) add(o *usageTotals) {
+	t.Requests += o.Requests
+	t.AudioSeconds += o.AudioSeconds
+	t.ProcessingMs += o.ProcessingMs
+	t.RateLimited += o.RateLimited
+	for name, e := range o.Engines {
+		if t.Engines == nil {
+			t.Engines = make(map[string]*usageTotals)
+		}
+		if t.Engines[name] == nil {
+			t.Engines[name] = &usageTotals{}
+		}
+		t.Engines[name].add(e)
+	}
+}
+
+// usageSaveInterval is how often recorded usage is written to disk. Usage
+// is kept in memory in between, so a busy server doesn't rewrite the file
+// on every request.
+const usageSaveInterval = 30 * time.Second
+
+// usageRetention is how many days of usage are kept, enough for a year of
+// GET /stats.
+const usageRetention = 366
+
+// usageTracker records per-user, per-day usage and persists it as JSON.
+type usageTracker struct {
+	path string
+	mu   sync.Mutex
+	// days maps user name → day ("2006-01-02") → totals. Anonymous usage
+	// is recorded under the empty name.
+	days map[string]map[string]*usageTotals
+	// dirty is set when days changed since the last save.
+	dirty bool
+	// saveMu serializes writes to path, done outside mu.
+	saveMu sync.Mutex
+}
+
+func newUsageTracker(path string) (*usageTracker, error) {
+	t := &usageTracker{path: path, days: make(map[string]map[string]*usageTotals)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &t.days); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	return t, nil
+}
+
+// Record adds a request for user name. It's saved to disk by the next
+// Save.
+func (t *usageTracker) Record(name, engine string, audioSeconds float64, processingMs int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	req := &usageTotals{Requests: 1, AudioSeconds: audioSeconds, ProcessingMs: processingMs}
+	if engine != "" {
+		req.Engines = map[string]*usageTotals{
+			engine: {Requests: 1, AudioSeconds: audioSeconds, ProcessingMs: processingMs},
+		}
+	}
+	t.today(name).add(req)
+	t.dirty = true
+}
+
+// RecordRateLimited counts a request of user name rejected by its rate
+// limit.
+func (t *usageTracker) RecordRateLimited(name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.today(name).RateLimited++
+	t.dirty = true
+}
+
+// today returns the totals of user name for the current day. t.mu must be
+// held.
+func (t *usageTracker) today(name string) *usageTotals {
+	day := time.Now().Format("2006-01-02")
+	if t.days[name] == nil {
+		t.days[name] = make(map[string]*usageTotals)
+	}
+	if t.days[name][day] == nil {
+		t.days[name][day] = &usageTotals{}
+	}
+	return t.days[name][day]
+}
+
+// Month returns the totals for user name in the calendar month of now.
+func (t *usageTracker) Month(name string, now time.Time) usageTotals {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	prefix := now.Format("2006-01-")
+	var sum usageTotals
+	for day, totals := range t.days[name] {
+		if strings.HasPrefix(day, prefix) {
+			sum.add(totals)
+		}
+	}
+	return sum
+}
+
+// Days returns a copy of the per-day totals for user name since the given
+// day ("2006-01-02"), oldest first.
+func (t *usageTracker) Days(name, since string) []dayUsage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var days []dayUsage
+	for day, totals := range t.days[name] {
+		if day < since {
+			continue
+		}
+		d := dayUsage{Date: day}
+		d.add(totals)
+		days = append(days, d)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Date < days[j].Date })
+	return days
+}
+
+// Save writes the usage to disk when it changed since the last save,
+// dropping the days older than usageRetention.
+func (t *usageTracker) Save() error {
+	t.saveMu.Lock()
+	defer t.saveMu.Unlock()
+
+	t.mu.Lock()
+	if !t.dirty {
+		t.mu.Unlock()
+		return nil
+	}
+	t.prune(time.Now().AddDate(0, 0, -usageRetention).Format("2006-01-02"))
+	data, err := json.MarshalIndent(t.days, "", "  ")
+	t.dirty = false
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := t.write(data); err != nil {
+		// Retried by the next save
+		t.mu.Lock()
+		t.dirty = true
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// prune drops the days before since. t.mu must be held.
+func (t *usageTracker) prune(since string) {
+	for name, days := range t.days {
+		for day := range days {
+			if day < since {
+				delete(days, day)
+			}
+		}
+		if len(days) == 0 {
+			delete(t.days, name)
+		}
+	}
+}
+
+func (t *usageTracker) write(data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(t.path), 0755); err != nil {
+		return err
+	}
+	tmp := t.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, t.path)
+}
+
+// saveUsage saves the usage every usageSaveInterval, and before exiting on
+// SIGINT or SIGTERM.
+func (srv *serverInfo) saveUsage() {
+	save := func() {
+		if err := srv.usage.Save(); err != nil {
+			log.Printf("usage: %v", err)
+		}
+	}
+	tick := time.NewTicker(usageSaveInterval)
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for {
+			select {
+			case <-tick.C:
+				save()
+			case sig := <-stop:
+				log.Printf("Got %s, saving usage and exiting", sig)
+				save()
+				os.Exit(0)
+			}
+		}
+	}()
+}
+
+// recordUsage adds a finished transcription to u's usage.
+func (srv *serverInfo) recordUsage(u *user, resp *api.TranscriptResponse) {
+	name := ""
+	if u != nil {
+		name = u.Name
+	}
+	srv.usage.Record(name, resp.Engine, resp.AudioDuration, resp.ProcessingMs)
+}
+
+// usageResponse is returned by GET /usage.
+type usageResponse struct {
+	User         string  `json:"user,omitempty"`
+	Month        string  `json:"month"`
+	Requests     int64   `json:"requests"`
+	AudioMinutes float64 `json:"audio_minutes"`
+	QuotaMinutes float64 `json:"quota_minutes,omitempty"`
+	// RemainingMinutes is only set when the user has a quota.
+	RemainingMinutes *float64 `json:"remaining_minutes,omitempty"`
+	// RequestsPerMinute is the user's rate limit, and RateLimited the
+	// requests it rejected this month.
+	RequestsPerMinute int   `json:"requests_per_minute,omitempty"`
+	RateLimited       int64 `json:"rate_limited,omitempty"`
+}
+
+// handleUsage reports the calling user's usage for the current month.
+func handleUsage(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	u, ok := srv.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	resp := usageResponse{Month: now.Format("2006-01")}
+	name := ""
+	if u != nil {
+		name = u.Name
+		resp.User = u.Name
+		resp.QuotaMinutes = u.QuotaMinutes
+		resp.RequestsPerMinute = cmp.Or(u.RequestsPerMinute, srv.rateLimit)
+	}
+	totals := srv.usage.Month(name, now)
+	resp.Requests = totals.Requests
+	resp.RateLimited = totals.RateLimited
+	resp.AudioMinutes = roundMinutes(totals.AudioSeconds)
+	if resp.QuotaMinutes > 0 {
+		remaining := max(0, resp.QuotaMinutes-resp.AudioMinutes)
+		resp.RemainingMinutes = &remaining
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// dayUsage is the usage of a single day.
+type dayUsage struct {
+	Date string `json:"date"`
+	usageTotals
+}
+
+// statsResponse is returned by GET /stats.
+type statsResponse struct {
+	User  string      `json:"user,omitempty"`
+	Since string      `json:"since"`
+	Total usageTotals `json:"total"`
+	Days  []dayUsage  `json:"days"`
+}
+
+// handleStats reports the calling user's daily usage over the last ?days=N
+// days (default 7), including today.
+func handleStats(w http.ResponseWriter, r *http.Request, srv *serverInfo) {
+	u, ok := srv.authenticate(r)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	days := 7
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			http.Error(w, "invalid days, must be a positive number", http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	name := ""
+	if u != nil {
+		name = u.Name
+	}
+	since := time.Now().AddDate(0, 0, 1-days).Format("2006-01-02")
+	resp := statsResponse{User: name, Since: since, Days: srv.usage.Days(name, since)}
+	if resp.Days == nil {
+		resp.Days = []dayUsage{}
+	}
+	for i := range resp.Days {
+		resp.Total.add(&resp.Days[i].usageTotals)
+		resp.Days[i].setRTF()
+	}
+	resp.Total.AudioSeconds = math.Round(resp.Total.AudioSeconds*1000) / 1000
+	resp.Total.setRTF()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func roundMinutes(seconds float64) float64 {
+	return math.Round(seconds/60*100) / 100
+}
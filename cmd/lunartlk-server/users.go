@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rubiojr/lunartlk/internal/queue"
+)
+
+// user is a named account authenticated by its Bearer token.
+type user struct {
+	Name  string `json:"name"`
+	Token string `json:"token"`
+	// QuotaMinutes limits the audio a user can transcribe per calendar
+	// month. Zero means unlimited.
+	QuotaMinutes float64 `json:"quota_minutes,omitempty"`
+	// Priority caps the scheduling priority of the user's requests
+	// ("interactive" or "batch"). Empty means interactive.
+	Priority string `json:"priority,omitempty"`
+	// Export is the -exports profile the user's transcripts go to when
+	// requests don't pick one.
+	Export string `json:"export,omitempty"`
+	// RequestsPerMinute limits how often the user can call the server.
+	// Zero means the -rate-limit default.
+	RequestsPerMinute int `json:"requests_per_minute,omitempty"`
+
+	// source is the file or flag the user comes from, for errors.
+	source string
+}
+
+// parseUserFlag parses a -user flag, name=token.
+func parseUserFlag(v string) (*user, error) {
+	name, token, ok := strings.Cut(v, "=")
+	if !ok {
+		return nil, fmt.Errorf("invalid -user %q, use name=token", v)
+	}
+	return &user{Name: name, Token: token, source: "-user"}, nil
+}
+
+// loadUsers reads a JSON array of users from path, when set, adds the
+// users given with -user, and indexes them by token.
+func loadUsers(path string, extra []*user) (map[string]*user, error) {
+	var list []*user
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return nil, fmt.Errorf("decode %s: %w", path, err)
+		}
+		for _, u := range list {
+			u.source = path
+		}
+	}
+	list = append(list, extra...)
+
+	users := make(map[string]*user)
+	names := make(map[string]bool)
+	for _, u := range list {
+		if u.Name == "" || u.Token == "" {
+			return nil, fmt.Errorf("%s: every user needs a name and a token", u.source)
+		}
+		if !validTranscriptID(u.Name) {
+			return nil, fmt.Errorf("%s: invalid user name %q", u.source, u.Name)
+		}
+		if names[u.Name] {
+			return nil, fmt.Errorf("%s: duplicate user %q", u.source, u.Name)
+		}
+		if u.Priority != "" {
+			if _, err := queue.ParsePriority(u.Priority); err != nil {
+				return nil, fmt.Errorf("%s: user %q: %w", u.source, u.Name, err)
+			}
+		}
+		if u.RequestsPerMinute < 0 {
+			return nil, fmt.Errorf("%s: user %q: negative requests_per_minute", u.source, u.Name)
+		}
+		if users[u.Token] != nil {
+			return nil, fmt.Errorf("%s: users %q and %q share a token", u.source, users[u.Token].Name, u.Name)
+		}
+		names[u.Name] = true
+		users[u.Token] = u
+	}
+	return users, nil
+}
+
+// authenticate returns the user owning the request's Bearer token. When no
+// authentication is configured every request is allowed with a nil user.
+func (srv *serverInfo) authenticate(r *http.Request) (*user, bool) {
+	if srv.token == "" && !srv.hasUsers() {
+		return nil, true
+	}
+	if u := srv.tokenUser(r); u != nil {
+		return u, true
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && srv.token != "" && token == srv.token {
+		return nil, true
+	}
+	return nil, false
+}
+
+// tokenUser returns the user owning the request's Bearer token, or nil.
+func (srv *serverInfo) tokenUser(r *http.Request) *user {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil
+	}
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	return srv.users[token]
+}
+
+func (srv *serverInfo) hasUsers() bool {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	return len(srv.users) > 0
+}
+
+// storeFor returns the transcript store for u. Named users get their own
+// directory; anonymous requests use the store root.
+func (srv *serverInfo) storeFor(u *user) (*transcriptStore, error) {
+	if srv.store == nil || u == nil {
+		return srv.store, nil
+	}
+	return srv.store.sub(filepath.Join("users", u.Name))
+}
+
+// checkQuota reports an error if transcribing audioSeconds more would take u
+// over its monthly quota.
+func (srv *serverInfo) checkQuota(u *user, audioSeconds float64) error {
+	if u == nil || u.QuotaMinutes <= 0 {
+		return nil
+	}
+	used := srv.usage.Month(u.Name, time.Now()).AudioSeconds
+	if used+audioSeconds > u.QuotaMinutes*60 {
+		return fmt.Errorf("monthly quota of %.0f minutes exceeded (%.1f used)", u.QuotaMinutes, used/60)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/queue"
+	"github.com/rubiojr/lunartlk/internal/seal"
+)
+
+// watchFile is the size and modification time of a file in a watched
+// directory, which tell whether it changed since it was last seen.
+type watchFile struct {
+	Size int64 `json:"size"`
+	// ModTime is in Unix nanoseconds, to compare with ==.
+	ModTime int64 `json:"mod_time"`
+}
+
+// dirWatcher transcribes the audio files dropped in a directory, e.g. a
+// Syncthing folder a phone saves voice notes to. The directory is polled:
+// a file is transcribed once it stopped changing between two polls, so
+// files still being copied aren't picked up half written.
+type dirWatcher struct {
+	srv *serverInfo
+	dir string
+	// toStore saves transcripts in -store instead of next to the audio.
+	toStore bool
+	// donePath keeps done across restarts: files transcribed to the
+	// store leave no transcript next to them to tell.
+	donePath string
+
+	// seen is each file as the last poll found it.
+	seen map[string]watchFile
+	// failed is the files that failed to transcribe, not retried until
+	// they change.
+	failed map[string]watchFile
+	// done is the files transcribed to the store.
+	done map[string]watchFile
+}
+
+// watchDir starts transcribing the audio files that appear in dir every
+// interval. output is "next", to write recording.txt next to
+// recording.opus, or "store".
+func (srv *serverInfo) watchDir(dir string, interval time.Duration, output string) error {
+	st, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+	if !st.IsDir() {
+		return fmt.Errorf("watch: %s is not a directory", dir)
+	}
+	dw := &dirWatcher{
+		srv:    srv,
+		dir:    dir,
+		seen:   make(map[string]watchFile),
+		failed: make(map[string]watchFile),
+		done:   make(map[string]watchFile),
+	}
+	switch output {
+	case "next":
+	case "store":
+		if srv.store == nil {
+			return fmt.Errorf("-watch-output store needs -store")
+		}
+		dw.toStore = true
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return fmt.Errorf("watch: %w", err)
+		}
+		dw.donePath = filepath.Join(stateDir(), "watch", strings.ReplaceAll(strings.Trim(abs, "/"), "/", "_")+".json")
+		if err := dw.loadDone(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown -watch-output %q, use next or store", output)
+	}
+
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			dw.poll()
+			<-t.C
+		}
+	}()
+	return nil
+}
+
+// poll transcribes the new files that didn't change since the previous
+// poll, one at a time.
+func (dw *dirWatcher) poll() {
+	entries, err := os.ReadDir(dw.dir)
+	if err != nil {
+		log.Printf("[watch] %v", err)
+		return
+	}
+	seen := make(map[string]watchFile, len(entries))
+	for _, e := range entries {
+		name := e.Name()
+		// Hidden files are partial downloads, e.g. .syncthing.*.tmp
+		if !e.Type().IsRegular() || strings.HasPrefix(name, ".") || !watchedAudio(name) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		f := watchFile{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+		seen[name] = f
+		if prev, ok := dw.seen[name]; !ok || prev != f || dw.failed[name] == f || dw.isDone(name, f) {
+			continue
+		}
+		if err := dw.transcribe(name); err != nil {
+			log.Printf("[watch] %s: %v", name, err)
+			// Files skipped while the server is busy are retried on the
+			// next poll
+			if !errors.Is(err, queue.ErrQueueFull) && !errors.Is(err, errNoSlot) {
+				dw.failed[name] = f
+			}
+			continue
+		}
+		delete(dw.failed, name)
+		if dw.toStore {
+			dw.markDone(name, f)
+		}
+	}
+	dw.seen = seen
+}
+
+// watchedAudio reports whether name is a format the server decodes.
+func watchedAudio(name string) bool {
+	switch filepath.Ext(strings.TrimSuffix(strings.ToLower(name), seal.Ext)) {
+	case ".wav", ".opus", ".ogg":
+		return true
+	}
+	return false
+}
+
+// transcriptPath returns where the transcript of an audio file goes with
+// -watch-output next: recording.opus gets recording.txt.
+func (dw *dirWatcher) transcriptPath(name string) string {
+	base := strings.TrimSuffix(name, filepath.Ext(name))
+	if seal.IsSealed(strings.ToLower(name)) {
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	return filepath.Join(dw.dir, base+".txt")
+}
+
+func (dw *dirWatcher) isDone(name string, f watchFile) bool {
+	if !dw.toStore {
+		_, err := os.Stat(dw.transcriptPath(name))
+		return err == nil
+	}
+	return dw.done[name] == f
+}
+
+// transcribe transcribes a file with the default engine and language,
+// post-processed like an upload.
+func (dw *dirWatcher) transcribe(name string) (err error) {
+	srv := dw.srv
+	data, err := os.ReadFile(filepath.Join(dw.dir, name))
+	if err != nil {
+		return err
+	}
+	lower := strings.ToLower(name)
+	plainName, plain, err := srv.unseal(lower, data)
+	if err != nil {
+		return err
+	}
+	samples, sampleRate, err := decodeAudio(plainName, plain)
+	if err != nil {
+		return fmt.Errorf("decode audio: %w", err)
+	}
+	up := &upload{name: lower, data: data, samples: samples, sampleRate: sampleRate, sealed: plainName != lower}
+	if srv.maxDuration > 0 && up.duration() > srv.maxDuration.Seconds() {
+		return fmt.Errorf("audio is %.1fs long, the limit is %s", up.duration(), srv.maxDuration)
+	}
+	// Voice notes can wait for live dictation
+	ctx := queue.WithPriority(context.Background(), queue.Batch)
+	release, err := srv.acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	var resp *api.TranscriptResponse
+	defer func() { srv.auditRequest(nil, nil, srv.defaultEng, "", srv.defaultLang, up, resp, err) }()
+
+	t, err := srv.selectTranscriber(srv.defaultEng, srv.defaultLang, "")
+	if err != nil {
+		return err
+	}
+	if srv.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, srv.timeout)
+		defer cancel()
+	}
+	resp, err = srv.transcribe(ctx, t, srv.defaultEng, samples, sampleRate, srv.defaultLang)
+	if err != nil {
+		return err
+	}
+	if err := srv.postprocess(ctx, resp); err != nil {
+		return fmt.Errorf("post-processing failed: %w", err)
+	}
+	save, err := srv.runScripts(ctx, resp)
+	if err != nil {
+		return fmt.Errorf("script failed: %w", err)
+	}
+	resp.Timings = nil
+	resp.AudioStats = up.audioStats()
+	srv.recordUsage(nil, resp)
+
+	if dw.toStore {
+		if save {
+			id, err := srv.store.Save(up.name, up.data, resp)
+			if err != nil {
+				return fmt.Errorf("store: %w", err)
+			}
+			resp.ID = id
+		}
+	} else if err := writeFileAtomic(dw.transcriptPath(name), []byte(resp.Text+"\n")); err != nil {
+		return err
+	}
+
+	srv.notify(resp)
+	// Voice notes go to the "default" export profile
+	profile, _ := srv.exportProfile("", nil)
+	srv.exportNote(profile, resp)
+	log.Printf("[watch] %s engine=%s lang=%s audio=%.1fs proc=%dms", name, srv.defaultEng, srv.defaultLang, resp.AudioDuration, resp.ProcessingMs)
+	return nil
+}
+
+// writeFileAtomic writes a file through a hidden temporary one, so neither
+// the watcher nor a sync tool see it half written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (dw *dirWatcher) loadDone() error {
+	data, err := os.ReadFile(dw.donePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("watch: %w", err)
+	}
+	if err := json.Unmarshal(data, &dw.done); err != nil {
+		return fmt.Errorf("watch: %s: %w", dw.donePath, err)
+	}
+	return nil
+}
+
+func (dw *dirWatcher) markDone(name string, f watchFile) {
+	dw.done[name] = f
+	data, err := json.MarshalIndent(dw.done, "", "  ")
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(dw.donePath), 0755); err == nil {
+			err = writeFileAtomic(dw.donePath, data)
+		}
+	}
+	if err != nil {
+		log.Printf("[watch] %v", err)
+	}
+}
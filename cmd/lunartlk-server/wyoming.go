@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rubiojr/lunartlk/api"
+	"github.com/rubiojr/lunartlk/internal/audio"
+	"github.com/rubiojr/lunartlk/internal/queue"
+	"github.com/rubiojr/lunartlk/internal/wyoming"
+)
+
+// wyomingRate is the only sample rate accepted over Wyoming, the one the
+// engines expect. Home Assistant streams 16 kHz audio.
+const wyomingRate = 16000
+
+var wyomingAttribution = wyoming.Attribution{Name: "lunartlk", URL: "https://github.com/rubiojr/lunartlk"}
+
+// serveWyoming accepts Wyoming protocol connections on addr, so Home
+// Assistant's Assist pipeline can use the server for speech-to-text. The
+// protocol has no authentication: listen on a trusted network only.
+func (srv *serverInfo) serveWyoming(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("wyoming: %w", err)
+	}
+	log.Printf("Wyoming listening on %s", addr)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				log.Printf("wyoming: %v", err)
+				return
+			}
+			go srv.handleWyoming(conn)
+		}
+	}()
+	return nil
+}
+
+// wyomingSession is the state of a connection between a transcribe event
+// and the end of its audio.
+type wyomingSession struct {
+	engine  string
+	lang    string
+	format  wyoming.AudioFormat
+	samples []float32
+	// received counts the audio bytes of the session, limited to
+	// -max-upload like an HTTP upload.
+	received int64
+}
+
+func (srv *serverInfo) handleWyoming(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	remote := conn.RemoteAddr().String()
+	s := srv.newWyomingSession(wyoming.Transcribe{})
+
+	for {
+		e, err := wyoming.Read(r, int(srv.maxUpload))
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("%s wyoming: %v", remote, err)
+			}
+			return
+		}
+
+		var reply *wyoming.Event
+		switch e.Type {
+		case wyoming.TypeDescribe:
+			reply, err = wyoming.NewEvent(wyoming.TypeInfo, srv.wyomingInfo())
+		case wyoming.TypeTranscribe:
+			var t wyoming.Transcribe
+			err = e.Decode(&t)
+			s = srv.newWyomingSession(t)
+		case wyoming.TypeAudioStart:
+			s.samples = s.samples[:0]
+			s.received = 0
+			err = e.Decode(&s.format)
+		case wyoming.TypeAudioChunk:
+			err = s.write(e, srv.maxUpload, srv.maxDuration)
+		case wyoming.TypeAudioStop:
+			var text string
+			if text, err = srv.wyomingTranscribe(remote, s); err == nil {
+				reply, err = wyoming.NewEvent(wyoming.TypeTranscript, wyoming.Transcript{Text: text, Language: s.lang})
+			}
+			s = srv.newWyomingSession(wyoming.Transcribe{})
+		default:
+			// Events for other services, e.g. wake word detection
+		}
+
+		if err != nil {
+			log.Printf("%s wyoming %s: %v", remote, e.Type, err)
+			reply, _ = wyoming.NewEvent(wyoming.TypeError, wyoming.Error{Text: err.Error()})
+		}
+		if reply != nil {
+			if err := wyoming.Write(conn, reply); err != nil {
+				log.Printf("%s wyoming: %v", remote, err)
+				return
+			}
+		}
+	}
+}
+
+// newWyomingSession starts a session for a transcribe request. The model
+// name selects the engine; Home Assistant sends languages like "en" but
+// regional variants ("en-US") are accepted too.
+func (srv *serverInfo) newWyomingSession(t wyoming.Transcribe) *wyomingSession {
+	s := &wyomingSession{
+		engine: t.Name,
+		lang:   t.Language,
+		format: wyoming.AudioFormat{Rate: wyomingRate, Width: 2, Channels: 1},
+	}
+	if s.engine == "" {
+		s.engine = srv.defaultEng
+	}
+	s.lang, _, _ = strings.Cut(strings.ReplaceAll(s.lang, "_", "-"), "-")
+	if s.lang == "" {
+		s.lang = srv.defaultLang
+	}
+	return s
+}
+
+// write appends the audio of a chunk event, up to maxBytes of audio and
+// maxDuration.
+func (s *wyomingSession) write(e *wyoming.Event, maxBytes int64, maxDuration time.Duration) error {
+	f := s.format
+	if err := e.Decode(&f); err != nil {
+		return err
+	}
+	if f.Rate != wyomingRate {
+		return fmt.Errorf("unsupported sample rate %d, send %d Hz", f.Rate, wyomingRate)
+	}
+	if (f.Width != 2 && f.Width != 4) || f.Channels < 1 {
+		return fmt.Errorf("unsupported audio format: %d bytes per sample, %d channels", f.Width, f.Channels)
+	}
+	s.received += int64(len(e.Payload))
+	if s.received > maxBytes {
+		return fmt.Errorf("audio too large, the limit is %s", formatSize(maxBytes))
+	}
+	s.samples = append(s.samples, audio.DecodePCM(e.Payload, uint16(f.Width*8), uint16(f.Channels))...)
+	if maxDuration > 0 && time.Duration(len(s.samples))*time.Second/wyomingRate > maxDuration {
+		return fmt.Errorf("audio too long, the limit is %s", maxDuration)
+	}
+	return nil
+}
+
+// wyomingTranscribe transcribes a finished session and post-processes the
+// result like an HTTP upload.
+func (srv *serverInfo) wyomingTranscribe(remote string, s *wyomingSession) (text string, err error) {
+	if len(s.samples) == 0 {
+		return "", nil
+	}
+	var resp *api.TranscriptResponse
+	defer func() { srv.auditWyoming(remote, s, resp, err) }()
+	if srv.shedding.Load() {
+		return "", errMemoryPressure
+	}
+	t, err := srv.selectTranscriber(s.engine, s.lang, "")
+	if err != nil {
+		return "", err
+	}
+
+	ctx := queue.WithPriority(context.Background(), queue.Interactive)
+	release, err := srv.acquire(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	if srv.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, srv.timeout)
+		defer cancel()
+	}
+
+	resp, err = srv.transcribe(ctx, t, s.engine, s.samples, wyomingRate, s.lang)
+	if err != nil {
+		return "", err
+	}
+	if err = srv.postprocess(ctx, resp); err != nil {
+		return "", fmt.Errorf("post-processing failed: %w", err)
+	}
+	resp.Timings = nil
+	srv.recordUsage(nil, resp)
+
+	srv.notify(resp)
+
+	if srv.debug {
+		log.Printf("%s wyoming engine=%s lang=%s audio=%.1fs proc=%dms text=%q",
+			remote, s.engine, s.lang, resp.AudioDuration, resp.ProcessingMs, resp.Text)
+	} else {
+		log.Printf("%s wyoming engine=%s lang=%s audio=%.1fs proc=%dms",
+			remote, s.engine, s.lang, resp.AudioDuration, resp.ProcessingMs)
+	}
+	return resp.Text, nil
+}
+
+// wyomingInfo describes the registered engines as Wyoming ASR models.
+func (srv *serverInfo) wyomingInfo() wyoming.Info {
+	program := wyoming.ASRProgram{
+		Name:        "lunartlk",
+		Description: "lunartlk speech-to-text",
+		Attribution: wyomingAttribution,
+		Installed:   true,
+		Version:     version,
+		Models:      []wyoming.ASRModel{},
+	}
+	if srv.engines.Has("parakeet", "") {
+		program.Models = append(program.Models, wyoming.ASRModel{
+			Name:        "parakeet",
+			Description: "Parakeet TDT 0.6B v3",
+			Attribution: wyoming.Attribution{Name: "NVIDIA", URL: "https://huggingface.co/nvidia/parakeet-tdt-0.6b-v3"},
+			Installed:   true,
+			Languages:   parakeetLangs,
+		})
+	}
+	if langs := srv.engines.Langs("moonshine"); len(langs) > 0 {
+		program.Models = append(program.Models, wyoming.ASRModel{
+			Name:        "moonshine",
+			Description: "Moonshine",
+			Attribution: wyoming.Attribution{Name: "Useful Sensors", URL: "https://github.com/moonshine-ai/moonshine"},
+			Installed:   true,
+			Languages:   langs,
+		})
+	}
+	// Clients that don't name a model pick the first one
+	sort.SliceStable(program.Models, func(i, j int) bool {
+		return program.Models[i].Name == srv.defaultEng && program.Models[j].Name != srv.defaultEng
+	})
+	return wyoming.Info{
+		ASR:    []wyoming.ASRProgram{program},
+		TTS:    []any{},
+		Handle: []any{},
+		Intent: []any{},
+		Wake:   []any{},
+	}
+}
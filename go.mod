@@ -7,3 +7,37 @@ require github.com/gordonklaus/portaudio v0.0.0-20260203164431-765aa7dfa631
 require github.com/hraban/opus v0.0.0-20251117090126-c76ea7e21bf3
 
 require github.com/yalue/onnxruntime_go v1.24.0
+
+require github.com/klauspost/compress v1.18.0
+
+require github.com/godbus/dbus/v5 v5.1.0
+
+require github.com/charmbracelet/bubbletea v1.3.4
+
+require fyne.io/systray v1.11.0
+
+require github.com/gorilla/websocket v1.5.3
+
+require go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+
+require github.com/gen2brain/malgo v0.11.24
+
+require golang.org/x/sys v0.30.0
+
+require (
+	github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
+	github.com/charmbracelet/lipgloss v1.0.0 // indirect
+	github.com/charmbracelet/x/ansi v0.8.0 // indirect
+	github.com/charmbracelet/x/term v0.2.1 // indirect
+	github.com/erikgeiser/coninput v0.0.0-20211004153227-1c3628e74d0f // indirect
+	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/mattn/go-localereader v0.0.1 // indirect
+	github.com/mattn/go-runewidth v0.0.16 // indirect
+	github.com/muesli/ansi v0.0.0-20230316100256-276c6243b2f6 // indirect
+	github.com/muesli/cancelreader v0.2.2 // indirect
+	github.com/muesli/termenv v0.15.2 // indirect
+	github.com/rivo/uniseg v0.4.7 // indirect
+	golang.org/x/sync v0.11.0 // indirect
+	golang.org/x/text v0.3.8 // indirect
+)
@@ -0,0 +1,148 @@
+// Package alert matches transcripts against keyword and regular expression
+// rules, so that saying e.g. "action item" can trigger a notification.
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Rule is an alert rule as written in the rules file. A rule matches when
+// any of its keywords or its regular expression is found in a transcript.
+type Rule struct {
+	Name string `json:"name"`
+	// Keywords match case-insensitively as whole words or phrases.
+	Keywords []string `json:"keywords,omitempty"`
+	// Regex is a Go regular expression, e.g. "(?i)deadline (is|on) \\w+".
+	Regex string `json:"regex,omitempty"`
+
+	// Actions: any combination of them.
+	Webhook   string `json:"webhook,omitempty"`
+	MQTTTopic string `json:"mqtt_topic,omitempty"`
+	Notify    bool   `json:"notify,omitempty"`
+
+	keywords *regexp.Regexp
+	regex    *regexp.Regexp
+}
+
+// Match is a rule that matched a transcript, with the matched text.
+type Match struct {
+	Rule    *Rule
+	Matches []string
+}
+
+// Load reads a JSON array of rules and compiles them.
+func Load(path string) ([]*Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []*Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, r := range rules {
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, r.Name, err)
+		}
+	}
+	return rules, nil
+}
+
+func (r *Rule) compile() error {
+	if len(r.Keywords) == 0 && r.Regex == "" {
+		return fmt.Errorf("needs keywords or a regex")
+	}
+	if r.Webhook == "" && r.MQTTTopic == "" && !r.Notify {
+		return fmt.Errorf("needs an action (webhook, mqtt_topic or notify)")
+	}
+	if len(r.Keywords) > 0 {
+		var alts []string
+		for i, k := range r.Keywords {
+			// Let any run of spaces separate the words of a phrase
+			words := strings.Fields(k)
+			if len(words) == 0 {
+				return fmt.Errorf("keyword %d is empty", i+1)
+			}
+			for i, w := range words {
+				words[i] = regexp.QuoteMeta(w)
+			}
+			alts = append(alts, strings.Join(words, `\s+`))
+		}
+		// Word boundaries are checked by findKeywords: \b only knows ASCII
+		re, err := regexp.Compile(`(?i)` + strings.Join(alts, "|"))
+		if err != nil {
+			return err
+		}
+		re.Longest()
+		r.keywords = re
+	}
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return err
+		}
+		r.regex = re
+	}
+	return nil
+}
+
+// Check returns the rules matching text.
+func Check(rules []*Rule, text string) []Match {
+	var matches []Match
+	for _, r := range rules {
+		var found []string
+		if r.keywords != nil {
+			found = r.findKeywords(text)
+		}
+		if r.regex != nil {
+			found = append(found, r.regex.FindAllString(text, -1)...)
+		}
+		if len(found) > 0 {
+			matches = append(matches, Match{Rule: r, Matches: found})
+		}
+	}
+	return matches
+}
+
+// findKeywords returns the keywords found in text as whole words: not
+// preceded or followed by a letter or digit, accented ones included.
+func (r *Rule) findKeywords(text string) []string {
+	var found []string
+	for i := 0; i < len(text); {
+		loc := r.keywords.FindStringIndex(text[i:])
+		if loc == nil {
+			break
+		}
+		start, end := i+loc[0], i+loc[1]
+		if wordEdge(text[:start], text[end:]) {
+			found = append(found, text[start:end])
+			i = end
+			continue
+		}
+		// Look again from the next character, for a hit inside this one
+		_, size := utf8.DecodeRuneInString(text[start:])
+		i = start + size
+	}
+	return found
+}
+
+// wordEdge reports whether before doesn't end with a letter or digit and
+// after doesn't start with one.
+func wordEdge(before, after string) bool {
+	b, _ := utf8.DecodeLastRuneInString(before)
+	a, _ := utf8.DecodeRuneInString(after)
+	return !isWordRune(b) && !isWordRune(a)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
@@ -0,0 +1,48 @@
+package alert
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCheckKeywords(t *testing.T) {
+	tests := []struct {
+		name     string
+		keywords []string
+		text     string
+		want     []string
+	}{
+		{"phrase", []string{"action item"}, "New Action  item: ship it", []string{"Action  item"}},
+		{"adjacent hits", []string{"urgent"}, "urgent urgent", []string{"urgent", "urgent"}},
+		{"adjacent phrases", []string{"action item"}, "action item action item", []string{"action item", "action item"}},
+		{"inside a word", []string{"item"}, "items and subitem", nil},
+		{"hit after a miss", []string{"item"}, "subitem item", []string{"item"}},
+		{"accented letters", []string{"reunión"}, "la reunión, no la reuniónx", []string{"reunión"}},
+		{"longest keyword", []string{"item", "items"}, "two items", []string{"items"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &Rule{Keywords: tt.keywords, Notify: true}
+			if err := r.compile(); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range Check([]*Rule{r}, tt.text) {
+				got = append(got, m.Matches...)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileEmptyKeyword(t *testing.T) {
+	for _, k := range []string{"", "  \t"} {
+		r := &Rule{Keywords: []string{"deadline", k}, Notify: true}
+		if err := r.compile(); err == nil || !strings.Contains(err.Error(), "keyword 2 is empty") {
+			t.Errorf("%q: got %v, want an empty keyword error", k, err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Package align transfers word timings from a recognized transcript to a
+// reference transcript of the same audio, such as a manually corrected one.
+package align
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/rubiojr/lunartlk/internal/textdiff"
+)
+
+// Word is a word with its position in the audio, in seconds.
+type Word struct {
+	Text  string  `json:"word"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	// Matched reports whether the word was recognized in the audio. The
+	// timings of unmatched words are interpolated from their neighbors.
+	Matched bool `json:"matched"`
+}
+
+// Words returns the words of reference with timings. Words that match the
+// recognized ones (ignoring case and punctuation) take their timings; the
+// rest share the time between their matched neighbors (or the end of the
+// audio, at duration), or of the recognized words they replace, in
+// proportion to their length.
+func Words(reference string, recognized []Word, duration float64) []Word {
+	texts := make([]string, len(recognized))
+	for i, w := range recognized {
+		texts[i] = w.Text
+	}
+
+	var out []Word
+	var inserted []string
+	ri := 0       // next recognized word
+	gapStart := 0 // first recognized word replaced by the pending gap
+	flush := func() {
+		if len(inserted) == 0 {
+			gapStart = ri
+			return
+		}
+		start, end := span(recognized, out, gapStart, ri, duration)
+		out = append(out, spread(inserted, start, end)...)
+		inserted = nil
+		gapStart = ri
+	}
+
+	for _, op := range textdiff.Words(strings.Join(texts, " "), reference) {
+		words := strings.Fields(op.Text)
+		switch op.Kind {
+		case textdiff.Equal:
+			flush()
+			for _, w := range words {
+				r := recognized[ri]
+				out = append(out, Word{Text: w, Start: r.Start, End: r.End, Matched: true})
+				ri++
+			}
+			gapStart = ri
+		case textdiff.Delete:
+			ri += len(words)
+		case textdiff.Insert:
+			inserted = append(inserted, words...)
+		}
+	}
+	flush()
+	return out
+}
+
+// span returns the time available to reference words replacing
+// recognized[from:to]: the time of those words, or if there are none, the
+// pause between the previous output word and the next recognized one or
+// the end of the audio.
+func span(recognized, out []Word, from, to int, duration float64) (float64, float64) {
+	if from < to {
+		return recognized[from].Start, recognized[to-1].End
+	}
+	var start float64
+	if len(out) > 0 {
+		start = out[len(out)-1].End
+	}
+	end := duration
+	if to < len(recognized) {
+		end = recognized[to].Start
+	}
+	end = max(end, start)
+	return start, end
+}
+
+// spread divides start-end among words in proportion to their length.
+func spread(words []string, start, end float64) []Word {
+	total := 0
+	for _, w := range words {
+		total += utf8.RuneCountInString(w)
+	}
+	out := make([]Word, len(words))
+	t := start
+	for i, w := range words {
+		d := (end - start) * float64(utf8.RuneCountInString(w)) / float64(max(total, 1))
+		out[i] = Word{Text: w, Start: t, End: t + d}
+		t += d
+	}
+	return out
+}
@@ -3,11 +3,45 @@ package audio
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 )
 
-// OggOpus wraps Opus frames in a standard Ogg Opus container.
+// preSkip is the number of samples, at 48kHz, players drop from the start
+// of the stream: the encoder's lookahead of 6.5ms, as opusenc writes it.
+const preSkip = 312
+
+// OggOption configures OggOpus.
+type OggOption func(*oggOptions)
+
+type oggOptions struct {
+	samples  int
+	comments []string
+}
+
+// WithLength sets the number of samples encoded, at the input sample rate,
+// so players trim the silence padding the last frame.
+func WithLength(samples int) OggOption {
+	return func(o *oggOptions) { o.samples = samples }
+}
+
+// WithComment adds a user comment, such as WithComment("DATE", "2024-05-01").
+// Empty values are skipped.
+func WithComment(key, value string) OggOption {
+	return func(o *oggOptions) {
+		if value != "" {
+			o.comments = append(o.comments, key+"="+value)
+		}
+	}
+}
+
+// OggOpus wraps 20ms Opus frames in a standard Ogg Opus container.
 // The result is playable by any media player.
-func OggOpus(opusFrames [][]byte, sampleRate, channels int) []byte {
+func OggOpus(opusFrames [][]byte, sampleRate, channels int, opts ...OggOption) []byte {
+	var o oggOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	var buf bytes.Buffer
 	serial := uint32(0x4C554E41) // "LUNA"
 
@@ -16,18 +50,26 @@ func OggOpus(opusFrames [][]byte, sampleRate, channels int) []byte {
 	writeOggPage(&buf, serial, 0, 0, 2, [][]byte{head}) // granule=0, BOS flag
 
 	// Page 2: OpusTags
-	tags := makeOpusTags()
+	tags := makeOpusTags(o.comments)
 	writeOggPage(&buf, serial, 0, 1, 0, [][]byte{tags})
 
-	// Audio pages: pack multiple frames per page (up to ~50ms worth)
+	// Granule positions count samples at 48kHz, whatever the input rate,
+	// including the pre-skip. The last page's stops at the end of the
+	// input so players don't count the padding.
+	samplesPerFrame := uint64(FrameSize * 48000 / SampleRate) // 960 = 20ms
+	end := uint64(len(opusFrames)) * samplesPerFrame
+	if o.samples > 0 {
+		end = min(end, preSkip+uint64(o.samples)*48000/uint64(sampleRate))
+	}
+
+	// Audio pages: pack multiple frames per page
 	var pageFrames [][]byte
 	var granulePos uint64
 	pageSeq := uint32(2)
-	samplesPerFrame := uint64(FrameSize) // 320 samples = 20ms at 16kHz
 
 	for i, frame := range opusFrames {
 		pageFrames = append(pageFrames, frame)
-		granulePos += samplesPerFrame
+		granulePos = min(granulePos+samplesPerFrame, end)
 
 		// Flush page every ~200ms (10 frames) or at end
 		if len(pageFrames) >= 10 || i == len(opusFrames)-1 {
@@ -49,20 +91,24 @@ func makeOpusHead(sampleRate, channels int) []byte {
 	buf.WriteString("OpusHead")
 	buf.WriteByte(1) // version
 	buf.WriteByte(byte(channels))
-	binary.Write(&buf, binary.LittleEndian, uint16(0))          // pre-skip
+	binary.Write(&buf, binary.LittleEndian, uint16(preSkip))    // pre-skip
 	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate)) // input sample rate
 	binary.Write(&buf, binary.LittleEndian, int16(0))           // output gain
 	buf.WriteByte(0)                                            // channel mapping family
 	return buf.Bytes()
 }
 
-func makeOpusTags() []byte {
+func makeOpusTags(comments []string) []byte {
 	var buf bytes.Buffer
 	buf.WriteString("OpusTags")
 	vendor := "lunartlk"
 	binary.Write(&buf, binary.LittleEndian, uint32(len(vendor)))
 	buf.WriteString(vendor)
-	binary.Write(&buf, binary.LittleEndian, uint32(0)) // no user comments
+	binary.Write(&buf, binary.LittleEndian, uint32(len(comments)))
+	for _, c := range comments {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(c)))
+		buf.WriteString(c)
+	}
 	return buf.Bytes()
 }
 
@@ -133,3 +179,84 @@ func crc32Ogg(data []byte) uint32 {
 	}
 	return crc
 }
+
+// ReadOggOpus extracts the Opus packets from an Ogg Opus file, skipping the
+// OpusHead and OpusTags header packets.
+func ReadOggOpus(data []byte) ([][]byte, error) {
+	packets, err := readOggPackets(data)
+	if err != nil {
+		return nil, err
+	}
+	return packets[2:], nil
+}
+
+// readOggPackets returns all the packets of an Ogg Opus file, the OpusHead
+// and OpusTags headers first.
+func readOggPackets(data []byte) ([][]byte, error) {
+	var packets [][]byte
+	var partial []byte
+	for off := 0; off < len(data); {
+		if len(data)-off < 27 || string(data[off:off+4]) != "OggS" {
+			return nil, fmt.Errorf("invalid Ogg page at offset %d", off)
+		}
+		numSegs := int(data[off+26])
+		hdrLen := 27 + numSegs
+		if len(data)-off < hdrLen {
+			return nil, fmt.Errorf("truncated Ogg page header at offset %d", off)
+		}
+		segTable := data[off+27 : off+hdrLen]
+		pos := off + hdrLen
+		for _, lacing := range segTable {
+			n := int(lacing)
+			if pos+n > len(data) {
+				return nil, fmt.Errorf("truncated Ogg page at offset %d", off)
+			}
+			partial = append(partial, data[pos:pos+n]...)
+			pos += n
+			if n < 255 {
+				packets = append(packets, partial)
+				partial = nil
+			}
+		}
+		off = pos
+	}
+
+	if len(packets) < 2 || !bytes.HasPrefix(packets[0], []byte("OpusHead")) {
+		return nil, fmt.Errorf("not an Ogg Opus stream")
+	}
+	return packets, nil
+}
+
+// decodeOggOpus decodes an Ogg Opus file, as recorded by browsers and
+// phones, to mono float32 PCM at 48kHz, the rate Opus decodes at natively.
+// The encoder delay announced in the header is dropped.
+func decodeOggOpus(data []byte) ([]float32, int32, error) {
+	packets, err := readOggPackets(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	head := packets[0]
+	if len(head) < 19 {
+		return nil, 0, fmt.Errorf("OpusHead too short")
+	}
+	channels := int(head[9])
+	skip := int(binary.LittleEndian.Uint16(head[10:]))
+	if channels != 1 && channels != 2 {
+		return nil, 0, fmt.Errorf("unsupported Ogg Opus channel count %d", channels)
+	}
+
+	dec, err := newFrameDecoder(48000, channels)
+	if err != nil {
+		return nil, 0, err
+	}
+	var samples []float32
+	pcm := make([]float32, 48000*120/1000*channels)
+	for _, p := range packets[2:] {
+		n, err := dec.DecodeFloat32(p, pcm)
+		if err != nil {
+			return nil, 0, fmt.Errorf("decode frame: %w", err)
+		}
+		samples = appendMono(samples, pcm[:n*channels], channels)
+	}
+	return samples[min(skip, len(samples)):], 48000, nil
+}
@@ -0,0 +1,174 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// oggPage is the header of a page, checked against its CRC.
+type oggPage struct {
+	flags   byte
+	granule uint64
+	seq     uint32
+}
+
+func readPages(t *testing.T, data []byte) []oggPage {
+	t.Helper()
+	var pages []oggPage
+	for off := 0; off < len(data); {
+		if len(data)-off < 27 || string(data[off:off+4]) != "OggS" {
+			t.Fatalf("no Ogg page at offset %d", off)
+		}
+		end := off + 27 + int(data[off+26])
+		for _, lacing := range data[off+27 : end] {
+			end += int(lacing)
+		}
+		page := append([]byte(nil), data[off:end]...)
+		crc := binary.LittleEndian.Uint32(page[22:])
+		clear(page[22:26])
+		if got := crc32Ogg(page); got != crc {
+			t.Fatalf("page at offset %d: CRC %08x, want %08x", off, crc, got)
+		}
+		pages = append(pages, oggPage{
+			flags:   page[5],
+			granule: binary.LittleEndian.Uint64(page[6:]),
+			seq:     binary.LittleEndian.Uint32(page[18:]),
+		})
+		off = end
+	}
+	return pages
+}
+
+// opusTags returns the vendor and comments of an OpusTags packet.
+func opusTags(t *testing.T, p []byte) (string, []string) {
+	t.Helper()
+	if !strings.HasPrefix(string(p), "OpusTags") {
+		t.Fatalf("second packet isn't OpusTags: %q", p)
+	}
+	p = p[8:]
+	next := func() string {
+		n := binary.LittleEndian.Uint32(p)
+		s := string(p[4 : 4+n])
+		p = p[4+n:]
+		return s
+	}
+	vendor := next()
+	comments := make([]string, binary.LittleEndian.Uint32(p))
+	p = p[4:]
+	for i := range comments {
+		comments[i] = next()
+	}
+	return vendor, comments
+}
+
+func TestOggOpus(t *testing.T) {
+	// 23 frames of 20ms, the last one padded: 450ms of audio at 16kHz
+	frames := make([][]byte, 23)
+	for i := range frames {
+		frames[i] = []byte{0xf8, byte(i)}
+	}
+	frames[5] = make([]byte, 300) // spans two lacing values
+	const samples = 7200
+	data := OggOpus(frames, SampleRate, 1,
+		WithLength(samples), WithComment("DATE", "2024-05-01"), WithComment("LANGUAGE", ""))
+
+	packets, err := readOggPackets(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 2+len(frames) || len(packets[2+5]) != 300 {
+		t.Fatalf("%d packets, want %d", len(packets), 2+len(frames))
+	}
+	head := packets[0]
+	if skip := binary.LittleEndian.Uint16(head[10:]); skip != preSkip {
+		t.Errorf("pre-skip %d, want %d", skip, preSkip)
+	}
+	if rate := binary.LittleEndian.Uint32(head[12:]); rate != SampleRate {
+		t.Errorf("input sample rate %d, want %d", rate, SampleRate)
+	}
+	vendor, comments := opusTags(t, packets[1])
+	if vendor != "lunartlk" || len(comments) != 1 || comments[0] != "DATE=2024-05-01" {
+		t.Errorf("vendor %q, comments %q", vendor, comments)
+	}
+
+	pages := readPages(t, data)
+	// The headers, then pages of 10 frames
+	if len(pages) != 5 {
+		t.Fatalf("%d pages, want 5", len(pages))
+	}
+	for i, p := range pages {
+		if p.seq != uint32(i) {
+			t.Errorf("page %d: sequence number %d", i, p.seq)
+		}
+	}
+	if pages[0].flags != 2 || pages[0].granule != 0 || pages[1].granule != 0 {
+		t.Errorf("header pages: flags %d, granules %d and %d", pages[0].flags, pages[0].granule, pages[1].granule)
+	}
+	if got := pages[2].granule; got != 10*960 {
+		t.Errorf("first audio page granule %d, want %d", got, 10*960)
+	}
+	last := pages[len(pages)-1]
+	if want := uint64(preSkip + samples*48000/SampleRate); last.granule != want {
+		t.Errorf("final granule %d, want %d", last.granule, want)
+	}
+	if last.flags != 4 {
+		t.Errorf("last page flags %d, want EOS", last.flags)
+	}
+}
+
+// TestOggOpusDecode plays an encoded recording back with opusdec, which
+// drops the pre-skip and trims the last frame to the final granule.
+func TestOggOpusDecode(t *testing.T) {
+	opusdec, err := exec.LookPath("opusdec")
+	if err != nil {
+		t.Skip("opusdec isn't installed")
+	}
+	enc, err := NewStreamEncoder(24000)
+	if errors.Is(err, ErrNoOpus) {
+		t.Skip(err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	const samples = 12345
+	pcm := make([]float32, samples)
+	for i := range pcm {
+		pcm[i] = 0.3 * float32(math.Sin(2*math.Pi*440*float64(i)/SampleRate))
+	}
+	if err := enc.Write(pcm); err != nil {
+		t.Fatal(err)
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	in, out := filepath.Join(dir, "in.opus"), filepath.Join(dir, "out.wav")
+	if err := os.WriteFile(in, enc.OggBytes(WithComment("TITLE", "tone")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	log, err := exec.Command(opusdec, "--rate", "48000", "--force-wav", in, out).CombinedOutput()
+	if err != nil {
+		t.Fatalf("opusdec: %v\n%s", err, log)
+	}
+	if !strings.Contains(string(log), "TITLE=tone") {
+		t.Errorf("opusdec didn't show the comment:\n%s", log)
+	}
+	wav, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, rate, err := DecodeWAV(wav)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := samples * 48000 / SampleRate; rate != 48000 || len(decoded) != want {
+		t.Errorf("decoded %d samples at %dHz, want %d at 48000Hz", len(decoded), rate, want)
+	}
+}
@@ -3,11 +3,10 @@ package audio
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
-
-	"github.com/hraban/opus"
 )
 
 const (
@@ -19,29 +18,112 @@ const (
 	maxFrameBytes = 1024
 )
 
+// ErrNoOpus is returned by the Opus encoders and decoders of builds
+// without libopus, made with the noopus tag or without cgo. The Ogg and
+// wire format containers still work, as they don't decode the frames.
+var ErrNoOpus = errors.New("built without Opus support")
+
+// frameEncoder and frameDecoder are the Opus codec, provided by libopus
+// when it's built in.
+type frameEncoder interface {
+	EncodeFloat32(pcm []float32, data []byte) (int, error)
+}
+
+type frameDecoder interface {
+	DecodeFloat32(data []byte, pcm []float32) (int, error)
+}
+
+// The wire format is a sequence of Opus frames, each prefixed with its
+// uint16 little-endian length. Version 2 streams start with a header
+// describing the audio:
+//
+//	magic "LTOP" | version uint8 | channels uint8 | sample rate uint32 | frame size uint16
+//
+// Version 1 streams have no header and are always 16kHz mono with 20ms
+// frames. A version 1 stream can't start with the magic, which as a frame
+// length would be larger than any Opus frame.
+const (
+	wireMagic      = "LTOP"
+	wireVersion    = 2
+	wireHeaderSize = 12
+)
+
+// WireHeader describes the audio of a wire format stream.
+type WireHeader struct {
+	Version    int
+	SampleRate int
+	Channels   int
+	// FrameSize is the number of samples per channel in each frame.
+	FrameSize int
+}
+
+// v1Header is the implicit header of version 1 streams.
+var v1Header = WireHeader{Version: 1, SampleRate: SampleRate, Channels: channels, FrameSize: FrameSize}
+
+func appendWireHeader(b []byte, rate, channels, frameSize int) []byte {
+	b = append(b, wireMagic...)
+	b = append(b, wireVersion, byte(channels))
+	b = binary.LittleEndian.AppendUint32(b, uint32(rate))
+	return binary.LittleEndian.AppendUint16(b, uint16(frameSize))
+}
+
+// ParseWireHeader returns the header of a wire format stream and the
+// frames following it. Streams without a header are version 1.
+func ParseWireHeader(data []byte) (WireHeader, []byte, error) {
+	if !bytes.HasPrefix(data, []byte(wireMagic)) {
+		return v1Header, data, nil
+	}
+	if len(data) < wireHeaderSize {
+		return WireHeader{}, nil, fmt.Errorf("opus wire header too short")
+	}
+	h := WireHeader{
+		Version:    int(data[4]),
+		Channels:   int(data[5]),
+		SampleRate: int(binary.LittleEndian.Uint32(data[6:])),
+		FrameSize:  int(binary.LittleEndian.Uint16(data[10:])),
+	}
+	if h.Version != wireVersion {
+		return WireHeader{}, nil, fmt.Errorf("unsupported opus wire format version %d", h.Version)
+	}
+	switch h.SampleRate {
+	case 8000, 12000, 16000, 24000, 48000:
+	default:
+		return WireHeader{}, nil, fmt.Errorf("invalid opus sample rate %d", h.SampleRate)
+	}
+	if h.Channels != 1 && h.Channels != 2 {
+		return WireHeader{}, nil, fmt.Errorf("invalid opus channel count %d", h.Channels)
+	}
+	if h.FrameSize == 0 {
+		return WireHeader{}, nil, fmt.Errorf("invalid opus frame size 0")
+	}
+	return h, data[wireHeaderSize:], nil
+}
+
 // StreamEncoder encodes PCM audio to Opus incrementally.
 type StreamEncoder struct {
-	enc    *opus.Encoder
+	enc    frameEncoder
 	buf    []float32
 	out    bytes.Buffer
 	frames [][]byte // individual encoded frames for Ogg muxing
 	frame  []byte
 	mu     sync.Mutex
+	// samples is the number of samples written, without the padding of
+	// the last frame.
+	samples int
 }
 
 // NewStreamEncoder creates a streaming Opus encoder.
 func NewStreamEncoder(bitrate int) (*StreamEncoder, error) {
-	enc, err := opus.NewEncoder(SampleRate, channels, opus.AppVoIP)
+	enc, err := newFrameEncoder(bitrate)
 	if err != nil {
-		return nil, fmt.Errorf("create encoder: %w", err)
-	}
-	if err := enc.SetBitrate(bitrate); err != nil {
-		return nil, fmt.Errorf("set bitrate: %w", err)
+		return nil, err
 	}
-	return &StreamEncoder{
+	s := &StreamEncoder{
 		enc:   enc,
 		frame: make([]byte, maxFrameBytes),
-	}, nil
+	}
+	s.out.Write(appendWireHeader(nil, SampleRate, channels, FrameSize))
+	return s, nil
 }
 
 // Write adds PCM samples and encodes any complete frames.
@@ -50,6 +132,7 @@ func (s *StreamEncoder) Write(samples []float32) error {
 	defer s.mu.Unlock()
 
 	s.buf = append(s.buf, samples...)
+	s.samples += len(samples)
 
 	for len(s.buf) >= FrameSize {
 		pcm := s.buf[:FrameSize]
@@ -102,10 +185,23 @@ func (s *StreamEncoder) Bytes() []byte {
 }
 
 // OggBytes returns the encoded audio as a standard Ogg Opus file (playable by media players).
-func (s *StreamEncoder) OggBytes() []byte {
+// Options can add comments describing the recording.
+func (s *StreamEncoder) OggBytes(opts ...OggOption) []byte {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	return OggOpus(s.frames, SampleRate, channels)
+	return OggOpus(s.frames, SampleRate, channels, append([]OggOption{WithLength(s.samples)}, opts...)...)
+}
+
+// WireFrames packs already-encoded 16kHz mono Opus frames of FrameSize
+// samples into the wire format accepted by DecodeOpus.
+func WireFrames(frames [][]byte) []byte {
+	var out bytes.Buffer
+	out.Write(appendWireHeader(nil, SampleRate, channels, FrameSize))
+	for _, f := range frames {
+		binary.Write(&out, binary.LittleEndian, uint16(len(f)))
+		out.Write(f)
+	}
+	return out.Bytes()
 }
 
 // EncodeOpus encodes float32 PCM samples to Opus in one shot.
@@ -123,16 +219,27 @@ func EncodeOpus(samples []float32, bitrate int) ([]byte, error) {
 	return se.Bytes(), nil
 }
 
-// DecodeOpus decodes an Opus stream back to float32 PCM samples.
+// DecodeOpus decodes a wire format Opus stream, version 1 or 2, or an Ogg
+// Opus file back to float32 PCM samples at the stream's sample rate (48kHz
+// for Ogg). Stereo is mixed down to mono.
 func DecodeOpus(data []byte) ([]float32, int32, error) {
-	dec, err := opus.NewDecoder(SampleRate, channels)
+	if bytes.HasPrefix(data, []byte("OggS")) {
+		return decodeOggOpus(data)
+	}
+	hdr, data, err := ParseWireHeader(data)
 	if err != nil {
-		return nil, 0, fmt.Errorf("create decoder: %w", err)
+		return nil, 0, err
+	}
+	dec, err := newFrameDecoder(hdr.SampleRate, hdr.Channels)
+	if err != nil {
+		return nil, 0, err
 	}
 
 	r := bytes.NewReader(data)
 	var samples []float32
-	pcm := make([]float32, FrameSize)
+	// Room for the longest Opus packet, 120ms, in case the frames aren't
+	// all FrameSize
+	pcm := make([]float32, max(hdr.FrameSize, hdr.SampleRate*120/1000)*hdr.Channels)
 
 	for {
 		var frameLen uint16
@@ -153,8 +260,19 @@ func DecodeOpus(data []byte) ([]float32, int32, error) {
 			return nil, 0, fmt.Errorf("decode frame: %w", err)
 		}
 
-		samples = append(samples, pcm[:n]...)
+		samples = appendMono(samples, pcm[:n*hdr.Channels], hdr.Channels)
 	}
 
-	return samples, SampleRate, nil
+	return samples, int32(hdr.SampleRate), nil
+}
+
+// appendMono appends interleaved pcm to samples, mixing stereo down to mono.
+func appendMono(samples, pcm []float32, channels int) []float32 {
+	if channels == 1 {
+		return append(samples, pcm...)
+	}
+	for i := 0; i+1 < len(pcm); i += 2 {
+		samples = append(samples, (pcm[i]+pcm[i+1])/2)
+	}
+	return samples
 }
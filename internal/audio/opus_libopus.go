@@ -0,0 +1,31 @@
+//go:build cgo && !noopus
+
+package audio
+
+import (
+	"fmt"
+
+	"github.com/hraban/opus"
+)
+
+// OpusSupported reports whether this build can encode and decode Opus.
+const OpusSupported = true
+
+func newFrameEncoder(bitrate int) (frameEncoder, error) {
+	enc, err := opus.NewEncoder(SampleRate, channels, opus.AppVoIP)
+	if err != nil {
+		return nil, fmt.Errorf("create encoder: %w", err)
+	}
+	if err := enc.SetBitrate(bitrate); err != nil {
+		return nil, fmt.Errorf("set bitrate: %w", err)
+	}
+	return enc, nil
+}
+
+func newFrameDecoder(sampleRate, channels int) (frameDecoder, error) {
+	dec, err := opus.NewDecoder(sampleRate, channels)
+	if err != nil {
+		return nil, fmt.Errorf("create decoder: %w", err)
+	}
+	return dec, nil
+}
@@ -0,0 +1,14 @@
+//go:build !cgo || noopus
+
+package audio
+
+// OpusSupported reports whether this build can encode and decode Opus.
+const OpusSupported = false
+
+func newFrameEncoder(int) (frameEncoder, error) {
+	return nil, ErrNoOpus
+}
+
+func newFrameDecoder(int, int) (frameDecoder, error) {
+	return nil, ErrNoOpus
+}
@@ -0,0 +1,105 @@
+package audio
+
+import (
+	"math"
+	"slices"
+)
+
+// Clipped samples pile up at the peak amplitude. Clients may have scaled
+// the audio since, and lossy codecs blur the flat tops, so samples within
+// clipMargin of the peak count as clipped rather than only full-scale ones.
+// Unclipped speech has very few of them.
+const (
+	clipMargin = 0.02
+	histBins   = 1000
+)
+
+// maxSNR caps the SNR estimate, which is infinite for digital silence
+// between words.
+const maxSNR = 100
+
+// Stats accumulates loudness and clipping statistics over audio added in
+// pieces, as it's decoded.
+type Stats struct {
+	frameSize int
+	frame     []float32
+	// frameRMS is the RMS of each complete 20ms frame.
+	frameRMS []float64
+	// hist counts samples by amplitude, to find those near the peak.
+	hist  [histBins + 1]int
+	peak  float64
+	sumSq float64
+	count int
+}
+
+// NewStats returns an empty Stats for audio at sampleRate.
+func NewStats(sampleRate int) *Stats {
+	return &Stats{frameSize: max(sampleRate/50, 1)}
+}
+
+// Add adds samples to the statistics.
+func (s *Stats) Add(samples []float32) {
+	for _, v := range samples {
+		a := math.Abs(float64(v))
+		s.peak = max(s.peak, a)
+		s.sumSq += a * a
+		s.hist[int(min(a, 1)*histBins)]++
+		s.frame = append(s.frame, v)
+		if len(s.frame) == s.frameSize {
+			s.frameRMS = append(s.frameRMS, rms(s.frame))
+			s.frame = s.frame[:0]
+		}
+	}
+	s.count += len(samples)
+}
+
+// Levels returns the statistics of the audio added so far. The SNR is
+// estimated from the loudness of 20ms frames: the quietest tenth is taken
+// as the noise floor, the loudest tenth as speech.
+func (s *Stats) Levels() Levels {
+	if s.count == 0 {
+		return Levels{}
+	}
+	l := Levels{
+		Peak: s.peak,
+		RMS:  math.Sqrt(s.sumSq / float64(s.count)),
+	}
+	// Near-silent recordings can't clip
+	if s.peak >= 0.1 {
+		var clipped int
+		for _, n := range s.hist[int(min(s.peak, 1)*(1-clipMargin)*histBins):] {
+			clipped += n
+		}
+		l.ClippingRatio = float64(clipped) / float64(s.count)
+	}
+	if len(s.frameRMS) > 0 {
+		sorted := slices.Sorted(slices.Values(s.frameRMS))
+		noise := sorted[len(sorted)/10]
+		signal := sorted[len(sorted)*9/10]
+		switch {
+		case signal == 0:
+		case noise == 0:
+			l.SNR = maxSNR
+		default:
+			l.SNR = min(20*math.Log10(signal/noise), maxSNR)
+		}
+	}
+	return l
+}
+
+// Levels are basic quality metrics of a recording. Peak and RMS are linear
+// amplitudes from 0 to 1, SNR is in decibels.
+type Levels struct {
+	Peak          float64
+	RMS           float64
+	ClippingRatio float64
+	SNR           float64
+}
+
+func rms(samples []float32) float64 {
+	var sum float64
+	for _, v := range samples {
+		sum += float64(v) * float64(v)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
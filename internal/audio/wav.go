@@ -2,9 +2,27 @@ package audio
 
 import (
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 )
 
+// MinWAVRate and MaxWAVRate bound the sample rates WAV files may declare,
+// from telephony to studio audio. Resampling anything else takes filters
+// too large to build for an uploaded header.
+const (
+	MinWAVRate = 8000
+	MaxWAVRate = 192000
+)
+
+// checkWAVRate rejects sample rates outside MinWAVRate and MaxWAVRate.
+func checkWAVRate(rate int64) error {
+	if rate < MinWAVRate || rate > MaxWAVRate {
+		return fmt.Errorf("invalid WAV sample rate %d, must be %d to %dHz", rate, MinWAVRate, MaxWAVRate)
+	}
+	return nil
+}
+
 // DecodeWAV parses a WAV file and returns float32 samples and sample rate.
 func DecodeWAV(data []byte) ([]float32, int32, error) {
 	if len(data) < 44 {
@@ -38,6 +56,9 @@ func DecodeWAV(data []byte) ([]float32, int32, error) {
 			if audioFormat != 1 {
 				return nil, 0, fmt.Errorf("only PCM WAV supported (got format %d)", audioFormat)
 			}
+			if err := checkWAVRate(int64(sampleRate)); err != nil {
+				return nil, 0, err
+			}
 			end := offset + 8 + int(chunkSize)
 			if end > len(data) {
 				end = len(data)
@@ -51,16 +72,131 @@ func DecodeWAV(data []byte) ([]float32, int32, error) {
 	return nil, 0, fmt.Errorf("missing fmt or data chunk")
 }
 
+// WAVReader decodes a PCM WAV file as it's read, for audio too long, or
+// arriving too slowly, to wait for the whole file.
+type WAVReader struct {
+	r             io.Reader
+	sampleRate    int32
+	bitsPerSample uint16
+	numChannels   uint16
+	// remaining is the number of data bytes left, or -1 when the header
+	// doesn't say (streamed WAVs often have a 0 or 0xFFFFFFFF size).
+	remaining int64
+}
+
+// NewWAVReader reads the WAV header from r, up to the start of the audio.
+func NewWAVReader(r io.Reader) (*WAVReader, error) {
+	var hdr [12]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, fmt.Errorf("file too small for WAV header")
+	}
+	if string(hdr[0:4]) != "RIFF" || string(hdr[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("not a WAV file")
+	}
+
+	w := &WAVReader{r: r}
+	foundFmt := false
+	for {
+		var chunk [8]byte
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			return nil, fmt.Errorf("missing fmt or data chunk")
+		}
+		chunkID := string(chunk[0:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(chunk[4:8]))
+		switch {
+		case chunkID == "fmt ":
+			if chunkSize < 16 {
+				return nil, fmt.Errorf("fmt chunk too small")
+			}
+			f := make([]byte, chunkSize)
+			if _, err := io.ReadFull(r, f); err != nil {
+				return nil, fmt.Errorf("fmt chunk: %w", err)
+			}
+			if format := binary.LittleEndian.Uint16(f[0:]); format != 1 {
+				return nil, fmt.Errorf("only PCM WAV supported (got format %d)", format)
+			}
+			w.numChannels = binary.LittleEndian.Uint16(f[2:])
+			w.sampleRate = int32(binary.LittleEndian.Uint32(f[4:]))
+			w.bitsPerSample = binary.LittleEndian.Uint16(f[14:])
+			if w.numChannels == 0 || (w.bitsPerSample != 16 && w.bitsPerSample != 32) {
+				return nil, fmt.Errorf("unsupported WAV: %d channels, %d bits", w.numChannels, w.bitsPerSample)
+			}
+			if err := checkWAVRate(int64(w.sampleRate)); err != nil {
+				return nil, err
+			}
+			foundFmt = true
+		case chunkID == "data" && foundFmt:
+			w.remaining = chunkSize
+			if chunkSize == 0 || chunkSize == 0xFFFFFFFF {
+				w.remaining = -1
+			}
+			return w, nil
+		default:
+			if _, err := io.CopyN(io.Discard, r, chunkSize); err != nil {
+				return nil, fmt.Errorf("missing fmt or data chunk")
+			}
+		}
+	}
+}
+
+// SampleRate returns the sample rate of the audio.
+func (w *WAVReader) SampleRate() int32 { return w.sampleRate }
+
+// Duration returns the audio length in seconds announced by the header, or
+// 0 when it doesn't say.
+func (w *WAVReader) Duration() float64 {
+	if w.remaining < 0 {
+		return 0
+	}
+	frameSize := int64(w.numChannels) * int64(w.bitsPerSample/8)
+	return float64(w.remaining/frameSize) / float64(w.sampleRate)
+}
+
+// Read returns up to n samples of the first channel, and io.EOF once the
+// audio is over.
+func (w *WAVReader) Read(n int) ([]float32, error) {
+	frameSize := int64(w.numChannels) * int64(w.bitsPerSample/8)
+	size := int64(n) * frameSize
+	if w.remaining >= 0 {
+		size = min(size, w.remaining/frameSize*frameSize)
+	}
+	if size == 0 {
+		return nil, io.EOF
+	}
+	buf := make([]byte, size)
+	read, err := io.ReadFull(w.r, buf)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		// A truncated upload keeps the audio that arrived
+		err = nil
+	}
+	if w.remaining >= 0 {
+		w.remaining -= int64(read)
+	}
+	read -= read % int(frameSize)
+	if read == 0 {
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, err
+	}
+	return pcmToFloat32(buf[:read], w.bitsPerSample, w.numChannels), err
+}
+
 // EncodeWAV creates a 16-bit mono PCM WAV from float32 samples.
 func EncodeWAV(samples []float32, sampleRate int) []byte {
-	numSamples := len(samples)
-	dataSize := numSamples * 2
-	fileSize := 36 + dataSize
-	buf := make([]byte, 0, fileSize+8)
+	buf := make([]byte, 0, wavHeaderSize+len(samples)*2)
+	buf = appendWAVHeader(buf, sampleRate, uint32(len(samples)*2))
+	return appendPCM16(buf, samples)
+}
+
+const wavHeaderSize = 44
 
+// appendWAVHeader appends the header of a 16-bit mono PCM WAV with
+// dataSize bytes of samples.
+func appendWAVHeader(buf []byte, sampleRate int, dataSize uint32) []byte {
 	// RIFF header
 	buf = append(buf, "RIFF"...)
-	buf = binary.LittleEndian.AppendUint32(buf, uint32(fileSize))
+	buf = binary.LittleEndian.AppendUint32(buf, riffSize(dataSize))
 	buf = append(buf, "WAVE"...)
 
 	// fmt chunk
@@ -75,7 +211,22 @@ func EncodeWAV(samples []float32, sampleRate int) []byte {
 
 	// data chunk
 	buf = append(buf, "data"...)
-	buf = binary.LittleEndian.AppendUint32(buf, uint32(dataSize))
+	return binary.LittleEndian.AppendUint32(buf, dataSize)
+}
+
+// riffSize returns the RIFF chunk size for dataSize bytes of samples,
+// keeping the "unknown" size of streamed files.
+func riffSize(dataSize uint32) uint32 {
+	if dataSize == unknownWAVSize {
+		return unknownWAVSize
+	}
+	return wavHeaderSize - 8 + dataSize
+}
+
+// unknownWAVSize is the size written while a file is being streamed.
+const unknownWAVSize = 0xFFFFFFFF
+
+func appendPCM16(buf []byte, samples []float32) []byte {
 	for _, s := range samples {
 		if s > 1.0 {
 			s = 1.0
@@ -84,10 +235,75 @@ func EncodeWAV(samples []float32, sampleRate int) []byte {
 		}
 		buf = binary.LittleEndian.AppendUint16(buf, uint16(int16(s*32767)))
 	}
-
 	return buf
 }
 
+// WAVWriter writes a 16-bit mono PCM WAV as samples arrive, so long
+// recordings go to disk instead of being held in memory.
+type WAVWriter struct {
+	w          io.Writer
+	sampleRate int
+	dataSize   int64
+	started    bool
+	buf        []byte
+}
+
+// NewWAVWriter returns a writer of WAV audio at sampleRate to w. The
+// header is written with the first samples.
+func NewWAVWriter(w io.Writer, sampleRate int) *WAVWriter {
+	return &WAVWriter{w: w, sampleRate: sampleRate}
+}
+
+// Write appends samples to the file.
+func (w *WAVWriter) Write(samples []float32) error {
+	w.buf = w.buf[:0]
+	if !w.started {
+		// The sizes aren't known yet: readers treat these as "until the
+		// end of the file", and Close fixes them when it can
+		w.buf = appendWAVHeader(w.buf, w.sampleRate, unknownWAVSize)
+		w.started = true
+	}
+	w.buf = appendPCM16(w.buf, samples)
+	if _, err := w.w.Write(w.buf); err != nil {
+		return err
+	}
+	w.dataSize += int64(len(samples) * 2)
+	return nil
+}
+
+// Close finishes the file. When the underlying writer is an
+// io.WriteSeeker, such as an *os.File, the header gets the final sizes.
+// It doesn't close the underlying writer.
+func (w *WAVWriter) Close() error {
+	if !w.started {
+		if err := w.Write(nil); err != nil {
+			return err
+		}
+	}
+	ws, ok := w.w.(io.WriteSeeker)
+	if !ok || w.dataSize >= unknownWAVSize {
+		return nil
+	}
+	dataSize := uint32(w.dataSize)
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], riffSize(dataSize))
+	if _, err := ws.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(size[:]); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint32(size[:], dataSize)
+	if _, err := ws.Seek(wavHeaderSize-4, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := ws.Write(size[:]); err != nil {
+		return err
+	}
+	_, err := ws.Seek(0, io.SeekEnd)
+	return err
+}
+
 func pcmToFloat32(data []byte, bitsPerSample, numChannels uint16) []float32 {
 	bytesPerSample := int(bitsPerSample / 8)
 	frameSize := int(numChannels) * bytesPerSample
@@ -107,3 +323,9 @@ func pcmToFloat32(data []byte, bitsPerSample, numChannels uint16) []float32 {
 	}
 	return samples
 }
+
+// DecodePCM converts raw little-endian PCM (16 or 32 bits per sample) to
+// float32 samples, keeping the first channel.
+func DecodePCM(data []byte, bitsPerSample, numChannels uint16) []float32 {
+	return pcmToFloat32(data, bitsPerSample, numChannels)
+}
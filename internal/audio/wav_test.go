@@ -0,0 +1,29 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestWAVSampleRate(t *testing.T) {
+	for _, rate := range []uint32{0, 4000, 1000003, 1 << 31} {
+		bad := EncodeWAV(make([]float32, 160), 16000)
+		binary.LittleEndian.PutUint32(bad[24:], rate)
+		if _, _, err := DecodeWAV(bad); err == nil || !strings.Contains(err.Error(), "sample rate") {
+			t.Errorf("DecodeWAV of a %dHz WAV: %v", rate, err)
+		}
+		if _, err := NewWAVReader(bytes.NewReader(bad)); err == nil || !strings.Contains(err.Error(), "sample rate") {
+			t.Errorf("NewWAVReader of a %dHz WAV: %v", rate, err)
+		}
+	}
+
+	w, err := NewWAVReader(bytes.NewReader(EncodeWAV(make([]float32, 16000), 16000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.SampleRate() != 16000 || w.Duration() != 1 {
+		t.Errorf("%dHz, %vs, want 16000Hz, 1s", w.SampleRate(), w.Duration())
+	}
+}
@@ -0,0 +1,154 @@
+// Package audit keeps an append-only log of who transcribed what, one JSON
+// object per line, rotated by size.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is a transcription request. The transcript and the token aren't
+// logged, only their hashes, so the log can be kept longer and shown to
+// more people than the transcripts themselves.
+type Entry struct {
+	Time time.Time `json:"time"`
+	// User is the named user who sent the request, empty for the shared
+	// -token or without authentication.
+	User string `json:"user,omitempty"`
+	// TokenID identifies the token the request used, see TokenID.
+	TokenID  string `json:"token_id,omitempty"`
+	ClientIP string `json:"client_ip"`
+	Path     string `json:"path"`
+	// Status is "ok", or "error" with Error saying why.
+	Status        string  `json:"status"`
+	Error         string  `json:"error,omitempty"`
+	UploadBytes   int     `json:"upload_bytes"`
+	AudioDuration float64 `json:"audio_duration"`
+	Engine        string  `json:"engine"`
+	Model         string  `json:"model,omitempty"`
+	Lang          string  `json:"lang"`
+	// ResultHash is the SHA-256 of the returned text, see Hash.
+	ResultHash string `json:"result_hash,omitempty"`
+	// TranscriptID is the stored transcript, with -store.
+	TranscriptID string `json:"transcript_id,omitempty"`
+}
+
+// Hash returns the hex SHA-256 of text, to tell later whether a transcript
+// is the one a request returned.
+func Hash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// TokenID returns the first 12 hex digits of the SHA-256 of a token: enough
+// to tell tokens apart, useless to authenticate with.
+func TokenID(token string) string {
+	if token == "" {
+		return ""
+	}
+	return Hash(token)[:12]
+}
+
+// Log appends entries to a file. When the file would grow over its
+// maximum size, it's renamed to path.1, path.1 to path.2 and so on, and
+// the oldest beyond the kept ones is deleted. It's safe for concurrent
+// use.
+type Log struct {
+	path    string
+	maxSize int64
+	keep    int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// Open opens the log at path for appending, creating it if needed.
+// maxSize 0 disables rotation.
+func Open(path string, maxSize int64, keep int) (*Log, error) {
+	l := &Log{path: path, maxSize: maxSize, keep: keep}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("open audit log: %w", err)
+	}
+	l.f, l.size = f, st.Size()
+	return nil
+}
+
+// Write appends e to the log, rotating it first when it's full.
+func (l *Log) Write(e Entry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return fmt.Errorf("audit log closed")
+	}
+	var rerr error
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		rerr = l.rotate()
+		if l.f == nil {
+			return rerr
+		}
+	}
+	n, err := l.f.Write(line)
+	l.size += int64(n)
+	return errors.Join(rerr, err)
+}
+
+// rotate renames the full log away and starts a new one. When the full
+// log can't be moved, it's reopened and written past its maximum size
+// rather than losing entries. l.f is nil if neither file could be opened.
+// l.mu must be held.
+func (l *Log) rotate() error {
+	l.f.Close()
+	l.f = nil
+	var err error
+	if l.keep > 0 {
+		os.Remove(fmt.Sprintf("%s.%d", l.path, l.keep))
+		for i := l.keep - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		err = os.Rename(l.path, l.path+".1")
+	} else {
+		err = os.Remove(l.path)
+	}
+	if err != nil {
+		err = fmt.Errorf("rotate audit log: %w", err)
+	}
+	return errors.Join(err, l.open())
+}
+
+// Close closes the log file.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.f == nil {
+		return nil
+	}
+	err := l.f.Close()
+	l.f = nil
+	return err
+}
@@ -0,0 +1,72 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func countEntries(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Entry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		n++
+	}
+	return n
+}
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	l, err := Open(path, 300, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for range 10 {
+		if err := l.Write(Entry{User: "ana", Path: "/transcribe", Status: "ok"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	total := 0
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		total += countEntries(t, name)
+	}
+	if _, err := os.Stat(path + ".3"); err == nil {
+		t.Error("kept more than 2 rotated logs")
+	}
+	if total == 0 || total == 10 {
+		t.Errorf("%d entries in the kept logs, want some dropped with the oldest", total)
+	}
+}
+
+func TestRotateFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// A directory that isn't empty can't be removed or replaced
+	os.MkdirAll(filepath.Join(path+".1", "x"), 0755)
+	l, err := Open(path, 100, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	for i := range 5 {
+		err := l.Write(Entry{User: "ana", Path: "/transcribe", Status: "ok"})
+		if i > 0 && err == nil {
+			t.Errorf("write %d: the failed rotation wasn't reported", i)
+		}
+	}
+	if n := countEntries(t, path); n != 5 {
+		t.Errorf("%d entries, want 5 in the unrotated log", n)
+	}
+}
@@ -0,0 +1,102 @@
+// Package chatbot receives voice messages from chat networks (Telegram and
+// Matrix) and replies to them with text, using the networks' HTTP APIs
+// directly.
+package chatbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxAudio bounds downloaded voice messages.
+const maxAudio = 50 << 20
+
+// Message is a voice or audio message received by a bot.
+type Message struct {
+	// Sender identifies the author: a numeric Telegram user ID or a Matrix
+	// user ID such as "@alice:example.org".
+	Sender string
+	// SenderName is the Telegram username, if any.
+	SenderName string
+	// Audio is the message's audio file and MimeType its type, usually
+	// "audio/ogg" (Opus).
+	Audio    []byte
+	MimeType string
+}
+
+// Handler processes a message and returns the reply. An empty reply sends
+// nothing.
+type Handler func(ctx context.Context, m *Message) string
+
+// Bot is a chat network connection that delivers voice messages to a
+// Handler until its context is cancelled.
+type Bot interface {
+	Run(ctx context.Context, h Handler) error
+}
+
+// pollClient has no timeout of its own: long polls are bounded by the
+// server-side timeout and the request context.
+var pollClient = &http.Client{}
+
+// do sends req and decodes a JSON response into v, failing on non-2xx
+// statuses.
+func do(req *http.Request, v any) error {
+	resp, err := pollClient.Do(req)
+	if err != nil {
+		return stripURL(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s: HTTP %d: %s", req.URL.Path, resp.StatusCode, body)
+	}
+	if v == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s: %w", req.URL.Path, err)
+	}
+	return nil
+}
+
+// download fetches a file of at most maxAudio bytes.
+func download(req *http.Request) ([]byte, error) {
+	resp, err := pollClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download: %w", stripURL(err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download: HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAudio+1))
+	if err != nil {
+		return nil, fmt.Errorf("download: %w", err)
+	}
+	if len(data) > maxAudio {
+		return nil, fmt.Errorf("download: file larger than %d MB", maxAudio>>20)
+	}
+	return data, nil
+}
+
+// sleep waits for d or until ctx is done, for backing off after errors.
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+// stripURL removes the request URL from a client error, since Telegram
+// URLs contain the bot token.
+func stripURL(err error) error {
+	if uerr, ok := err.(*url.Error); ok {
+		return uerr.Err
+	}
+	return err
+}
@@ -0,0 +1,178 @@
+package chatbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Matrix is a bot using the Matrix client-server API with /sync long
+// polling. It joins the rooms it's invited to. End-to-end encrypted rooms
+// aren't supported.
+type Matrix struct {
+	homeserver string
+	token      string
+	userID     string
+	txn        int64
+}
+
+// NewMatrix returns a bot for an account on homeserver (e.g.
+// "https://matrix.example.org"), authenticated with an access token.
+func NewMatrix(homeserver, accessToken string) *Matrix {
+	return &Matrix{
+		homeserver: strings.TrimSuffix(homeserver, "/"),
+		token:      accessToken,
+		txn:        time.Now().UnixNano(),
+	}
+}
+
+type matrixEvent struct {
+	Type    string `json:"type"`
+	Sender  string `json:"sender"`
+	EventID string `json:"event_id"`
+	Content struct {
+		MsgType string `json:"msgtype"`
+		URL     string `json:"url"`
+		Info    struct {
+			MimeType string `json:"mimetype"`
+		} `json:"info"`
+	} `json:"content"`
+}
+
+type matrixSync struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]json.RawMessage `json:"invite"`
+	} `json:"rooms"`
+}
+
+// Run syncs and answers m.audio messages (voice messages included) with
+// h's reply, as a notice in reply to them. Messages sent before Run
+// started are skipped.
+func (m *Matrix) Run(ctx context.Context, h Handler) error {
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	if err := m.do(ctx, "GET", "/_matrix/client/v3/account/whoami", nil, &whoami); err != nil {
+		return fmt.Errorf("matrix: %w", err)
+	}
+	m.userID = whoami.UserID
+
+	var since string
+	for ctx.Err() == nil {
+		// The first sync returns immediately and only sets the starting point
+		path := "/_matrix/client/v3/sync?timeout=0"
+		if since != "" {
+			path = "/_matrix/client/v3/sync?timeout=30000&since=" + url.QueryEscape(since)
+		}
+		var s matrixSync
+		if err := m.do(ctx, "GET", path, nil, &s); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[matrix] %v", err)
+				sleep(ctx, 5*time.Second)
+			}
+			continue
+		}
+
+		for room := range s.Rooms.Invite {
+			if err := m.do(ctx, "POST", "/_matrix/client/v3/rooms/"+url.PathEscape(room)+"/join", struct{}{}, nil); err != nil {
+				log.Printf("[matrix] join %s: %v", room, err)
+			}
+		}
+		if since != "" {
+			for room, joined := range s.Rooms.Join {
+				for _, e := range joined.Timeline.Events {
+					m.handle(ctx, room, e, h)
+				}
+			}
+		}
+		since = s.NextBatch
+	}
+	return nil
+}
+
+func (m *Matrix) handle(ctx context.Context, room string, e matrixEvent, h Handler) {
+	if e.Type != "m.room.message" || e.Content.MsgType != "m.audio" || e.Sender == m.userID {
+		return
+	}
+	if e.Content.URL == "" {
+		// Encrypted attachments come in content.file
+		return
+	}
+	data, err := m.download(ctx, e.Content.URL)
+	if err != nil {
+		log.Printf("[matrix] %v", err)
+		return
+	}
+	reply := h(ctx, &Message{Sender: e.Sender, Audio: data, MimeType: e.Content.Info.MimeType})
+	if reply == "" {
+		return
+	}
+
+	m.txn++
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(room) + "/send/m.room.message/" + strconv.FormatInt(m.txn, 10)
+	err = m.do(ctx, "PUT", path, map[string]any{
+		"msgtype": "m.notice",
+		"body":    reply,
+		"m.relates_to": map[string]any{
+			"m.in_reply_to": map[string]string{"event_id": e.EventID},
+		},
+	}, nil)
+	if err != nil {
+		log.Printf("[matrix] reply: %v", err)
+	}
+}
+
+// download fetches an mxc:// URI, with the authenticated media API and
+// falling back to the legacy one for older homeservers.
+func (m *Matrix) download(ctx context.Context, mxc string) ([]byte, error) {
+	server, media, ok := strings.Cut(strings.TrimPrefix(mxc, "mxc://"), "/")
+	if !ok || !strings.HasPrefix(mxc, "mxc://") {
+		return nil, fmt.Errorf("bad media URI %q", mxc)
+	}
+	var err error
+	for _, prefix := range []string{"/_matrix/client/v1/media/download/", "/_matrix/media/v3/download/"} {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, "GET", m.homeserver+prefix+url.PathEscape(server)+"/"+url.PathEscape(media), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+m.token)
+		var data []byte
+		if data, err = download(req); err == nil {
+			return data, nil
+		}
+	}
+	return nil, err
+}
+
+func (m *Matrix) do(ctx context.Context, method, path string, body, result any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, m.homeserver+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return do(req, result)
+}
@@ -0,0 +1,179 @@
+package chatbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const telegramAPI = "https://api.telegram.org"
+
+// Telegram is a bot using the Telegram Bot API with long polling.
+type Telegram struct {
+	token string
+}
+
+// NewTelegram returns a bot for the token given by @BotFather.
+func NewTelegram(token string) *Telegram {
+	return &Telegram{token: token}
+}
+
+type telegramFile struct {
+	FileID   string `json:"file_id"`
+	MimeType string `json:"mime_type"`
+}
+
+type telegramMessage struct {
+	MessageID int64 `json:"message_id"`
+	From      struct {
+		ID       int64  `json:"id"`
+		Username string `json:"username"`
+	} `json:"from"`
+	Chat struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+	Voice *telegramFile `json:"voice"`
+	Audio *telegramFile `json:"audio"`
+}
+
+type telegramResponse struct {
+	OK          bool            `json:"ok"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+}
+
+// Run polls for messages and answers voice and audio messages with h's
+// reply. Other messages are ignored.
+func (t *Telegram) Run(ctx context.Context, h Handler) error {
+	// Fail early on a bad token
+	if err := t.call(ctx, "getMe", nil, nil); err != nil {
+		return fmt.Errorf("telegram: %w", err)
+	}
+
+	var offset int64
+	for ctx.Err() == nil {
+		var updates []struct {
+			UpdateID int64            `json:"update_id"`
+			Message  *telegramMessage `json:"message"`
+		}
+		params := url.Values{
+			"timeout":         {"50"},
+			"offset":          {strconv.FormatInt(offset, 10)},
+			"allowed_updates": {`["message"]`},
+		}
+		if err := t.call(ctx, "getUpdates", params, &updates); err != nil {
+			if ctx.Err() == nil {
+				log.Printf("[telegram] %v", err)
+				sleep(ctx, 5*time.Second)
+			}
+			continue
+		}
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			if u.Message != nil {
+				t.handle(ctx, u.Message, h)
+			}
+		}
+	}
+	return nil
+}
+
+func (t *Telegram) handle(ctx context.Context, msg *telegramMessage, h Handler) {
+	file := msg.Voice
+	if file == nil {
+		file = msg.Audio
+	}
+	if file == nil {
+		return
+	}
+	data, err := t.download(ctx, file.FileID)
+	if err != nil {
+		log.Printf("[telegram] %v", err)
+		return
+	}
+	reply := h(ctx, &Message{
+		Sender:     strconv.FormatInt(msg.From.ID, 10),
+		SenderName: msg.From.Username,
+		Audio:      data,
+		MimeType:   file.MimeType,
+	})
+	if reply == "" {
+		return
+	}
+	err = t.post(ctx, "sendMessage", map[string]any{
+		"chat_id":          msg.Chat.ID,
+		"text":             reply,
+		"reply_parameters": map[string]any{"message_id": msg.MessageID},
+	})
+	if err != nil {
+		log.Printf("[telegram] %v", err)
+	}
+}
+
+func (t *Telegram) download(ctx context.Context, fileID string) ([]byte, error) {
+	var f struct {
+		FilePath string `json:"file_path"`
+	}
+	if err := t.call(ctx, "getFile", url.Values{"file_id": {fileID}}, &f); err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", telegramAPI+"/file/bot"+t.token+"/"+f.FilePath, nil)
+	if err != nil {
+		return nil, err
+	}
+	return download(req)
+}
+
+// call invokes a Bot API method with GET parameters.
+func (t *Telegram) call(ctx context.Context, method string, params url.Values, result any) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", t.methodURL(method)+"?"+params.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	return t.send(req, method, result)
+}
+
+// post invokes a Bot API method with a JSON body.
+func (t *Telegram) post(ctx context.Context, method string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", t.methodURL(method), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return t.send(req, method, nil)
+}
+
+func (t *Telegram) methodURL(method string) string {
+	return telegramAPI + "/bot" + t.token + "/" + method
+}
+
+// send performs a request. Errors mention the method rather than the URL,
+// which contains the token.
+func (t *Telegram) send(req *http.Request, method string, result any) error {
+	resp, err := pollClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", method, stripURL(err))
+	}
+	defer resp.Body.Close()
+	var r telegramResponse
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return fmt.Errorf("%s: HTTP %d", method, resp.StatusCode)
+	}
+	if !r.OK {
+		return fmt.Errorf("%s: %s", method, r.Description)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(r.Result, result)
+}
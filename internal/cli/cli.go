@@ -0,0 +1,431 @@
+// Package cli describes command-line programs as a tree of commands built
+// on the standard flag package, so that usage, shell completions and man
+// pages are generated from the same definitions.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Command is a program or one of its subcommands.
+type Command struct {
+	Name  string
+	Short string
+	// Args describes the positional arguments in usage, e.g. "<id>".
+	Args string
+	// Long is an optional description for the man page.
+	Long string
+	// Flags are parsed before Run; they may appear before or after the
+	// positional arguments. Nil means no flags.
+	Flags *flag.FlagSet
+	// Run executes the command with the positional arguments. Commands
+	// without Run only group subcommands.
+	Run      func(args []string)
+	Commands []*Command
+	// Complete returns dynamic completion values for a flag, by flag name.
+	// It's called after the flags already on the command line are parsed.
+	Complete map[string]func() []string
+	// Hidden commands are left out of usage, completions and man pages.
+	Hidden bool
+	// EnvPrefix, when set, lets each of the command's flags be set with an
+	// environment variable too, named by the prefix and the flag in upper
+	// case, e.g. APP_MAX_UPLOAD for -max-upload. The command line takes
+	// precedence. Flag values that may be repeated, which have an
+	// IsRepeatable method returning true, take several values separated by
+	// spaces.
+	EnvPrefix string
+	// ConfigFlag, when set, names a string flag with the path of a config
+	// file setting the other flags (see loadConfig). The environment and
+	// the command line take precedence over it. Flag values with a Reset
+	// method, such as repeatable flags, are reset the first time a source
+	// sets them, so the environment or the command line replace the config
+	// file's values instead of adding to them.
+	ConfigFlag string
+
+	parent *Command
+	// args and configFile are those of the last parse, for Reparse.
+	args       []string
+	configFile string
+}
+
+// Execute runs the command selected by args. When that is the root command
+// and it has no Run, Execute only parses its flags and returns the
+// positional arguments, so the program's main can carry on.
+func (c *Command) Execute(args []string) []string {
+	c.link()
+	cmd, args := c.find(args)
+	if cmd == c && cmd.Run == nil {
+		return cmd.parse(args)
+	}
+	if cmd.Run == nil {
+		if len(args) > 0 {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n", strings.Join(append([]string{cmd.path()}, args[0]), " "))
+		}
+		cmd.Usage(os.Stderr)
+		os.Exit(2)
+	}
+	cmd.Run(cmd.parse(args))
+	os.Exit(0)
+	return nil
+}
+
+func (c *Command) link() {
+	for _, sub := range c.Commands {
+		sub.parent = c
+		sub.link()
+	}
+}
+
+// find returns the subcommand named by the leading args and the rest.
+func (c *Command) find(args []string) (*Command, []string) {
+	if len(args) > 0 {
+		if sub := c.sub(args[0]); sub != nil {
+			return sub.find(args[1:])
+		}
+	}
+	return c, args
+}
+
+func (c *Command) sub(name string) *Command {
+	for _, sub := range c.Commands {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// parse parses flags interspersed with positional arguments and returns
+// the positional arguments.
+func (c *Command) parse(args []string) []string {
+	if c.Flags == nil {
+		return args
+	}
+	c.Flags.Usage = func() { c.Usage(c.Flags.Output()) }
+	c.args = args
+	if c.ConfigFlag != "" {
+		c.parseConfig(args)
+	}
+	if c.EnvPrefix != "" {
+		var err error
+		resetting(c.Flags, func() { err = c.setEnv(c.Flags) })
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	var rest []string
+	resetting(c.Flags, func() {
+		for {
+			c.Flags.Parse(args)
+			args = c.Flags.Args()
+			if len(args) == 0 {
+				return
+			}
+			rest = append(rest, args[0])
+			args = args[1:]
+		}
+	})
+	return rest
+}
+
+// Reparse sets the flags of fs from the config file, the environment and
+// the command line of the last parse again, for programs that reload part
+// of their configuration while running. fs holds some of the command's
+// flags, defined anew so they start from their defaults; the other flags
+// are left out.
+func (c *Command) Reparse(fs *flag.FlagSet) error {
+	if c.configFile != "" {
+		if err := c.loadConfig(fs, c.configFile); err != nil {
+			return err
+		}
+	}
+	var err error
+	if c.EnvPrefix != "" {
+		resetting(fs, func() { err = c.setEnv(fs) })
+		if err != nil {
+			return err
+		}
+	}
+	resetting(fs, func() { err = fs.Parse(reparseArgs(c.Flags, fs, c.args)) })
+	return err
+}
+
+// reparseArgs returns the flags of fs, and their values, in args, which
+// are parsed with all of the command's flags.
+func reparseArgs(all, fs *flag.FlagSet, args []string) []string {
+	var out []string
+	for i := 0; i < len(args) && args[i] != "--"; i++ {
+		f := lookupFlag(all, args[i])
+		if f == nil {
+			continue
+		}
+		n := 1
+		if !isBoolFlag(f) && !strings.Contains(args[i], "=") && i+1 < len(args) {
+			n = 2
+		}
+		if fs.Lookup(f.Name) != nil {
+			out = append(out, args[i:i+n]...)
+		}
+		i += n - 1
+	}
+	return out
+}
+
+// setEnv sets the flags of fs that have an environment variable set.
+func (c *Command) setEnv(fs *flag.FlagSet) error {
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		v, ok := os.LookupEnv(c.EnvVar(f.Name))
+		if !ok || err != nil {
+			return
+		}
+		values := []string{v}
+		if isRepeatable(f) {
+			values = strings.Fields(v)
+		}
+		for _, v := range values {
+			if e := fs.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("invalid value %q for $%s: %v", v, c.EnvVar(f.Name), e)
+				return
+			}
+		}
+	})
+	return err
+}
+
+// resetting runs fn, a source of flag values, with the flags of fs that
+// have a Reset method reset before fn first sets them.
+func resetting(fs *flag.FlagSet, fn func()) {
+	var wrapped []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) {
+		if _, ok := f.Value.(interface{ Reset() }); ok {
+			f.Value = &resetOnSet{Value: f.Value}
+			wrapped = append(wrapped, f)
+		}
+	})
+	defer func() {
+		for _, f := range wrapped {
+			f.Value = f.Value.(*resetOnSet).Value
+		}
+	}()
+	fn()
+}
+
+// resetOnSet resets a flag value before it's first set.
+type resetOnSet struct {
+	flag.Value
+	set bool
+}
+
+func (r *resetOnSet) Set(v string) error {
+	if !r.set {
+		r.Value.(interface{ Reset() }).Reset()
+		r.set = true
+	}
+	return r.Value.Set(v)
+}
+
+func (r *resetOnSet) IsBoolFlag() bool {
+	b, ok := r.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func (r *resetOnSet) IsRepeatable() bool {
+	rp, ok := r.Value.(interface{ IsRepeatable() bool })
+	return ok && rp.IsRepeatable()
+}
+
+// EnvVar returns the environment variable for a flag of the command (see
+// EnvPrefix).
+func (c *Command) EnvVar(flagName string) string {
+	return c.EnvPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// path returns the full command name, e.g. "lunartlk-client history show".
+func (c *Command) path() string {
+	if c.parent == nil {
+		return c.Name
+	}
+	return c.parent.path() + " " + c.Name
+}
+
+func (c *Command) root() *Command {
+	if c.parent == nil {
+		return c
+	}
+	return c.parent.root()
+}
+
+func (c *Command) visible() []*Command {
+	var cmds []*Command
+	for _, sub := range c.Commands {
+		if !sub.Hidden {
+			cmds = append(cmds, sub)
+		}
+	}
+	return cmds
+}
+
+// Usage writes the command's help.
+func (c *Command) Usage(w io.Writer) {
+	usage := "Usage: " + c.path()
+	switch {
+	case len(c.visible()) == 0:
+	case c.Run != nil || c.parent == nil:
+		// The command also works on its own
+		usage += " [command]"
+	default:
+		usage += " <command>"
+	}
+	if c.Flags != nil && hasFlags(c.Flags) {
+		usage += " [flags]"
+	}
+	if c.Args != "" {
+		usage += " " + c.Args
+	}
+	fmt.Fprintln(w, usage)
+	if c.Short != "" {
+		fmt.Fprintf(w, "\n%s\n", c.Short)
+	}
+
+	if cmds := c.visible(); len(cmds) > 0 {
+		fmt.Fprintln(w, "\nCommands:")
+		for _, sub := range cmds {
+			fmt.Fprintf(w, "  %-22s %s\n", strings.TrimSpace(sub.Name+" "+sub.Args), sub.Short)
+		}
+	}
+	if c.Flags != nil && hasFlags(c.Flags) {
+		fmt.Fprintln(w, "\nFlags:")
+		c.Flags.SetOutput(w)
+		c.Flags.PrintDefaults()
+		if c.EnvPrefix != "" {
+			var example string
+			c.Flags.VisitAll(func(f *flag.Flag) {
+				if example == "" {
+					example = f.Name
+				}
+			})
+			fmt.Fprintf(w, "\nEach flag can also be set with an environment variable, e.g. $%s for -%s.\n",
+				c.EnvVar(example), example)
+		}
+	}
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	n := 0
+	fs.VisitAll(func(*flag.Flag) { n++ })
+	return n > 0
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+func isRepeatable(f *flag.Flag) bool {
+	r, ok := f.Value.(interface{ IsRepeatable() bool })
+	return ok && r.IsRepeatable()
+}
+
+// CompleteCommand returns the hidden command the completion scripts call
+// to get candidates. Add it to the root command.
+func CompleteCommand() *Command {
+	c := &Command{Name: "__complete", Hidden: true}
+	c.Run = func(args []string) {
+		for _, s := range c.root().complete(args) {
+			fmt.Println(s)
+		}
+	}
+	return c
+}
+
+// complete returns the candidates for the last of words, which are the
+// command line after the program name.
+func (c *Command) complete(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur, words := words[len(words)-1], words[:len(words)-1]
+
+	// Walk down the subcommands; flags can't come before them
+	cmd := c
+	for len(words) > 0 {
+		next := cmd.sub(words[0])
+		if next == nil {
+			break
+		}
+		cmd, words = next, words[1:]
+	}
+
+	var candidates []string
+	if cmd.Flags != nil {
+		// Load the flags already typed, e.g. -server for dynamic values
+		cmd.Flags.Init(cmd.Name, flag.ContinueOnError)
+		cmd.Flags.SetOutput(io.Discard)
+		cmd.Flags.Parse(flagWords(cmd.Flags, words))
+
+		if n := len(words); n > 0 {
+			if f := lookupFlag(cmd.Flags, words[n-1]); f != nil && !isBoolFlag(f) {
+				if fn := cmd.Complete[f.Name]; fn != nil {
+					return filter(fn(), cur)
+				}
+				return nil
+			}
+		}
+		if strings.HasPrefix(cur, "-") {
+			cmd.Flags.VisitAll(func(f *flag.Flag) {
+				candidates = append(candidates, "-"+f.Name)
+			})
+			return filter(candidates, cur)
+		}
+	}
+	if len(words) == 0 {
+		for _, sub := range cmd.visible() {
+			candidates = append(candidates, sub.Name)
+		}
+	}
+	return filter(candidates, cur)
+}
+
+// flagWords returns the words that are flags or flag values.
+func flagWords(fs *flag.FlagSet, words []string) []string {
+	var out []string
+	for i := 0; i < len(words); i++ {
+		f := lookupFlag(fs, words[i])
+		if f == nil {
+			continue
+		}
+		out = append(out, words[i])
+		if !isBoolFlag(f) && !strings.Contains(words[i], "=") && i+1 < len(words) {
+			i++
+			out = append(out, words[i])
+		}
+	}
+	return out
+}
+
+func lookupFlag(fs *flag.FlagSet, word string) *flag.Flag {
+	if !strings.HasPrefix(word, "-") {
+		return nil
+	}
+	name := strings.TrimLeft(word, "-")
+	name, _, _ = strings.Cut(name, "=")
+	return fs.Lookup(name)
+}
+
+func filter(candidates []string, prefix string) []string {
+	var out []string
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) {
+			out = append(out, c)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// list is a repeatable flag value, like the programs' string lists.
+type list []string
+
+func (l *list) String() string     { return strings.Join(*l, ",") }
+func (l *list) Set(v string) error { *l = append(*l, v); return nil }
+func (l *list) IsRepeatable() bool { return true }
+func (l *list) Reset()             { *l = nil }
+
+func testCommand(t *testing.T, config string) (*Command, *list, *string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TEST_CONFIG", path)
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	var hooks list
+	fs.Var(&hooks, "hook", "")
+	lang := fs.String("lang", "es", "")
+	fs.String("config", "", "")
+	fs.Bool("debug", false, "")
+	return &Command{Name: "test", Flags: fs, EnvPrefix: "TEST_", ConfigFlag: "config"}, &hooks, lang
+}
+
+func TestSources(t *testing.T) {
+	tests := []struct {
+		name string
+		env  string
+		args []string
+		want []string
+	}{
+		{"config", "", nil, []string{"a", "b"}},
+		{"environment", "c d", nil, []string{"c", "d"}},
+		{"command line", "c", []string{"-hook", "e", "-debug", "-hook=f"}, []string{"e", "f"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, hooks, _ := testCommand(t, `hook = ["a", "b"]`)
+			if tt.env != "" {
+				t.Setenv("TEST_HOOK", tt.env)
+			}
+			c.parse(tt.args)
+			if !slices.Equal(*hooks, tt.want) {
+				t.Errorf("hooks %q, want %q", *hooks, tt.want)
+			}
+		})
+	}
+}
+
+func TestReparse(t *testing.T) {
+	c, _, lang := testCommand(t, "hook = [\"a\"]\nlang = \"en\"\n")
+	if rest := c.parse([]string{"file", "-debug", "-lang", "fr", "-hook", "b"}); !slices.Equal(rest, []string{"file"}) {
+		t.Fatalf("arguments %q", rest)
+	}
+	if *lang != "fr" {
+		t.Fatalf("lang %q, want fr", *lang)
+	}
+
+	os.WriteFile(c.configFile, []byte(`hook = ["c"]`), 0644)
+	fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+	var hooks list
+	fs.Var(&hooks, "hook", "")
+	if err := c.Reparse(fs); err != nil {
+		t.Fatal(err)
+	}
+	// The command line still overrides the edited config file
+	if !slices.Equal(hooks, list{"b"}) {
+		t.Errorf("hooks %q, want [b]", hooks)
+	}
+
+	os.WriteFile(c.configFile, []byte(`bogus = 1`), 0644)
+	if err := c.Reparse(fs); err == nil {
+		t.Error("an unknown option was accepted")
+	}
+}
@@ -0,0 +1,272 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// parseConfig sets the flags found in the config file named by the
+// ConfigFlag flag on the command line, or its environment variable.
+func (c *Command) parseConfig(args []string) {
+	path := configPath(c.Flags, c.ConfigFlag, args)
+	if path == "" && c.EnvPrefix != "" {
+		path = os.Getenv(c.EnvVar(c.ConfigFlag))
+	}
+	if path == "" {
+		return
+	}
+	c.configFile = path
+	if err := c.loadConfig(c.Flags, path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+}
+
+// configPath returns the value of the flag named name in args, before the
+// flags are parsed.
+func configPath(fs *flag.FlagSet, name string, args []string) string {
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			break
+		}
+		f := lookupFlag(fs, args[i])
+		if f == nil {
+			continue
+		}
+		if f.Name != name {
+			if !isBoolFlag(f) && !strings.Contains(args[i], "=") {
+				i++
+			}
+			continue
+		}
+		if _, v, ok := strings.Cut(args[i], "="); ok {
+			return v
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// loadConfig sets the flags of fs from a config file: TOML key = value
+// pairs named after the flags. Repeatable flags take arrays. Keys naming
+// the command's flags that fs doesn't have are skipped.
+func (c *Command) loadConfig(fs *flag.FlagSet, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries, err := parseTOML(bufio.NewScanner(f))
+	if err != nil {
+		return fmt.Errorf("%s:%w", path, err)
+	}
+	for _, e := range entries {
+		fl := c.Flags.Lookup(e.key)
+		if fl == nil || fl.Name == c.ConfigFlag {
+			return fmt.Errorf("%s:%d: unknown option %q", path, e.line, e.key)
+		}
+		if e.array && !isRepeatable(fl) {
+			return fmt.Errorf("%s:%d: %s takes a single value", path, e.line, e.key)
+		}
+		if fs.Lookup(fl.Name) == nil {
+			continue
+		}
+		for _, v := range e.values {
+			if err := fs.Set(fl.Name, v); err != nil {
+				return fmt.Errorf("%s:%d: invalid value %q for %s: %v", path, e.line, v, e.key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// configEntry is a key = value line of a config file.
+type configEntry struct {
+	key    string
+	values []string
+	array  bool
+	line   int
+}
+
+// parseTOML reads the subset of TOML config files need: comments and
+// key = value pairs of strings, numbers, booleans and arrays of them.
+// Tables aren't supported. Errors start with the line number.
+func parseTOML(sc *bufio.Scanner) ([]configEntry, error) {
+	var entries []configEntry
+	seen := make(map[string]bool)
+	n := 0
+	for sc.Scan() {
+		n++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			return nil, fmt.Errorf("%d: tables aren't supported, set the options at the top level", n)
+		}
+		key, rest, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%d: expected key = value", n)
+		}
+		key = strings.TrimSpace(key)
+		if uq, err := strconv.Unquote(key); err == nil {
+			key = uq
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("%d: %s is set twice", n, key)
+		}
+		seen[key] = true
+
+		e := configEntry{key: key, line: n}
+		rest = strings.TrimSpace(rest)
+		if strings.HasPrefix(rest, "[") {
+			// Arrays may span several lines
+			for !arrayClosed(rest) && sc.Scan() {
+				n++
+				rest += "\n" + sc.Text()
+			}
+			e.array = true
+			vals, err := parseArray(rest)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", e.line, err)
+			}
+			e.values = vals
+		} else {
+			v, tail, err := parseValue(rest)
+			if err != nil {
+				return nil, fmt.Errorf("%d: %v", n, err)
+			}
+			if err := checkTail(tail); err != nil {
+				return nil, fmt.Errorf("%d: %v", n, err)
+			}
+			e.values = []string{v}
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%d: %v", n, err)
+	}
+	return entries, nil
+}
+
+// arrayClosed reports whether s has the closing bracket of an array,
+// outside strings and comments.
+func arrayClosed(s string) bool {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' && quote == '"' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '#':
+			// Skip the rest of the line
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case ch == ']':
+			return true
+		}
+	}
+	return false
+}
+
+func parseArray(s string) ([]string, error) {
+	s = strings.TrimSpace(s[1:])
+	var vals []string
+	for {
+		s = skipSpace(s)
+		if strings.HasPrefix(s, "]") {
+			return vals, checkTail(s[1:])
+		}
+		v, rest, err := parseValue(s)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+		s = skipSpace(rest)
+		switch {
+		case strings.HasPrefix(s, ","):
+			s = s[1:]
+		case strings.HasPrefix(s, "]"):
+		default:
+			return nil, fmt.Errorf("expected , or ] in array")
+		}
+	}
+}
+
+// parseValue returns the string, number or boolean at the start of s, and
+// what follows it.
+func parseValue(s string) (string, string, error) {
+	switch {
+	case s == "":
+		return "", "", fmt.Errorf("missing value")
+	case s[0] == '"':
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				v, err := strconv.Unquote(s[:i+1])
+				if err != nil {
+					return "", "", fmt.Errorf("invalid string %s", s[:i+1])
+				}
+				return v, s[i+1:], nil
+			}
+		}
+		return "", "", fmt.Errorf("unterminated string")
+	case s[0] == '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	}
+	end := strings.IndexAny(s, " \t\n,]#")
+	if end < 0 {
+		end = len(s)
+	}
+	v := s[:end]
+	if v != "true" && v != "false" {
+		if _, err := strconv.ParseFloat(strings.ReplaceAll(v, "_", ""), 64); err != nil {
+			return "", "", fmt.Errorf("invalid value %q, quote strings", v)
+		}
+		v = strings.ReplaceAll(v, "_", "")
+	}
+	return v, s[end:], nil
+}
+
+// skipSpace skips blanks, newlines and comments.
+func skipSpace(s string) string {
+	for {
+		s = strings.TrimLeft(s, " \t\r\n")
+		if !strings.HasPrefix(s, "#") {
+			return s
+		}
+		if i := strings.IndexByte(s, '\n'); i >= 0 {
+			s = s[i:]
+		} else {
+			return ""
+		}
+	}
+}
+
+// checkTail returns an error unless s is blank or a comment.
+func checkTail(s string) error {
+	if s = strings.TrimSpace(s); s != "" && s[0] != '#' {
+		return fmt.Errorf("unexpected %q after the value", s)
+	}
+	return nil
+}
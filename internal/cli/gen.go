@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// CompletionCommand returns a "completion <shell>" command that prints the
+// completion script for bash, zsh or fish.
+func CompletionCommand() *Command {
+	c := &Command{
+		Name:  "completion",
+		Short: "print the shell completion script (bash, zsh, fish)",
+		Args:  "<shell>",
+	}
+	c.Run = func(args []string) {
+		if len(args) != 1 {
+			c.Usage(os.Stderr)
+			os.Exit(2)
+		}
+		if err := c.root().WriteCompletion(os.Stdout, args[0]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	return c
+}
+
+// ManCommand returns a "man" command that prints the man page.
+func ManCommand(section int, version string) *Command {
+	c := &Command{Name: "man", Short: "print the man page (roff)"}
+	c.Run = func([]string) {
+		c.root().WriteMan(os.Stdout, section, version)
+	}
+	return c
+}
+
+// WriteCompletion writes the completion script for shell. The scripts ask
+// the program itself for candidates through the __complete command.
+func (c *Command) WriteCompletion(w io.Writer, shell string) error {
+	prog := c.Name
+	fn := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(prog)
+	switch shell {
+	case "bash":
+		fmt.Fprintf(w, `# bash completion for %[1]s
+%[2]s() {
+    local IFS=$'\n'
+    COMPREPLY=($(%[1]s __complete "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F %[2]s %[1]s
+`, prog, fn)
+	case "zsh":
+		fmt.Fprintf(w, `#compdef %[1]s
+%[2]s() {
+    local -a candidates
+    candidates=("${(@f)$(%[1]s __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    if [[ -n ${candidates[1]} ]]; then
+        compadd -a candidates
+    else
+        _files
+    fi
+}
+compdef %[2]s %[1]s
+`, prog, fn)
+	case "fish":
+		fmt.Fprintf(w, `# fish completion for %[1]s
+function %[2]s
+    set -l args (commandline -opc) (commandline -ct)
+    %[1]s __complete $args[2..-1] 2>/dev/null
+end
+complete -c %[1]s -a '(%[2]s)'
+`, prog, fn)
+	default:
+		return fmt.Errorf("unsupported shell %q (use bash, zsh or fish)", shell)
+	}
+	return nil
+}
+
+// WriteMan writes a man page covering the command and its subcommands.
+func (c *Command) WriteMan(w io.Writer, section int, version string) {
+	fmt.Fprintf(w, ".TH %s %d %q %q \"User Commands\"\n",
+		strings.ToUpper(roff(c.Name)), section, time.Now().Format("2006-01-02"), c.Name+" "+version)
+	fmt.Fprintf(w, ".SH NAME\n%s \\- %s\n", roff(c.Name), roff(c.Short))
+
+	fmt.Fprintln(w, ".SH SYNOPSIS")
+	fmt.Fprintf(w, ".B %s\n[flags]\n", roff(c.Name))
+	if len(c.visible()) > 0 {
+		fmt.Fprintf(w, ".br\n.B %s\n.I command\n[flags] [args]\n", roff(c.Name))
+	}
+
+	if c.Long != "" {
+		fmt.Fprintf(w, ".SH DESCRIPTION\n%s\n", roff(c.Long))
+	}
+	if c.Flags != nil && hasFlags(c.Flags) {
+		fmt.Fprintln(w, ".SH OPTIONS")
+		writeManFlags(w, c.Flags)
+	}
+	if c.EnvPrefix != "" && c.Flags != nil {
+		fmt.Fprintln(w, ".SH ENVIRONMENT")
+		fmt.Fprintf(w, "Each option can also be set with an environment variable named %s and the option in upper case, with dashes as underscores. Options on the command line take precedence.\n", roff(c.EnvPrefix))
+	}
+	if c.ConfigFlag != "" && c.Flags != nil {
+		fmt.Fprintln(w, ".SH FILES")
+		fmt.Fprintf(w, "Options can also be read from a TOML file given with \\-%s, as key = value lines named after the options. Environment variables and the command line take precedence.\n", roff(c.ConfigFlag))
+	}
+
+	var subs []*Command
+	var collect func(*Command)
+	collect = func(cmd *Command) {
+		for _, sub := range cmd.visible() {
+			subs = append(subs, sub)
+			collect(sub)
+		}
+	}
+	collect(c)
+	if len(subs) > 0 {
+		fmt.Fprintln(w, ".SH COMMANDS")
+		for _, sub := range subs {
+			name := strings.TrimPrefix(sub.path(), c.Name+" ")
+			fmt.Fprintf(w, ".SS %s\n", roff(strings.TrimSpace(name+" "+sub.Args)))
+			if sub.Short != "" {
+				fmt.Fprintf(w, "%s\n", roff(sub.Short))
+			}
+			if sub.Long != "" {
+				fmt.Fprintf(w, ".PP\n%s\n", roff(sub.Long))
+			}
+			if sub.Flags != nil && hasFlags(sub.Flags) {
+				writeManFlags(w, sub.Flags)
+			}
+		}
+	}
+}
+
+func writeManFlags(w io.Writer, fs *flag.FlagSet) {
+	fs.VisitAll(func(f *flag.Flag) {
+		name, usage := flag.UnquoteUsage(f)
+		if name != "" {
+			fmt.Fprintf(w, ".TP\n.BI \"\\-%s \" %s\n", roff(f.Name), roff(name))
+		} else {
+			fmt.Fprintf(w, ".TP\n.B \\-%s\n", roff(f.Name))
+		}
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" && f.DefValue != "0s" {
+			usage += fmt.Sprintf(" (default %s)", f.DefValue)
+		}
+		fmt.Fprintln(w, roff(usage))
+	})
+}
+
+// roff escapes text for a man page.
+func roff(s string) string {
+	s = strings.NewReplacer(`\`, `\e`, "-", `\-`).Replace(s)
+	lines := strings.Split(s, "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, ".") || strings.HasPrefix(l, "'") {
+			lines[i] = `\&` + l
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,302 @@
+package dictation
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// symbol is a character sequence spoken by name in code mode, with
+// whether it takes a space before and after it.
+type symbol struct {
+	text          string
+	before, after bool
+	// toggle symbols, like quotes, open when they're said the first time
+	// and close the second.
+	toggle bool
+}
+
+// identCase is a way of joining the words of an identifier.
+type identCase int
+
+const (
+	snakeCase identCase = iota + 1
+	camelCase
+	pascalCase
+	kebabCase
+	constantCase
+)
+
+var (
+	glued   = symbol{}
+	opening = symbol{before: true}
+	closing = symbol{after: true}
+	spaced  = symbol{before: true, after: true}
+)
+
+func sym(s symbol, text string) symbol {
+	s.text = text
+	return s
+}
+
+func quote(text string) symbol {
+	return symbol{text: text, toggle: true}
+}
+
+var caseCommands = map[string]identCase{
+	"snake case":    snakeCase,
+	"camel case":    camelCase,
+	"pascal case":   pascalCase,
+	"kebab case":    kebabCase,
+	"constant case": constantCase,
+}
+
+var codeGrammars = map[string]*CodeGrammar{
+	"en": newCodeGrammar(map[string]symbol{
+		"open paren":       sym(glued, "("),
+		"close paren":      sym(closing, ")"),
+		"open bracket":     sym(glued, "["),
+		"close bracket":    sym(closing, "]"),
+		"open brace":       sym(spaced, "{"),
+		"close brace":      sym(spaced, "}"),
+		"dot":              sym(glued, "."),
+		"comma":            sym(closing, ","),
+		"colon":            sym(closing, ":"),
+		"semicolon":        sym(closing, ";"),
+		"double colon":     sym(glued, "::"),
+		"question mark":    sym(closing, "?"),
+		"equals":           sym(spaced, "="),
+		"double equals":    sym(spaced, "=="),
+		"not equals":       sym(spaced, "!="),
+		"colon equals":     sym(spaced, ":="),
+		"plus equals":      sym(spaced, "+="),
+		"minus equals":     sym(spaced, "-="),
+		"plus plus":        sym(closing, "++"),
+		"minus minus":      sym(closing, "--"),
+		"plus":             sym(spaced, "+"),
+		"minus":            sym(spaced, "-"),
+		"times":            sym(spaced, "*"),
+		"divided by":       sym(spaced, "/"),
+		"modulo":           sym(spaced, "%"),
+		"less than":        sym(spaced, "<"),
+		"greater than":     sym(spaced, ">"),
+		"less or equal":    sym(spaced, "<="),
+		"greater or equal": sym(spaced, ">="),
+		"and and":          sym(spaced, "&&"),
+		"or or":            sym(spaced, "||"),
+		"arrow":            sym(spaced, "->"),
+		"fat arrow":        sym(spaced, "=>"),
+		"pipe":             sym(spaced, "|"),
+		"bang":             sym(opening, "!"),
+		"star":             sym(opening, "*"),
+		"ampersand":        sym(opening, "&"),
+		"at sign":          sym(opening, "@"),
+		"hash":             sym(opening, "#"),
+		"dollar":           sym(opening, "$"),
+		"tilde":            sym(opening, "~"),
+		"underscore":       sym(glued, "_"),
+		"dash":             sym(glued, "-"),
+		"slash":            sym(glued, "/"),
+		"backslash":        sym(glued, `\`),
+		"quote":            quote(`"`),
+		"single quote":     quote("'"),
+		"backtick":         quote("`"),
+		"new line":         sym(glued, "\n"),
+		"tab":              sym(glued, "\t"),
+		"space":            sym(glued, " "),
+	}),
+	"es": newCodeGrammar(map[string]symbol{
+		"abrir parentesis":  sym(glued, "("),
+		"cerrar parentesis": sym(closing, ")"),
+		"abrir corchete":    sym(glued, "["),
+		"cerrar corchete":   sym(closing, "]"),
+		"abrir llave":       sym(spaced, "{"),
+		"cerrar llave":      sym(spaced, "}"),
+		"punto":             sym(glued, "."),
+		"coma":              sym(closing, ","),
+		"dos puntos":        sym(closing, ":"),
+		"punto y coma":      sym(closing, ";"),
+		"doble dos puntos":  sym(glued, "::"),
+		"interrogacion":     sym(closing, "?"),
+		"igual":             sym(spaced, "="),
+		"doble igual":       sym(spaced, "=="),
+		"distinto de":       sym(spaced, "!="),
+		"dos puntos igual":  sym(spaced, ":="),
+		"mas igual":         sym(spaced, "+="),
+		"menos igual":       sym(spaced, "-="),
+		"mas mas":           sym(closing, "++"),
+		"menos menos":       sym(closing, "--"),
+		"mas":               sym(spaced, "+"),
+		"menos":             sym(spaced, "-"),
+		"multiplicado por":  sym(spaced, "*"),
+		"dividido entre":    sym(spaced, "/"),
+		"modulo":            sym(spaced, "%"),
+		"menor que":         sym(spaced, "<"),
+		"mayor que":         sym(spaced, ">"),
+		"menor o igual":     sym(spaced, "<="),
+		"mayor o igual":     sym(spaced, ">="),
+		"doble ampersand":   sym(spaced, "&&"),
+		"doble barra":       sym(spaced, "||"),
+		"flecha":            sym(spaced, "->"),
+		"flecha doble":      sym(spaced, "=>"),
+		"barra vertical":    sym(spaced, "|"),
+		"exclamacion":       sym(opening, "!"),
+		"asterisco":         sym(opening, "*"),
+		"ampersand":         sym(opening, "&"),
+		"arroba":            sym(opening, "@"),
+		"almohadilla":       sym(opening, "#"),
+		"dolar":             sym(opening, "$"),
+		"virgulilla":        sym(opening, "~"),
+		"guion bajo":        sym(glued, "_"),
+		"guion":             sym(glued, "-"),
+		"barra":             sym(glued, "/"),
+		"barra invertida":   sym(glued, `\`),
+		"comillas":          quote(`"`),
+		"comilla simple":    quote("'"),
+		"acento grave":      quote("`"),
+		"nueva linea":       sym(glued, "\n"),
+		"tabulador":         sym(glued, "\t"),
+		"espacio":           sym(glued, " "),
+	}),
+}
+
+// CodeGrammar holds the spoken symbols of code mode in one language.
+type CodeGrammar struct {
+	symbols []codeCommand
+}
+
+type codeCommand struct {
+	words []string
+	sym   symbol
+	ident identCase
+}
+
+func newCodeGrammar(symbols map[string]symbol) *CodeGrammar {
+	g := &CodeGrammar{}
+	for phrase, s := range symbols {
+		g.symbols = append(g.symbols, codeCommand{words: strings.Fields(phrase), sym: s})
+	}
+	// Programmers use the English names of the cases in every language
+	for phrase, c := range caseCommands {
+		g.symbols = append(g.symbols, codeCommand{words: strings.Fields(phrase), ident: c})
+	}
+	return g
+}
+
+type codeToken struct {
+	text          string
+	before, after bool
+}
+
+// Apply turns dictated code into source text: spoken symbols ("open
+// paren", "equals") become characters, "snake case user name" and the
+// other case commands join the words up to the next command or pause
+// into an identifier, and the rest of the words are lowercased. The
+// punctuation the engine adds is dropped.
+func (g *CodeGrammar) Apply(text string) string {
+	words := strings.Fields(text)
+	norm := make([]string, len(words))
+	for i, w := range words {
+		norm[i] = normalize(w)
+	}
+	word := func(i int) string {
+		return strings.ToLower(strings.Trim(words[i], punct))
+	}
+
+	var out []codeToken
+	inQuote := map[string]bool{}
+	for i := 0; i < len(words); {
+		c, n := g.match(norm[i:])
+		switch {
+		case n == 0:
+			if w := word(i); w != "" {
+				out = append(out, codeToken{text: w, before: true, after: true})
+			}
+			i++
+		case c.ident != 0:
+			i += n
+			var parts []string
+			for i < len(words) {
+				if _, m := g.match(norm[i:]); m > 0 {
+					break
+				}
+				if w := word(i); w != "" {
+					parts = append(parts, w)
+				}
+				i++
+				if pauses(words[i-1]) {
+					break
+				}
+			}
+			if len(parts) > 0 {
+				out = append(out, codeToken{text: joinIdent(parts, c.ident), before: true, after: true})
+			}
+		default:
+			i += n
+			s := c.sym
+			if s.toggle {
+				s.before, s.after = !inQuote[s.text], inQuote[s.text]
+				inQuote[s.text] = !inQuote[s.text]
+			}
+			out = append(out, codeToken{text: s.text, before: s.before, after: s.after})
+		}
+	}
+
+	var b strings.Builder
+	for i, t := range out {
+		if i > 0 && out[i-1].after && t.before {
+			b.WriteByte(' ')
+		}
+		b.WriteString(t.text)
+	}
+	return b.String()
+}
+
+// match returns the longest command at the start of words and how many
+// words it spans.
+func (g *CodeGrammar) match(words []string) (codeCommand, int) {
+	var best codeCommand
+	for _, c := range g.symbols {
+		if len(c.words) <= len(best.words) || len(c.words) > len(words) {
+			continue
+		}
+		ok := true
+		for i, w := range c.words {
+			if words[i] != w {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			best = c
+		}
+	}
+	return best, len(best.words)
+}
+
+// pauses reports whether the engine ended a word with punctuation, which
+// ends the identifier a case command is building.
+func pauses(w string) bool {
+	r, _ := utf8.DecodeLastRuneInString(w)
+	return strings.ContainsRune(".,;:!?", r)
+}
+
+func joinIdent(words []string, c identCase) string {
+	switch c {
+	case snakeCase:
+		return strings.Join(words, "_")
+	case kebabCase:
+		return strings.Join(words, "-")
+	case constantCase:
+		return strings.ToUpper(strings.Join(words, "_"))
+	}
+	var b strings.Builder
+	for i, w := range words {
+		if i > 0 || c == pascalCase {
+			r, size := utf8.DecodeRuneInString(w)
+			w = string(unicode.ToUpper(r)) + w[size:]
+		}
+		b.WriteString(w)
+	}
+	return b.String()
+}
@@ -0,0 +1,211 @@
+// Package dictation turns spoken formatting commands ("new line", "comma",
+// "open quote", "undo that", ...) in a transcript into the text edits they
+// stand for.
+package dictation
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type kind int
+
+const (
+	// attach is punctuation glued to the previous word ("comma").
+	attach kind = iota + 1
+	// open is glued to the next word ("open quote").
+	open
+	// newline breaks the line, with no spaces around it.
+	newline
+	// undo removes the last dictated phrase.
+	undo
+)
+
+type command struct {
+	words []string
+	kind  kind
+	text  string
+}
+
+// Grammar holds the spoken commands of one language.
+type Grammar struct {
+	commands []command
+}
+
+var grammars = map[string]*Grammar{
+	"en": newGrammar(map[string]command{
+		"new line":          {kind: newline, text: "\n"},
+		"new paragraph":     {kind: newline, text: "\n\n"},
+		"comma":             {kind: attach, text: ","},
+		"period":            {kind: attach, text: "."},
+		"full stop":         {kind: attach, text: "."},
+		"question mark":     {kind: attach, text: "?"},
+		"exclamation mark":  {kind: attach, text: "!"},
+		"exclamation point": {kind: attach, text: "!"},
+		"colon":             {kind: attach, text: ":"},
+		"semicolon":         {kind: attach, text: ";"},
+		"open quote":        {kind: open, text: "\""},
+		"close quote":       {kind: attach, text: "\""},
+		"open paren":        {kind: open, text: "("},
+		"close paren":       {kind: attach, text: ")"},
+		"undo that":         {kind: undo},
+	}),
+	"es": newGrammar(map[string]command{
+		"nueva linea":            {kind: newline, text: "\n"},
+		"punto y aparte":         {kind: attach, text: ".\n\n"},
+		"nuevo parrafo":          {kind: newline, text: "\n\n"},
+		"coma":                   {kind: attach, text: ","},
+		"punto":                  {kind: attach, text: "."},
+		"punto y seguido":        {kind: attach, text: "."},
+		"punto final":            {kind: attach, text: "."},
+		"signo de interrogacion": {kind: attach, text: "?"},
+		"cerrar interrogacion":   {kind: attach, text: "?"},
+		"abrir interrogacion":    {kind: open, text: "¿"},
+		"cerrar exclamacion":     {kind: attach, text: "!"},
+		"abrir exclamacion":      {kind: open, text: "¡"},
+		"dos puntos":             {kind: attach, text: ":"},
+		"punto y coma":           {kind: attach, text: ";"},
+		"abrir comillas":         {kind: open, text: "\""},
+		"cerrar comillas":        {kind: attach, text: "\""},
+		"abrir parentesis":       {kind: open, text: "("},
+		"cerrar parentesis":      {kind: attach, text: ")"},
+		"deshacer eso":           {kind: undo},
+	}),
+}
+
+func newGrammar(phrases map[string]command) *Grammar {
+	g := &Grammar{}
+	for phrase, c := range phrases {
+		c.words = strings.Fields(phrase)
+		g.commands = append(g.commands, c)
+	}
+	return g
+}
+
+// ForLang returns the grammar for a language code ("en", "es").
+func ForLang(lang string) (*Grammar, bool) {
+	g, ok := grammars[lang]
+	return g, ok
+}
+
+// Langs returns the languages with a grammar.
+func Langs() []string {
+	return []string{"en", "es"}
+}
+
+type token struct {
+	text string
+	kind kind // 0 for dictated words
+}
+
+// Apply replaces the spoken commands in text with their edits. Punctuation
+// the engine added around command words is dropped, and the word after a
+// sentence end or line break is capitalized.
+func (g *Grammar) Apply(text string) string {
+	words := strings.Fields(text)
+	norm := make([]string, len(words))
+	for i, w := range words {
+		norm[i] = normalize(w)
+	}
+
+	var out []token
+	// phrases holds the index in out where each dictated phrase starts, a
+	// phrase being the words between two commands.
+	var phrases []int
+	inPhrase := false
+	for i := 0; i < len(words); {
+		c, n := g.match(norm[i:])
+		if n == 0 {
+			if !inPhrase {
+				phrases = append(phrases, len(out))
+				inPhrase = true
+			}
+			out = append(out, token{text: words[i]})
+			i++
+			continue
+		}
+		i += n
+		inPhrase = false
+
+		switch c.kind {
+		case undo:
+			if len(phrases) > 0 {
+				out = out[:phrases[len(phrases)-1]]
+				phrases = phrases[:len(phrases)-1]
+			}
+		case attach, newline:
+			if len(out) > 0 && out[len(out)-1].kind == 0 {
+				out[len(out)-1].text = trimPunct(out[len(out)-1].text)
+			}
+			out = append(out, token{text: c.text, kind: c.kind})
+		case open:
+			out = append(out, token{text: c.text, kind: c.kind})
+		}
+	}
+	return render(out)
+}
+
+// match returns the longest command at the start of words and how many
+// words it spans.
+func (g *Grammar) match(words []string) (command, int) {
+	var best command
+	for _, c := range g.commands {
+		if len(c.words) <= len(best.words) || len(c.words) > len(words) {
+			continue
+		}
+		ok := true
+		for i, w := range c.words {
+			if words[i] != w {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			best = c
+		}
+	}
+	return best, len(best.words)
+}
+
+func render(tokens []token) string {
+	var b strings.Builder
+	capitalize := false
+	for i, t := range tokens {
+		text := t.text
+		if t.kind == 0 && capitalize {
+			r, size := utf8.DecodeRuneInString(text)
+			text = string(unicode.ToUpper(r)) + text[size:]
+		}
+		if i > 0 && t.kind != attach && t.kind != newline {
+			prev := tokens[i-1]
+			if prev.kind != open && prev.kind != newline && !strings.HasSuffix(prev.text, "\n") {
+				b.WriteByte(' ')
+			}
+		}
+		b.WriteString(text)
+
+		switch t.kind {
+		case 0, open:
+			capitalize = false
+		case attach, newline:
+			capitalize = strings.ContainsAny(text, ".?!\n")
+		}
+	}
+	return b.String()
+}
+
+const punct = ".,;:!?¿¡\"'()"
+
+func trimPunct(s string) string {
+	if t := strings.TrimRight(s, punct); t != "" {
+		return t
+	}
+	return s
+}
+
+var unaccent = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u")
+
+func normalize(w string) string {
+	return unaccent.Replace(strings.ToLower(strings.Trim(w, punct)))
+}
@@ -0,0 +1,139 @@
+package dictation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Macros expands spoken phrases ("insert signature") into text snippets.
+type Macros struct {
+	macros []*macro
+}
+
+type macro struct {
+	phrase string
+	re     *regexp.Regexp
+	tmpl   *template.Template
+}
+
+// macroFuncs are the functions macro templates can call.
+var macroFuncs = template.FuncMap{
+	// date formats the current time with a Go layout, e.g.
+	// {{date "2006-01-02"}}.
+	"date": func(layout string) string { return time.Now().Format(layout) },
+	"env":  os.Getenv,
+}
+
+// LoadMacros reads a JSON object mapping spoken phrases to the text they
+// expand to, which is a Go template. A missing file has no macros.
+func LoadMacros(path string) (*Macros, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Macros{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var defs map[string]string
+	if err := json.Unmarshal(data, &defs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	m := &Macros{}
+	for phrase, text := range defs {
+		mac, err := newMacro(phrase, text)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %q: %w", path, phrase, err)
+		}
+		m.macros = append(m.macros, mac)
+	}
+	// Longest first, so "insert work signature" isn't cut short by
+	// "insert work"
+	slices.SortFunc(m.macros, func(a, b *macro) int { return len(b.phrase) - len(a.phrase) })
+	return m, nil
+}
+
+func newMacro(phrase, text string) (*macro, error) {
+	words := strings.Fields(phrase)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("empty phrase")
+	}
+	for i, w := range words {
+		// Engines write either apostrophe
+		w = regexp.QuoteMeta(strings.Trim(strings.ToLower(w), punct))
+		words[i] = strings.NewReplacer("'", "['’]?", "’", "['’]?").Replace(w)
+	}
+	re, err := regexp.Compile(`(?i)` + strings.Join(words, `[\s,]+`) + `([.,;:!?]?)`)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := template.New(phrase).Funcs(macroFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return &macro{phrase: phrase, re: re, tmpl: tmpl}, nil
+}
+
+// Len returns the number of macros.
+func (m *Macros) Len() int {
+	return len(m.macros)
+}
+
+// Apply replaces the macro phrases in text with their expansions. The
+// punctuation the engine ends a phrase with is kept, unless the expansion
+// is a block of several lines, like a signature. A macro whose template
+// fails is left as it was said.
+func (m *Macros) Apply(text string) string {
+	for _, mac := range m.macros {
+		var found [][]int
+		for _, loc := range mac.re.FindAllStringSubmatchIndex(text, -1) {
+			// The phrase must be whole words, before its punctuation
+			if wordBoundary(text, loc[0]) && wordBoundary(text, loc[2]) {
+				found = append(found, loc)
+			}
+		}
+		if len(found) == 0 {
+			continue
+		}
+		var out strings.Builder
+		if err := mac.tmpl.Execute(&out, nil); err != nil {
+			continue
+		}
+		expansion := out.String()
+
+		var b strings.Builder
+		last := 0
+		for _, loc := range found {
+			b.WriteString(text[last:loc[0]])
+			b.WriteString(expansion)
+			if !strings.Contains(expansion, "\n") {
+				b.WriteString(text[loc[2]:loc[3]])
+			}
+			last = loc[1]
+		}
+		b.WriteString(text[last:])
+		text = b.String()
+	}
+	return text
+}
+
+// wordBoundary reports whether i in s isn't between two letters or
+// digits.
+func wordBoundary(s string, i int) bool {
+	before, _ := utf8.DecodeLastRuneInString(s[:i])
+	after, _ := utf8.DecodeRuneInString(s[i:])
+	return !isWordRune(before) || !isWordRune(after)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsNumber(r)
+}
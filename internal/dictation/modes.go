@@ -0,0 +1,89 @@
+package dictation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Formatter rewrites a dictated transcript.
+type Formatter interface {
+	Apply(text string) string
+}
+
+// Modes returns the dictation modes ForMode accepts.
+func Modes() []string {
+	return []string{"code", "list"}
+}
+
+// ForMode returns the formatter of a dictation mode ("code", "list") for
+// a language code.
+func ForMode(mode, lang string) (Formatter, error) {
+	var f Formatter
+	var ok bool
+	switch mode {
+	case "code":
+		f, ok = codeGrammars[lang]
+	case "list":
+		f, ok = listGrammars[lang]
+	default:
+		return nil, fmt.Errorf("unknown mode %q (available: %s)", mode, strings.Join(Modes(), ", "))
+	}
+	if !ok {
+		return nil, fmt.Errorf("no %s mode for lang '%s' (available: %s)", mode, lang, strings.Join(Langs(), ", "))
+	}
+	return f, nil
+}
+
+// ListGrammar holds the spoken item separators of list mode in one
+// language.
+type ListGrammar struct {
+	separator *regexp.Regexp
+}
+
+var listGrammars = map[string]*ListGrammar{
+	"en": newListGrammar("next item", "new item", "next point"),
+	"es": newListGrammar("siguiente punto", "nuevo punto", "siguiente elemento", "nuevo elemento"),
+}
+
+func newListGrammar(separators ...string) *ListGrammar {
+	alts := make([]string, len(separators))
+	for i, s := range separators {
+		alts[i] = strings.Join(strings.Fields(s), `[\s,.]+`)
+	}
+	// The engine may put punctuation around the separator
+	re := regexp.MustCompile(`(?i)[\s,.;:]*(?:^|\s)(?:` + strings.Join(alts, "|") + `)[\s,.;:]*`)
+	return &ListGrammar{separator: re}
+}
+
+var sentenceEnd = regexp.MustCompile(`[.?!…]+\s+`)
+
+// Apply turns dictated items into a numbered list, one per line. Items
+// are separated by a spoken separator ("next item"), or by sentences when
+// none was said. Each item is capitalized and loses its final period.
+func (g *ListGrammar) Apply(text string) string {
+	var items []string
+	if g.separator.MatchString(text) {
+		items = g.separator.Split(text, -1)
+	} else {
+		items = sentenceEnd.Split(text, -1)
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, item := range items {
+		item = strings.TrimRight(strings.TrimSpace(item), ".,;")
+		if item == "" {
+			continue
+		}
+		n++
+		if n > 1 {
+			b.WriteByte('\n')
+		}
+		r, size := utf8.DecodeRuneInString(item)
+		fmt.Fprintf(&b, "%d. %c%s", n, unicode.ToUpper(r), item[size:])
+	}
+	return b.String()
+}
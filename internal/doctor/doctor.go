@@ -5,7 +5,10 @@ import (
 	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
+
+	"golang.org/x/sys/cpu"
 )
 
 type CheckResult struct {
@@ -20,10 +23,14 @@ func RunChecks(role string) []CheckResult {
 	var results []CheckResult
 
 	// OS/Arch
+	platform := fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
+	if simd := SIMD(); simd != "" {
+		platform += " (" + simd + ")"
+	}
 	results = append(results, CheckResult{
 		Name:   "platform",
 		OK:     true,
-		Detail: fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+		Detail: platform,
 	})
 
 	// PortAudio (client only)
@@ -50,6 +57,11 @@ func RunChecks(role string) []CheckResult {
 		results = append(results, checkLib("libmoonshine"))
 	}
 
+	// RAM (server only)
+	if role == "server" {
+		results = append(results, checkMemory())
+	}
+
 	// zstd command (server bundle)
 	if role == "server" {
 		results = append(results, checkCommand("zstd"))
@@ -136,6 +148,64 @@ func checkLib(name string) CheckResult {
 	return CheckResult{Name: name, OK: false, Detail: "not found"}
 }
 
+// SIMD returns the vector instructions the CPU has that ONNX Runtime
+// speeds up inference with, "avx2" or "neon", or "" for none of them.
+func SIMD() string {
+	switch {
+	case cpu.X86.HasAVX2:
+		return "avx2"
+	case cpu.ARM64.HasASIMD, cpu.ARM.HasNEON:
+		return "neon"
+	}
+	return ""
+}
+
+// LowMemory is the total RAM below which the server should run with
+// -low-memory: Parakeet alone takes over 1GB once loaded.
+const LowMemory = 4 << 30
+
+// MemoryInfo returns the total and available RAM in bytes from
+// /proc/meminfo, or zeros when it can't be read.
+func MemoryInfo() (total, available uint64) {
+	data, err := os.ReadFile("/proc/meminfo")
+	if err != nil {
+		return 0, 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch name {
+		case "MemTotal":
+			total = kb << 10
+		case "MemAvailable":
+			available = kb << 10
+		}
+	}
+	return total, available
+}
+
+func checkMemory() CheckResult {
+	total, available := MemoryInfo()
+	if total == 0 {
+		return CheckResult{Name: "memory", OK: true, Detail: "unknown"}
+	}
+	detail := fmt.Sprintf("%.1f GiB total, %.1f GiB available", gib(total), gib(available))
+	if total < LowMemory {
+		detail += " (low, run the server with -low-memory)"
+	}
+	return CheckResult{Name: "memory", OK: true, Detail: detail}
+}
+
+func gib(n uint64) float64 {
+	return float64(n) / (1 << 30)
+}
+
 func checkCommand(name string) CheckResult {
 	path, err := exec.LookPath(name)
 	if err != nil {
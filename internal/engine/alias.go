@@ -0,0 +1,58 @@
+package engine
+
+import (
+	"fmt"
+	"maps"
+	"strings"
+)
+
+// Alias is a name clients can use for a model, like "fast" for
+// moonshine/base-en.
+type Alias struct {
+	Engine string
+	// Model is empty to pick the engine's model for the language.
+	Model string
+}
+
+// ParseAlias parses an alias target written as engine/model, or engine
+// alone.
+func ParseAlias(s string) (Alias, error) {
+	engine, model, _ := strings.Cut(s, "/")
+	if engine == "" {
+		return Alias{}, fmt.Errorf("invalid alias target %q, use engine/model", s)
+	}
+	return Alias{Engine: engine, Model: model}, nil
+}
+
+func (a Alias) String() string {
+	if a.Model == "" {
+		return a.Engine
+	}
+	return a.Engine + "/" + a.Model
+}
+
+// SetAlias points name at a model. The model doesn't need to be
+// registered yet: aliases are resolved when looked up.
+func (r *Registry[T]) SetAlias(name string, a Alias) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.aliases == nil {
+		r.aliases = map[string]Alias{}
+	}
+	r.aliases[name] = a
+}
+
+// Alias returns the model an alias points at.
+func (r *Registry[T]) Alias(name string) (Alias, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	a, ok := r.aliases[name]
+	return a, ok
+}
+
+// Aliases returns all the aliases by name.
+func (r *Registry[T]) Aliases() map[string]Alias {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return maps.Clone(r.aliases)
+}
@@ -0,0 +1,240 @@
+// Package engine keeps track of the speech-to-text models a server can
+// use, and of their lifecycle when they are loaded lazily.
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Spec describes a registered model.
+type Spec struct {
+	// Engine is the engine name clients select, e.g. "parakeet".
+	Engine string
+	// Model names the model, unique within an engine.
+	Model string
+	// Langs are the languages the model transcribes.
+	Langs []string
+	// Multilingual models detect the language themselves: they are
+	// picked for any language, Langs only documents what they support.
+	Multilingual bool
+}
+
+func (s Spec) supports(lang string) bool {
+	return s.Multilingual || slices.Contains(s.Langs, lang)
+}
+
+// Lifecycle is implemented by engines that load their model on demand and
+// can free it.
+type Lifecycle interface {
+	Loaded() bool
+	// Load loads the model if it isn't loaded yet.
+	Load() error
+	// Unload frees the model unless it's in use, and reports whether it
+	// did. It's loaded again when needed.
+	Unload() bool
+}
+
+// Hooks are called after lifecycle events. Any of them can be nil.
+type Hooks struct {
+	OnRegister   func(Spec)
+	OnUnregister func(Spec)
+	OnLoad       func(Spec)
+	OnUnload     func(Spec)
+}
+
+// Entry is a registered engine.
+type Entry[T any] struct {
+	Spec   Spec
+	Engine T
+}
+
+// Loaded reports whether the entry's model is loaded. Engines without a
+// lifecycle always are.
+func (e Entry[T]) Loaded() bool {
+	if l, ok := any(e.Engine).(Lifecycle); ok {
+		return l.Loaded()
+	}
+	return true
+}
+
+// Registry holds engines of type T by engine, language and model. It's
+// safe for concurrent use.
+type Registry[T any] struct {
+	mu      sync.RWMutex
+	entries []Entry[T] // in registration order
+	aliases map[string]Alias
+	hooks   Hooks
+}
+
+// NewRegistry returns an empty registry calling hooks on lifecycle events.
+func NewRegistry[T any](hooks Hooks) *Registry[T] {
+	return &Registry[T]{hooks: hooks}
+}
+
+// Register adds an engine. Engine and model names are required, and a
+// model can only be registered once per engine.
+func (r *Registry[T]) Register(spec Spec, engine T) error {
+	if spec.Engine == "" || spec.Model == "" {
+		return fmt.Errorf("register: engine and model names are required")
+	}
+	r.mu.Lock()
+	for _, e := range r.entries {
+		if e.Spec.Engine == spec.Engine && e.Spec.Model == spec.Model {
+			r.mu.Unlock()
+			return fmt.Errorf("register: %s model %s is already registered", spec.Engine, spec.Model)
+		}
+	}
+	r.entries = append(r.entries, Entry[T]{Spec: spec, Engine: engine})
+	r.mu.Unlock()
+
+	if r.hooks.OnRegister != nil {
+		r.hooks.OnRegister(spec)
+	}
+	return nil
+}
+
+// Unregister removes a model, unloading it first when possible, and
+// reports whether it was registered. Requests already using it finish.
+func (r *Registry[T]) Unregister(engine, model string) bool {
+	r.mu.Lock()
+	i := slices.IndexFunc(r.entries, func(e Entry[T]) bool { return e.Spec.Engine == engine && e.Spec.Model == model })
+	if i < 0 {
+		r.mu.Unlock()
+		return false
+	}
+	e := r.entries[i]
+	r.entries = slices.Delete(r.entries, i, i+1)
+	r.mu.Unlock()
+
+	r.unload(e)
+	if r.hooks.OnUnregister != nil {
+		r.hooks.OnUnregister(e.Spec)
+	}
+	return true
+}
+
+// Lookup returns the engine to transcribe lang with. An empty model picks
+// the first one registered for the engine and language.
+func (r *Registry[T]) Lookup(engine, lang, model string) (Entry[T], error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	found := false
+	for _, e := range r.entries {
+		if e.Spec.Engine != engine {
+			continue
+		}
+		found = true
+		if (model == "" || e.Spec.Model == model) && e.Spec.supports(lang) {
+			return e, nil
+		}
+	}
+	var zero Entry[T]
+	switch {
+	case !found:
+		return zero, fmt.Errorf("unknown engine '%s', available: %s", engine, strings.Join(r.engines(), ", "))
+	case model != "":
+		return zero, fmt.Errorf("%s: unknown model '%s' for lang '%s'", engine, model, lang)
+	default:
+		return zero, fmt.Errorf("%s: unknown lang '%s', available: %s", engine, lang, strings.Join(r.langs(engine), ", "))
+	}
+}
+
+// Has reports whether an engine can transcribe lang.
+func (r *Registry[T]) Has(engine, lang string) bool {
+	_, err := r.Lookup(engine, lang, "")
+	return err == nil
+}
+
+// Entries returns the registered engines in registration order.
+func (r *Registry[T]) Entries() []Entry[T] {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.entries)
+}
+
+// Engines returns the registered engine names in registration order.
+func (r *Registry[T]) Engines() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.engines()
+}
+
+func (r *Registry[T]) engines() []string {
+	var names []string
+	for _, e := range r.entries {
+		if !slices.Contains(names, e.Spec.Engine) {
+			names = append(names, e.Spec.Engine)
+		}
+	}
+	return names
+}
+
+// Langs returns the sorted languages the models of an engine support.
+func (r *Registry[T]) Langs(engine string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.langs(engine)
+}
+
+func (r *Registry[T]) langs(engine string) []string {
+	var langs []string
+	for _, e := range r.entries {
+		if e.Spec.Engine != engine {
+			continue
+		}
+		for _, l := range e.Spec.Langs {
+			if !slices.Contains(langs, l) {
+				langs = append(langs, l)
+			}
+		}
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// Load loads the model that Lookup returns for the same arguments.
+func (r *Registry[T]) Load(engine, lang, model string) error {
+	e, err := r.Lookup(engine, lang, model)
+	if err != nil {
+		return err
+	}
+	l, ok := any(e.Engine).(Lifecycle)
+	if !ok || l.Loaded() {
+		return nil
+	}
+	if err := l.Load(); err != nil {
+		return err
+	}
+	if r.hooks.OnLoad != nil {
+		r.hooks.OnLoad(e.Spec)
+	}
+	return nil
+}
+
+// UnloadIdle unloads every model not in use, and reports whether it
+// unloaded any.
+func (r *Registry[T]) UnloadIdle() bool {
+	unloaded := false
+	for _, e := range r.Entries() {
+		if r.unload(e) {
+			unloaded = true
+		}
+	}
+	return unloaded
+}
+
+func (r *Registry[T]) unload(e Entry[T]) bool {
+	l, ok := any(e.Engine).(Lifecycle)
+	if !ok || !l.Unload() {
+		return false
+	}
+	if r.hooks.OnUnload != nil {
+		r.hooks.OnUnload(e.Spec)
+	}
+	return true
+}
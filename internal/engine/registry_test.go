@@ -0,0 +1,194 @@
+package engine
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeModel is a lazily loaded model.
+type fakeModel struct {
+	name   string
+	loaded atomic.Bool
+	inUse  atomic.Bool
+}
+
+func (m *fakeModel) Loaded() bool { return m.loaded.Load() }
+
+func (m *fakeModel) Load() error {
+	m.loaded.Store(true)
+	return nil
+}
+
+func (m *fakeModel) Unload() bool {
+	if m.inUse.Load() || !m.loaded.Load() {
+		return false
+	}
+	m.loaded.Store(false)
+	return true
+}
+
+func testRegistry(t *testing.T, hooks Hooks) *Registry[*fakeModel] {
+	t.Helper()
+	r := NewRegistry[*fakeModel](hooks)
+	for _, spec := range []Spec{
+		{Engine: "moonshine", Model: "base-en", Langs: []string{"en"}},
+		{Engine: "moonshine", Model: "tiny-en", Langs: []string{"en"}},
+		{Engine: "moonshine", Model: "base-es", Langs: []string{"es"}},
+		{Engine: "parakeet", Model: "v3", Langs: []string{"en", "es", "fr"}, Multilingual: true},
+	} {
+		if err := r.Register(spec, &fakeModel{name: spec.Model}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func TestLookup(t *testing.T) {
+	r := testRegistry(t, Hooks{})
+	tests := []struct {
+		engine, lang, model string
+		want                string
+		wantErr             bool
+	}{
+		{"moonshine", "en", "", "base-en", false},
+		{"moonshine", "en", "tiny-en", "tiny-en", false},
+		{"moonshine", "es", "", "base-es", false},
+		{"moonshine", "es", "tiny-en", "", true},
+		{"moonshine", "fr", "", "", true},
+		{"parakeet", "de", "", "v3", false},
+		{"whisper", "en", "", "", true},
+	}
+	for _, tt := range tests {
+		e, err := r.Lookup(tt.engine, tt.lang, tt.model)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Lookup(%q, %q, %q) error = %v, want error %v", tt.engine, tt.lang, tt.model, err, tt.wantErr)
+			continue
+		}
+		if err == nil && e.Spec.Model != tt.want {
+			t.Errorf("Lookup(%q, %q, %q) = %s, want %s", tt.engine, tt.lang, tt.model, e.Spec.Model, tt.want)
+		}
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	r := testRegistry(t, Hooks{})
+	if err := r.Register(Spec{Engine: "moonshine", Model: "base-en", Langs: []string{"en"}}, &fakeModel{}); err == nil {
+		t.Error("registering moonshine/base-en twice succeeded")
+	}
+	if err := r.Register(Spec{Engine: "moonshine"}, &fakeModel{}); err == nil {
+		t.Error("registering a model without a name succeeded")
+	}
+}
+
+func TestConcurrentRegisterLookup(t *testing.T) {
+	r := NewRegistry[*fakeModel](Hooks{})
+	const n = 50
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			model := fmt.Sprintf("m%d", i)
+			if err := r.Register(Spec{Engine: "moonshine", Model: model, Langs: []string{"en"}}, &fakeModel{name: model}); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			r.Lookup("moonshine", "en", fmt.Sprintf("m%d", i))
+			r.Entries()
+			r.Langs("moonshine")
+		}()
+	}
+	wg.Wait()
+
+	if got := len(r.Entries()); got != n {
+		t.Fatalf("%d entries, want %d", got, n)
+	}
+	for i := range n {
+		model := fmt.Sprintf("m%d", i)
+		if e, err := r.Lookup("moonshine", "en", model); err != nil || e.Engine.name != model {
+			t.Errorf("Lookup(%s) = %v, %v", model, e.Spec, err)
+		}
+	}
+}
+
+func TestAliases(t *testing.T) {
+	r := testRegistry(t, Hooks{})
+	a, err := ParseAlias("moonshine/tiny-en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetAlias("fast", a)
+	r.SetAlias("accurate", Alias{Engine: "parakeet"})
+
+	got, ok := r.Alias("fast")
+	if !ok || got != (Alias{Engine: "moonshine", Model: "tiny-en"}) {
+		t.Errorf("Alias(fast) = %v, %v", got, ok)
+	}
+	if e, err := r.Lookup(got.Engine, "en", got.Model); err != nil || e.Spec.Model != "tiny-en" {
+		t.Errorf("Lookup(fast) = %v, %v", e.Spec, err)
+	}
+	if _, ok := r.Alias("slow"); ok {
+		t.Error("Alias(slow) found an alias never set")
+	}
+	all := r.Aliases()
+	if len(all) != 2 || all["accurate"].String() != "parakeet" || all["fast"].String() != "moonshine/tiny-en" {
+		t.Errorf("Aliases() = %v", all)
+	}
+	if _, err := ParseAlias("/tiny-en"); err == nil {
+		t.Error("ParseAlias(/tiny-en) succeeded")
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(kind string) func(Spec) {
+		return func(s Spec) {
+			mu.Lock()
+			defer mu.Unlock()
+			events = append(events, kind+" "+s.Model)
+		}
+	}
+	r := testRegistry(t, Hooks{
+		OnRegister:   record("register"),
+		OnUnregister: record("unregister"),
+		OnLoad:       record("load"),
+		OnUnload:     record("unload"),
+	})
+	events = nil
+
+	if err := r.Load("moonshine", "en", ""); err != nil {
+		t.Fatal(err)
+	}
+	// Loading a loaded model does nothing
+	if err := r.Load("moonshine", "en", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Load("moonshine", "es", ""); err != nil {
+		t.Fatal(err)
+	}
+	es, _ := r.Lookup("moonshine", "es", "")
+	es.Engine.inUse.Store(true)
+	if !r.UnloadIdle() {
+		t.Error("UnloadIdle unloaded nothing")
+	}
+	if !es.Loaded() {
+		t.Error("UnloadIdle unloaded a model in use")
+	}
+	es.Engine.inUse.Store(false)
+	if !r.Unregister("moonshine", "base-es") {
+		t.Error("Unregister(base-es) = false")
+	}
+	if r.Unregister("moonshine", "base-es") {
+		t.Error("Unregister(base-es) twice = true")
+	}
+
+	want := []string{"load base-en", "load base-es", "unload base-en", "unload base-es", "unregister base-es"}
+	if fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+}
@@ -0,0 +1,97 @@
+package engine
+
+import "sync"
+
+// Status is the state of an engine's model.
+type Status string
+
+const (
+	StatusNotLoaded Status = "not_loaded"
+	StatusLoading   Status = "loading"
+	StatusReady     Status = "ready"
+	// StatusError is reported when the last attempt to load the model
+	// failed. The next request tries again.
+	StatusError Status = "error"
+)
+
+// StatusReporter is implemented by engines that can tell a model being
+// loaded, or one that failed to, from one that isn't loaded.
+type StatusReporter interface {
+	// Status returns the model's state and, with StatusError, why it
+	// failed to load.
+	Status() (Status, error)
+}
+
+// QueueReporter is implemented by engines that queue requests while their
+// model is busy.
+type QueueReporter interface {
+	// Waiting returns the number of requests queued for the model.
+	Waiting() int
+}
+
+// Status returns the state of the entry's model. Engines reporting no
+// status are ready when loaded.
+func (e Entry[T]) Status() (Status, error) {
+	if s, ok := any(e.Engine).(StatusReporter); ok {
+		return s.Status()
+	}
+	if e.Loaded() {
+		return StatusReady, nil
+	}
+	return StatusNotLoaded, nil
+}
+
+// Waiting returns the number of requests queued for the entry's model.
+func (e Entry[T]) Waiting() int {
+	if q, ok := any(e.Engine).(QueueReporter); ok {
+		return q.Waiting()
+	}
+	return 0
+}
+
+// LoadState tracks the loading of a lazily loaded model, for engines to
+// implement StatusReporter with. Unlike the engine's own lock, it isn't
+// held while the model loads, so the status can be read meanwhile. The
+// zero value is a model that isn't loaded.
+type LoadState struct {
+	mu      sync.Mutex
+	loading bool
+	loaded  bool
+	err     error
+}
+
+// Start records that the model started loading.
+func (s *LoadState) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loading = true
+}
+
+// Done records the outcome of loading the model.
+func (s *LoadState) Done(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loading, s.loaded, s.err = false, err == nil, err
+}
+
+// Unloaded records that the model was freed.
+func (s *LoadState) Unloaded() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loaded = false
+}
+
+// Status implements StatusReporter.
+func (s *LoadState) Status() (Status, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.loading:
+		return StatusLoading, nil
+	case s.loaded:
+		return StatusReady, nil
+	case s.err != nil:
+		return StatusError, s.err
+	}
+	return StatusNotLoaded, nil
+}
@@ -0,0 +1,248 @@
+// Package intent matches transcripts against user-defined voice commands,
+// like "open {app}" or "set a timer for {duration}", and dispatches them
+// to shell commands or D-Bus method calls.
+package intent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// slotPattern finds the {slot} placeholders in patterns and actions.
+var slotPattern = regexp.MustCompile(`\{([a-z_][a-z0-9_]*)\}`)
+
+// Intent is a voice command as written in the intents file. It matches
+// when the whole transcript matches one of its patterns.
+type Intent struct {
+	Name string `json:"name"`
+	// Patterns are phrases where {slot} captures one or more words and
+	// [word] is optional, e.g. "open [the] {app}".
+	Patterns []string `json:"patterns"`
+
+	// Actions: one of them.
+	// Exec is a command line, split on spaces before slots are filled in,
+	// so captured words can't add arguments or shell syntax. Slot values
+	// starting with "-" are rejected, so they can't pass options either.
+	Exec string    `json:"exec,omitempty"`
+	DBus *DBusCall `json:"dbus,omitempty"`
+
+	patterns []*regexp.Regexp
+}
+
+// DBusCall is a D-Bus method call, e.g. to an MPRIS player.
+type DBusCall struct {
+	// Bus is "session" (the default) or "system".
+	Bus    string `json:"bus,omitempty"`
+	Dest   string `json:"dest"`
+	Path   string `json:"path"`
+	Method string `json:"method"` // interface and member, e.g. org.mpris.MediaPlayer2.Player.Pause
+	// Args are strings, where slots are filled in, numbers (sent as int32
+	// when whole, float64 otherwise) and booleans.
+	Args []any `json:"args,omitempty"`
+}
+
+// Match is an intent that matched a transcript, with its slot values.
+type Match struct {
+	Intent *Intent
+	Slots  map[string]string
+}
+
+// Load reads a JSON array of intents and compiles them.
+func Load(path string) ([]*Intent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var intents []*Intent
+	if err := json.Unmarshal(data, &intents); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for i, in := range intents {
+		if in.Name == "" {
+			in.Name = fmt.Sprintf("intent %d", i+1)
+		}
+		if err := in.compile(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, in.Name, err)
+		}
+	}
+	return intents, nil
+}
+
+func (in *Intent) compile() error {
+	if len(in.Patterns) == 0 {
+		return fmt.Errorf("needs patterns")
+	}
+	if (in.Exec == "") == (in.DBus == nil) {
+		return fmt.Errorf("needs one action (exec or dbus)")
+	}
+	if in.DBus != nil {
+		if in.DBus.Dest == "" || in.DBus.Path == "" || in.DBus.Method == "" {
+			return fmt.Errorf("dbus needs dest, path and method")
+		}
+		if b := in.DBus.Bus; b != "" && b != "session" && b != "system" {
+			return fmt.Errorf("unknown bus %q, use session or system", b)
+		}
+	}
+	for _, p := range in.Patterns {
+		re, err := compilePattern(p)
+		if err != nil {
+			return fmt.Errorf("pattern %q: %w", p, err)
+		}
+		in.patterns = append(in.patterns, re)
+	}
+	return nil
+}
+
+// compilePattern turns a pattern into a regular expression matching a
+// normalized transcript from start to end.
+func compilePattern(p string) (*regexp.Regexp, error) {
+	var parts []string
+	seen := map[string]bool{}
+	for _, w := range strings.Fields(strings.ToLower(p)) {
+		switch {
+		case slotPattern.FindString(w) == w:
+			name := w[1 : len(w)-1]
+			if seen[name] {
+				return nil, fmt.Errorf("slot {%s} used twice", name)
+			}
+			seen[name] = true
+			parts = append(parts, `(?P<`+name+`>.+?) `)
+		case strings.HasPrefix(w, "[") && strings.HasSuffix(w, "]") && len(w) > 2:
+			parts = append(parts, `(?:`+regexp.QuoteMeta(w[1:len(w)-1])+` )?`)
+		default:
+			if strings.ContainsAny(w, "{}[]") {
+				return nil, fmt.Errorf("bad word %q", w)
+			}
+			parts = append(parts, regexp.QuoteMeta(w)+` `)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty pattern")
+	}
+	// Every word is followed by a space, and normalize adds one at the end
+	return regexp.Compile(`^` + strings.Join(parts, "") + `$`)
+}
+
+// normalize lowercases text and drops the punctuation engines add, so
+// "Open Firefox." matches "open {app}".
+func normalize(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\'' && r != '-'
+	})
+	if len(words) == 0 {
+		return ""
+	}
+	return strings.Join(words, " ") + " "
+}
+
+// Find returns the first intent matching text, or nil.
+func Find(intents []*Intent, text string) *Match {
+	norm := normalize(text)
+	if norm == "" {
+		return nil
+	}
+	for _, in := range intents {
+		for _, re := range in.patterns {
+			m := re.FindStringSubmatch(norm)
+			if m == nil {
+				continue
+			}
+			slots := map[string]string{}
+			for i, name := range re.SubexpNames() {
+				if name != "" {
+					slots[name] = strings.TrimSpace(m[i])
+				}
+			}
+			return &Match{Intent: in, Slots: slots}
+		}
+	}
+	return nil
+}
+
+// fill replaces the {slot} placeholders in s with their values.
+func fill(s string, slots map[string]string) string {
+	return slotPattern.ReplaceAllStringFunc(s, func(p string) string {
+		if v, ok := slots[p[1:len(p)-1]]; ok {
+			return v
+		}
+		return p
+	})
+}
+
+// Dispatch runs the matched intent's action. Commands get the slots in
+// the environment too, as LUNARTLK_SLOT_<NAME>.
+func (m *Match) Dispatch(ctx context.Context) error {
+	if m.Intent.DBus != nil {
+		return m.call(m.Intent.DBus)
+	}
+	for name, v := range m.Slots {
+		if strings.HasPrefix(v, "-") {
+			return fmt.Errorf("slot {%s} is %q, which would be taken as an option", name, v)
+		}
+	}
+	args := strings.Fields(m.Intent.Exec)
+	for i, a := range args {
+		args[i] = fill(a, m.Slots)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Env = os.Environ()
+	for k, v := range m.Slots {
+		cmd.Env = append(cmd.Env, "LUNARTLK_SLOT_"+strings.ToUpper(k)+"="+v)
+	}
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s: %w", args[0], err)
+	}
+	return nil
+}
+
+func (m *Match) call(c *DBusCall) error {
+	connect := dbus.ConnectSessionBus
+	if c.Bus == "system" {
+		connect = dbus.ConnectSystemBus
+	}
+	conn, err := connect()
+	if err != nil {
+		return fmt.Errorf("connect %s bus: %w", c.busName(), err)
+	}
+	defer conn.Close()
+
+	args := make([]any, len(c.Args))
+	for i, a := range c.Args {
+		switch a := a.(type) {
+		case string:
+			args[i] = fill(a, m.Slots)
+		case float64:
+			if a == float64(int32(a)) {
+				args[i] = int32(a)
+			} else {
+				args[i] = a
+			}
+		case bool:
+			args[i] = a
+		default:
+			return fmt.Errorf("dbus arg %d: unsupported type %T", i+1, a)
+		}
+	}
+	obj := conn.Object(c.Dest, dbus.ObjectPath(c.Path))
+	if err := obj.Call(c.Method, 0, args...).Err; err != nil {
+		return fmt.Errorf("%s: %w", c.Method, err)
+	}
+	return nil
+}
+
+func (c *DBusCall) busName() string {
+	if c.Bus == "" {
+		return "session"
+	}
+	return c.Bus
+}
@@ -0,0 +1,36 @@
+package intent
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDispatchOptionSlot(t *testing.T) {
+	in := &Intent{Name: "open", Patterns: []string{"open {app}"}, Exec: "true {app}"}
+	if err := in.compile(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		text    string
+		wantErr bool
+	}{
+		{"Open Firefox.", false},
+		{"Open --help", true},
+		{"Open -rf now", true},
+		{"Open wi-fi settings", false},
+	}
+	for _, tt := range tests {
+		m := Find([]*Intent{in}, tt.text)
+		if m == nil {
+			t.Fatalf("%q didn't match", tt.text)
+		}
+		err := m.Dispatch(context.Background())
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: Dispatch() = %v, want error %v", tt.text, err, tt.wantErr)
+		}
+		if err != nil && !strings.Contains(err.Error(), "option") {
+			t.Errorf("%q: unexpected error %v", tt.text, err)
+		}
+	}
+}
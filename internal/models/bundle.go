@@ -0,0 +1,215 @@
+package models
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// bundleDirs are the cache directories a bundle carries: the models and
+// the shared libraries, ONNX Runtime included.
+var bundleDirs = []string{"models", "libs"}
+
+// Export writes the models and libraries in cacheDir to w as a
+// zstd-compressed tar bundle, for Import on a machine without network
+// access. Partial downloads and lock files are left out.
+func Export(w io.Writer, cacheDir string) error {
+	zw, err := zstd.NewWriter(w)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+	for _, dir := range bundleDirs {
+		root := filepath.Join(cacheDir, dir)
+		if _, err := os.Stat(root); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if strings.HasSuffix(p, ".tmp") || strings.HasSuffix(p, ".lock") {
+				return nil
+			}
+			return addToBundle(tw, cacheDir, p)
+		})
+		if err != nil {
+			return fmt.Errorf("export %s: %w", dir, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func addToBundle(tw *tar.Writer, cacheDir, p string) error {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return err
+	}
+	var link string
+	if info.Mode()&fs.ModeSymlink != 0 {
+		if link, err = os.Readlink(p); err != nil {
+			return err
+		}
+	}
+	hdr, err := tar.FileInfoHeader(info, link)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(cacheDir, p)
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(rel)
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Import extracts a bundle written by Export into cacheDir, replacing the
+// files it contains. Entries outside the bundled directories are
+// rejected, so a bundle can't write anywhere else.
+func Import(r io.Reader, cacheDir string) (int, error) {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer zr.Close()
+
+	var files int
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, fmt.Errorf("read bundle: %w", err)
+		}
+		name, err := bundlePath(hdr.Name)
+		if err != nil {
+			return files, err
+		}
+		dest := filepath.Join(cacheDir, filepath.FromSlash(name))
+		if err := checkNoSymlinks(cacheDir, name, hdr.Typeflag == tar.TypeDir); err != nil {
+			return files, err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return files, err
+			}
+		case tar.TypeReg:
+			if err := extractFile(tr, dest, hdr.FileInfo().Mode().Perm()); err != nil {
+				return files, fmt.Errorf("extract %s: %w", name, err)
+			}
+			files++
+		case tar.TypeSymlink:
+			// Libraries link to their versioned names next to them
+			if !isSiblingName(hdr.Linkname) {
+				return files, fmt.Errorf("bundle entry %s links outside its directory", name)
+			}
+			os.Remove(dest)
+			if err := os.Symlink(hdr.Linkname, dest); err != nil {
+				return files, err
+			}
+		default:
+			return files, fmt.Errorf("unsupported bundle entry %s", name)
+		}
+	}
+}
+
+// bundlePath validates the name of a bundle entry.
+func bundlePath(name string) (string, error) {
+	clean := path.Clean(name)
+	top, _, _ := strings.Cut(clean, "/")
+	if path.IsAbs(clean) || strings.HasPrefix(clean, "../") || clean == ".." {
+		return "", fmt.Errorf("invalid bundle entry %s", name)
+	}
+	for _, dir := range bundleDirs {
+		if top == dir {
+			return clean, nil
+		}
+	}
+	return "", fmt.Errorf("unexpected bundle entry %s", name)
+}
+
+// isSiblingName reports whether a symlink target names a file in the
+// link's own directory.
+func isSiblingName(target string) bool {
+	return target != "" && target != "." && target != ".." && !strings.ContainsAny(target, `/\`)
+}
+
+// checkNoSymlinks makes sure the entry name, relative to cacheDir, doesn't
+// go through a symlink already there, which could point anywhere. The last
+// element is only checked for directories: files and links replace it.
+func checkNoSymlinks(cacheDir, name string, dir bool) error {
+	parts := strings.Split(name, "/")
+	if !dir {
+		parts = parts[:len(parts)-1]
+	}
+	p := cacheDir
+	for _, part := range parts {
+		p = filepath.Join(p, part)
+		info, err := os.Lstat(p)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("bundle entry %s goes through the symlink %s", name, p)
+		}
+	}
+	return nil
+}
+
+// extractFile writes r to dest through a temporary file, so a failed
+// import doesn't leave a truncated model behind.
+func extractFile(r io.Reader, dest string, perm fs.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	// The temporary file is created anew, not written through a link
+	tmp := dest + ".tmp"
+	os.Remove(tmp)
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_EXCL|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
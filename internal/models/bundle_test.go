@@ -0,0 +1,146 @@
+package models
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// bundleEntry is a tar entry of a test bundle: a file with data, a
+// directory when name ends in "/", or a symlink to link.
+type bundleEntry struct {
+	name, data, link string
+}
+
+func testBundle(t *testing.T, entries ...bundleEntry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := zstd.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(zw)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: tar.TypeReg, Size: int64(len(e.data))}
+		switch {
+		case e.link != "":
+			hdr.Typeflag, hdr.Linkname, hdr.Size = tar.TypeSymlink, e.link, 0
+		case strings.HasSuffix(e.name, "/"):
+			hdr.Typeflag, hdr.Mode = tar.TypeDir, 0755
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(e.data))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+func TestExportImport(t *testing.T) {
+	src := t.TempDir()
+	os.MkdirAll(filepath.Join(src, "models", "base-en"), 0755)
+	os.MkdirAll(filepath.Join(src, "libs"), 0755)
+	os.WriteFile(filepath.Join(src, "models", "base-en", "encoder.ort"), []byte("encoder"), 0644)
+	os.WriteFile(filepath.Join(src, "models", "base-en", "decoder.ort.tmp"), []byte("partial"), 0644)
+	os.WriteFile(filepath.Join(src, "libs", "libonnxruntime.so.1.22.0"), []byte("ort"), 0755)
+	os.Symlink("libonnxruntime.so.1.22.0", filepath.Join(src, "libs", "libonnxruntime.so.1"))
+	os.WriteFile(filepath.Join(src, "usage.json"), []byte("{}"), 0644)
+
+	var buf bytes.Buffer
+	if err := Export(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+	files, err := Import(&buf, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if files != 2 {
+		t.Errorf("imported %d files, want 2", files)
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "libs", "libonnxruntime.so.1")); err != nil || string(data) != "ort" {
+		t.Errorf("library through its link: %q, %v", data, err)
+	}
+	for _, name := range []string{"models/base-en/decoder.ort.tmp", "usage.json"} {
+		if _, err := os.Lstat(filepath.Join(dst, name)); err == nil {
+			t.Errorf("%s was exported", name)
+		}
+	}
+}
+
+func TestImportRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []bundleEntry
+	}{
+		{"absolute path", []bundleEntry{{name: "/etc/passwd", data: "x"}}},
+		{"parent path", []bundleEntry{{name: "models/../../x", data: "x"}}},
+		{"other directory", []bundleEntry{{name: "transcripts/x", data: "x"}}},
+		{"link to a path", []bundleEntry{{name: "libs/x", link: "../../etc/passwd"}}},
+		{"link to the parent", []bundleEntry{
+			{name: "models/"},
+			// models/up is the cache, and models/up/up the directory it's in
+			{name: "models/up", link: ".."},
+			{name: "models/up/up", link: ".."},
+			{name: "models/up/up/x", data: "x"},
+		}},
+		{"link to itself", []bundleEntry{
+			{name: "models/"},
+			{name: "models/here", link: "."},
+			{name: "models/here/x", data: "x"},
+		}},
+		{"through a link", []bundleEntry{
+			{name: "models/"},
+			{name: "models/lib", link: "libs"},
+			{name: "models/lib/x", data: "x"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cacheDir := filepath.Join(dir, "cache")
+			if _, err := Import(testBundle(t, tt.entries...), cacheDir); err == nil {
+				t.Error("import succeeded")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "x")); err == nil {
+				t.Error("a file was written outside the cache")
+			}
+		})
+	}
+}
+
+func TestImportRefusesExistingSymlinks(t *testing.T) {
+	cacheDir, outside := t.TempDir(), t.TempDir()
+	os.MkdirAll(filepath.Join(cacheDir, "models"), 0755)
+	if err := os.Symlink(outside, filepath.Join(cacheDir, "models", "base-en")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Import(testBundle(t, bundleEntry{name: "models/base-en/encoder.ort", data: "x"}), cacheDir); err == nil {
+		t.Error("import through an existing symlink succeeded")
+	}
+	if _, err := os.Stat(filepath.Join(outside, "encoder.ort")); err == nil {
+		t.Error("the import wrote through the symlink")
+	}
+
+	// A link planted where the temporary file goes is replaced, not
+	// followed
+	target := filepath.Join(outside, "target")
+	os.Symlink(target, filepath.Join(cacheDir, "models", "model.ort.tmp"))
+	if _, err := Import(testBundle(t, bundleEntry{name: "models/model.ort", data: "x"}), cacheDir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(target); err == nil {
+		t.Error("the import wrote through the temporary file's link")
+	}
+}
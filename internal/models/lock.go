@@ -0,0 +1,44 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// lockFile takes an exclusive lock on path, creating it if needed, and
+// waits for other processes holding it, so two servers, or a server and
+// the models command, don't download to the same files at once. The lock
+// is released by calling the returned function, or when the process
+// exits.
+func lockFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		// Some network filesystems mounted as volumes have no locks:
+		// carry on unlocked rather than never downloading
+		if errors.Is(err, syscall.ENOLCK) || errors.Is(err, syscall.EOPNOTSUPP) {
+			log.Printf("Can't lock %s (%v), downloading without a lock", path, err)
+			return func() {}, nil
+		}
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// lockModel locks a model's directory in the cache.
+func lockModel(cacheDir string, info ModelInfo) (func(), error) {
+	return lockFile(filepath.Join(cacheDir, "models", info.Name+".lock"))
+}
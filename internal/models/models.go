@@ -1,48 +1,145 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 )
 
 type ModelInfo struct {
 	Name    string
 	BaseURL string
 	Files   []string
+	// Revision pins the upstream version of the files, replacing
+	// "{revision}" in BaseURL. Hugging Face accepts a branch or a commit
+	// hash: only a commit hash guarantees the files never change.
+	Revision string
+	// Path is a local directory with the model's files, used as is instead
+	// of downloading them to the cache, e.g. a shared read-only store.
+	Path string
+	// Checksums are the SHA-256 digests of files, by name, when the
+	// registry pins them. Downloads are checked against them, or against
+	// the digest Hugging Face publishes for the file when there's none,
+	// and Verify compares cached files to them, or to the digest recorded
+	// at download time. None are pinned yet: Parakeet follows the "main"
+	// revision, whose files may change.
+	Checksums map[string]string
+	// Memory is roughly how much memory the model takes once loaded, in
+	// bytes, so a server can tell whether it fits before loading it.
+	// Zero means unknown.
+	Memory int64
+}
+
+// FileURL returns the download URL of one of the model's files.
+func (m ModelInfo) FileURL(file string) string {
+	return strings.ReplaceAll(m.BaseURL, "{revision}", m.Revision) + "/" + file
 }
 
 var MoonshineModels = map[string]ModelInfo{
+	// Served for English with -low-memory
+	"tiny-en": {
+		Name:    "tiny-en",
+		BaseURL: "https://download.moonshine.ai/model/tiny-en/quantized/tiny-en",
+		Files:   []string{"encoder_model.ort", "decoder_model_merged.ort", "tokenizer.bin"},
+		Memory:  120 << 20,
+	},
 	"base-es": {
 		Name:    "base-es",
 		BaseURL: "https://download.moonshine.ai/model/base-es/quantized/base-es",
 		Files:   []string{"encoder_model.ort", "decoder_model_merged.ort", "tokenizer.bin"},
+		Memory:  300 << 20,
 	},
 	"base-en": {
 		Name:    "base-en",
 		BaseURL: "https://download.moonshine.ai/model/base-en/quantized/base-en",
 		Files:   []string{"encoder_model.ort", "decoder_model_merged.ort", "tokenizer.bin"},
+		Memory:  300 << 20,
 	},
 }
 
 var ParakeetModel = ModelInfo{
-	Name:    "parakeet-v3-sherpa",
-	BaseURL: "https://huggingface.co/csukuangfj/sherpa-onnx-nemo-parakeet-tdt-0.6b-v3-int8/resolve/main",
-	Files:   []string{"encoder.int8.onnx", "decoder.int8.onnx", "joiner.int8.onnx", "tokens.txt"},
+	Name:     "parakeet-v3-sherpa",
+	BaseURL:  "https://huggingface.co/csukuangfj/sherpa-onnx-nemo-parakeet-tdt-0.6b-v3-int8/resolve/{revision}",
+	Files:    []string{"encoder.int8.onnx", "decoder.int8.onnx", "joiner.int8.onnx", "tokens.txt"},
+	Revision: "main",
+	// Includes its preprocessor
+	Memory: 1200 << 20,
 }
 
 var ParakeetPreprocessor = ModelInfo{
-	Name:    "parakeet-v3-sherpa",
-	BaseURL: "https://huggingface.co/istupakov/parakeet-tdt-0.6b-v3-onnx/resolve/main",
-	Files:   []string{"nemo128.onnx"},
+	Name:     "parakeet-v3-sherpa",
+	BaseURL:  "https://huggingface.co/istupakov/parakeet-tdt-0.6b-v3-onnx/resolve/{revision}",
+	Files:    []string{"nemo128.onnx"},
+	Revision: "main",
+}
+
+// SetPath makes the model with the given name use the files in dir
+// instead of the cache (see ModelInfo.Path).
+func SetPath(name, dir string) error {
+	var found bool
+	if m, ok := MoonshineModels[name]; ok {
+		m.Path = dir
+		MoonshineModels[name] = m
+		found = true
+	}
+	// The Parakeet model and its preprocessor share a directory
+	for _, m := range []*ModelInfo{&ParakeetModel, &ParakeetPreprocessor} {
+		if m.Name == name {
+			m.Path = dir
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown model %q", name)
+	}
+	return nil
+}
+
+// SetURL makes the model with the given name download its files from
+// baseURL, e.g. a mirror, instead of upstream. "{revision}" in baseURL is
+// replaced as in BaseURL.
+func SetURL(name, baseURL string) error {
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	var found bool
+	if m, ok := MoonshineModels[name]; ok {
+		m.BaseURL = baseURL
+		MoonshineModels[name] = m
+		found = true
+	}
+	// The Parakeet model and its preprocessor are mirrored together
+	for _, m := range []*ModelInfo{&ParakeetModel, &ParakeetPreprocessor} {
+		if m.Name == name {
+			m.BaseURL = baseURL
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown model %q", name)
+	}
+	return nil
 }
 
 // EnsureModel downloads model files if they don't exist in dir.
-// Returns the model directory path.
+// Returns the model directory path. Models with a Path are never
+// downloaded: their files must be there.
 func EnsureModel(cacheDir string, info ModelInfo) (string, error) {
+	if info.Path != "" {
+		for _, f := range info.Files {
+			if _, err := os.Stat(filepath.Join(info.Path, f)); err != nil {
+				return "", fmt.Errorf("model %s: %w", info.Name, err)
+			}
+		}
+		return info.Path, nil
+	}
+
 	dir := filepath.Join(cacheDir, "models", info.Name)
 
 	// Check if all files exist
@@ -60,15 +157,21 @@ func EnsureModel(cacheDir string, info ModelInfo) (string, error) {
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return "", fmt.Errorf("create dir %s: %w", dir, err)
 	}
+	// Another process may be downloading the same files: wait for it,
+	// then skip what it downloaded
+	unlock, err := lockModel(cacheDir, info)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
 
 	for _, f := range info.Files {
 		dest := filepath.Join(dir, f)
 		if _, err := os.Stat(dest); err == nil {
 			continue
 		}
-		url := info.BaseURL + "/" + f
 		log.Printf("Downloading %s/%s...", info.Name, f)
-		if err := downloadFile(url, dest); err != nil {
+		if _, err := downloadFile(info.FileURL(f), dest, fileMeta{}, info.Checksums[f]); err != nil {
 			return "", fmt.Errorf("download %s: %w", f, err)
 		}
 	}
@@ -76,34 +179,174 @@ func EnsureModel(cacheDir string, info ModelInfo) (string, error) {
 	return dir, nil
 }
 
-func downloadFile(url, dest string) error {
+// downloadFile downloads url to dest and records its validators in the
+// directory's metadata. With the validators of a previous download in
+// prev, it does nothing and returns false when the file hasn't changed.
+// The file is checked against the SHA-256 digest want or, when it's
+// empty, the one the server publishes for it, if any.
+func downloadFile(url, dest string, prev fileMeta, want string) (bool, error) {
 	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
-		return err
+		return false, err
 	}
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
-		return err
+		return false, err
+	}
+	if prev.URL == url {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return false, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
 	if resp.StatusCode != 200 {
-		return fmt.Errorf("HTTP %d for %s", resp.StatusCode, url)
+		return false, fmt.Errorf("HTTP %d for %s", resp.StatusCode, url)
 	}
 
 	tmp := dest + ".tmp"
 	f, err := os.Create(tmp)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	written, err := io.Copy(f, resp.Body)
+	h := sha256.New()
+	body := newProgressReader(resp.Body, filepath.Base(dest), resp.ContentLength)
+	written, err := io.Copy(io.MultiWriter(f, h), &limitedReader{r: body})
 	f.Close()
+	sum := hex.EncodeToString(h.Sum(nil))
+	if want == "" {
+		want = publishedDigest(resp)
+	}
+	if err == nil && want != "" && !strings.EqualFold(sum, want) {
+		err = fmt.Errorf("checksum mismatch for %s, expected sha256 %s", url, want)
+	}
 	if err != nil {
 		os.Remove(tmp)
-		return err
+		return false, err
 	}
 
 	log.Printf("  Downloaded %s (%.1f MB)", filepath.Base(dest), float64(written)/1024/1024)
-	return os.Rename(tmp, dest)
+	if err := os.Rename(tmp, dest); err != nil {
+		return false, err
+	}
+	meta := fileMeta{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		SHA256:       sum,
+	}
+	if err := saveFileMeta(filepath.Dir(dest), filepath.Base(dest), meta); err != nil {
+		return true, fmt.Errorf("save metadata: %w", err)
+	}
+	return true, nil
+}
+
+// publishedDigest returns the SHA-256 digest Hugging Face publishes for
+// a file stored with Git LFS, in the X-Linked-Etag header of the redirect
+// to its CDN, or "" when there's none.
+func publishedDigest(resp *http.Response) string {
+	for r := resp; r != nil; {
+		tag := strings.Trim(r.Header.Get("X-Linked-Etag"), `"`)
+		if len(tag) == sha256.Size*2 {
+			if _, err := hex.DecodeString(tag); err == nil {
+				return tag
+			}
+		}
+		if r.Request == nil {
+			break
+		}
+		r = r.Request.Response
+	}
+	return ""
+}
+
+// downloads throttles all model downloads together, so several models
+// loading at once share the limit.
+var downloads struct {
+	mu sync.Mutex
+	// rate is the limit in bytes per second, 0 for none.
+	rate int64
+	// next is when the bytes read so far are paid for at rate.
+	next time.Time
+}
+
+// SetDownloadLimit caps the combined speed of model downloads to
+// bytesPerSec, so lazy downloads don't saturate a shared connection.
+// 0 removes the limit.
+func SetDownloadLimit(bytesPerSec int64) {
+	downloads.mu.Lock()
+	defer downloads.mu.Unlock()
+	downloads.rate = bytesPerSec
+}
+
+// limitedReader reads at most the download limit per second.
+type limitedReader struct {
+	r io.Reader
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	downloads.mu.Lock()
+	rate := downloads.rate
+	downloads.mu.Unlock()
+	if rate == 0 {
+		return l.r.Read(p)
+	}
+
+	// Read at most a tenth of a second's worth at a time, to keep the
+	// rate smooth
+	p = p[:min(int64(len(p)), max(rate/10, 1))]
+	n, err := l.r.Read(p)
+
+	downloads.mu.Lock()
+	now := time.Now()
+	if downloads.next.Before(now) {
+		downloads.next = now
+	}
+	downloads.next = downloads.next.Add(time.Duration(n) * time.Second / time.Duration(rate))
+	wait := downloads.next.Sub(now)
+	downloads.mu.Unlock()
+	time.Sleep(wait)
+	return n, err
+}
+
+// progressInterval is how often progressReader logs.
+const progressInterval = 5 * time.Second
+
+// progressReader logs how much of a download is done, every
+// progressInterval, so long downloads don't look stuck.
+type progressReader struct {
+	r     io.Reader
+	name  string
+	total int64 // -1 when unknown
+	read  int64
+	last  time.Time
+}
+
+func newProgressReader(r io.Reader, name string, total int64) *progressReader {
+	return &progressReader{r: r, name: name, total: total, last: time.Now()}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.read += int64(n)
+	if time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		if p.total > 0 {
+			log.Printf("  %s: %d%% (%.1f/%.1f MB)", p.name, p.read*100/p.total, float64(p.read)/1024/1024, float64(p.total)/1024/1024)
+		} else {
+			log.Printf("  %s: %.1f MB", p.name, float64(p.read)/1024/1024)
+		}
+	}
+	return n, err
 }
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadFileChecksum(t *testing.T) {
+	body := []byte("model weights")
+	sum := sha256.Sum256(body)
+	good := hex.EncodeToString(sum[:])
+	bad := strings.Repeat("0", 64)
+
+	// Like Hugging Face: the LFS digest is on the redirect to the CDN
+	var linked string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/resolve/main/model.onnx", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Linked-Etag", `"`+linked+`"`)
+		http.Redirect(w, r, "/cdn/model.onnx", http.StatusFound)
+	})
+	mux.HandleFunc("/cdn/model.onnx", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	url := ts.URL + "/resolve/main/model.onnx"
+
+	tests := []struct {
+		name, pinned, linked string
+		wantErr              bool
+	}{
+		{"pinned", good, "", false},
+		{"pinned mismatch", bad, good, true},
+		{"published", "", good, false},
+		{"published mismatch", "", bad, true},
+		{"neither", "", "", false},
+	}
+	for _, tt := range tests {
+		dest := filepath.Join(t.TempDir(), "model.onnx")
+		linked = tt.linked
+		_, err := downloadFile(url, dest, fileMeta{}, tt.pinned)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: downloadFile() = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+		if _, serr := os.Stat(dest); (serr == nil) == tt.wantErr {
+			t.Errorf("%s: file kept %v, want %v", tt.name, serr == nil, !tt.wantErr)
+		}
+	}
+}
+
+func TestVerifyUnverified(t *testing.T) {
+	cache := t.TempDir()
+	info := ModelInfo{Name: "m", BaseURL: "http://127.0.0.1:1", Files: []string{"a.onnx"}}
+	dir := filepath.Join(cache, "models", "m")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "a.onnx"), []byte("maybe corrupt"), 0644)
+
+	for range 2 {
+		issues, err := Verify(cache, []ModelInfo{info}, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(issues) != 1 || issues[0].Problem != Unverified {
+			t.Fatalf("issues = %+v, want one unverified", issues)
+		}
+	}
+	if meta, _ := loadMeta(dir); meta["a.onnx"].SHA256 != "" {
+		t.Errorf("recorded the digest of an unverified file")
+	}
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+)
+
+// metaFile keeps the HTTP validators of the files downloaded to a model
+// directory, so updates only fetch the files that changed upstream.
+const metaFile = ".meta.json"
+
+// fileMeta identifies the upstream version of a downloaded file.
+type fileMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	// SHA256 is the digest of the file as downloaded.
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+func loadMeta(dir string) (map[string]fileMeta, error) {
+	meta := map[string]fileMeta{}
+	data, err := os.ReadFile(filepath.Join(dir, metaFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return meta, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", metaFile, err)
+	}
+	return meta, nil
+}
+
+func saveFileMeta(dir, file string, m fileMeta) error {
+	meta, err := loadMeta(dir)
+	if err != nil {
+		return err
+	}
+	meta[file] = m
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, metaFile), data, 0644)
+}
+
+// Update checks the files of a downloaded model upstream and downloads
+// those that changed since, or that are missing. Files of a model whose
+// Revision changed are always downloaded again. Models that were never
+// downloaded, or that have a local Path, are left alone. It returns the names of the files it
+// downloaded.
+func Update(cacheDir string, info ModelInfo) ([]string, error) {
+	dir := filepath.Join(cacheDir, "models", info.Name)
+	if info.Path != "" || !slices.ContainsFunc(info.Files, func(f string) bool {
+		_, err := os.Stat(filepath.Join(dir, f))
+		return err == nil
+	}) {
+		return nil, nil
+	}
+	unlock, err := lockModel(cacheDir, info)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	meta, err := loadMeta(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var updated []string
+	for _, f := range info.Files {
+		dest := filepath.Join(dir, f)
+		url := info.FileURL(f)
+		prev, ok := meta[f]
+		if _, err := os.Stat(dest); err != nil {
+			prev = fileMeta{}
+		} else if !ok {
+			// Downloaded before validators were kept: adopt the upstream
+			// ones if the file looks like the upstream one
+			if prev, err = adoptFile(url, dest); err != nil {
+				return updated, fmt.Errorf("check %s: %w", f, err)
+			}
+		}
+
+		changed, err := downloadFile(url, dest, prev, info.Checksums[f])
+		if err != nil {
+			return updated, fmt.Errorf("download %s: %w", f, err)
+		}
+		if changed {
+			updated = append(updated, f)
+		} else {
+			log.Printf("%s/%s is up to date", info.Name, f)
+		}
+	}
+	return updated, nil
+}
+
+// adoptFile records the validators of url for a local file without any,
+// when its size matches the upstream file. Otherwise it returns empty
+// validators, so the file is downloaded again.
+func adoptFile(url, dest string) (fileMeta, error) {
+	st, err := os.Stat(dest)
+	if err != nil {
+		return fileMeta{}, err
+	}
+	resp, err := http.Head(url)
+	if err != nil {
+		return fileMeta{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fileMeta{}, fmt.Errorf("HTTP %d for %s", resp.StatusCode, url)
+	}
+	if size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err != nil || size != st.Size() {
+		return fileMeta{}, nil
+	}
+	m := fileMeta{URL: url, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	if err := saveFileMeta(filepath.Dir(dest), filepath.Base(dest), m); err != nil {
+		return fileMeta{}, fmt.Errorf("save metadata: %w", err)
+	}
+	return m, nil
+}
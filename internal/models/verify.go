@@ -0,0 +1,174 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Problems found by Verify.
+const (
+	// Corrupt files don't match their checksum.
+	Corrupt = "corrupt"
+	// Missing files belong to a downloaded model but aren't there.
+	Missing = "missing"
+	// Orphaned files and directories don't belong to any model.
+	Orphaned = "orphaned"
+	// Unverified files have no known checksum, e.g. downloaded before
+	// digests were recorded. Repairing downloads them again, checked
+	// against the published digest when there is one, and records it.
+	Unverified = "unverified"
+)
+
+// Issue is a problem Verify found with a cached file.
+type Issue struct {
+	Path    string
+	Problem string
+	// Repaired is set when Verify fixed the problem.
+	Repaired bool
+	// Err is why repairing failed.
+	Err error
+}
+
+// Verify hashes the cached files of the given models and reports those
+// that are corrupt, missing, orphaned or unverified. Models sharing a
+// directory must be verified together, or the other's files count as
+// orphaned. With repair, corrupt, missing and unverified files are
+// downloaded again and orphaned ones removed. Models that were never downloaded, or that have a local Path,
+// are skipped.
+func Verify(cacheDir string, infos []ModelInfo, repair bool) ([]Issue, error) {
+	byDir := map[string][]ModelInfo{}
+	for _, info := range infos {
+		if info.Path == "" {
+			byDir[info.Name] = append(byDir[info.Name], info)
+		}
+	}
+
+	var issues []Issue
+	for _, name := range slices.Sorted(maps.Keys(byDir)) {
+		dirIssues, err := verifyDir(cacheDir, byDir[name], repair)
+		issues = append(issues, dirIssues...)
+		if err != nil {
+			return issues, err
+		}
+	}
+	return issues, nil
+}
+
+func verifyDir(cacheDir string, infos []ModelInfo, repair bool) ([]Issue, error) {
+	dir := filepath.Join(cacheDir, "models", infos[0].Name)
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	unlock, err := lockModel(cacheDir, infos[0])
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	meta, err := loadMeta(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []Issue
+	known := map[string]bool{metaFile: true}
+	for _, info := range infos {
+		for _, f := range info.Files {
+			known[f] = true
+			path := filepath.Join(dir, f)
+			want := info.Checksums[f]
+			if want == "" {
+				want = meta[f].SHA256
+			}
+
+			sum, err := hashFile(path)
+			var issue Issue
+			switch {
+			case errors.Is(err, fs.ErrNotExist):
+				issue = Issue{Path: path, Problem: Missing}
+			case err != nil:
+				return issues, err
+			case want == "":
+				// A file's current digest isn't a reference: it may already
+				// be corrupt
+				issue = Issue{Path: path, Problem: Unverified}
+			case !strings.EqualFold(sum, want):
+				issue = Issue{Path: path, Problem: Corrupt}
+			default:
+				continue
+			}
+
+			if repair {
+				os.Remove(path)
+				_, issue.Err = downloadFile(info.FileURL(f), path, fileMeta{}, info.Checksums[f])
+				issue.Repaired = issue.Err == nil
+			}
+			issues = append(issues, issue)
+		}
+	}
+
+	for _, e := range entries {
+		if known[e.Name()] {
+			continue
+		}
+		issue := Issue{Path: filepath.Join(dir, e.Name()), Problem: Orphaned}
+		if repair {
+			issue.Err = os.RemoveAll(issue.Path)
+			issue.Repaired = issue.Err == nil
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+// OrphanedDirs reports the directories in the cache's models/ that don't
+// belong to any of the given models, removing them with repair. Lock
+// files are left alone.
+func OrphanedDirs(cacheDir string, infos []ModelInfo, repair bool) ([]Issue, error) {
+	root := filepath.Join(cacheDir, "models")
+	entries, err := os.ReadDir(root)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var issues []Issue
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasSuffix(name, ".lock") || slices.ContainsFunc(infos, func(m ModelInfo) bool { return m.Name == name }) {
+			continue
+		}
+		issue := Issue{Path: filepath.Join(root, name), Problem: Orphaned}
+		if repair {
+			issue.Err = os.RemoveAll(issue.Path)
+			issue.Repaired = issue.Err == nil
+		}
+		issues = append(issues, issue)
+	}
+	return issues, nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,76 @@
+// Package mpris pauses and resumes desktop media players through the MPRIS
+// D-Bus interface, so background music doesn't end up in recordings.
+package mpris
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	busPrefix   = "org.mpris.MediaPlayer2."
+	objectPath  = "/org/mpris/MediaPlayer2"
+	playerIface = "org.mpris.MediaPlayer2.Player"
+)
+
+// Paused is the set of players paused by PausePlaying.
+type Paused struct {
+	conn    *dbus.Conn
+	players []string
+}
+
+// PausePlaying pauses every MPRIS player that is currently playing and
+// returns them so they can be resumed later. Players that are already
+// paused or stopped are left alone.
+func PausePlaying() (*Paused, error) {
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("connect session bus: %w", err)
+	}
+
+	var names []string
+	if err := conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("list bus names: %w", err)
+	}
+
+	p := &Paused{conn: conn}
+	for _, name := range names {
+		if !strings.HasPrefix(name, busPrefix) {
+			continue
+		}
+		obj := conn.Object(name, objectPath)
+		status, err := obj.GetProperty(playerIface + ".PlaybackStatus")
+		if err != nil || status.Value() != "Playing" {
+			continue
+		}
+		if err := obj.Call(playerIface+".Pause", 0).Err; err != nil {
+			continue
+		}
+		p.players = append(p.players, name)
+	}
+	return p, nil
+}
+
+// Players returns the bus names of the paused players, e.g.
+// "org.mpris.MediaPlayer2.spotify".
+func (p *Paused) Players() []string {
+	return p.players
+}
+
+// Resume starts the paused players again and closes the bus connection.
+func (p *Paused) Resume() error {
+	defer p.conn.Close()
+	var errs []string
+	for _, name := range p.players {
+		if err := p.conn.Object(name, objectPath).Call(playerIface+".Play", 0).Err; err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", strings.TrimPrefix(name, busPrefix), err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("resume: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
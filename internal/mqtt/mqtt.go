@@ -0,0 +1,297 @@
+// Package mqtt publishes messages to an MQTT 3.1.1 broker. It implements
+// only what a publisher needs: connecting (optionally over TLS and with a
+// username and password) and QoS 1 publishing, reconnecting when the
+// connection drops.
+package mqtt
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	packetConnect    = 0x10
+	packetConnack    = 0x20
+	packetPublish    = 0x30
+	packetPuback     = 0x40
+	packetDisconnect = 0xe0
+)
+
+// connackErrors are the CONNACK return codes.
+var connackErrors = map[byte]string{
+	1: "unacceptable protocol version",
+	2: "client identifier rejected",
+	3: "server unavailable",
+	4: "bad user name or password",
+	5: "not authorized",
+}
+
+// Publisher sends messages to a broker over a single connection, which is
+// opened on the first Publish. It's safe for concurrent use.
+type Publisher struct {
+	addr     string
+	tls      *tls.Config
+	username string
+	password string
+	clientID string
+	timeout  time.Duration
+
+	mu       sync.Mutex
+	conn     net.Conn
+	r        *bufio.Reader
+	packetID uint16
+}
+
+// Option configures a Publisher.
+type Option func(*Publisher)
+
+// WithTLSConfig sets the TLS configuration for mqtts:// brokers, e.g. to
+// trust a private CA.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(p *Publisher) { p.tls = cfg }
+}
+
+// WithClientID sets the client identifier (default: "lunartlk-" and a
+// random suffix).
+func WithClientID(id string) Option {
+	return func(p *Publisher) { p.clientID = id }
+}
+
+// WithTimeout sets how long to wait for the broker to answer (default: 10s).
+func WithTimeout(d time.Duration) Option {
+	return func(p *Publisher) { p.timeout = d }
+}
+
+// New creates a Publisher for a broker URL: mqtt://host[:1883] or, for
+// TLS, mqtts://host[:8883]. Credentials go in the URL's user info.
+func New(rawURL string, opts ...Option) (*Publisher, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("broker URL: %w", err)
+	}
+	p := &Publisher{timeout: 10 * time.Second}
+	port := "1883"
+	switch u.Scheme {
+	case "mqtt", "tcp":
+	case "mqtts", "ssl", "tls":
+		port = "8883"
+		p.tls = &tls.Config{}
+	default:
+		return nil, fmt.Errorf("broker URL: unsupported scheme %q, use mqtt:// or mqtts://", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("broker URL: missing host")
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	p.addr = net.JoinHostPort(u.Hostname(), port)
+	if u.User != nil {
+		p.username = u.User.Username()
+		p.password, _ = u.User.Password()
+	}
+
+	tlsURL := p.tls != nil
+	for _, opt := range opts {
+		opt(p)
+	}
+	if !tlsURL {
+		p.tls = nil
+	} else if p.tls.ServerName == "" {
+		p.tls = p.tls.Clone()
+		p.tls.ServerName = u.Hostname()
+	}
+	if p.clientID == "" {
+		b := make([]byte, 4)
+		rand.Read(b)
+		p.clientID = "lunartlk-" + hex.EncodeToString(b)
+	}
+	return p, nil
+}
+
+// Publish sends payload to topic with QoS 1 and waits for the broker's
+// acknowledgement. A failed attempt is retried once on a new connection,
+// since the broker may have dropped an idle one.
+func (p *Publisher) Publish(topic string, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if err = p.publish(topic, payload); err == nil {
+			return nil
+		}
+		p.closeConn()
+	}
+	return err
+}
+
+func (p *Publisher) publish(topic string, payload []byte) error {
+	if p.conn == nil {
+		if err := p.connect(); err != nil {
+			return err
+		}
+	}
+	p.packetID++
+	if p.packetID == 0 {
+		p.packetID = 1
+	}
+	body := appendString(nil, topic)
+	body = binary.BigEndian.AppendUint16(body, p.packetID)
+	body = append(body, payload...)
+
+	p.conn.SetDeadline(time.Now().Add(p.timeout))
+	if err := writePacket(p.conn, packetPublish|0x02, body); err != nil {
+		return fmt.Errorf("publish: %w", err)
+	}
+	for {
+		typ, ack, err := readPacket(p.r)
+		if err != nil {
+			return fmt.Errorf("publish: %w", err)
+		}
+		if typ&0xf0 == packetPuback && len(ack) == 2 && binary.BigEndian.Uint16(ack) == p.packetID {
+			return nil
+		}
+	}
+}
+
+func (p *Publisher) connect() error {
+	dialer := &net.Dialer{Timeout: p.timeout}
+	var conn net.Conn
+	var err error
+	if p.tls != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", p.addr, p.tls)
+	} else {
+		conn, err = dialer.Dial("tcp", p.addr)
+	}
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
+	}
+
+	flags := byte(0x02) // clean session
+	if p.username != "" {
+		flags |= 0x80
+	}
+	if p.password != "" {
+		flags |= 0x40
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, 4, flags) // protocol level 3.1.1
+	// No keep-alive: the connection sits idle between transcripts, and a
+	// dropped one is detected by the missing PUBACK
+	body = binary.BigEndian.AppendUint16(body, 0)
+	body = appendString(body, p.clientID)
+	if p.username != "" {
+		body = appendString(body, p.username)
+	}
+	if p.password != "" {
+		body = appendString(body, p.password)
+	}
+
+	conn.SetDeadline(time.Now().Add(p.timeout))
+	r := bufio.NewReader(conn)
+	if err := writePacket(conn, packetConnect, body); err != nil {
+		conn.Close()
+		return fmt.Errorf("connect: %w", err)
+	}
+	typ, ack, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("connect: %w", err)
+	}
+	if typ&0xf0 != packetConnack || len(ack) != 2 {
+		conn.Close()
+		return fmt.Errorf("connect: unexpected packet 0x%02x", typ)
+	}
+	if ack[1] != 0 {
+		conn.Close()
+		if msg, ok := connackErrors[ack[1]]; ok {
+			return fmt.Errorf("connect: %s", msg)
+		}
+		return fmt.Errorf("connect: refused with code %d", ack[1])
+	}
+	p.conn, p.r = conn, r
+	return nil
+}
+
+func (p *Publisher) closeConn() {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn, p.r = nil, nil
+	}
+}
+
+// Close disconnects from the broker.
+func (p *Publisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.conn == nil {
+		return nil
+	}
+	p.conn.SetDeadline(time.Now().Add(p.timeout))
+	err := writePacket(p.conn, packetDisconnect, nil)
+	p.closeConn()
+	return err
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func writePacket(w io.Writer, typ byte, body []byte) error {
+	buf := []byte{typ}
+	// Remaining length, 7 bits per byte
+	n := len(body)
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		buf = append(buf, b)
+		if n == 0 {
+			break
+		}
+	}
+	buf = append(buf, body...)
+	_, err := w.Write(buf)
+	return err
+}
+
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, mult := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("malformed remaining length")
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		n += int(b&0x7f) * mult
+		mult *= 128
+		if b&0x80 == 0 {
+			break
+		}
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return typ, body, nil
+}
@@ -0,0 +1,191 @@
+package notes
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// defaultJoplinURL is where Joplin's Web Clipper service listens.
+const defaultJoplinURL = "http://localhost:41184"
+
+func (t Target) joplinURL() string {
+	if t.URL == "" {
+		return defaultJoplinURL
+	}
+	return strings.TrimSuffix(t.URL, "/")
+}
+
+// exportJoplin creates a note through Joplin's Data API.
+func (t Target) exportJoplin(ctx context.Context, hc *http.Client, n Note) error {
+	note := map[string]any{
+		"title":             n.Title,
+		"body":              n.Body,
+		"user_created_time": n.Created.UnixMilli(),
+	}
+	if t.Notebook != "" {
+		note["parent_id"] = t.Notebook
+	}
+	return postJSON(ctx, hc, t.joplinURL()+"/notes?token="+url.QueryEscape(t.Token), nil, note)
+}
+
+// notionVersion is the Notion API version the requests are written for.
+const notionVersion = "2022-06-28"
+
+// notionTextMax is the most characters a Notion rich text object takes.
+const notionTextMax = 2000
+
+// exportNotion adds a page with the transcript to a Notion database.
+func (t Target) exportNotion(ctx context.Context, hc *http.Client, n Note) error {
+	titleProp := t.TitleProperty
+	if titleProp == "" {
+		titleProp = "Name"
+	}
+	var blocks []any
+	for _, para := range strings.Split(n.Text, "\n") {
+		for _, chunk := range splitRunes(strings.TrimSpace(para), notionTextMax) {
+			blocks = append(blocks, map[string]any{
+				"object": "block",
+				"type":   "paragraph",
+				"paragraph": map[string]any{
+					"rich_text": []any{notionText(chunk)},
+				},
+			})
+		}
+	}
+	// A page is created with at most 100 blocks
+	if len(blocks) > 100 {
+		blocks = blocks[:100]
+	}
+	page := map[string]any{
+		"parent": map[string]any{"database_id": t.Database},
+		"properties": map[string]any{
+			titleProp: map[string]any{"title": []any{notionText(n.Title)}},
+		},
+		"children": blocks,
+	}
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+t.Token)
+	header.Set("Notion-Version", notionVersion)
+	return postJSON(ctx, hc, "https://api.notion.com/v1/pages", header, page)
+}
+
+func notionText(s string) map[string]any {
+	return map[string]any{"type": "text", "text": map[string]any{"content": s}}
+}
+
+// splitRunes cuts s in pieces of at most n characters, none for "".
+func splitRunes(s string, n int) []string {
+	var parts []string
+	for s != "" {
+		i, count := 0, 0
+		for i < len(s) && count < n {
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+			count++
+		}
+		parts = append(parts, s[:i])
+		s = s[i:]
+	}
+	return parts
+}
+
+// exportCalDAV adds a journal entry (VJOURNAL) to a CalDAV calendar.
+func (t Target) exportCalDAV(ctx context.Context, hc *http.Client, n Note) error {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return err
+	}
+	uid := hex.EncodeToString(b[:])
+	req, err := http.NewRequestWithContext(ctx, "PUT", strings.TrimSuffix(t.URL, "/")+"/"+uid+".ics",
+		strings.NewReader(vjournal(uid, n)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+	// Never overwrite an entry
+	req.Header.Set("If-None-Match", "*")
+	if t.Username != "" {
+		req.SetBasicAuth(t.Username, t.Password)
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return check(resp)
+}
+
+// vjournal renders n as an iCalendar journal entry dated the day it was
+// created.
+func vjournal(uid string, n Note) string {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//lunartlk//lunartlk//EN",
+		"BEGIN:VJOURNAL",
+		"UID:" + uid,
+		"DTSTAMP:" + n.Created.UTC().Format("20060102T150405Z"),
+		"DTSTART;VALUE=DATE:" + n.Created.Format("20060102"),
+		"SUMMARY:" + icalEscape(n.Title),
+		"DESCRIPTION:" + icalEscape(n.Text),
+		"END:VJOURNAL",
+		"END:VCALENDAR",
+	}
+	var sb strings.Builder
+	for _, l := range lines {
+		sb.WriteString(icalFold(l))
+		sb.WriteString("\r\n")
+	}
+	return sb.String()
+}
+
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+func icalEscape(s string) string {
+	return icalEscaper.Replace(s)
+}
+
+// icalFold folds a content line longer than 75 octets, continuing it on
+// lines starting with a space, without splitting characters.
+func icalFold(line string) string {
+	var sb strings.Builder
+	width := 0
+	for _, r := range line {
+		size := utf8.RuneLen(r)
+		if width+size > 75 {
+			sb.WriteString("\r\n ")
+			width = 1
+		}
+		sb.WriteRune(r)
+		width += size
+	}
+	return sb.String()
+}
+
+func postJSON(ctx context.Context, hc *http.Client, endpoint string, header http.Header, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := hc.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return check(resp)
+}
@@ -0,0 +1,151 @@
+// Package notes exports transcripts to note-taking apps: Joplin, Notion
+// and CalDAV journals.
+package notes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// Note is a transcript as exported.
+type Note struct {
+	Title string
+	// Body is Markdown, for the apps that render it.
+	Body string
+	// Text is the plain transcript.
+	Text    string
+	Created time.Time
+}
+
+// Target is where a profile's notes go. Type selects the app, and the
+// other fields it uses.
+type Target struct {
+	// Type is joplin, notion or caldav.
+	Type string `json:"type"`
+	// URL is Joplin's Web Clipper service (http://localhost:41184 by
+	// default) or the CalDAV calendar collection to add journal entries
+	// to. Notion's API has a fixed URL.
+	URL string `json:"url,omitempty"`
+	// Token is Joplin's authorization token or the Notion integration
+	// secret.
+	Token string `json:"token,omitempty"`
+	// Notebook is the ID of the Joplin notebook notes are created in; the
+	// default notebook if empty.
+	Notebook string `json:"notebook,omitempty"`
+	// Database is the ID of the Notion database pages are added to, and
+	// TitleProperty the name of its title column ("Name" if empty).
+	Database      string `json:"database,omitempty"`
+	TitleProperty string `json:"title_property,omitempty"`
+	// Username and Password authenticate to the CalDAV server.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Profiles are named lists of targets. A transcript exported with a
+// profile is sent to each of its targets.
+type Profiles map[string][]Target
+
+// Load reads profiles from a JSON file: an object of profile names to
+// arrays of targets.
+func Load(path string) (Profiles, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Profiles
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	for name, targets := range p {
+		for i, t := range targets {
+			if err := t.validate(); err != nil {
+				return nil, fmt.Errorf("%s: profile %q, target %d: %w", path, name, i+1, err)
+			}
+		}
+	}
+	return p, nil
+}
+
+func (t Target) validate() error {
+	switch t.Type {
+	case "joplin":
+		if t.Token == "" {
+			return fmt.Errorf("joplin needs the token of its Web Clipper service")
+		}
+	case "notion":
+		if t.Token == "" || t.Database == "" {
+			return fmt.Errorf("notion needs an integration token and a database")
+		}
+	case "caldav":
+		if t.URL == "" {
+			return fmt.Errorf("caldav needs the URL of a calendar collection")
+		}
+	default:
+		return fmt.Errorf("unknown type %q, use joplin, notion or caldav", t.Type)
+	}
+	return nil
+}
+
+// String names the target in logs, without its credentials.
+func (t Target) String() string {
+	switch t.Type {
+	case "notion":
+		return "notion database " + t.Database
+	case "joplin":
+		return "joplin " + t.joplinURL()
+	}
+	return t.Type + " " + t.URL
+}
+
+// Export creates n in the target's app.
+func (t Target) Export(ctx context.Context, hc *http.Client, n Note) error {
+	switch t.Type {
+	case "joplin":
+		return t.exportJoplin(ctx, hc, n)
+	case "notion":
+		return t.exportNotion(ctx, hc, n)
+	case "caldav":
+		return t.exportCalDAV(ctx, hc, n)
+	}
+	return fmt.Errorf("unknown type %q", t.Type)
+}
+
+// StatusError is a response from an app that isn't a success.
+type StatusError struct {
+	Status string
+	Code   int
+	Body   string
+}
+
+func (e *StatusError) Error() string {
+	return e.Status + ": " + e.Body
+}
+
+// Retryable reports whether an Export that failed with err is worth
+// retrying: network errors and 5xx responses. Apps may have created the
+// note before answering with another error, and retrying would add it
+// twice.
+func Retryable(err error) bool {
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code >= 500
+	}
+	var ue *url.Error
+	return errors.As(err, &ue)
+}
+
+// check returns an error for a response that isn't a success.
+func check(resp *http.Response) error {
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+	var b [512]byte
+	n, _ := resp.Body.Read(b[:])
+	return &StatusError{Status: resp.Status, Code: resp.StatusCode, Body: string(b[:n])}
+}
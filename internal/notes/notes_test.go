@@ -0,0 +1,37 @@
+package notes
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		status int
+		want   bool
+	}{
+		{http.StatusBadRequest, false},
+		{http.StatusConflict, false},
+		{http.StatusInternalServerError, true},
+		{http.StatusServiceUnavailable, true},
+	}
+	for _, tt := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		}))
+		err := Target{Type: "joplin", URL: ts.URL, Token: "t"}.Export(context.Background(), ts.Client(), Note{Title: "t"})
+		ts.Close()
+		if err == nil || Retryable(err) != tt.want {
+			t.Errorf("HTTP %d: Retryable(%v) = %v, want %v", tt.status, err, !tt.want, tt.want)
+		}
+	}
+
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	err := Target{Type: "joplin", URL: ts.URL, Token: "t"}.Export(context.Background(), http.DefaultClient, Note{Title: "t"})
+	if err == nil || !Retryable(err) {
+		t.Errorf("network error: Retryable(%v) = false", err)
+	}
+}
@@ -0,0 +1,171 @@
+// Package obs drives OBS Studio through obs-websocket (protocol v5, built
+// into OBS 28 and later).
+package obs
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	opHello           = 0
+	opIdentify        = 1
+	opIdentified      = 2
+	opRequest         = 6
+	opRequestResponse = 7
+)
+
+// Client is a connection to obs-websocket. It's safe for concurrent use.
+type Client struct {
+	mu     sync.Mutex
+	conn   *websocket.Conn
+	nextID int
+}
+
+type message struct {
+	Op int             `json:"op"`
+	D  json.RawMessage `json:"d"`
+}
+
+type hello struct {
+	Authentication *struct {
+		Challenge string `json:"challenge"`
+		Salt      string `json:"salt"`
+	} `json:"authentication"`
+}
+
+type requestStatus struct {
+	Result  bool   `json:"result"`
+	Code    int    `json:"code"`
+	Comment string `json:"comment"`
+}
+
+// Dial connects to obs-websocket at url (e.g. ws://localhost:4455) and
+// identifies, authenticating with password if the server requires it.
+func Dial(url, password string) (*Client, error) {
+	dialer := websocket.Dialer{HandshakeTimeout: 10 * time.Second}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("obs: %w", err)
+	}
+	c := &Client{conn: conn}
+	if err := c.identify(password); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("obs: %w", err)
+	}
+	return c, nil
+}
+
+func (c *Client) identify(password string) error {
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer c.conn.SetReadDeadline(time.Time{})
+
+	var m message
+	if err := c.conn.ReadJSON(&m); err != nil {
+		return err
+	}
+	if m.Op != opHello {
+		return fmt.Errorf("expected Hello, got op %d", m.Op)
+	}
+	var h hello
+	if err := json.Unmarshal(m.D, &h); err != nil {
+		return err
+	}
+
+	identify := map[string]any{"rpcVersion": 1, "eventSubscriptions": 0}
+	if h.Authentication != nil {
+		if password == "" {
+			return fmt.Errorf("server requires a password")
+		}
+		identify["authentication"] = authResponse(password, h.Authentication.Salt, h.Authentication.Challenge)
+	}
+	if err := c.send(opIdentify, identify); err != nil {
+		return err
+	}
+	if err := c.conn.ReadJSON(&m); err != nil {
+		// OBS closes the connection on failed authentication
+		return fmt.Errorf("identify: %w", err)
+	}
+	if m.Op != opIdentified {
+		return fmt.Errorf("expected Identified, got op %d", m.Op)
+	}
+	return nil
+}
+
+// authResponse computes the obs-websocket authentication string.
+func authResponse(password, salt, challenge string) string {
+	secret := sha256.Sum256([]byte(password + salt))
+	auth := sha256.Sum256([]byte(base64.StdEncoding.EncodeToString(secret[:]) + challenge))
+	return base64.StdEncoding.EncodeToString(auth[:])
+}
+
+func (c *Client) send(op int, d any) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return c.conn.WriteJSON(message{Op: op, D: data})
+}
+
+// Request sends a request and waits for its response.
+func (c *Client) Request(requestType string, data any) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.nextID++
+	id := strconv.Itoa(c.nextID)
+	err := c.send(opRequest, map[string]any{
+		"requestType": requestType,
+		"requestId":   id,
+		"requestData": data,
+	})
+	if err != nil {
+		return fmt.Errorf("obs %s: %w", requestType, err)
+	}
+
+	c.conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	defer c.conn.SetReadDeadline(time.Time{})
+	for {
+		var m message
+		if err := c.conn.ReadJSON(&m); err != nil {
+			return fmt.Errorf("obs %s: %w", requestType, err)
+		}
+		if m.Op != opRequestResponse {
+			continue
+		}
+		var resp struct {
+			RequestID     string        `json:"requestId"`
+			RequestStatus requestStatus `json:"requestStatus"`
+		}
+		if err := json.Unmarshal(m.D, &resp); err != nil {
+			return fmt.Errorf("obs %s: %w", requestType, err)
+		}
+		if resp.RequestID != id {
+			continue
+		}
+		if !resp.RequestStatus.Result {
+			return fmt.Errorf("obs %s: %s (code %d)", requestType, resp.RequestStatus.Comment, resp.RequestStatus.Code)
+		}
+		return nil
+	}
+}
+
+// SetText sets the text of a text source (Text GDI+ or FreeType 2).
+func (c *Client) SetText(input, text string) error {
+	return c.Request("SetInputSettings", map[string]any{
+		"inputName":     input,
+		"inputSettings": map[string]string{"text": text},
+	})
+}
+
+// Close closes the connection.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -2,10 +2,14 @@ package parakeet
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"math"
 	"os"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	ort "github.com/yalue/onnxruntime_go"
 )
@@ -18,22 +22,69 @@ type Model struct {
 	joiner       *ort.DynamicAdvancedSession
 	vocab        []string
 	blankIdx     int
+	maxSymbols   int
+}
+
+// DefaultMaxSymbols is how many tokens the decoder emits at most at an
+// encoder frame before moving on to the next one.
+const DefaultMaxSymbols = 10
+
+// Option configures how a model is loaded.
+type Option func(*loadConfig)
+
+type loadConfig struct {
+	threads    int
+	maxSymbols int
+}
+
+// WithThreads limits each ONNX Runtime session to n threads, instead of
+// one per core. Fewer threads are slower but need less memory.
+func WithThreads(n int) Option {
+	return func(c *loadConfig) { c.threads = n }
+}
+
+// WithMaxSymbols limits the tokens the decoder emits at an encoder frame
+// to n (DefaultMaxSymbols if 0). The TDT decoder stays on a frame while it
+// predicts tokens lasting 0 frames; the limit keeps pathological input
+// from holding it there.
+func WithMaxSymbols(n int) Option {
+	return func(c *loadConfig) { c.maxSymbols = n }
 }
 
 // LoadModel loads the Parakeet v3 model in sherpa-onnx format.
-func LoadModel(dir string, ortLibPath string) (*Model, error) {
-	ort.SetSharedLibraryPath(ortLibPath)
-	if err := ort.InitializeEnvironment(); err != nil {
-		return nil, fmt.Errorf("init onnxruntime: %w", err)
+func LoadModel(dir string, ortLibPath string, opts ...Option) (*Model, error) {
+	var cfg loadConfig
+	for _, opt := range opts {
+		opt(&cfg)
 	}
 
-	m := &Model{}
+	// The environment outlives models, which can be closed and loaded again
+	if !ort.IsInitialized() {
+		ort.SetSharedLibraryPath(ortLibPath)
+		if err := ort.InitializeEnvironment(); err != nil {
+			return nil, fmt.Errorf("init onnxruntime: %w", err)
+		}
+	}
+
+	m := &Model{maxSymbols: cfg.maxSymbols}
+	if m.maxSymbols <= 0 {
+		m.maxSymbols = DefaultMaxSymbols
+	}
 	var err error
 
+	// nil options leave ONNX Runtime's defaults
+	var so *ort.SessionOptions
+	if cfg.threads > 0 {
+		if so, err = sessionOptions(cfg.threads); err != nil {
+			return nil, err
+		}
+		defer so.Destroy()
+	}
+
 	if _, e := os.Stat(dir + "/nemo128.onnx"); e == nil {
 		m.preprocessor, err = ort.NewDynamicAdvancedSession(dir+"/nemo128.onnx",
 			[]string{"waveforms", "waveforms_lens"},
-			[]string{"features", "features_lens"}, nil)
+			[]string{"features", "features_lens"}, so)
 		if err != nil {
 			return nil, fmt.Errorf("load preprocessor: %w", err)
 		}
@@ -41,21 +92,21 @@ func LoadModel(dir string, ortLibPath string) (*Model, error) {
 
 	m.encoder, err = ort.NewDynamicAdvancedSession(dir+"/encoder.int8.onnx",
 		[]string{"audio_signal", "length"},
-		[]string{"outputs", "encoded_lengths"}, nil)
+		[]string{"outputs", "encoded_lengths"}, so)
 	if err != nil {
 		return nil, fmt.Errorf("load encoder: %w", err)
 	}
 
 	m.decoder, err = ort.NewDynamicAdvancedSession(dir+"/decoder.int8.onnx",
 		[]string{"targets", "target_length", "states.1", "onnx::Slice_3"},
-		[]string{"outputs", "prednet_lengths", "states", "162"}, nil)
+		[]string{"outputs", "prednet_lengths", "states", "162"}, so)
 	if err != nil {
 		return nil, fmt.Errorf("load decoder: %w", err)
 	}
 
 	m.joiner, err = ort.NewDynamicAdvancedSession(dir+"/joiner.int8.onnx",
 		[]string{"encoder_outputs", "decoder_outputs"},
-		[]string{"outputs"}, nil)
+		[]string{"outputs"}, so)
 	if err != nil {
 		return nil, fmt.Errorf("load joiner: %w", err)
 	}
@@ -76,11 +127,72 @@ func LoadModel(dir string, ortLibPath string) (*Model, error) {
 	return m, nil
 }
 
+func sessionOptions(threads int) (*ort.SessionOptions, error) {
+	so, err := ort.NewSessionOptions()
+	if err != nil {
+		return nil, fmt.Errorf("session options: %w", err)
+	}
+	if err := so.SetIntraOpNumThreads(threads); err != nil {
+		so.Destroy()
+		return nil, fmt.Errorf("session options: %w", err)
+	}
+	if err := so.SetInterOpNumThreads(threads); err != nil {
+		so.Destroy()
+		return nil, fmt.Errorf("session options: %w", err)
+	}
+	return so, nil
+}
+
+// Close releases the ONNX Runtime sessions. The model can't be used
+// afterwards.
+func (m *Model) Close() {
+	for _, s := range []*ort.DynamicAdvancedSession{m.preprocessor, m.encoder, m.decoder, m.joiner} {
+		if s != nil {
+			s.Destroy()
+		}
+	}
+}
+
 // Transcribe takes float32 PCM audio at 16kHz and returns the transcript.
-func (m *Model) Transcribe(samples []float32) (string, error) {
+// Decoding stops early with ctx.Err() if ctx is cancelled.
+func (m *Model) Transcribe(ctx context.Context, samples []float32) (string, error) {
+	text, _, err := m.TranscribeTimed(ctx, samples)
+	return text, err
+}
+
+// Timings is how long each stage of a transcription took.
+type Timings struct {
+	// Preprocess covers feature extraction and normalization.
+	Preprocess time.Duration
+	Encoder    time.Duration
+	// Search is the greedy TDT decoding over the encoder output.
+	Search time.Duration
+	// Stats describe what the decoder did.
+	Stats DecodeStats
+}
+
+// TranscribeTimed is like Transcribe but also returns the time spent in
+// each stage.
+func (m *Model) TranscribeTimed(ctx context.Context, samples []float32) (string, Timings, error) {
+	var tm Timings
+	emitted, err := m.decode(ctx, samples, &tm)
+	if err != nil {
+		return "", tm, err
+	}
+	tokens := make([]int, len(emitted))
+	for i, e := range emitted {
+		tokens[i] = e.token
+	}
+	return tokensToText(m.vocab, tokens), tm, nil
+}
+
+// decode runs the encoder and the greedy TDT decoder over samples,
+// recording the time spent in each stage in tm.
+func (m *Model) decode(ctx context.Context, samples []float32, tm *Timings) ([]emission, error) {
 	var encOut ort.Value
 	var encodedLen int64
 
+	start := time.Now()
 	if m.preprocessor != nil {
 		audioLen := int64(len(samples))
 		wf, _ := ort.NewTensor(ort.NewShape(1, audioLen), samples)
@@ -90,7 +202,7 @@ func (m *Model) Transcribe(samples []float32) (string, error) {
 
 		prepOut := []ort.Value{nil, nil}
 		if err := m.preprocessor.Run([]ort.Value{wf, wl}, prepOut); err != nil {
-			return "", fmt.Errorf("preprocessor: %w", err)
+			return nil, fmt.Errorf("preprocessor: %w", err)
 		}
 		defer prepOut[0].Destroy()
 		defer prepOut[1].Destroy()
@@ -107,35 +219,52 @@ func (m *Model) Transcribe(samples []float32) (string, error) {
 		// Re-create tensor with normalized data
 		normFeat, _ := ort.NewTensor(ort.NewShape(featShape...), featData)
 		defer normFeat.Destroy()
+		tm.Preprocess = time.Since(start)
+		start = time.Now()
 
 		el, _ := ort.NewTensor(ort.NewShape(1), []int64{featLen})
 		defer el.Destroy()
 
 		eOut := []ort.Value{nil, nil}
 		if err := m.encoder.Run([]ort.Value{normFeat, el}, eOut); err != nil {
-			return "", fmt.Errorf("encoder: %w", err)
+			return nil, fmt.Errorf("encoder: %w", err)
 		}
 		defer eOut[1].Destroy()
 		encOut = eOut[0]
 		encodedLen = getInt64(eOut[1])[0]
+		tm.Encoder = time.Since(start)
 	}
 	defer encOut.Destroy()
 
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	encShape := encOut.GetShape()
 	encData := getFloat32(encOut)
 
-	tokens, err := m.decodeTDT(encData, encShape, int(encodedLen))
+	start = time.Now()
+	emitted, err := m.decodeTDT(ctx, encData, encShape, int(encodedLen), &tm.Stats)
 	if err != nil {
-		return "", fmt.Errorf("decode: %w", err)
+		return nil, fmt.Errorf("decode: %w", err)
 	}
+	tm.Search = time.Since(start)
+	return emitted, nil
+}
 
-	return tokensToText(m.vocab, tokens), nil
+// emission is a token emitted by the TDT decoder at an encoder frame, with
+// the number of frames the model predicted it lasts.
+type emission struct {
+	token    int
+	frame    int
+	duration int
 }
 
-func (m *Model) decodeTDT(encData []float32, encShape []int64, encodedLen int) ([]int, error) {
+func (m *Model) decodeTDT(ctx context.Context, encData []float32, encShape []int64, encodedLen int, stats *DecodeStats) ([]emission, error) {
 	vocabSize := len(m.vocab)
 
-	var tokens []int
+	var tokens []emission
+	stats.Frames = encodedLen
 
 	states1 := make([]float32, 2*1*640)
 	states2 := make([]float32, 2*1*640)
@@ -148,18 +277,37 @@ func (m *Model) decodeTDT(encData []float32, encShape []int64, encodedLen int) (
 	copy(states1, newS1)
 	copy(states2, newS2)
 
+	// The joiner reads the encoder frame [1, 1024, 1] from a single buffer
+	// refilled at every step, rather than a tensor allocated per frame.
+	hidden, stride := encShape[1], encShape[2]
+	frame := make([]float32, hidden)
+	encFrame, err := ort.NewTensor(ort.NewShape(1, hidden, 1), frame)
+	if err != nil {
+		return nil, fmt.Errorf("encoder frame: %w", err)
+	}
+	defer encFrame.Destroy()
+
 	t := 0
+	// symbols is how many tokens were emitted at frame t, and last the
+	// last of them.
+	symbols, last := 0, -1
+	var probSum float64
 	for t < encodedLen {
-		// Extract encoder frame [1, 1024, 1]
-		frameData := make([]float32, encShape[1])
-		for h := int64(0); h < encShape[1]; h++ {
-			frameData[h] = encData[h*encShape[2]+int64(t)]
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
 
-		logits, err := m.runJoiner(frameData, encShape[1], decOut)
+		if symbols == 0 {
+			for h := range frame {
+				frame[h] = encData[int64(h)*stride+int64(t)]
+			}
+		}
+
+		logits, err := m.runJoiner(encFrame, decOut)
 		if err != nil {
 			return nil, fmt.Errorf("joiner t=%d: %w", t, err)
 		}
+		stats.Steps++
 
 		// TDT: separate argmax for token and duration
 		bestToken := 0
@@ -180,23 +328,50 @@ func (m *Model) decodeTDT(encData []float32, encShape []int64, encodedLen int) (
 				skip = i - vocabSize
 			}
 		}
-		if skip == 0 {
-			skip = 1
+		stats.addSkip(skip)
+
+		if bestToken == m.blankIdx {
+			// A blank lasting 0 frames would never leave the frame
+			t += max(skip, 1)
+			symbols, last = 0, -1
+			continue
 		}
 
-		if bestToken != m.blankIdx {
-			tokens = append(tokens, bestToken)
-			copy(states1, newS1)
-			copy(states2, newS2)
-			decOut, newS1, newS2, err = m.runDecoder([]int32{int32(bestToken)}, states1, states2)
-			if err != nil {
-				return nil, fmt.Errorf("decoder t=%d: %w", t, err)
-			}
+		// The same token twice at a frame is the decoder going round in
+		// circles, not speech: keep the first and move on.
+		if bestToken == last {
+			stats.Loops++
+			t++
+			symbols, last = 0, -1
+			continue
+		}
+		tokens = append(tokens, emission{token: bestToken, frame: t, duration: skip})
+		stats.Emitted++
+		probSum += tokenProb(logits[:vocabSize], bestToken)
+		copy(states1, newS1)
+		copy(states2, newS2)
+		decOut, newS1, newS2, err = m.runDecoder([]int32{int32(bestToken)}, states1, states2)
+		if err != nil {
+			return nil, fmt.Errorf("decoder t=%d: %w", t, err)
 		}
 
-		t += skip
+		switch {
+		case skip > 0:
+			t += skip
+			symbols, last = 0, -1
+		case symbols+1 >= m.maxSymbols:
+			stats.MaxSymbolsHits++
+			t++
+			symbols, last = 0, -1
+		default:
+			symbols++
+			last = bestToken
+		}
 	}
 
+	if stats.Emitted > 0 {
+		stats.Confidence = probSum / float64(stats.Emitted)
+	}
 	return tokens, nil
 }
 
@@ -227,9 +402,7 @@ func (m *Model) runDecoder(targets []int32, s1, s2 []float32) ([]float32, []floa
 	return out, ns1, ns2, nil
 }
 
-func (m *Model) runJoiner(encFrame []float32, hiddenDim int64, decOut []float32) ([]float32, error) {
-	ef, _ := ort.NewTensor(ort.NewShape(1, hiddenDim, 1), encFrame)
-	defer ef.Destroy()
+func (m *Model) runJoiner(ef ort.Value, decOut []float32) ([]float32, error) {
 	df, _ := ort.NewTensor(ort.NewShape(1, 640, 1), decOut)
 	defer df.Destroy()
 
@@ -298,28 +471,43 @@ func copyF32(src []float32) []float32 {
 	return dst
 }
 
-// normalizeFeatures applies per-feature mean/stddev normalization.
+// normalizeFeatures applies per-feature mean/stddev normalization, with
+// the features split across CPUs.
 // Features layout: [1, numFeats, numFrames] stored row-major.
 func normalizeFeatures(data []float32, numFeats, numFrames int64) {
-	for f := int64(0); f < numFeats; f++ {
-		// Compute mean
-		var sum float64
-		for t := int64(0); t < numFrames; t++ {
-			sum += float64(data[f*numFrames+t])
-		}
-		mean := sum / float64(numFrames)
+	workers := min(int64(runtime.GOMAXPROCS(0)), numFeats)
+	var wg sync.WaitGroup
+	for w := int64(0); w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := w; f < numFeats; f += workers {
+				normalizeRow(data[f*numFrames : (f+1)*numFrames])
+			}
+		}()
+	}
+	wg.Wait()
+}
 
-		// Compute stddev
-		var sqSum float64
-		for t := int64(0); t < numFrames; t++ {
-			d := float64(data[f*numFrames+t]) - mean
-			sqSum += d * d
-		}
-		stddev := math.Sqrt(sqSum/float64(numFrames)) + 1e-5
+// normalizeRow normalizes the frames of a single feature.
+func normalizeRow(row []float32) {
+	// Compute mean
+	var sum float64
+	for _, v := range row {
+		sum += float64(v)
+	}
+	mean := sum / float64(len(row))
 
-		// Normalize
-		for t := int64(0); t < numFrames; t++ {
-			data[f*numFrames+t] = float32((float64(data[f*numFrames+t]) - mean) / stddev)
-		}
+	// Compute stddev
+	var sqSum float64
+	for _, v := range row {
+		d := float64(v) - mean
+		sqSum += d * d
+	}
+	stddev := math.Sqrt(sqSum/float64(len(row))) + 1e-5
+
+	// Normalize
+	for i, v := range row {
+		row[i] = float32((float64(v) - mean) / stddev)
 	}
 }
@@ -0,0 +1,127 @@
+package parakeet
+
+import (
+	"math"
+	"math/rand/v2"
+	"os"
+	"testing"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// 30s of 128 mel features at 100 frames a second, and the encoder output
+// for them: 1024 hidden units over 375 frames.
+const (
+	benchFeats, benchFrames = 128, 3000
+	benchHidden, benchSteps = 1024, 375
+)
+
+func randomFeatures() []float32 {
+	r := rand.New(rand.NewPCG(1, 2))
+	data := make([]float32, benchFeats*benchFrames)
+	for i := range data {
+		data[i] = r.Float32()*20 - 10
+	}
+	return data
+}
+
+// normalizeSerial is normalizeFeatures on a single goroutine.
+func normalizeSerial(data []float32, numFeats, numFrames int64) {
+	for f := range numFeats {
+		normalizeRow(data[f*numFrames : (f+1)*numFrames])
+	}
+}
+
+func TestNormalizeFeatures(t *testing.T) {
+	data := randomFeatures()
+	want := append([]float32(nil), data...)
+	normalizeFeatures(data, benchFeats, benchFrames)
+	normalizeSerial(want, benchFeats, benchFrames)
+	for i := range data {
+		if data[i] != want[i] {
+			t.Fatalf("data[%d] = %v, want %v", i, data[i], want[i])
+		}
+	}
+
+	row := data[:benchFrames]
+	var sum, sqSum float64
+	for _, v := range row {
+		sum += float64(v)
+		sqSum += float64(v) * float64(v)
+	}
+	mean := sum / benchFrames
+	if math.Abs(mean) > 1e-4 {
+		t.Errorf("mean = %v, want 0", mean)
+	}
+	if stddev := math.Sqrt(sqSum/benchFrames - mean*mean); math.Abs(stddev-1) > 1e-3 {
+		t.Errorf("stddev = %v, want 1", stddev)
+	}
+}
+
+func BenchmarkNormalizeFeatures(b *testing.B) {
+	src := randomFeatures()
+	data := make([]float32, len(src))
+	for _, bm := range []struct {
+		name string
+		fn   func([]float32, int64, int64)
+	}{
+		{"serial", normalizeSerial},
+		{"parallel", normalizeFeatures},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for b.Loop() {
+				copy(data, src)
+				bm.fn(data, benchFeats, benchFrames)
+			}
+		})
+	}
+}
+
+// BenchmarkJoinerFrame compares building the joiner's encoder frame in a
+// new tensor at every step with refilling a single one, as decodeTDT does.
+// It needs ONNX Runtime, set LUNARTLK_ORT to libonnxruntime.so.1.
+func BenchmarkJoinerFrame(b *testing.B) {
+	lib := os.Getenv("LUNARTLK_ORT")
+	if lib == "" {
+		b.Skip("LUNARTLK_ORT isn't set")
+	}
+	if !ort.IsInitialized() {
+		ort.SetSharedLibraryPath(lib)
+		if err := ort.InitializeEnvironment(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	encData := make([]float32, benchHidden*benchSteps)
+	shape := ort.NewShape(1, benchHidden, 1)
+
+	b.Run("alloc", func(b *testing.B) {
+		for b.Loop() {
+			for t := range benchSteps {
+				frame := make([]float32, benchHidden)
+				for h := range frame {
+					frame[h] = encData[h*benchSteps+t]
+				}
+				ef, err := ort.NewTensor(shape, frame)
+				if err != nil {
+					b.Fatal(err)
+				}
+				ef.Destroy()
+			}
+		}
+	})
+	b.Run("reuse", func(b *testing.B) {
+		frame := make([]float32, benchHidden)
+		ef, err := ort.NewTensor(shape, frame)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer ef.Destroy()
+		for b.Loop() {
+			for t := range benchSteps {
+				for h := range frame {
+					frame[h] = encData[h*benchSteps+t]
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,67 @@
+package parakeet
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// DecodeStats describe a run of the greedy TDT decoder, to tell what it
+// did with an input that came out wrong.
+type DecodeStats struct {
+	// Frames is the number of encoder frames.
+	Frames int
+	// Steps is the number of joiner runs: a frame is visited once per
+	// token emitted at it, and skipped frames not at all.
+	Steps int
+	// Emitted is the number of tokens emitted.
+	Emitted int
+	// Skips counts the durations the decoder predicted: Skips[n] is how
+	// many steps predicted moving n frames ahead.
+	Skips []int
+	// MaxSymbolsHits is how many times the decoder was moved to the next
+	// frame by the WithMaxSymbols limit.
+	MaxSymbolsHits int
+	// Loops is how many times the decoder predicted the token it had just
+	// emitted at the same frame, and was moved to the next frame.
+	Loops int
+	// Confidence is the mean probability the joiner gave the tokens
+	// emitted, from 0 to 1; 0 when none were.
+	Confidence float64
+}
+
+// tokenProb returns the softmax probability of logits[best].
+func tokenProb(logits []float32, best int) float64 {
+	var sum float64
+	for _, l := range logits {
+		sum += math.Exp(float64(l - logits[best]))
+	}
+	return 1 / sum
+}
+
+func (s *DecodeStats) addSkip(n int) {
+	for len(s.Skips) <= n {
+		s.Skips = append(s.Skips, 0)
+	}
+	s.Skips[n]++
+}
+
+// Pathological reports whether the decoder had to be moved along, which
+// points at input it got stuck on.
+func (s DecodeStats) Pathological() bool {
+	return s.MaxSymbolsHits > 0 || s.Loops > 0
+}
+
+// String formats the statistics for logs, e.g. "frames=250 steps=180
+// emitted=42 skips=[0:10 1:120 2:50] max_symbols_hits=0 loops=0
+// confidence=0.912".
+func (s DecodeStats) String() string {
+	var skips []string
+	for n, c := range s.Skips {
+		if c > 0 {
+			skips = append(skips, fmt.Sprintf("%d:%d", n, c))
+		}
+	}
+	return fmt.Sprintf("frames=%d steps=%d emitted=%d skips=[%s] max_symbols_hits=%d loops=%d confidence=%.3f",
+		s.Frames, s.Steps, s.Emitted, strings.Join(skips, " "), s.MaxSymbolsHits, s.Loops, s.Confidence)
+}
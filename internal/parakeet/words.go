@@ -0,0 +1,59 @@
+package parakeet
+
+import (
+	"context"
+	"strings"
+)
+
+// FrameSeconds is the duration of an encoder frame: 10ms feature hops,
+// subsampled 8 times.
+const FrameSeconds = 0.08
+
+// Word is a recognized word with its position in the audio, in seconds.
+type Word struct {
+	Text  string
+	Start float64
+	End   float64
+}
+
+// TranscribeWords is like Transcribe but returns the words with their
+// timings, taken from the frames where the decoder emitted their tokens
+// and the durations it predicted for them.
+func (m *Model) TranscribeWords(ctx context.Context, samples []float32) ([]Word, error) {
+	emitted, err := m.decode(ctx, samples, new(Timings))
+	if err != nil {
+		return nil, err
+	}
+
+	var words []Word
+	for _, e := range emitted {
+		if e.token < 0 || e.token >= len(m.vocab) {
+			continue
+		}
+		tok := m.vocab[e.token]
+		if strings.HasPrefix(tok, "<") && strings.HasSuffix(tok, ">") {
+			continue
+		}
+		start := float64(e.frame) * FrameSeconds
+		end := float64(e.frame+max(e.duration, 1)) * FrameSeconds
+
+		// Word pieces starting with ▁ begin a new word
+		text, newWord := strings.CutPrefix(tok, "▁")
+		if newWord || len(words) == 0 {
+			words = append(words, Word{Text: text, Start: start, End: end})
+			continue
+		}
+		w := &words[len(words)-1]
+		w.Text += text
+		w.End = end
+	}
+
+	// Drop empty words left by lone ▁ tokens
+	out := words[:0]
+	for _, w := range words {
+		if w.Text != "" {
+			out = append(out, w)
+		}
+	}
+	return out, nil
+}
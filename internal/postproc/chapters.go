@@ -0,0 +1,133 @@
+package postproc
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/rubiojr/lunartlk/translate"
+)
+
+// chaptersPrompt asks for the first line and title of every chapter. It's
+// used through the translate backend, like the client's meeting summaries.
+const chaptersPrompt = "Split this numbered transcript into chapters, one per topic, with titles written in %s. " +
+	"Return one line per chapter in the form \"N: title\", where N is the number of the chapter's first line and the title is a few words long. " +
+	"Return only those lines.\n\n%s"
+
+// minChapterWords is the transcript length below which chaptering is
+// skipped; short dictations have a single topic.
+const minChapterWords = 300
+
+func init() {
+	Register("chapters", func(arg string) (Processor, error) {
+		if arg == "" {
+			return nil, fmt.Errorf("missing Ollama model, use chapters:MODEL")
+		}
+		llm := translate.NewOllama(translate.WithModel(arg), translate.WithPrompt(chaptersPrompt))
+		return &Chapters{LLM: llm, MinWords: minChapterWords}, nil
+	})
+}
+
+// Chapters splits long transcripts into titled chapters with an LLM. The
+// chapters are built from the transcript lines when the engine returns
+// them, and from its sentences otherwise.
+type Chapters struct {
+	LLM      translate.Translator
+	MinWords int
+}
+
+func (c *Chapters) Name() string { return "chapters" }
+
+func (c *Chapters) Process(ctx context.Context, t *Transcript) error {
+	t.Chapters = nil
+	if len(strings.Fields(t.Text)) < c.MinWords {
+		return nil
+	}
+
+	units := chapterUnits(t)
+	var numbered strings.Builder
+	for i, u := range units {
+		fmt.Fprintf(&numbered, "%d. %s\n", i+1, u.text)
+	}
+	out, err := c.LLM.Translate(ctx, numbered.String(), "the same language as the transcript")
+	if err != nil {
+		return err
+	}
+
+	starts := parseChapters(out, len(units))
+	for i, s := range starts {
+		end := len(units)
+		if i+1 < len(starts) {
+			end = starts[i+1].line
+		}
+		var text []string
+		for _, u := range units[s.line:end] {
+			text = append(text, u.text)
+		}
+		t.Chapters = append(t.Chapters, Chapter{
+			Title:     s.title,
+			StartTime: units[s.line].start,
+			Text:      strings.Join(text, " "),
+		})
+	}
+	return nil
+}
+
+// chapterUnit is a line or sentence the LLM can start a chapter at.
+type chapterUnit struct {
+	text  string
+	start float64
+}
+
+var sentenceEnd = regexp.MustCompile(`[.?!…]\s+`)
+
+func chapterUnits(t *Transcript) []chapterUnit {
+	var units []chapterUnit
+	if len(t.Lines) > 0 {
+		for _, l := range t.Lines {
+			units = append(units, chapterUnit{text: strings.TrimSpace(l.Text), start: l.StartTime})
+		}
+		return units
+	}
+	// Without timings, chapters can only start at a sentence
+	rest := t.Text
+	for _, loc := range sentenceEnd.FindAllStringIndex(t.Text, -1) {
+		units = append(units, chapterUnit{text: strings.TrimSpace(t.Text[len(t.Text)-len(rest) : loc[1]])})
+		rest = t.Text[loc[1]:]
+	}
+	if s := strings.TrimSpace(rest); s != "" {
+		units = append(units, chapterUnit{text: s})
+	}
+	return units
+}
+
+type chapterStart struct {
+	line  int
+	title string
+}
+
+var chapterLine = regexp.MustCompile(`(?m)^\W*(\d+)\s*[:.)-]\s*(.+?)\s*$`)
+
+// parseChapters reads the "N: title" lines of the LLM answer, keeping the
+// ones that start after the previous chapter. The first chapter always
+// starts at the first line.
+func parseChapters(out string, n int) []chapterStart {
+	var starts []chapterStart
+	for _, m := range chapterLine.FindAllStringSubmatch(out, -1) {
+		line, err := strconv.Atoi(m[1])
+		title := strings.Trim(m[2], "\"*# ")
+		if err != nil || line < 1 || line > n || title == "" {
+			continue
+		}
+		line--
+		if len(starts) == 0 {
+			line = 0
+		} else if line <= starts[len(starts)-1].line {
+			continue
+		}
+		starts = append(starts, chapterStart{line: line, title: title})
+	}
+	return starts
+}
@@ -0,0 +1,127 @@
+package postproc
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func init() {
+	Register("dictionary", func(arg string) (Processor, error) {
+		if arg == "" {
+			return nil, fmt.Errorf("missing file, use dictionary:/path/to/file")
+		}
+		return LoadDictionary(arg)
+	})
+}
+
+// Dictionary replaces commonly misrecognized words or phrases with their
+// correct spelling.
+type Dictionary struct {
+	entries []dictEntry
+}
+
+type dictEntry struct {
+	re *regexp.Regexp
+	to string
+}
+
+// LoadDictionary reads replacements from a file with one "from => to" entry
+// per line. Blank lines and lines starting with # are ignored. Matching is
+// case-insensitive and only whole words are replaced.
+func LoadDictionary(path string) (*Dictionary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	d := &Dictionary{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		from, to, ok := strings.Cut(line, "=>")
+		from, to = strings.TrimSpace(from), strings.TrimSpace(to)
+		if !ok || from == "" {
+			return nil, fmt.Errorf("%s:%d: expected 'from => to'", path, n)
+		}
+		d.Add(from, to)
+	}
+	return d, scanner.Err()
+}
+
+// Add registers a replacement.
+func (d *Dictionary) Add(from, to string) {
+	d.entries = append(d.entries, dictEntry{
+		re: regexp.MustCompile("(?i)" + regexp.QuoteMeta(from)),
+		to: to,
+	})
+}
+
+func (d *Dictionary) Name() string { return "dictionary" }
+
+func (d *Dictionary) Process(ctx context.Context, t *Transcript) error {
+	mapText(t, d.Replace)
+	return nil
+}
+
+// Replace applies every entry to s.
+func (d *Dictionary) Replace(s string) string {
+	for _, e := range d.entries {
+		s = replaceWords(s, e.re, e.to)
+	}
+	return s
+}
+
+// replaceWords replaces matches of re that start and end on word boundaries.
+func replaceWords(s string, re *regexp.Regexp, to string) string {
+	return replaceWordsFunc(s, re, func(string) string { return to })
+}
+
+// replaceWordsFunc replaces matches of re that start and end on word
+// boundaries with the result of fn.
+func replaceWordsFunc(s string, re *regexp.Regexp, fn func(string) string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range re.FindAllStringIndex(s, -1) {
+		if !wordBoundary(s, m[0], m[1]) {
+			continue
+		}
+		b.WriteString(s[last:m[0]])
+		b.WriteString(fn(s[m[0]:m[1]]))
+		last = m[1]
+	}
+	if last == 0 {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func wordBoundary(s string, start, end int) bool {
+	if start > 0 {
+		r, _ := utf8.DecodeLastRuneInString(s[:start])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	if end < len(s) {
+		r, _ := utf8.DecodeRuneInString(s[end:])
+		if isWordRune(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
@@ -0,0 +1,141 @@
+package postproc
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// fillers are the words dropped from transcripts by language. Words that
+// are also regular words, like "este" ("this"), are in pauseFillers
+// instead, and only dropped when a pause follows them.
+var (
+	fillers = map[string][]string{
+		"en": {"um", "umm", "uh", "uhh", "uhm", "er", "erm", "ah", "hmm", "mm", "mhm"},
+		"es": {"eh", "ehm", "em", "mmm", "mm", "ah"},
+	}
+	pauseFillers = map[string][]string{
+		"en": {"like"},
+		"es": {"este", "o sea"},
+	}
+)
+
+func init() {
+	Register("disfluency", func(string) (Processor, error) { return Disfluency{}, nil })
+}
+
+// Disfluency removes filler words and repeated words ("I I think") from
+// transcripts, so dictated text reads naturally. Transcripts in languages
+// without a filler list use every list.
+type Disfluency struct{}
+
+func (Disfluency) Name() string { return "disfluency" }
+
+func (Disfluency) Process(ctx context.Context, t *Transcript) error {
+	always, pause := fillerSet(fillers, t.Lang), fillerSet(pauseFillers, t.Lang)
+	clean := func(s string) string { return removeDisfluencies(s, always, pause) }
+	mapText(t, clean)
+	for i := range t.Chapters {
+		t.Chapters[i].Text = clean(t.Chapters[i].Text)
+	}
+	return nil
+}
+
+func fillerSet(lists map[string][]string, lang string) map[string]bool {
+	set := map[string]bool{}
+	words, ok := lists[lang]
+	if !ok {
+		for _, l := range lists {
+			words = append(words, l...)
+		}
+	}
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+func removeDisfluencies(s string, always, pause map[string]bool) string {
+	toks := tokenize(s)
+	var out []itnToken
+	changed, capNext := false, false
+	for i := 0; i < len(toks); i++ {
+		t := toks[i]
+		drop := always[t.lower]
+		// "o sea" and other pause fillers of two words
+		n := 1
+		if !drop && i+1 < len(toks) && t.post == "" && toks[i+1].pre == "" && pause[t.lower+" "+toks[i+1].lower] {
+			n = 2
+		}
+		last := toks[i+n-1]
+		if !drop && (n == 2 || pause[t.lower]) {
+			drop = pausesAfter(last.post) || (i+n < len(toks) && always[toks[i+n].lower])
+		}
+		if !drop && t.word != "" && len(out) > 0 {
+			prev := out[len(out)-1]
+			drop = prev.lower == t.lower && prev.post == "" && t.pre == ""
+		}
+		if !drop {
+			if capNext {
+				t.word = capitalize(t.word)
+				capNext = false
+			}
+			out = append(out, t)
+			continue
+		}
+
+		changed = true
+		if sentenceStart(out) && startsUpper(t.word) {
+			capNext = true
+		}
+		// Keep the punctuation that isn't the filler's own pause
+		end := last.post
+		if pausesAfter(end) {
+			end = strings.TrimLeft(end, ",….")
+		}
+		if len(out) > 0 && !sentenceStart(out) {
+			// "should, uh, go" and "ready, eh" lose the comma before too
+			prev := &out[len(out)-1]
+			if end != "" || i+n == len(toks) || strings.HasPrefix(last.post, ",") {
+				prev.post = strings.TrimSuffix(prev.post, ",")
+			}
+			prev.post += end
+		}
+		if t.pre != "" && i+n < len(toks) && !strings.ContainsAny(last.post, ")]") {
+			toks[i+n].pre = t.pre + toks[i+n].pre
+		}
+		i += n - 1
+	}
+	if !changed {
+		return s
+	}
+	parts := make([]string, len(out))
+	for i, t := range out {
+		parts[i] = t.pre + t.word + t.post
+	}
+	return strings.Join(parts, " ")
+}
+
+// pausesAfter reports whether punctuation marks a pause.
+func pausesAfter(post string) bool {
+	return strings.ContainsAny(post, ",…") || strings.HasPrefix(post, "..")
+}
+
+func sentenceStart(out []itnToken) bool {
+	if len(out) == 0 {
+		return true
+	}
+	last, _ := utf8.DecodeLastRuneInString(out[len(out)-1].post)
+	return strings.ContainsRune(".?!", last)
+}
+
+func startsUpper(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsUpper(r)
+}
+
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
@@ -0,0 +1,61 @@
+package postproc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+func init() {
+	Register("exec", func(arg string) (Processor, error) {
+		args := strings.Fields(arg)
+		if len(args) == 0 {
+			return nil, fmt.Errorf("missing command, use exec:/path/to/plugin")
+		}
+		return &Exec{Args: args, Timeout: 10 * time.Second}, nil
+	})
+}
+
+// Exec runs an external plugin. The transcript is written as JSON to the
+// plugin's stdin and the plugin must print the (possibly modified)
+// transcript as JSON on stdout. A non-zero exit status fails the pipeline.
+type Exec struct {
+	Args    []string
+	Timeout time.Duration
+}
+
+func (e *Exec) Name() string { return "exec:" + e.Args[0] }
+
+func (e *Exec) Process(ctx context.Context, t *Transcript) error {
+	in, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Args[0], e.Args[1:]...)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+
+	// Fields the plugin leaves out keep their current values
+	out := *t
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return fmt.Errorf("decode plugin output: %w", err)
+	}
+	*t = out
+	return nil
+}
@@ -0,0 +1,661 @@
+package postproc
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+func init() {
+	Register("itn", func(string) (Processor, error) { return itn{}, nil })
+}
+
+// itn converts spoken forms to written ones (inverse text normalization):
+// numbers, decimals, amounts of money, percentages and dates, e.g.
+// "twenty three euros" to "€23" and "march fifth twenty twenty five" to
+// "2025-03-05". Transcripts in languages without a grammar are left alone.
+type itn struct{}
+
+func (itn) Name() string { return "itn" }
+
+func (itn) Process(ctx context.Context, t *Transcript) error {
+	g, ok := itnGrammars[t.Lang]
+	if !ok {
+		return nil
+	}
+	mapText(t, g.normalize)
+	for i := range t.Chapters {
+		t.Chapters[i].Text = g.normalize(t.Chapters[i].Text)
+	}
+	return nil
+}
+
+// itnGrammar describes how a language says numbers, amounts and dates.
+type itnGrammar struct {
+	units    map[string]int // words for numbers below the first tens word
+	tens     map[string]int
+	hundreds map[string]int // words for whole hundreds, "doscientos"
+	// hundred multiplies what comes before it, "three hundred"
+	hundred string
+	scales  map[string]int
+	// bareThousand is set when the thousand scale word counts on its
+	// own: "mil" is 1000 in Spanish, while English says "one thousand".
+	bareThousand bool
+	ordinals     map[string]int
+	// and joins parts of a number: "one hundred and five" after a
+	// hundred or a scale in English, "treinta y dos" after tens in
+	// Spanish.
+	and     string
+	andTens bool
+	// point starts the decimals, written after decimalSep.
+	point      string
+	decimalSep string
+	months     map[string]int
+	currencies map[string]string
+	cents      map[string]bool
+	// centsAnd are the words joining an amount and its cents.
+	centsAnd []string
+	percent  [][]string
+	// symbolAfter writes symbols after the amount, "23 €", "50 %".
+	symbolAfter bool
+	// yearPairs reads years said in pairs, "nineteen ninety nine".
+	yearPairs bool
+	// dayFirst reads dates as "cinco de marzo de dos mil", with dateOf
+	// between the parts, instead of "march fifth twenty twenty".
+	dayFirst bool
+	dateOf   string
+}
+
+var itnGrammars = map[string]*itnGrammar{
+	"en": {
+		units: map[string]int{
+			"zero": 0, "one": 1, "two": 2, "three": 3, "four": 4, "five": 5, "six": 6, "seven": 7,
+			"eight": 8, "nine": 9, "ten": 10, "eleven": 11, "twelve": 12, "thirteen": 13,
+			"fourteen": 14, "fifteen": 15, "sixteen": 16, "seventeen": 17, "eighteen": 18, "nineteen": 19,
+		},
+		tens: map[string]int{
+			"twenty": 20, "thirty": 30, "forty": 40, "fifty": 50, "sixty": 60, "seventy": 70,
+			"eighty": 80, "ninety": 90,
+		},
+		hundred: "hundred",
+		scales:  map[string]int{"thousand": 1e3, "million": 1e6, "billion": 1e9},
+		ordinals: map[string]int{
+			"first": 1, "second": 2, "third": 3, "fourth": 4, "fifth": 5, "sixth": 6, "seventh": 7,
+			"eighth": 8, "ninth": 9, "tenth": 10, "eleventh": 11, "twelfth": 12, "thirteenth": 13,
+			"fourteenth": 14, "fifteenth": 15, "sixteenth": 16, "seventeenth": 17, "eighteenth": 18,
+			"nineteenth": 19, "twentieth": 20, "thirtieth": 30, "fortieth": 40, "fiftieth": 50,
+			"sixtieth": 60, "seventieth": 70, "eightieth": 80, "ninetieth": 90,
+		},
+		and:        "and",
+		point:      "point",
+		decimalSep: ".",
+		months: map[string]int{
+			"january": 1, "february": 2, "march": 3, "april": 4, "may": 5, "june": 6, "july": 7,
+			"august": 8, "september": 9, "october": 10, "november": 11, "december": 12,
+		},
+		currencies: map[string]string{
+			"euro": "€", "euros": "€", "dollar": "$", "dollars": "$", "bucks": "$",
+			"pound": "£", "pounds": "£", "yen": "¥",
+		},
+		cents:     map[string]bool{"cent": true, "cents": true, "pence": true},
+		centsAnd:  []string{"and"},
+		percent:   [][]string{{"percent"}, {"per", "cent"}},
+		yearPairs: true,
+	},
+	"es": {
+		units: map[string]int{
+			"cero": 0, "uno": 1, "un": 1, "una": 1, "dos": 2, "tres": 3, "cuatro": 4, "cinco": 5,
+			"seis": 6, "siete": 7, "ocho": 8, "nueve": 9, "diez": 10, "once": 11, "doce": 12,
+			"trece": 13, "catorce": 14, "quince": 15, "dieciséis": 16, "dieciseis": 16,
+			"diecisiete": 17, "dieciocho": 18, "diecinueve": 19, "veinte": 20, "veintiuno": 21,
+			"veintiún": 21, "veintiun": 21, "veintiuna": 21, "veintidós": 22, "veintidos": 22,
+			"veintitrés": 23, "veintitres": 23, "veinticuatro": 24, "veinticinco": 25,
+			"veintiséis": 26, "veintiseis": 26, "veintisiete": 27, "veintiocho": 28, "veintinueve": 29,
+		},
+		tens: map[string]int{
+			"treinta": 30, "cuarenta": 40, "cincuenta": 50, "sesenta": 60, "setenta": 70,
+			"ochenta": 80, "noventa": 90,
+		},
+		hundreds: map[string]int{
+			"cien": 100, "ciento": 100, "doscientos": 200, "doscientas": 200, "trescientos": 300,
+			"trescientas": 300, "cuatrocientos": 400, "cuatrocientas": 400, "quinientos": 500,
+			"quinientas": 500, "seiscientos": 600, "seiscientas": 600, "setecientos": 700,
+			"setecientas": 700, "ochocientos": 800, "ochocientas": 800, "novecientos": 900,
+			"novecientas": 900,
+		},
+		scales:       map[string]int{"mil": 1e3, "millón": 1e6, "millon": 1e6, "millones": 1e6},
+		bareThousand: true,
+		ordinals:     map[string]int{"primero": 1},
+		and:          "y",
+		andTens:      true,
+		point:        "coma",
+		decimalSep:   ",",
+		months: map[string]int{
+			"enero": 1, "febrero": 2, "marzo": 3, "abril": 4, "mayo": 5, "junio": 6, "julio": 7,
+			"agosto": 8, "septiembre": 9, "setiembre": 9, "octubre": 10, "noviembre": 11, "diciembre": 12,
+		},
+		currencies: map[string]string{
+			"euro": "€", "euros": "€", "dólar": "$", "dólares": "$", "dolar": "$", "dolares": "$",
+			"libra": "£", "libras": "£",
+		},
+		cents:       map[string]bool{"céntimo": true, "céntimos": true, "centimos": true, "centavo": true, "centavos": true},
+		centsAnd:    []string{"con", "y"},
+		percent:     [][]string{{"por", "ciento"}},
+		symbolAfter: true,
+		dayFirst:    true,
+		dateOf:      "de",
+	},
+}
+
+// itnToken is a word with the punctuation around it.
+type itnToken struct {
+	pre, word, post string
+	lower           string
+}
+
+func tokenize(s string) []itnToken {
+	var toks []itnToken
+	for _, f := range strings.Fields(s) {
+		start := strings.IndexFunc(f, isWordRune)
+		if start < 0 {
+			toks = append(toks, itnToken{pre: f})
+			continue
+		}
+		end := strings.LastIndexFunc(f, isWordRune)
+		_, size := utf8.DecodeRuneInString(f[end:])
+		end += size
+		t := itnToken{pre: f[:start], word: f[start:end], post: f[end:]}
+		t.lower = strings.ToLower(t.word)
+		toks = append(toks, t)
+	}
+	return toks
+}
+
+// splitHyphens splits hyphenated numbers, "twenty-three", into their
+// words.
+func (g *itnGrammar) splitHyphens(toks []itnToken) []itnToken {
+	var out []itnToken
+	for _, t := range toks {
+		parts := strings.Split(t.word, "-")
+		if len(parts) == 1 || !g.allNumberWords(parts) {
+			out = append(out, t)
+			continue
+		}
+		for i, p := range parts {
+			pt := itnToken{word: p, lower: strings.ToLower(p)}
+			if i == 0 {
+				pt.pre = t.pre
+			}
+			if i == len(parts)-1 {
+				pt.post = t.post
+			}
+			out = append(out, pt)
+		}
+	}
+	return out
+}
+
+func (g *itnGrammar) allNumberWords(words []string) bool {
+	for _, w := range words {
+		w = strings.ToLower(w)
+		_, unit := g.units[w]
+		_, tens := g.tens[w]
+		_, ord := g.ordinals[w]
+		if !unit && !tens && !ord {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *itnGrammar) normalize(s string) string {
+	toks := g.splitHyphens(tokenize(s))
+	var out []string
+	changed := false
+	for i := 0; i < len(toks); {
+		written, n := g.date(toks, i)
+		if n == 0 {
+			written, n = g.amount(toks, i)
+		}
+		if n == 0 {
+			out = append(out, toks[i].pre+toks[i].word+toks[i].post)
+			i++
+			continue
+		}
+		out = append(out, toks[i].pre+written+toks[i+n-1].post)
+		changed = true
+		i += n
+	}
+	if !changed {
+		return s
+	}
+	return strings.Join(out, " ")
+}
+
+// joined reports whether toks[j] continues the phrase before it, with no
+// punctuation in between.
+func joined(toks []itnToken, j int) bool {
+	return j < len(toks) && toks[j].pre == "" && toks[j-1].post == ""
+}
+
+// words reports whether the words of toks from i are seq.
+func words(toks []itnToken, i int, seq []string) bool {
+	for k, w := range seq {
+		if i+k >= len(toks) || toks[i+k].lower != w || (k > 0 && !joined(toks, i+k)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Parts of a number, to tell which words can come next.
+const (
+	numStart = iota
+	numUnit
+	numTens
+	numHundred
+	numScale
+	numAnd
+)
+
+// number reads a cardinal, or an ordinal, starting at toks[i], and
+// returns its value and how many tokens it took.
+func (g *itnGrammar) number(toks []itnToken, i int) (val, n int, ordinal bool) {
+	total, group, part, lastScale := 0, 0, numStart, math.MaxInt
+	for j := i; j < len(toks); j++ {
+		if j > i && !joined(toks, j) {
+			break
+		}
+		w := toks[j].lower
+		if v, ok := g.units[w]; ok && g.unitFits(part, group, v) {
+			group, part, n = group+v, numUnit, j-i+1
+			continue
+		}
+		if v, ok := g.tens[w]; ok && g.tensFit(part, group) {
+			group, part, n = group+v, numTens, j-i+1
+			continue
+		}
+		if v, ok := g.ordinals[w]; ok {
+			if (v%10 == 0 && v >= 20 && g.tensFit(part, group)) || (v < 20 && g.unitFits(part, group, v)) {
+				group, n, ordinal = group+v, j-i+1, true
+			}
+			break
+		}
+		if v, ok := g.hundreds[w]; ok && group == 0 && (part == numStart || part == numScale) {
+			group, part, n = v, numHundred, j-i+1
+			continue
+		}
+		if w == g.hundred && g.hundred != "" && group > 0 && group < 100 && (part == numUnit || part == numTens) {
+			group, part, n = group*100, numHundred, j-i+1
+			continue
+		}
+		// "dos mil millones", a larger scale multiplies all that came
+		// before it
+		if v, ok := g.scales[w]; ok && v > lastScale && lastScale != math.MaxInt && (group > 0 || part == numScale) && total+group < v {
+			total, group, part, lastScale, n = (total+group)*v, 0, numScale, v, j-i+1
+			continue
+		}
+		if v, ok := g.scales[w]; ok && v < lastScale {
+			if group == 0 {
+				if part != numStart || v != 1e3 || !g.bareThousand {
+					break
+				}
+				group = 1
+			}
+			total, group, part, lastScale, n = total+group*v, 0, numScale, v, j-i+1
+			continue
+		}
+		if w == g.and && g.andFits(part) && j+1 < len(toks) && joined(toks, j+1) && g.followsAnd(toks[j+1].lower) {
+			part = numAnd
+			continue
+		}
+		break
+	}
+	if n == 0 {
+		return 0, 0, false
+	}
+	return total + group, n, ordinal
+}
+
+func (g *itnGrammar) unitFits(part, group, v int) bool {
+	switch part {
+	case numStart, numHundred, numScale:
+		return group%100 == 0
+	case numTens:
+		return !g.andTens && v > 0 && v < 10
+	case numAnd:
+		if g.andTens {
+			return v > 0 && v < 10
+		}
+		return group%100 == 0
+	}
+	return false
+}
+
+func (g *itnGrammar) tensFit(part, group int) bool {
+	switch part {
+	case numStart, numHundred, numScale:
+		return group%100 == 0
+	case numAnd:
+		return !g.andTens && group%100 == 0
+	}
+	return false
+}
+
+func (g *itnGrammar) andFits(part int) bool {
+	if g.andTens {
+		return part == numTens
+	}
+	return part == numHundred || part == numScale
+}
+
+func (g *itnGrammar) followsAnd(w string) bool {
+	v, unit := g.units[w]
+	if g.andTens {
+		return unit && v > 0 && v < 10
+	}
+	_, tens := g.tens[w]
+	_, ord := g.ordinals[w]
+	return unit || tens || ord
+}
+
+// amount writes the number at toks[i] with digits, along with the
+// decimals, currency or percent sign that follow it. Single numbers below
+// ten are left as words, "one of them", unless something follows.
+func (g *itnGrammar) amount(toks []itnToken, i int) (string, int) {
+	val, n, ordinal := g.number(toks, i)
+	if n == 0 {
+		return "", 0
+	}
+	if ordinal {
+		if n == 1 && val < 10 {
+			return "", 0
+		}
+		return g.ordinalString(val), n
+	}
+	// "twelve fifty dollars" is a price, not a time or a year
+	second, sn := g.pairPart(toks, i+n)
+	price := sn > 0 && n == 1 && g.yearPairs && g.suffixAt(toks, i+n+sn)
+	if !price {
+		if c, cn := g.clockTime(toks, i, val, n); cn > 0 {
+			return c, cn
+		}
+		if y, yn := g.yearPair(toks, i, val, n); yn > 0 {
+			return strconv.Itoa(y), yn
+		}
+	}
+
+	written := strconv.Itoa(val)
+	end := i + n
+	decimals := ""
+	if price {
+		if _, ok := g.currencies[toks[i+n+sn].lower]; ok {
+			decimals = fmt.Sprintf("%02d", second)
+			written += g.decimalSep + decimals
+			end += sn
+		}
+	}
+	if decimals == "" && words(toks, end, []string{g.point}) && joined(toks, end) {
+		for j := end + 1; j < len(toks) && joined(toks, j); j++ {
+			d, ok := g.units[toks[j].lower]
+			if !ok || d > 9 {
+				break
+			}
+			decimals += strconv.Itoa(d)
+		}
+		if decimals != "" {
+			written += g.decimalSep + decimals
+			end += 1 + len(decimals)
+		}
+	}
+
+	if end < len(toks) && joined(toks, end) {
+		if sym, ok := g.currencies[toks[end].lower]; ok {
+			end++
+			if decimals == "" {
+				if cents, cn := g.centsAfter(toks, end); cn > 0 {
+					written += g.decimalSep + fmt.Sprintf("%02d", cents)
+					end += cn
+				}
+			}
+			if g.symbolAfter {
+				return written + " " + sym, end - i
+			}
+			return sym + written, end - i
+		}
+		for _, seq := range g.percent {
+			if words(toks, end, seq) {
+				end += len(seq)
+				if g.symbolAfter {
+					return written + " %", end - i
+				}
+				return written + "%", end - i
+			}
+		}
+	}
+
+	// "mil gracias" isn't a number either
+	if n == 1 && (val < 10 || g.scales[toks[i].lower] > 0) && decimals == "" {
+		return "", 0
+	}
+	return written, end - i
+}
+
+// centsAfter reads "and fifty cents" after a currency word.
+func (g *itnGrammar) centsAfter(toks []itnToken, i int) (int, int) {
+	if i >= len(toks) || !joined(toks, i) {
+		return 0, 0
+	}
+	for _, and := range g.centsAnd {
+		if toks[i].lower != and || !joined(toks, i+1) {
+			continue
+		}
+		v, n, ordinal := g.number(toks, i+1)
+		end := i + 1 + n
+		if n == 0 || ordinal || v >= 100 || !joined(toks, end) || !g.cents[toks[end].lower] {
+			continue
+		}
+		return v, n + 2
+	}
+	return 0, 0
+}
+
+// yearPair reads years said in two parts, "nineteen ninety nine" or
+// "twenty oh five", given the first part already read.
+func (g *itnGrammar) yearPair(toks []itnToken, i, first, n int) (int, int) {
+	if !g.yearPairs || first < 11 || first > 20 {
+		return 0, 0
+	}
+	second, n2 := g.pairPart(toks, i+n)
+	if n2 == 0 {
+		return 0, 0
+	}
+	return first*100 + second, n + n2
+}
+
+// clockTime reads times said as the hour and the minutes, "twelve thirty"
+// or "seven oh five", given the hour already read.
+func (g *itnGrammar) clockTime(toks []itnToken, i, hour, n int) (string, int) {
+	if !g.yearPairs || n != 1 || hour < 1 || hour > 12 {
+		return "", 0
+	}
+	minutes, n2 := g.pairPart(toks, i+n)
+	if n2 == 0 || minutes > 59 {
+		return "", 0
+	}
+	if g.suffixAt(toks, i+n+n2) || words(toks, i+n+n2, []string{g.point}) {
+		return "", 0
+	}
+	return fmt.Sprintf("%d:%02d", hour, minutes), n + n2
+}
+
+// suffixAt reports whether a currency or a percent follows at toks[j].
+func (g *itnGrammar) suffixAt(toks []itnToken, j int) bool {
+	if !joined(toks, j) {
+		return false
+	}
+	if _, ok := g.currencies[toks[j].lower]; ok {
+		return true
+	}
+	for _, seq := range g.percent {
+		if words(toks, j, seq) {
+			return true
+		}
+	}
+	return false
+}
+
+// pairPart reads the second part of a year or a time at toks[j]: a number
+// from 10 to 99, or "oh" and a digit.
+func (g *itnGrammar) pairPart(toks []itnToken, j int) (int, int) {
+	if !joined(toks, j) {
+		return 0, 0
+	}
+	if toks[j].lower == "oh" && joined(toks, j+1) {
+		if d, ok := g.units[toks[j+1].lower]; ok && d > 0 && d < 10 {
+			return d, 2
+		}
+		return 0, 0
+	}
+	v, n, ordinal := g.number(toks, j)
+	if n == 0 || ordinal || v < 10 || v > 99 {
+		return 0, 0
+	}
+	return v, n
+}
+
+// year reads a year at toks[i], in pairs or as a whole number.
+func (g *itnGrammar) year(toks []itnToken, i int) (int, int) {
+	val, n, ordinal := g.number(toks, i)
+	if n == 0 || ordinal {
+		return 0, 0
+	}
+	if y, yn := g.yearPair(toks, i, val, n); yn > 0 {
+		return y, yn
+	}
+	if val < 1000 || val > 2999 {
+		return 0, 0
+	}
+	return val, n
+}
+
+// date reads dates: "march fifth twenty twenty five", "the fifth of
+// march, twenty twenty five" or "cinco de marzo de dos mil veinticinco".
+// Dates with a year are written as YYYY-MM-DD, ones without as "March 5"
+// or "5 de marzo".
+func (g *itnGrammar) date(toks []itnToken, i int) (string, int) {
+	if g.dayFirst {
+		return g.dayFirstDate(toks, i)
+	}
+
+	// Month, then day
+	if month, ok := g.months[toks[i].lower]; ok {
+		j := i + 1
+		if words(toks, j, []string{"the"}) && joined(toks, j) {
+			j++
+		}
+		if !joined(toks, j) {
+			return "", 0
+		}
+		day, n, ordinal := g.number(toks, j)
+		if n == 0 || day < 1 || day > 31 {
+			return "", 0
+		}
+		j += n
+		if y, yn := g.dateYear(toks, j, true); yn > 0 {
+			return isoDate(y, month, day, j+yn-i)
+		}
+		if !ordinal {
+			return "", 0
+		}
+		r, size := utf8.DecodeRuneInString(toks[i].word)
+		return string(unicode.ToUpper(r)) + toks[i].word[size:] + " " + strconv.Itoa(day), j - i
+	}
+
+	// The day of month, with a year
+	j := i
+	if toks[j].lower == "the" {
+		j++
+	}
+	if j == i || !joined(toks, j) {
+		return "", 0
+	}
+	day, n, ordinal := g.number(toks, j)
+	j += n
+	if n == 0 || !ordinal || day > 31 || !words(toks, j, []string{"of"}) || !joined(toks, j) || !joined(toks, j+1) {
+		return "", 0
+	}
+	month, ok := g.months[toks[j+1].lower]
+	if !ok {
+		return "", 0
+	}
+	j += 2
+	if y, yn := g.dateYear(toks, j, true); yn > 0 {
+		return isoDate(y, month, day, j+yn-i)
+	}
+	return "", 0
+}
+
+func (g *itnGrammar) dayFirstDate(toks []itnToken, i int) (string, int) {
+	day, n, _ := g.number(toks, i)
+	j := i + n
+	if n == 0 || day < 1 || day > 31 || !words(toks, j, []string{g.dateOf}) || !joined(toks, j) || !joined(toks, j+1) {
+		return "", 0
+	}
+	month, ok := g.months[toks[j+1].lower]
+	if !ok {
+		return "", 0
+	}
+	j += 2
+	if words(toks, j, []string{g.dateOf}) && joined(toks, j) {
+		if y, yn := g.dateYear(toks, j+1, false); yn > 0 {
+			return isoDate(y, month, day, j+1+yn-i)
+		}
+	}
+	return strconv.Itoa(day) + " " + toks[i+n].word + " " + toks[i+n+1].word, j - i
+}
+
+// dateYear reads the year of a date at toks[i], which may follow a comma
+// when comma is set.
+func (g *itnGrammar) dateYear(toks []itnToken, i int, comma bool) (int, int) {
+	if i >= len(toks) || toks[i].pre != "" {
+		return 0, 0
+	}
+	if p := toks[i-1].post; p != "" && (!comma || p != ",") {
+		return 0, 0
+	}
+	return g.year(toks, i)
+}
+
+// isoDate writes a date read from n tokens as YYYY-MM-DD, unless the
+// month has no such day.
+func isoDate(year, month, day, n int) (string, int) {
+	d := time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if d.Day() != day {
+		return "", 0
+	}
+	return d.Format(time.DateOnly), n
+}
+
+func (g *itnGrammar) ordinalString(v int) string {
+	if g.dayFirst {
+		return strconv.Itoa(v)
+	}
+	suffix := "th"
+	if v%100 < 11 || v%100 > 13 {
+		switch v % 10 {
+		case 1:
+			suffix = "st"
+		case 2:
+			suffix = "nd"
+		case 3:
+			suffix = "rd"
+		}
+	}
+	return strconv.Itoa(v) + suffix
+}
@@ -0,0 +1,74 @@
+package postproc
+
+import (
+	"context"
+	"testing"
+)
+
+func TestITN(t *testing.T) {
+	tests := []struct {
+		lang, in, want string
+	}{
+		// English numbers
+		{"en", "one of them", "one of them"},
+		{"en", "twenty three people", "23 people"},
+		{"en", "twenty-three people", "23 people"},
+		{"en", "three hundred and five", "305"},
+		{"en", "two thousand five hundred", "2500"},
+		{"en", "one million two hundred thousand", "1200000"},
+		{"en", "two thousand million", "2000000000"},
+		{"en", "the twenty first time", "the 21st time"},
+		{"en", "the second one", "the second one"},
+		{"en", "three point one four", "3.14"},
+		// Amounts
+		{"en", "twenty three euros", "€23"},
+		{"en", "five dollars and fifty cents", "$5.50"},
+		{"en", "fifty percent", "50%"},
+		{"en", "ten per cent.", "10%."},
+		{"en", "twelve fifty dollars", "$12.50"},
+		{"en", "twelve oh five pounds", "£12.05"},
+		// Years, dates and times
+		{"en", "in nineteen ninety nine", "in 1999"},
+		{"en", "in twenty oh five", "in 2005"},
+		{"en", "march fifth twenty twenty five", "2025-03-05"},
+		{"en", "june first, twenty twenty", "2020-06-01"},
+		{"en", "at twelve thirty", "at 12:30"},
+		{"en", "at seven oh five", "at 7:05"},
+		{"en", "at seven forty five.", "at 7:45."},
+		// Punctuation between words ends the phrase
+		{"en", "twenty, three", "20, three"},
+
+		// Spanish numbers
+		{"es", "uno de ellos", "uno de ellos"},
+		{"es", "treinta y dos personas", "32 personas"},
+		{"es", "veintitrés años", "23 años"},
+		{"es", "doscientos cincuenta", "250"},
+		{"es", "mil novecientos noventa y nueve", "1999"},
+		{"es", "mil gracias", "mil gracias"},
+		{"es", "dos millones", "2000000"},
+		{"es", "dos mil millones", "2000000000"},
+		{"es", "mil millones", "1000000000"},
+		{"es", "dos mil trescientos millones quinientos mil", "2300500000"},
+		{"es", "tres coma cinco", "3,5"},
+		// Amounts
+		{"es", "veinte euros", "20 €"},
+		{"es", "cinco euros con cincuenta céntimos", "5,50 €"},
+		{"es", "cincuenta por ciento", "50 %"},
+		// Dates
+		{"es", "el cinco de marzo de dos mil veinte", "el 2020-03-05"},
+		// Spanish has no time or year pairs
+		{"es", "doce treinta", "12 30"},
+
+		// Languages without a grammar are left alone
+		{"fr", "vingt trois", "vingt trois"},
+	}
+	for _, tt := range tests {
+		tr := &Transcript{Text: tt.in, Lang: tt.lang}
+		if err := (itn{}).Process(context.Background(), tr); err != nil {
+			t.Fatal(err)
+		}
+		if tr.Text != tt.want {
+			t.Errorf("%s: %q = %q, want %q", tt.lang, tt.in, tr.Text, tt.want)
+		}
+	}
+}
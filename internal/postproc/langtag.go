@@ -0,0 +1,156 @@
+package postproc
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// stopwords are frequent short words of each language the language tagger
+// tells apart. Most lines of speech have a few.
+var stopwords = map[string][]string{
+	"en": {
+		"the", "and", "is", "are", "was", "were", "of", "to", "in", "it", "that", "this", "you",
+		"i", "we", "they", "he", "she", "have", "has", "not", "with", "for", "on", "what",
+		"but", "be", "do", "don't", "it's", "i'm", "can", "will", "just", "so", "my", "your",
+		"there", "about", "would", "at", "from", "know", "think", "going", "yeah", "okay",
+	},
+	"es": {
+		"el", "la", "los", "las", "de", "del", "que", "y", "es", "en", "un", "una", "por",
+		"con", "para", "no", "se", "lo", "al", "su", "pero", "como", "más", "muy", "está",
+		"esto", "eso", "yo", "tú", "nosotros", "hay", "qué", "sí", "también", "ya", "porque",
+		"cuando", "donde", "bueno", "entonces", "vale", "tengo", "estoy", "hacer", "ahora",
+	},
+	"fr": {
+		"le", "la", "les", "de", "des", "du", "et", "est", "un", "une", "que", "qui", "pas",
+		"je", "tu", "il", "elle", "nous", "vous", "ils", "dans", "pour", "sur", "avec", "ce",
+		"c'est", "mais", "ou", "au", "aux", "très", "bien", "oui", "non", "alors", "suis",
+	},
+	"de": {
+		"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "ich", "du", "er", "sie",
+		"wir", "ihr", "mit", "auf", "für", "von", "zu", "den", "dem", "auch", "aber", "noch",
+		"schon", "jetzt", "ja", "nein", "wie", "was", "habe", "sind", "bin", "kann",
+	},
+	"it": {
+		"il", "lo", "la", "gli", "le", "di", "che", "e", "è", "un", "una", "per", "con",
+		"non", "sono", "della", "nel", "anche", "ma", "come", "questo", "quello", "io", "noi",
+		"voi", "molto", "perché", "sì", "ciao", "allora", "però",
+	},
+	"pt": {
+		"o", "a", "os", "as", "de", "do", "da", "dos", "das", "que", "e", "é", "um", "uma",
+		"para", "com", "não", "em", "no", "na", "mas", "como", "isso", "isto", "eu", "você",
+		"nós", "muito", "também", "então", "sim", "está", "tem", "foi",
+	},
+}
+
+// letterHints are letters that only some of the tagged languages write.
+var letterHints = map[rune][]string{
+	'ñ': {"es"}, '¿': {"es"}, '¡': {"es"},
+	'ã': {"pt"}, 'õ': {"pt"}, 'ç': {"fr", "pt"},
+	'ß': {"de"}, 'ä': {"de"}, 'ö': {"de"}, 'ü': {"de", "es"},
+	'ù': {"fr", "it"}, 'û': {"fr"}, 'ê': {"fr", "pt"}, 'è': {"fr", "it"},
+}
+
+var stopwordSets = func() map[string]map[string]bool {
+	sets := make(map[string]map[string]bool, len(stopwords))
+	for lang, words := range stopwords {
+		sets[lang] = make(map[string]bool, len(words))
+		for _, w := range words {
+			sets[lang][w] = true
+		}
+	}
+	return sets
+}()
+
+// TaggedLangs returns the languages DetectLang tells apart.
+func TaggedLangs() []string {
+	return slices.Sorted(maps.Keys(stopwords))
+}
+
+// DetectLang returns which of langs text is most likely in, from its
+// common words and the letters it uses, or "" when nothing gives it away,
+// as with names or a single word. An empty langs considers every tagged
+// language.
+func DetectLang(text string, langs []string) string {
+	if len(langs) == 0 {
+		langs = TaggedLangs()
+	}
+	scores := make(map[string]float64, len(langs))
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	}) {
+		for _, lang := range langs {
+			if stopwordSets[lang][w] {
+				scores[lang]++
+			}
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		for _, lang := range letterHints[r] {
+			if slices.Contains(langs, lang) {
+				scores[lang] += 0.5
+			}
+		}
+	}
+
+	best, bestScore, tie := "", 0.0, false
+	for _, lang := range langs {
+		switch s := scores[lang]; {
+		case s > bestScore:
+			best, bestScore, tie = lang, s, false
+		case s == bestScore && s > 0:
+			tie = true
+		}
+	}
+	if tie {
+		return ""
+	}
+	return best
+}
+
+func init() {
+	Register("langtag", func(arg string) (Processor, error) {
+		var langs []string
+		if arg != "" {
+			langs = strings.Split(arg, "+")
+		}
+		for _, lang := range langs {
+			if _, ok := stopwords[lang]; !ok {
+				return nil, fmt.Errorf("can't tag %q (available: %s)", lang, strings.Join(TaggedLangs(), ", "))
+			}
+		}
+		return &LangTag{Langs: langs}, nil
+	})
+}
+
+// LangTag tags every line with the language it's in, for recordings that
+// switch languages. Lines that don't give their language away, like a
+// name, take the language of the line before them, or the transcript's.
+// Transcripts without lines are left alone.
+type LangTag struct {
+	// Langs are the languages spoken in the recordings; empty means any
+	// tagged language.
+	Langs []string
+}
+
+func (l *LangTag) Name() string { return "langtag" }
+
+func (l *LangTag) Process(ctx context.Context, t *Transcript) error {
+	TagLines(t.Lines, l.Langs, t.Lang)
+	return nil
+}
+
+// TagLines sets the language of lines, see LangTag. fallback is used until
+// a line's language is detected.
+func TagLines(lines []Line, langs []string, fallback string) {
+	prev := fallback
+	for i := range lines {
+		if lang := DetectLang(lines[i].Text, langs); lang != "" {
+			prev = lang
+		}
+		lines[i].Lang = prev
+	}
+}
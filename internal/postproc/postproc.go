@@ -0,0 +1,113 @@
+// Package postproc implements the transcript post-processing pipeline: an
+// ordered chain of processors that rewrite transcripts after inference.
+package postproc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Line is a timed segment of a transcript.
+type Line struct {
+	Text      string  `json:"text"`
+	StartTime float64 `json:"start_time"`
+	Duration  float64 `json:"duration"`
+	Speaker   uint32  `json:"speaker"`
+	// SpeakerName is the recognized speaker, if any.
+	SpeakerName string `json:"speaker_name,omitempty"`
+	// Lang is set by the langtag processor.
+	Lang string `json:"lang,omitempty"`
+	// Tags added by the sentiment processor.
+	Sentiment string `json:"sentiment,omitempty"`
+	Emotion   string `json:"emotion,omitempty"`
+}
+
+// Chapter is a titled section of a long transcript. StartTime is only set
+// when the transcript has line timings.
+type Chapter struct {
+	Title     string  `json:"title"`
+	StartTime float64 `json:"start_time"`
+	Text      string  `json:"text"`
+}
+
+// Transcript is the part of a transcription result processors can change.
+type Transcript struct {
+	Text     string    `json:"text"`
+	Lines    []Line    `json:"lines"`
+	Chapters []Chapter `json:"chapters,omitempty"`
+	Lang     string    `json:"lang"`
+	Engine   string    `json:"engine"`
+	Model    string    `json:"model"`
+}
+
+// Processor rewrites a transcript in place.
+type Processor interface {
+	Name() string
+	Process(ctx context.Context, t *Transcript) error
+}
+
+// Factory builds a processor from the argument in its spec ("name:arg").
+type Factory func(arg string) (Processor, error)
+
+var factories = map[string]Factory{}
+
+// Register makes a processor available to Parse under name.
+func Register(name string, f Factory) {
+	factories[name] = f
+}
+
+// Names returns the registered processor names.
+func Names() []string {
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Pipeline runs processors in order.
+type Pipeline []Processor
+
+// Parse builds a pipeline from a comma-separated list of processor specs,
+// e.g. "punctuate,dictionary:/etc/lunartlk/words.txt,exec:/usr/local/bin/fix".
+func Parse(specs string) (Pipeline, error) {
+	var p Pipeline
+	for _, spec := range strings.Split(specs, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		name, arg, _ := strings.Cut(spec, ":")
+		f, ok := factories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown post-processor %q (available: %s)", name, strings.Join(Names(), ", "))
+		}
+		proc, err := f(arg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		p = append(p, proc)
+	}
+	return p, nil
+}
+
+// Run applies every processor to t, stopping at the first error.
+func (p Pipeline) Run(ctx context.Context, t *Transcript) error {
+	for _, proc := range p {
+		if err := proc.Process(ctx, t); err != nil {
+			return fmt.Errorf("%s: %w", proc.Name(), err)
+		}
+	}
+	return nil
+}
+
+// mapText applies fn to the full text and to every line.
+func mapText(t *Transcript, fn func(string) string) {
+	t.Text = fn(t.Text)
+	for i := range t.Lines {
+		t.Lines[i].Text = fn(t.Lines[i].Text)
+	}
+}
@@ -0,0 +1,119 @@
+package postproc
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// profanity are the words masked by the profanity filter, by language.
+// Entries ending in * also match the words they start, e.g. "fuck*"
+// matches "fucking", so they're only used for stems no innocent word
+// starts with.
+var profanity = map[string][]string{
+	"en": {
+		"arse", "arses", "arsehole*", "ass", "asses", "asshole*", "bastard*", "bitch*", "bollocks",
+		"bullshit*", "cock", "cocks", "cocksucker*", "crap", "crappy", "cunt*", "damn", "dick",
+		"dickhead*", "dumbass*", "fag", "fags", "faggot*", "fuck*", "goddamn*", "jackass*",
+		"motherfuck*", "piss", "pissed", "prick", "pricks", "pussy", "shit", "shits", "shitty",
+		"shitting", "shithead*", "shithole*", "slut*", "twat*", "wanker*", "whore*",
+	},
+	"es": {
+		"cabrón", "cabron", "cabrona*", "cabrones", "carajo", "cojón", "cojones", "coño",
+		"culero*", "follar", "gilipolla*", "hijoputa*", "hostia*", "joder", "jodido*",
+		"maricón", "maricon*", "mierda*", "pendejo*", "polla", "pollas", "puta", "putas",
+		"puto", "putos", "zorra*",
+	},
+}
+
+// Profanity masking styles.
+const (
+	// MaskFirst keeps the first letter: "f***".
+	MaskFirst = "first"
+	// MaskStars replaces every letter: "****".
+	MaskStars = "stars"
+	// MaskTag replaces the word with "[censored]".
+	MaskTag = "tag"
+)
+
+func init() {
+	Register("profanity", func(arg string) (Processor, error) {
+		if arg == "" {
+			arg = MaskFirst
+		}
+		return NewProfanity(arg)
+	})
+}
+
+// Profanity masks swear words, from a list for the transcript's language,
+// or from every list when the language has none.
+type Profanity struct {
+	style    string
+	patterns map[string]*regexp.Regexp
+	all      *regexp.Regexp
+}
+
+// NewProfanity returns a profanity filter masking words in the given
+// style: MaskFirst, MaskStars or MaskTag.
+func NewProfanity(style string) (*Profanity, error) {
+	switch style {
+	case MaskFirst, MaskStars, MaskTag:
+	default:
+		return nil, fmt.Errorf("unknown masking style %q, use %s, %s or %s", style, MaskFirst, MaskStars, MaskTag)
+	}
+	p := &Profanity{style: style, patterns: map[string]*regexp.Regexp{}}
+	var all []string
+	for _, lang := range slices.Sorted(maps.Keys(profanity)) {
+		p.patterns[lang] = wordsPattern(profanity[lang])
+		all = append(all, profanity[lang]...)
+	}
+	p.all = wordsPattern(all)
+	return p, nil
+}
+
+// wordsPattern matches any of words, longest first, so a word isn't cut
+// short by another it starts with.
+func wordsPattern(words []string) *regexp.Regexp {
+	words = slices.Clone(words)
+	slices.SortStableFunc(words, func(a, b string) int { return len(b) - len(a) })
+	alts := make([]string, len(words))
+	for i, w := range words {
+		if stem, ok := strings.CutSuffix(w, "*"); ok {
+			alts[i] = regexp.QuoteMeta(stem) + `[\p{L}\p{N}_]*`
+		} else {
+			alts[i] = regexp.QuoteMeta(w)
+		}
+	}
+	return regexp.MustCompile("(?i)(?:" + strings.Join(alts, "|") + ")")
+}
+
+func (p *Profanity) Name() string { return "profanity" }
+
+func (p *Profanity) Process(ctx context.Context, t *Transcript) error {
+	re, ok := p.patterns[t.Lang]
+	if !ok {
+		re = p.all
+	}
+	mask := func(s string) string { return replaceWordsFunc(s, re, p.mask) }
+	mapText(t, mask)
+	for i := range t.Chapters {
+		t.Chapters[i].Title = mask(t.Chapters[i].Title)
+		t.Chapters[i].Text = mask(t.Chapters[i].Text)
+	}
+	return nil
+}
+
+func (p *Profanity) mask(word string) string {
+	switch p.style {
+	case MaskTag:
+		return "[censored]"
+	case MaskStars:
+		return strings.Repeat("*", utf8.RuneCountInString(word))
+	}
+	first, size := utf8.DecodeRuneInString(word)
+	return string(first) + strings.Repeat("*", utf8.RuneCountInString(word[size:]))
+}
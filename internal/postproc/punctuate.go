@@ -0,0 +1,38 @@
+package postproc
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func init() {
+	Register("punctuate", func(string) (Processor, error) { return punctuate{}, nil })
+}
+
+// punctuate capitalizes the first letter and terminates the text with a
+// period when the engine left it unpunctuated.
+type punctuate struct{}
+
+func (punctuate) Name() string { return "punctuate" }
+
+func (punctuate) Process(ctx context.Context, t *Transcript) error {
+	mapText(t, punctuateText)
+	return nil
+}
+
+func punctuateText(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return s
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	s = string(unicode.ToUpper(r)) + s[size:]
+
+	last, _ := utf8.DecodeLastRuneInString(s)
+	if !strings.ContainsRune(".?!…", last) {
+		s += "."
+	}
+	return s
+}
@@ -0,0 +1,153 @@
+package postproc
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/rubiojr/lunartlk/translate"
+)
+
+// namesPrompt asks for the names of the people in a transcript. The target
+// language the translate backend passes first is irrelevant here.
+const namesPrompt = "List the names of the people mentioned in this transcript, one per line, " +
+	"exactly as they are written in it, and every form used (full name, first name, surname). " +
+	"Return only the names, or nothing if there are none.\n\n%[2]s"
+
+// Masks replacing redacted text.
+const (
+	maskEmail = "[EMAIL]"
+	maskPhone = "[PHONE]"
+	maskCard  = "[CARD]"
+	maskName  = "[NAME]"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`(?i)\b[a-z0-9._%+-]+@[a-z0-9-]+(?:\.[a-z0-9-]+)*\.[a-z]{2,}\b`)
+	// Spoken addresses, as engines transcribe them: "ana at example dot com"
+	spokenEmailPattern = regexp.MustCompile(`(?i)\b[a-z0-9._-]+\s+(?:at|arroba)\s+[a-z0-9-]+(?:\s+(?:dot|punto)\s+[a-z]{2,})+\b`)
+	cardPattern        = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	phonePattern       = regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?(?:\(\d{1,4}\)[ .-]?)?\d{2,4}(?:[ .-]?\d{2,4}){1,4}\b`)
+)
+
+// minPhoneDigits keeps years, amounts and times from being taken for phone
+// numbers.
+const minPhoneDigits = 7
+
+func init() {
+	Register("redact", func(arg string) (Processor, error) {
+		return NewRedact(arg), nil
+	})
+}
+
+// NewRedact returns a Redact that finds names with the given Ollama model,
+// or masks only what the patterns find when model is empty.
+func NewRedact(model string) *Redact {
+	r := &Redact{}
+	if model != "" {
+		r.LLM = translate.NewOllama(translate.WithModel(model), translate.WithPrompt(namesPrompt))
+	}
+	return r
+}
+
+// Redact masks personal information in transcripts: email addresses,
+// phone numbers and payment card numbers, found with patterns, and the
+// names of people when an LLM is set to find them.
+type Redact struct {
+	LLM translate.Translator
+}
+
+func (r *Redact) Name() string { return "redact" }
+
+func (r *Redact) Process(ctx context.Context, t *Transcript) error {
+	var names *Dictionary
+	if r.LLM != nil {
+		out, err := r.LLM.Translate(ctx, t.Text, "")
+		if err != nil {
+			return err
+		}
+		names = nameMasks(out)
+	}
+	mask := func(s string) string {
+		s = RedactPatterns(s)
+		if names != nil {
+			s = names.Replace(s)
+		}
+		return s
+	}
+	mapText(t, mask)
+	for i := range t.Chapters {
+		t.Chapters[i].Title = mask(t.Chapters[i].Title)
+		t.Chapters[i].Text = mask(t.Chapters[i].Text)
+	}
+	return nil
+}
+
+// RedactPatterns masks the email addresses, card numbers and phone
+// numbers in s.
+func RedactPatterns(s string) string {
+	s = emailPattern.ReplaceAllString(s, maskEmail)
+	s = spokenEmailPattern.ReplaceAllString(s, maskEmail)
+	s = cardPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if !luhn(m) {
+			return m
+		}
+		return maskCard
+	})
+	return phonePattern.ReplaceAllStringFunc(s, func(m string) string {
+		if countDigits(m) < minPhoneDigits {
+			return m
+		}
+		return maskPhone
+	})
+}
+
+// nameMasks builds replacements for the names the LLM listed, longest
+// first, so full names are masked before their parts.
+func nameMasks(out string) *Dictionary {
+	var names []string
+	for _, line := range strings.Split(out, "\n") {
+		name := strings.Trim(line, " \t-*•\"'.,")
+		if len([]rune(name)) > 1 {
+			names = append(names, name)
+		}
+	}
+	sort.SliceStable(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	d := &Dictionary{}
+	for _, name := range names {
+		d.Add(name, maskName)
+	}
+	return d
+}
+
+// luhn reports whether the digits in s pass the Luhn check payment card
+// numbers carry.
+func luhn(s string) bool {
+	var sum, n int
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if n%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		n++
+	}
+	return n > 0 && sum%10 == 0
+}
+
+func countDigits(s string) int {
+	n := 0
+	for _, c := range s {
+		if c >= '0' && c <= '9' {
+			n++
+		}
+	}
+	return n
+}
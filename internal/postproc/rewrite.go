@@ -0,0 +1,67 @@
+package postproc
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/rubiojr/lunartlk/translate"
+)
+
+// rewritePrompts turn a dictated transcript into a polished text, by
+// style. The target language the translate backend passes first is
+// irrelevant here: the text stays in the transcript's language.
+var rewritePrompts = map[string]string{
+	"email": "Rewrite this dictated transcript as a clear, polite email in the same language, " +
+		"with a greeting, paragraphs and a sign-off. Fix grammar and remove fillers and false starts, " +
+		"but keep every fact, name and number. Return only the email.\n\n%[2]s",
+	"note": "Rewrite this dictated transcript as a concise note in the same language, with complete sentences " +
+		"and paragraphs. Fix grammar and remove fillers, repetitions and false starts, but keep every fact, " +
+		"name and number. Return only the note.\n\n%[2]s",
+	"bullet": "Rewrite this dictated transcript as a list of short bullet points in the same language, " +
+		"one idea per bullet, starting each with \"- \". Keep every fact, name and number. " +
+		"Return only the list.\n\n%[2]s",
+}
+
+// RewriteStyles returns the styles Rewriter accepts.
+func RewriteStyles() []string {
+	return slices.Sorted(maps.Keys(rewritePrompts))
+}
+
+// Rewriter polishes transcripts with an LLM, e.g. into an email or a
+// bullet list. Unlike processors, it returns the polished text instead of
+// changing the transcript, so the original can be kept next to it.
+type Rewriter struct {
+	llms map[string]translate.Translator
+}
+
+// NewRewriter returns a Rewriter using the given Ollama model.
+func NewRewriter(model string) *Rewriter {
+	r := &Rewriter{llms: map[string]translate.Translator{}}
+	for style, prompt := range rewritePrompts {
+		r.llms[style] = translate.NewOllama(translate.WithModel(model), translate.WithPrompt(prompt))
+	}
+	return r
+}
+
+// CheckRewriteStyle returns an error for styles Rewrite doesn't know.
+func CheckRewriteStyle(style string) error {
+	if _, ok := rewritePrompts[style]; !ok {
+		return fmt.Errorf("unknown rewrite style %q, use %s", style, strings.Join(RewriteStyles(), ", "))
+	}
+	return nil
+}
+
+// Rewrite returns text rewritten in the given style.
+func (r *Rewriter) Rewrite(ctx context.Context, style, text string) (string, error) {
+	if err := CheckRewriteStyle(style); err != nil {
+		return "", err
+	}
+	out, err := r.llms[style].Translate(ctx, text, "")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(out), nil
+}
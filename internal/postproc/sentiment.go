@@ -0,0 +1,89 @@
+package postproc
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rubiojr/lunartlk/translate"
+)
+
+// sentimentPrompt asks for the sentiment and emotion of every line. The
+// target language the translate backend passes first is irrelevant here.
+const sentimentPrompt = "For each numbered line of this transcript, give the speaker's sentiment " +
+	"(positive, neutral or negative) and emotion (joy, anger, frustration, sadness, fear, surprise or none). " +
+	"Return one line per transcript line in the form \"N: sentiment, emotion\". " +
+	"Return only those lines.\n\n%[2]s"
+
+var (
+	sentiments = []string{"positive", "neutral", "negative"}
+	emotions   = []string{"joy", "anger", "frustration", "sadness", "fear", "surprise", "none"}
+)
+
+// sentimentBatch is how many lines are sent to the LLM at once, so long
+// recordings don't overflow small models' context.
+const sentimentBatch = 50
+
+func init() {
+	Register("sentiment", func(arg string) (Processor, error) {
+		if arg == "" {
+			return nil, fmt.Errorf("missing Ollama model, use sentiment:MODEL")
+		}
+		llm := translate.NewOllama(translate.WithModel(arg), translate.WithPrompt(sentimentPrompt))
+		return &Sentiment{LLM: llm}, nil
+	})
+}
+
+// Sentiment tags every transcript line with its sentiment and emotion,
+// using an LLM. Transcripts without lines are left alone.
+type Sentiment struct {
+	LLM translate.Translator
+}
+
+func (s *Sentiment) Name() string { return "sentiment" }
+
+func (s *Sentiment) Process(ctx context.Context, t *Transcript) error {
+	for start := 0; start < len(t.Lines); start += sentimentBatch {
+		batch := t.Lines[start:min(start+sentimentBatch, len(t.Lines))]
+		var numbered strings.Builder
+		for i, l := range batch {
+			fmt.Fprintf(&numbered, "%d. %s\n", i+1, strings.TrimSpace(l.Text))
+		}
+		out, err := s.LLM.Translate(ctx, numbered.String(), "")
+		if err != nil {
+			return err
+		}
+		for i, tag := range parseSentiments(out, len(batch)) {
+			batch[i].Sentiment, batch[i].Emotion = tag.sentiment, tag.emotion
+		}
+	}
+	return nil
+}
+
+type sentimentTag struct {
+	sentiment, emotion string
+}
+
+var sentimentLine = regexp.MustCompile(`(?m)^\W*(\d+)\s*[:.)-]\s*(\w+)\W*(\w*)`)
+
+// parseSentiments reads the "N: sentiment, emotion" lines of the LLM
+// answer. Lines it skipped or tagged with unknown labels stay untagged,
+// and an emotion of "none" is left empty.
+func parseSentiments(out string, n int) map[int]sentimentTag {
+	tags := map[int]sentimentTag{}
+	for _, m := range sentimentLine.FindAllStringSubmatch(out, -1) {
+		line, err := strconv.Atoi(m[1])
+		sentiment, emotion := strings.ToLower(m[2]), strings.ToLower(m[3])
+		if err != nil || line < 1 || line > n || !slices.Contains(sentiments, sentiment) {
+			continue
+		}
+		if !slices.Contains(emotions, emotion) || emotion == "none" {
+			emotion = ""
+		}
+		tags[line-1] = sentimentTag{sentiment: sentiment, emotion: emotion}
+	}
+	return tags
+}
@@ -0,0 +1,157 @@
+// Package queue provides a counting semaphore whose waiters are served by
+// priority, so interactive requests get ahead of queued batch work.
+package queue
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrQueueFull is returned by Acquire when no slot is free and a bounded
+// semaphore already has as many waiters as it allows.
+var ErrQueueFull = errors.New("queue full")
+
+// Priority orders waiters; lower values are served first.
+type Priority int
+
+const (
+	// Interactive is for live dictation, where latency matters.
+	Interactive Priority = iota
+	// Batch is for bulk jobs that can wait.
+	Batch
+
+	numPriorities
+)
+
+func (p Priority) String() string {
+	switch p {
+	case Interactive:
+		return "interactive"
+	case Batch:
+		return "batch"
+	}
+	return fmt.Sprintf("Priority(%d)", int(p))
+}
+
+// ParsePriority parses "interactive" or "batch".
+func ParsePriority(s string) (Priority, error) {
+	switch s {
+	case "interactive":
+		return Interactive, nil
+	case "batch":
+		return Batch, nil
+	}
+	return 0, fmt.Errorf("unknown priority '%s', use 'interactive' or 'batch'", s)
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a context carrying p.
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority stored in ctx, Interactive by default.
+func PriorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return Interactive
+}
+
+// Semaphore limits concurrent holders to a fixed number of slots. When all
+// slots are taken, waiters are woken in priority order, FIFO within the
+// same priority.
+type Semaphore struct {
+	mu      sync.Mutex
+	slots   int
+	inUse   int
+	waiters [numPriorities]list.List // of chan struct{}
+	// maxWaiting bounds the waiters, when not negative.
+	maxWaiting int
+}
+
+// NewSemaphore creates a semaphore with the given number of slots.
+func NewSemaphore(slots int) *Semaphore {
+	return &Semaphore{slots: slots, maxWaiting: -1}
+}
+
+// NewBoundedSemaphore creates a semaphore with the given number of slots,
+// where at most maxWaiting callers wait for one. Acquire fails with
+// ErrQueueFull beyond them.
+func NewBoundedSemaphore(slots, maxWaiting int) *Semaphore {
+	return &Semaphore{slots: slots, maxWaiting: maxWaiting}
+}
+
+// Acquire takes a slot, waiting with the priority stored in ctx. It returns
+// ctx.Err() if ctx is done before a slot is available, and ErrQueueFull
+// when a bounded semaphore has no room left to wait.
+func (s *Semaphore) Acquire(ctx context.Context) error {
+	p := PriorityFrom(ctx)
+	if p < 0 || p >= numPriorities {
+		p = Batch
+	}
+
+	s.mu.Lock()
+	if s.inUse < s.slots && s.waitingLocked() == 0 {
+		s.inUse++
+		s.mu.Unlock()
+		return nil
+	}
+	if s.maxWaiting >= 0 && s.waitingLocked() >= s.maxWaiting {
+		s.mu.Unlock()
+		return ErrQueueFull
+	}
+	ready := make(chan struct{})
+	el := s.waiters[p].PushBack(ready)
+	s.mu.Unlock()
+
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		s.mu.Lock()
+		select {
+		case <-ready:
+			// Granted while giving up: pass the slot on
+			s.mu.Unlock()
+			s.Release()
+		default:
+			s.waiters[p].Remove(el)
+			s.mu.Unlock()
+		}
+		return ctx.Err()
+	}
+}
+
+// Release returns a slot, handing it to the highest-priority waiter.
+func (s *Semaphore) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p := range s.waiters {
+		if el := s.waiters[p].Front(); el != nil {
+			s.waiters[p].Remove(el)
+			close(el.Value.(chan struct{}))
+			return
+		}
+	}
+	s.inUse--
+}
+
+// Waiting returns the number of callers blocked in Acquire.
+func (s *Semaphore) Waiting() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.waitingLocked()
+}
+
+func (s *Semaphore) waitingLocked() int {
+	n := 0
+	for p := range s.waiters {
+		n += s.waiters[p].Len()
+	}
+	return n
+}
@@ -0,0 +1,159 @@
+// Package resample converts audio between sample rates, either quickly by
+// linear interpolation or with a windowed-sinc filter that keeps archived
+// and transcribed audio free of aliasing.
+package resample
+
+import (
+	"fmt"
+	"math"
+)
+
+// Quality selects the resampling algorithm.
+type Quality int
+
+const (
+	// High uses a polyphase windowed-sinc filter: no audible aliasing or
+	// muffling, at some CPU cost.
+	High Quality = iota
+	// Linear interpolates between neighbouring samples. It's cheap but
+	// aliases when downsampling and dulls high frequencies.
+	Linear
+)
+
+// ParseQuality parses "high" or "linear".
+func ParseQuality(s string) (Quality, error) {
+	switch s {
+	case "high":
+		return High, nil
+	case "linear":
+		return Linear, nil
+	}
+	return 0, fmt.Errorf("invalid resampling quality %q, use high or linear", s)
+}
+
+func (q Quality) String() string {
+	if q == Linear {
+		return "linear"
+	}
+	return "high"
+}
+
+const (
+	// zeroCrossings is the number of sinc lobes on each side of the
+	// filter's center, at the lower of the two rates.
+	zeroCrossings = 16
+	// kaiserBeta shapes the window for about 90dB of stopband attenuation.
+	kaiserBeta = 8.6
+	// rolloff puts the cutoff a little below Nyquist, so the transition
+	// band doesn't fold back into the audio.
+	rolloff = 0.95
+	// maxPhases caps the filter phases precomputed. Rates with a small
+	// common divisor, e.g. 44101 to 16000, would need one per output
+	// sample position otherwise; past the cap each output sample takes the
+	// phase just before its position, off by under a thousandth of a
+	// sample.
+	maxPhases = 1024
+	// maxHalf caps the taps on each side of the filter's center, reached
+	// only when downsampling by over 60 times.
+	maxHalf = 1024
+)
+
+// Resample converts samples from one rate to another.
+func Resample(samples []float32, from, to int, q Quality) []float32 {
+	if from == to || len(samples) == 0 {
+		return samples
+	}
+	if q == Linear {
+		return linear(samples, from, to)
+	}
+	return sinc(samples, from, to)
+}
+
+func linear(samples []float32, from, to int) []float32 {
+	n := int(int64(len(samples)) * int64(to) / int64(from))
+	out := make([]float32, n)
+	step := float64(from) / float64(to)
+	for i := range out {
+		pos := float64(i) * step
+		j := int(pos)
+		frac := float32(pos - float64(j))
+		next := samples[min(j+1, len(samples)-1)]
+		out[i] = samples[j] + (next-samples[j])*frac
+	}
+	return out
+}
+
+// sinc resamples with a polyphase filter. The ratio to/from is reduced to
+// up/down, and output sample i sits at input position i*down/up: its
+// fractional part is one of up phases, each with precomputed taps, or
+// the one just before it of maxPhases when up is larger.
+func sinc(samples []float32, from, to int) []float32 {
+	g := gcd(from, to)
+	up, down := to/g, from/g
+
+	// Low-pass at the lower Nyquist frequency, relative to the input rate
+	cutoff := rolloff * min(1, float64(to)/float64(from))
+	half := min(int(math.Ceil(zeroCrossings/cutoff)), maxHalf)
+
+	phases := min(up, maxPhases)
+	taps := make([][]float32, phases)
+	for p := range taps {
+		frac := float64(p) / float64(phases)
+		taps[p] = make([]float32, 2*half)
+		for k := range taps[p] {
+			// Distance from the output position to input sample k-half+1
+			x := float64(k-half+1) - frac
+			w := kaiser(x / float64(half))
+			taps[p][k] = float32(cutoff * sincFn(cutoff*x) * w)
+		}
+	}
+
+	n := int(int64(len(samples)) * int64(up) / int64(down))
+	out := make([]float32, n)
+	for i := range out {
+		pos := int64(i) * int64(down)
+		base := int(pos / int64(up))
+		h := taps[pos%int64(up)*int64(phases)/int64(up)]
+		var sum float32
+		start := base - half + 1
+		for k, c := range h {
+			if j := start + k; j >= 0 && j < len(samples) {
+				sum += samples[j] * c
+			}
+		}
+		out[i] = sum
+	}
+	return out
+}
+
+func sincFn(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// kaiser is the Kaiser window for x in [-1, 1].
+func kaiser(x float64) float64 {
+	if x < -1 || x > 1 {
+		return 0
+	}
+	return besselI0(kaiserBeta*math.Sqrt(1-x*x)) / besselI0(kaiserBeta)
+}
+
+// besselI0 is the zeroth-order modified Bessel function of the first kind.
+func besselI0(x float64) float64 {
+	sum, term := 1.0, 1.0
+	for k := 1; term > sum*1e-12; k++ {
+		term *= (x / (2 * float64(k))) * (x / (2 * float64(k)))
+		sum += term
+	}
+	return sum
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
@@ -0,0 +1,39 @@
+package resample
+
+import (
+	"math"
+	"testing"
+)
+
+// TestSincPhases resamples a 440Hz tone between rates with no common
+// divisor, where the phases are capped, and checks it against the tone at
+// the new rate.
+func TestSincPhases(t *testing.T) {
+	tests := []struct{ from, to int }{
+		{44100, 16000},
+		{44101, 16000},
+		{191999, 16000},
+		{8000, 48001},
+	}
+	for _, tt := range tests {
+		in := tone(tt.from, tt.from/10)
+		out := Resample(in, tt.from, tt.to, High)
+		want := tone(tt.to, len(out))
+		var worst float64
+		// The filter's edges are left out, where it runs past the input
+		for i := len(out) / 4; i < len(out)*3/4; i++ {
+			worst = max(worst, math.Abs(float64(out[i]-want[i])))
+		}
+		if worst > 0.01 {
+			t.Errorf("%d to %d: off by up to %.4f", tt.from, tt.to, worst)
+		}
+	}
+}
+
+func tone(rate, n int) []float32 {
+	s := make([]float32, n)
+	for i := range s {
+		s[i] = float32(0.5 * math.Sin(2*math.Pi*440*float64(i)/float64(rate)))
+	}
+	return s
+}
@@ -0,0 +1,366 @@
+// Package script runs user Starlark scripts over transcription results,
+// for custom workflows that don't justify recompiling the server.
+//
+// A script is a .star file defining process(t), where t is a dict with
+// the transcript: text, lines, chapters, lang, engine, model,
+// audio_duration and fields. process can change it in place or return a
+// new dict. Keys it adds end up in the response's fields, and setting
+// t["save"] = False keeps the transcript from being stored.
+package script
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+
+	"github.com/rubiojr/lunartlk/api"
+)
+
+// maxSteps bounds how long a script can run, so a loop can't hang a
+// request.
+const maxSteps = 10_000_000
+
+// known are the transcript keys that aren't custom fields.
+var known = []string{"text", "lines", "chapters", "lang", "engine", "model", "audio_duration", "fields", "save"}
+
+// Script is a loaded script.
+type Script struct {
+	Name    string
+	process starlark.Callable
+}
+
+// Set is the scripts run over every transcript, in order.
+type Set []*Script
+
+// LoadDir loads the .star files in dir, in name order. A missing dir has
+// no scripts.
+func LoadDir(dir string) (Set, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.star"))
+	if err != nil {
+		return nil, err
+	}
+	slices.Sort(paths)
+	var set Set
+	for _, p := range paths {
+		s, err := Load(p)
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, s)
+	}
+	return set, nil
+}
+
+// Load loads a script file, which must define process(t).
+func Load(path string) (*Script, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Base(path)
+	thread := newThread(name)
+	predeclared := starlark.StringDict{"json": json.Module}
+	globals, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, path, src, predeclared)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	// Requests run the script concurrently, so its globals can't change
+	globals.Freeze()
+	process, ok := globals["process"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s: no process(t) function", name)
+	}
+	return &Script{Name: name, process: process}, nil
+}
+
+func newThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(_ *starlark.Thread, msg string) {
+			log.Printf("[script %s] %s", name, msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(maxSteps)
+	return thread
+}
+
+// Run runs the scripts over resp in order, and reports whether the
+// transcript should be stored.
+func (set Set) Run(ctx context.Context, resp *api.TranscriptResponse) (bool, error) {
+	save := true
+	for _, s := range set {
+		ok, err := s.Run(ctx, resp)
+		if err != nil {
+			return false, err
+		}
+		save = save && ok
+	}
+	return save, nil
+}
+
+// Run runs the script over resp, and reports whether the transcript
+// should be stored.
+func (s *Script) Run(ctx context.Context, resp *api.TranscriptResponse) (bool, error) {
+	thread := newThread(s.Name)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	t := toDict(resp)
+	out, err := starlark.Call(thread, s.process, starlark.Tuple{t}, nil)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", s.Name, err)
+	}
+	switch out := out.(type) {
+	case starlark.NoneType:
+	case *starlark.Dict:
+		t = out
+	default:
+		return false, fmt.Errorf("%s: process returned %s, want a dict or None", s.Name, out.Type())
+	}
+	save, err := fromDict(t, resp)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", s.Name, err)
+	}
+	return save, nil
+}
+
+func toDict(resp *api.TranscriptResponse) *starlark.Dict {
+	lines := make([]starlark.Value, len(resp.Lines))
+	for i, l := range resp.Lines {
+		lines[i] = dict(map[string]starlark.Value{
+			"text":         starlark.String(l.Text),
+			"start_time":   starlark.Float(l.StartTime),
+			"duration":     starlark.Float(l.Duration),
+			"speaker":      starlark.MakeInt(int(l.Speaker)),
+			"speaker_name": starlark.String(l.SpeakerName),
+			"lang":         starlark.String(l.Lang),
+			"sentiment":    starlark.String(l.Sentiment),
+			"emotion":      starlark.String(l.Emotion),
+		})
+	}
+	chapters := make([]starlark.Value, len(resp.Chapters))
+	for i, c := range resp.Chapters {
+		chapters[i] = dict(map[string]starlark.Value{
+			"title":      starlark.String(c.Title),
+			"start_time": starlark.Float(c.StartTime),
+			"text":       starlark.String(c.Text),
+		})
+	}
+	fields := starlark.NewDict(len(resp.Fields))
+	for k, v := range resp.Fields {
+		if sv, err := toValue(v); err == nil {
+			fields.SetKey(starlark.String(k), sv)
+		}
+	}
+	return dict(map[string]starlark.Value{
+		"text":           starlark.String(resp.Text),
+		"lines":          starlark.NewList(lines),
+		"chapters":       starlark.NewList(chapters),
+		"lang":           starlark.String(resp.Lang),
+		"engine":         starlark.String(resp.Engine),
+		"model":          starlark.String(resp.Model),
+		"audio_duration": starlark.Float(resp.AudioDuration),
+		"fields":         fields,
+		"save":           starlark.True,
+	})
+}
+
+func dict(m map[string]starlark.Value) *starlark.Dict {
+	d := starlark.NewDict(len(m))
+	for k, v := range m {
+		d.SetKey(starlark.String(k), v)
+	}
+	return d
+}
+
+// fromDict copies what a script may change back into resp: the text, the
+// lines' and chapters' text, and the fields.
+func fromDict(t *starlark.Dict, resp *api.TranscriptResponse) (bool, error) {
+	m := map[string]any{}
+	for _, item := range t.Items() {
+		k, ok := starlark.AsString(item[0])
+		if !ok {
+			return false, fmt.Errorf("transcript key %s isn't a string", item[0])
+		}
+		v, err := fromValue(item[1])
+		if err != nil {
+			return false, fmt.Errorf("%s: %w", k, err)
+		}
+		m[k] = v
+	}
+
+	if text, ok := m["text"].(string); ok {
+		resp.Text = text
+	}
+	if lines, ok := m["lines"].([]any); ok {
+		resp.Lines = resp.Lines[:0]
+		for _, l := range lines {
+			l, _ := l.(map[string]any)
+			resp.Lines = append(resp.Lines, api.TranscriptLine{
+				Text:        asString(l["text"]),
+				StartTime:   asFloat(l["start_time"]),
+				Duration:    asFloat(l["duration"]),
+				Speaker:     uint32(asFloat(l["speaker"])),
+				SpeakerName: asString(l["speaker_name"]),
+				Lang:        asString(l["lang"]),
+				Sentiment:   asString(l["sentiment"]),
+				Emotion:     asString(l["emotion"]),
+			})
+		}
+	}
+	if chapters, ok := m["chapters"].([]any); ok {
+		resp.Chapters = nil
+		for _, c := range chapters {
+			c, _ := c.(map[string]any)
+			resp.Chapters = append(resp.Chapters, api.Chapter{
+				Title:     asString(c["title"]),
+				StartTime: asFloat(c["start_time"]),
+				Text:      asString(c["text"]),
+			})
+		}
+	}
+
+	fields, _ := m["fields"].(map[string]any)
+	for k, v := range m {
+		if !slices.Contains(known, k) {
+			if fields == nil {
+				fields = map[string]any{}
+			}
+			fields[k] = v
+		}
+	}
+	if len(fields) > 0 {
+		resp.Fields = fields
+	} else {
+		resp.Fields = nil
+	}
+
+	save, ok := m["save"].(bool)
+	return save || !ok, nil
+}
+
+func asString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func asFloat(v any) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case int64:
+		return float64(v)
+	}
+	return 0
+}
+
+// fromValue converts a Starlark value to the Go value encoding/json
+// would decode it to, with int64 for integers.
+func fromValue(v starlark.Value) (any, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Int:
+		i, ok := v.Int64()
+		if !ok {
+			return nil, fmt.Errorf("integer %s out of range", v)
+		}
+		return i, nil
+	case starlark.Float:
+		return float64(v), nil
+	case *starlark.List, starlark.Tuple:
+		var out []any
+		iter := starlark.Iterate(v)
+		defer iter.Done()
+		var x starlark.Value
+		for iter.Next(&x) {
+			e, err := fromValue(x)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, e)
+		}
+		return out, nil
+	case *starlark.Dict:
+		out := map[string]any{}
+		for _, item := range v.Items() {
+			k, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("dict key %s isn't a string", item[0])
+			}
+			e, err := fromValue(item[1])
+			if err != nil {
+				return nil, err
+			}
+			out[k] = e
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("can't use a %s in a transcript", v.Type())
+}
+
+// toValue converts a value decoded from JSON, or built by fromValue, to
+// Starlark.
+func toValue(v any) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case float64:
+		return starlark.Float(v), nil
+	case []any:
+		elems := make([]starlark.Value, len(v))
+		for i, e := range v {
+			sv, err := toValue(e)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = sv
+		}
+		return starlark.NewList(elems), nil
+	case map[string]any:
+		d := starlark.NewDict(len(v))
+		for k, e := range v {
+			sv, err := toValue(e)
+			if err != nil {
+				return nil, err
+			}
+			d.SetKey(starlark.String(k), sv)
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("unsupported value %T", v)
+}
+
+// Names returns the names of the scripts, for logs.
+func (set Set) Names() string {
+	names := make([]string, len(set))
+	for i, s := range set {
+		names[i] = s.Name
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,61 @@
+package script
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rubiojr/lunartlk/api"
+)
+
+func loadScript(t *testing.T, src string) *Script {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.star")
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestRun(t *testing.T) {
+	s := loadScript(t, `
+def process(t):
+    t["text"] = t["text"].upper()
+    t["fields"]["words"] = len(t["text"].split())
+    t["save"] = t["lang"] != "es"
+`)
+	resp := &api.TranscriptResponse{Text: "hello there", Lang: "es"}
+	save, err := s.Run(context.Background(), resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if save || resp.Text != "HELLO THERE" || resp.Fields["words"] != int64(2) {
+		t.Errorf("save %v, text %q, fields %v", save, resp.Text, resp.Fields)
+	}
+}
+
+func TestGlobalsFrozen(t *testing.T) {
+	s := loadScript(t, `
+seen = []
+
+def process(t):
+    seen.append(t["text"])
+`)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			_, err := s.Run(context.Background(), &api.TranscriptResponse{Text: "hello"})
+			if err == nil || !strings.Contains(err.Error(), "frozen") {
+				t.Errorf("appending to a global: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,97 @@
+// Package seal encrypts audio with a key shared by the client and the
+// server, so the proxies and storage between them only ever see
+// ciphertext.
+package seal
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Ext is appended to the name of sealed files: recording.opus is sent as
+// recording.opus.enc.
+const Ext = ".enc"
+
+// KeySize is the length of a key in bytes, for AES-256.
+const KeySize = 32
+
+// magic starts every sealed file, versioning the format.
+var magic = []byte("LTE1")
+
+// ErrOpen is returned when sealed data can't be decrypted: it was sealed
+// with another key, or changed since.
+var ErrOpen = errors.New("can't decrypt: wrong key or corrupted data")
+
+// LoadKey reads a base64 encoded key from a file, as written by
+// "openssl rand -base64 32".
+func LoadKey(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: key isn't base64: %w", path, err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("%s: key is %d bytes, want %d", path, len(key), KeySize)
+	}
+	return key, nil
+}
+
+// IsSealed reports whether name is the name of a sealed file.
+func IsSealed(name string) bool {
+	return strings.HasSuffix(name, Ext)
+}
+
+// Seal encrypts data with AES-256-GCM. The result is the format magic, a
+// random nonce and the ciphertext.
+func Seal(key, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(magic), len(magic)+aead.NonceSize()+len(data)+aead.Overhead())
+	copy(out, magic)
+	nonce := out[len(magic) : len(magic)+aead.NonceSize()]
+	out = out[:len(magic)+aead.NonceSize()]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(out, nonce, data, magic), nil
+}
+
+// Open decrypts data sealed with Seal.
+func Open(key, data []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, magic) || len(data) < len(magic)+aead.NonceSize() {
+		return nil, errors.New("not sealed data")
+	}
+	data = data[len(magic):]
+	out, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], magic)
+	if err != nil {
+		return nil, ErrOpen
+	}
+	return out, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("key is %d bytes, want %d", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,148 @@
+// Package semantic implements meaning-based search over transcripts: an
+// embeddings index kept in a JSON file next to them, updated on demand.
+package semantic
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+)
+
+// embedBatch is the number of texts sent per embedding request.
+const embedBatch = 16
+
+// Index maps document IDs to embeddings of their text.
+type Index struct {
+	Model   string            `json:"model"`
+	Entries map[string]*entry `json:"entries"`
+}
+
+type entry struct {
+	// Sum is a hash of the embedded text, to notice edits.
+	Sum    string    `json:"sum"`
+	Vector []float32 `json:"vector"`
+}
+
+// Result is a search hit with its cosine similarity to the query.
+type Result struct {
+	ID    string  `json:"id"`
+	Score float64 `json:"score"`
+}
+
+// Load reads an index file. A missing file is an empty index.
+func Load(path string) (*Index, error) {
+	idx := &Index{Entries: make(map[string]*entry)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return idx, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, idx); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	if idx.Entries == nil {
+		idx.Entries = make(map[string]*entry)
+	}
+	return idx, nil
+}
+
+// Save writes the index to path atomically.
+func (idx *Index) Save(path string) error {
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Update makes the index match docs (text by ID): new and changed
+// documents are embedded, and removed ones dropped. Switching to another
+// model re-embeds everything. It reports whether the index changed.
+func (idx *Index) Update(ctx context.Context, e Embedder, docs map[string]string) (bool, error) {
+	changed := false
+	if idx.Model != e.Model() {
+		idx.Model = e.Model()
+		idx.Entries = make(map[string]*entry)
+		changed = true
+	}
+	for id := range idx.Entries {
+		if _, ok := docs[id]; !ok {
+			delete(idx.Entries, id)
+			changed = true
+		}
+	}
+
+	var ids, texts []string
+	for id, text := range docs {
+		if text == "" {
+			continue
+		}
+		if en, ok := idx.Entries[id]; !ok || en.Sum != sum(text) {
+			ids = append(ids, id)
+			texts = append(texts, text)
+		}
+	}
+	for start := 0; start < len(texts); start += embedBatch {
+		end := min(start+embedBatch, len(texts))
+		vecs, err := e.Embed(ctx, texts[start:end])
+		if err != nil {
+			return changed, err
+		}
+		for i, v := range vecs {
+			idx.Entries[ids[start+i]] = &entry{Sum: sum(texts[start+i]), Vector: v}
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// Search embeds query and returns the n most similar documents, best
+// first.
+func (idx *Index) Search(ctx context.Context, e Embedder, query string, n int) ([]Result, error) {
+	vecs, err := e.Embed(ctx, []string{query})
+	if err != nil {
+		return nil, err
+	}
+	results := []Result{}
+	for id, en := range idx.Entries {
+		results = append(results, Result{ID: id, Score: cosine(vecs[0], en.Vector)})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	if len(results) > n {
+		results = results[:n]
+	}
+	return results, nil
+}
+
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+func sum(text string) string {
+	h := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(h[:8])
+}
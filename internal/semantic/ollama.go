@@ -0,0 +1,73 @@
+package semantic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/rubiojr/lunartlk/translate"
+)
+
+// Embedder turns texts into embedding vectors.
+type Embedder interface {
+	// Model names the embedding model; vectors from different models
+	// can't be compared.
+	Model() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// Ollama computes embeddings with an Ollama embedding model such as
+// nomic-embed-text.
+type Ollama struct {
+	host  string
+	model string
+	http  *http.Client
+}
+
+// NewOllama returns an embedder using model on the Ollama server at host,
+// or at translate.DefaultHost() when host is empty.
+func NewOllama(model, host string) *Ollama {
+	if host == "" {
+		host = translate.DefaultHost()
+	}
+	return &Ollama{host: host, model: model, http: http.DefaultClient}
+}
+
+func (o *Ollama) Model() string { return o.model }
+
+// Embed returns one vector per text, in order.
+func (o *Ollama) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	body, err := json.Marshal(map[string]any{"model": o.model, "input": texts})
+	if err != nil {
+		return nil, fmt.Errorf("ollama: marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", o.host+"/api/embed", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("ollama: create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ollama: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("ollama: server returned %d: %s", resp.StatusCode, string(b))
+	}
+
+	var result struct {
+		Embeddings [][]float32 `json:"embeddings"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("ollama: decode response: %w", err)
+	}
+	if len(result.Embeddings) != len(texts) {
+		return nil, fmt.Errorf("ollama: got %d embeddings for %d texts", len(result.Embeddings), len(texts))
+	}
+	return result.Embeddings, nil
+}
@@ -0,0 +1,157 @@
+package speaker
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// Kaldi-style filterbank parameters, which speaker embedding models like
+// WeSpeaker and 3D-Speaker are trained on.
+const (
+	sampleRate  = 16000
+	frameLength = 400 // 25ms
+	frameShift  = 160 // 10ms
+	fftSize     = 512
+	numMelBins  = 80
+	lowFreq     = 20
+	preemphasis = 0.97
+)
+
+var (
+	poveyWindow = makePoveyWindow()
+	melBanks    = makeMelBanks()
+)
+
+// Fbank returns the log mel filterbank features of 16kHz audio, one
+// 80-bin frame per 10ms, with the mean of each bin subtracted.
+func Fbank(samples []float32) [][]float32 {
+	if len(samples) < frameLength {
+		return nil
+	}
+	n := 1 + (len(samples)-frameLength)/frameShift
+	feats := make([][]float32, n)
+	frame := make([]float64, frameLength)
+	buf := make([]complex128, fftSize)
+	for i := range feats {
+		// Samples are scaled to the 16-bit range, like Kaldi reads them
+		var mean float64
+		for j := range frame {
+			frame[j] = float64(samples[i*frameShift+j]) * 32768
+			mean += frame[j]
+		}
+		mean /= frameLength
+		for j := range frame {
+			frame[j] -= mean
+		}
+		for j := frameLength - 1; j > 0; j-- {
+			frame[j] -= preemphasis * frame[j-1]
+		}
+		frame[0] -= preemphasis * frame[0]
+
+		for j := range buf {
+			buf[j] = 0
+			if j < frameLength {
+				buf[j] = complex(frame[j]*poveyWindow[j], 0)
+			}
+		}
+		fft(buf)
+
+		feat := make([]float32, numMelBins)
+		for m, bank := range melBanks {
+			var e float64
+			for k, w := range bank.weights {
+				p := cmplx.Abs(buf[bank.first+k])
+				e += w * p * p
+			}
+			feat[m] = float32(math.Log(max(e, math.SmallestNonzeroFloat32)))
+		}
+		feats[i] = feat
+	}
+
+	for m := range numMelBins {
+		var mean float32
+		for _, f := range feats {
+			mean += f[m]
+		}
+		mean /= float32(len(feats))
+		for _, f := range feats {
+			f[m] -= mean
+		}
+	}
+	return feats
+}
+
+func makePoveyWindow() []float64 {
+	w := make([]float64, frameLength)
+	for i := range w {
+		w[i] = math.Pow(0.5-0.5*math.Cos(2*math.Pi*float64(i)/float64(frameLength-1)), 0.85)
+	}
+	return w
+}
+
+type melBank struct {
+	first   int // first FFT bin
+	weights []float64
+}
+
+func mel(hz float64) float64 { return 1127 * math.Log(1+hz/700) }
+
+// makeMelBanks returns triangular filters evenly spaced on the mel scale
+// from lowFreq to the Nyquist frequency.
+func makeMelBanks() []melBank {
+	lo, hi := mel(lowFreq), mel(sampleRate/2)
+	delta := (hi - lo) / (numMelBins + 1)
+	banks := make([]melBank, numMelBins)
+	for m := range banks {
+		left, center, right := lo+float64(m)*delta, lo+float64(m+1)*delta, lo+float64(m+2)*delta
+		bank := melBank{first: -1}
+		for k := range fftSize / 2 {
+			f := mel(float64(k) * sampleRate / fftSize)
+			if f <= left || f >= right {
+				if bank.first >= 0 {
+					break
+				}
+				continue
+			}
+			if bank.first < 0 {
+				bank.first = k
+			}
+			if f <= center {
+				bank.weights = append(bank.weights, (f-left)/(center-left))
+			} else {
+				bank.weights = append(bank.weights, (right-f)/(right-center))
+			}
+		}
+		if bank.first < 0 {
+			bank.first = 0
+		}
+		banks[m] = bank
+	}
+	return banks
+}
+
+// fft transforms x in place. len(x) must be a power of two.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			wk := complex(1, 0)
+			for k := range size / 2 {
+				a, b := x[start+k], x[start+k+size/2]*wk
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				wk *= w
+			}
+		}
+	}
+}
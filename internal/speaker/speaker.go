@@ -0,0 +1,249 @@
+// Package speaker recognizes enrolled speakers by their voiceprints,
+// embeddings computed by a speaker embedding model.
+package speaker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// MinSamples is the shortest audio an embedding is computed for, 1s at
+// 16kHz. Shorter clips don't say enough about a voice.
+const MinSamples = sampleRate
+
+// Model computes voiceprints with an ONNX speaker embedding model that
+// takes 80-bin filterbank features, shaped [1, frames, 80], and returns an
+// embedding shaped [1, dims], like the WeSpeaker and 3D-Speaker exports.
+type Model struct {
+	session *ort.DynamicAdvancedSession
+	// ONNX Runtime sessions are safe for concurrent use, but one
+	// embedding at a time keeps memory flat.
+	mu sync.Mutex
+}
+
+// LoadModel loads an embedding model. ONNX Runtime is initialized from
+// ortLibPath unless another model did already.
+func LoadModel(path, ortLibPath string) (*Model, error) {
+	if !ort.IsInitialized() {
+		ort.SetSharedLibraryPath(ortLibPath)
+		if err := ort.InitializeEnvironment(); err != nil {
+			return nil, fmt.Errorf("init onnxruntime: %w", err)
+		}
+	}
+	inputs, outputs, err := ort.GetInputOutputInfo(path)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", path, err)
+	}
+	if len(inputs) != 1 || len(outputs) == 0 {
+		return nil, fmt.Errorf("%s: expected one input and an output, has %d and %d", path, len(inputs), len(outputs))
+	}
+	session, err := ort.NewDynamicAdvancedSession(path,
+		[]string{inputs[0].Name}, []string{outputs[0].Name}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", path, err)
+	}
+	return &Model{session: session}, nil
+}
+
+// Close releases the model.
+func (m *Model) Close() error {
+	return m.session.Destroy()
+}
+
+// Embed returns the L2-normalized voiceprint of 16kHz audio, which must be
+// at least MinSamples long.
+func (m *Model) Embed(samples []float32) ([]float32, error) {
+	if len(samples) < MinSamples {
+		return nil, fmt.Errorf("audio too short for a voiceprint: %.1fs, needs %.0fs",
+			float64(len(samples))/sampleRate, float64(MinSamples)/sampleRate)
+	}
+	feats := Fbank(samples)
+	data := make([]float32, 0, len(feats)*numMelBins)
+	for _, f := range feats {
+		data = append(data, f...)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	in, err := ort.NewTensor(ort.NewShape(1, int64(len(feats)), numMelBins), data)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Destroy()
+	out := []ort.Value{nil}
+	if err := m.session.Run([]ort.Value{in}, out); err != nil {
+		return nil, fmt.Errorf("embedding model: %w", err)
+	}
+	defer out[0].Destroy()
+	t, ok := out[0].(*ort.Tensor[float32])
+	if !ok {
+		return nil, fmt.Errorf("embedding model: output isn't a float32 tensor")
+	}
+	return normalize(slices.Clone(t.GetData())), nil
+}
+
+func normalize(v []float32) []float32 {
+	var sum float64
+	for _, x := range v {
+		sum += float64(x) * float64(x)
+	}
+	if sum == 0 {
+		return v
+	}
+	n := float32(math.Sqrt(sum))
+	for i := range v {
+		v[i] /= n
+	}
+	return v
+}
+
+// Similarity returns the cosine similarity of two normalized voiceprints,
+// from -1 to 1.
+func Similarity(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return -1
+	}
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return dot
+}
+
+// Profile is an enrolled speaker.
+type Profile struct {
+	Name string `json:"name"`
+	// Embedding is the mean of the voiceprints of the enrollment clips.
+	Embedding []float32 `json:"embedding"`
+	// Clips is how many clips were enrolled.
+	Clips   int       `json:"clips"`
+	Updated time.Time `json:"updated"`
+}
+
+// Profiles are the enrolled speakers of a user, kept in a JSON file.
+type Profiles struct {
+	path   string
+	mu     sync.Mutex
+	byName map[string]*Profile
+}
+
+// LoadProfiles reads the profiles in path. A missing file has none.
+func LoadProfiles(path string) (*Profiles, error) {
+	p := &Profiles{path: path, byName: make(map[string]*Profile)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []*Profile
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+	for _, pr := range list {
+		p.byName[pr.Name] = pr
+	}
+	return p, nil
+}
+
+// List returns the profiles by name.
+func (p *Profiles) List() []Profile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	list := make([]Profile, 0, len(p.byName))
+	for _, pr := range p.byName {
+		list = append(list, *pr)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// Len returns the number of profiles.
+func (p *Profiles) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.byName)
+}
+
+// Enroll adds a voiceprint to the named speaker, creating it when it's new,
+// and saves the profiles.
+func (p *Profiles) Enroll(name string, embedding []float32) (Profile, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pr := p.byName[name]
+	switch {
+	case pr == nil:
+		pr = &Profile{Name: name, Embedding: slices.Clone(embedding)}
+		p.byName[name] = pr
+	case len(pr.Embedding) != len(embedding):
+		return Profile{}, fmt.Errorf("voiceprint of %s has %d dimensions, the model gives %d: remove it and enroll again",
+			name, len(pr.Embedding), len(embedding))
+	default:
+		// Running mean, normalized again
+		n := float32(pr.Clips)
+		for i := range pr.Embedding {
+			pr.Embedding[i] = (pr.Embedding[i]*n + embedding[i]) / (n + 1)
+		}
+		normalize(pr.Embedding)
+	}
+	pr.Clips++
+	pr.Updated = time.Now()
+	return *pr, p.save()
+}
+
+// Remove deletes the named speaker, reporting whether it existed.
+func (p *Profiles) Remove(name string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.byName[name]; !ok {
+		return false, nil
+	}
+	delete(p.byName, name)
+	return true, p.save()
+}
+
+// Identify returns the enrolled speaker whose voiceprint is most similar to
+// embedding, if the similarity is at least threshold.
+func (p *Profiles) Identify(embedding []float32, threshold float64) (string, float64, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	best, bestScore := "", -1.0
+	for name, pr := range p.byName {
+		if s := Similarity(embedding, pr.Embedding); s > bestScore {
+			best, bestScore = name, s
+		}
+	}
+	return best, bestScore, best != "" && bestScore >= threshold
+}
+
+func (p *Profiles) save() error {
+	list := make([]*Profile, 0, len(p.byName))
+	for _, pr := range p.byName {
+		list = append(list, pr)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0700); err != nil {
+		return err
+	}
+	tmp := p.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p.path)
+}
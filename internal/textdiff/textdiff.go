@@ -0,0 +1,237 @@
+// Package textdiff computes word-level differences between transcripts.
+package textdiff
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Op is a run of words that are equal in both texts, only in the second
+// (insert) or only in the first (delete).
+type Op struct {
+	Kind string `json:"op"`
+	Text string `json:"text"`
+}
+
+const (
+	Equal  = "equal"
+	Insert = "insert"
+	Delete = "delete"
+)
+
+// Words diffs a against b word by word. Words are compared ignoring case and
+// surrounding punctuation, so "Hola," and "hola" are considered equal.
+// Where the texts differ, the deleted words come before the inserted ones.
+func Words(a, b string) []Op {
+	aw := strings.Fields(a)
+	bw := strings.Fields(b)
+	d := &differ{a: normalize(aw), b: normalize(bw)}
+	d.compare(0, len(aw), 0, len(bw))
+
+	var ops []Op
+	var equal, deleted, inserted []string
+	flush := func(kind string, words *[]string) {
+		if len(*words) > 0 {
+			ops = append(ops, Op{Kind: kind, Text: strings.Join(*words, " ")})
+			*words = (*words)[:0]
+		}
+	}
+	for _, e := range d.edits {
+		switch e.kind {
+		case Equal:
+			flush(Delete, &deleted)
+			flush(Insert, &inserted)
+			equal = append(equal, bw[e.j])
+		case Delete:
+			flush(Equal, &equal)
+			deleted = append(deleted, aw[e.i])
+		case Insert:
+			flush(Equal, &equal)
+			inserted = append(inserted, bw[e.j])
+		}
+	}
+	flush(Equal, &equal)
+	flush(Delete, &deleted)
+	flush(Insert, &inserted)
+	return ops
+}
+
+// edit keeps, deletes or inserts a word: a[i] for deletions, b[j] for
+// insertions, both for equal words.
+type edit struct {
+	kind string
+	i, j int
+}
+
+// differ finds the shortest edit script from a to b with Myers'
+// algorithm, in linear space: each step finds the middle of the script
+// and recurses on the halves before and after it.
+type differ struct {
+	a, b  []string
+	edits []edit
+	// vf and vb are the furthest points reached on each diagonal, forwards
+	// and backwards, reused across steps.
+	vf, vb []int
+}
+
+// compare appends the edits from a[a0:a1] to b[b0:b1].
+func (d *differ) compare(a0, a1, b0, b1 int) {
+	// Common prefix and suffix
+	for a0 < a1 && b0 < b1 && d.a[a0] == d.b[b0] {
+		d.edits = append(d.edits, edit{Equal, a0, b0})
+		a0, b0 = a0+1, b0+1
+	}
+	suffix := 0
+	for a0 < a1-suffix && b0 < b1-suffix && d.a[a1-suffix-1] == d.b[b1-suffix-1] {
+		suffix++
+	}
+	a1, b1 = a1-suffix, b1-suffix
+
+	switch {
+	case a0 == a1:
+		for j := b0; j < b1; j++ {
+			d.edits = append(d.edits, edit{Insert, a0, j})
+		}
+	case b0 == b1:
+		for i := a0; i < a1; i++ {
+			d.edits = append(d.edits, edit{Delete, i, b0})
+		}
+	default:
+		x, y, u, v := d.middleSnake(a0, a1, b0, b1)
+		d.compare(a0, x, b0, y)
+		for ; x < u; x, y = x+1, y+1 {
+			d.edits = append(d.edits, edit{Equal, x, y})
+		}
+		d.compare(u, a1, v, b1)
+	}
+
+	for k := suffix; k > 0; k-- {
+		d.edits = append(d.edits, edit{Equal, a1 + suffix - k, b1 + suffix - k})
+	}
+}
+
+// middleSnake returns the run of equal words, from (x, y) to (u, v), in
+// the middle of a shortest edit script from a[a0:a1] to b[b0:b1]. Both
+// ranges are non-empty and differ at both ends.
+func (d *differ) middleSnake(a0, a1, b0, b1 int) (x, y, u, v int) {
+	n, m := a1-a0, b1-b0
+	delta := n - m
+	odd := delta%2 != 0
+	maxD := (n + m + 1) / 2
+	off := maxD + 1
+	if size := 2*maxD + 3; len(d.vf) < size {
+		d.vf, d.vb = make([]int, size), make([]int, size)
+	}
+	vf, vb := d.vf[:2*maxD+3], d.vb[:2*maxD+3]
+	clear(vf)
+	clear(vb)
+
+	for D := 0; D <= maxD; D++ {
+		// Forwards from (a0, b0); diagonal k is x - y = k
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vf[off+k-1] < vf[off+k+1]) {
+				x = vf[off+k+1]
+			} else {
+				x = vf[off+k-1] + 1
+			}
+			y, sx := x-k, x
+			for x < n && y < m && d.a[a0+x] == d.b[b0+y] {
+				x, y = x+1, y+1
+			}
+			vf[off+k] = x
+			if kb := delta - k; odd && kb >= -(D-1) && kb <= D-1 && x+vb[off+kb] >= n {
+				return a0 + sx, b0 + sx - k, a0 + x, b0 + y
+			}
+		}
+		// Backwards from (a1, b1), counting from the ends
+		for k := -D; k <= D; k += 2 {
+			var x int
+			if k == -D || (k != D && vb[off+k-1] < vb[off+k+1]) {
+				x = vb[off+k+1]
+			} else {
+				x = vb[off+k-1] + 1
+			}
+			y, sx := x-k, x
+			for x < n && y < m && d.a[a1-x-1] == d.b[b1-y-1] {
+				x, y = x+1, y+1
+			}
+			vb[off+k] = x
+			if kf := delta - k; !odd && kf >= -D && kf <= D && x+vf[off+kf] >= n {
+				return a1 - x, b1 - y, a1 - sx, b1 - sx + k
+			}
+		}
+	}
+	panic("textdiff: no middle snake")
+}
+
+func normalize(words []string) []string {
+	out := make([]string, len(words))
+	for i, w := range words {
+		out[i] = strings.ToLower(strings.TrimFunc(w, func(r rune) bool {
+			return unicode.IsPunct(r) || unicode.IsSymbol(r)
+		}))
+	}
+	return out
+}
+
+// Substitution is a run of words in the first text replaced by a run in
+// the second.
+type Substitution struct {
+	From, To string
+}
+
+// Substitutions returns the runs of up to maxWords words that b replaces in
+// a, without their surrounding punctuation. Words only deleted or only
+// inserted aren't substitutions.
+func Substitutions(a, b string, maxWords int) []Substitution {
+	trim := func(s string) string {
+		return strings.TrimFunc(s, func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSymbol(r) })
+	}
+	ops := Words(a, b)
+	var subs []Substitution
+	for i := 0; i+1 < len(ops); i++ {
+		if ops[i].Kind != Delete || ops[i+1].Kind != Insert {
+			continue
+		}
+		from, to := trim(ops[i].Text), trim(ops[i+1].Text)
+		if from == "" || to == "" || len(strings.Fields(from)) > maxWords || len(strings.Fields(to)) > maxWords {
+			continue
+		}
+		subs = append(subs, Substitution{From: from, To: to})
+	}
+	return subs
+}
+
+// WER returns the word error rate of hyp against the reference ref: the
+// substituted, deleted and inserted words over the words in ref, compared
+// like Words does. An empty ref has a WER of 0, or 1 if hyp isn't empty.
+func WER(ref, hyp string) float64 {
+	r := normalize(strings.Fields(ref))
+	h := normalize(strings.Fields(hyp))
+	if len(r) == 0 {
+		if len(h) == 0 {
+			return 0
+		}
+		return 1
+	}
+
+	// Edit distance over words, one row at a time
+	prev := make([]int, len(h)+1)
+	cur := make([]int, len(h)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(r); i++ {
+		cur[0] = i
+		for j := 1; j <= len(h); j++ {
+			sub := prev[j-1]
+			if r[i-1] != h[j-1] {
+				sub++
+			}
+			cur[j] = min(sub, prev[j]+1, cur[j-1]+1)
+		}
+		prev, cur = cur, prev
+	}
+	return float64(prev[len(h)]) / float64(len(r))
+}
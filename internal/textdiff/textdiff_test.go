@@ -0,0 +1,116 @@
+package textdiff
+
+import (
+	"math/rand/v2"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want []Op
+	}{
+		{"", "", nil},
+		{"hola mundo", "", []Op{{Delete, "hola mundo"}}},
+		{"", "hola mundo", []Op{{Insert, "hola mundo"}}},
+		{"Hola, mundo.", "hola mundo", []Op{{Equal, "hola mundo"}}},
+		{"the cat sat", "the dog sat", []Op{{Equal, "the"}, {Delete, "cat"}, {Insert, "dog"}, {Equal, "sat"}}},
+		{"a b c", "c b a", []Op{{Delete, "a b"}, {Equal, "c"}, {Insert, "b a"}}},
+		{"send it to ana", "send it to Anna now", []Op{{Equal, "send it to"}, {Delete, "ana"}, {Insert, "Anna now"}}},
+	}
+	for _, tt := range tests {
+		if got := Words(tt.a, tt.b); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Words(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// lcs is the length of the longest common subsequence of a and b.
+func lcs(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			if a[i] == b[j] {
+				cur[j+1] = prev[j] + 1
+			} else {
+				cur[j+1] = max(prev[j+1], cur[j])
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func TestWordsShortest(t *testing.T) {
+	rng := rand.New(rand.NewPCG(1, 2))
+	words := func() []string {
+		w := make([]string, rng.IntN(30))
+		for i := range w {
+			w[i] = string(rune('a' + rng.IntN(4)))
+		}
+		return w
+	}
+	for range 2000 {
+		a, b := words(), words()
+		var gotA, gotB []string
+		equal := 0
+		ops := Words(strings.Join(a, " "), strings.Join(b, " "))
+		for i, op := range ops {
+			if i > 0 && op.Kind == Delete && ops[i-1].Kind == Insert {
+				t.Fatalf("%q -> %q: insertion before a deletion", a, b)
+			}
+			w := strings.Fields(op.Text)
+			if op.Kind != Insert {
+				gotA = append(gotA, w...)
+			}
+			if op.Kind != Delete {
+				gotB = append(gotB, w...)
+			}
+			if op.Kind == Equal {
+				equal += len(w)
+			}
+		}
+		if strings.Join(gotA, " ") != strings.Join(a, " ") || strings.Join(gotB, " ") != strings.Join(b, " ") {
+			t.Fatalf("%q -> %q: the ops don't rebuild the texts", a, b)
+		}
+		if want := lcs(a, b); equal != want {
+			t.Fatalf("%q -> %q: %d equal words, want %d", a, b, equal, want)
+		}
+	}
+}
+
+func TestWordsLong(t *testing.T) {
+	// An hour of speech each: the whole table would take gigabytes
+	a := make([]string, 20000)
+	for i := range a {
+		a[i] = "word" + string(rune('a'+i%26))
+	}
+	b := append([]string(nil), a...)
+	for i := 0; i < len(b); i += 50 {
+		b[i] = "other"
+	}
+	ops := Words(strings.Join(a, " "), strings.Join(b, " "))
+	changed := 0
+	for _, op := range ops {
+		if op.Kind == Insert {
+			changed += len(strings.Fields(op.Text))
+		}
+	}
+	if changed != 400 {
+		t.Errorf("%d words inserted, want 400", changed)
+	}
+}
+
+func BenchmarkWords(b *testing.B) {
+	words := strings.Fields(strings.Repeat("the quick brown fox jumps over the lazy dog ", 1000))
+	other := append([]string(nil), words...)
+	for i := 0; i < len(other); i += 20 {
+		other[i] = "cat"
+	}
+	x, y := strings.Join(words, " "), strings.Join(other, " ")
+	for b.Loop() {
+		Words(x, y)
+	}
+}
@@ -0,0 +1,228 @@
+// Package vad finds speech in audio with a simple energy-based voice
+// activity detector. It needs no model and is cheap enough to run on every
+// recording.
+package vad
+
+import (
+	"math"
+	"slices"
+	"time"
+)
+
+// Config tunes the detector.
+type Config struct {
+	// Frame is the analysis window.
+	Frame time.Duration
+	// Threshold is the minimum RMS level counted as speech. The effective
+	// threshold is raised above the noise floor of noisy recordings.
+	Threshold float64
+	// MinSpeech drops segments shorter than this.
+	MinSpeech time.Duration
+	// MinSilence is the pause needed to end a segment.
+	MinSilence time.Duration
+	// Padding is kept around each segment so word edges aren't clipped.
+	Padding time.Duration
+	// MaxSegment splits longer speech into several segments. Zero means no
+	// limit.
+	MaxSegment time.Duration
+}
+
+// DefaultConfig returns settings that work for dictation at 16kHz.
+func DefaultConfig() Config {
+	return Config{
+		Frame:      30 * time.Millisecond,
+		Threshold:  0.01,
+		MinSpeech:  250 * time.Millisecond,
+		MinSilence: 700 * time.Millisecond,
+		Padding:    200 * time.Millisecond,
+		MaxSegment: 30 * time.Second,
+	}
+}
+
+// Segment is a span of speech, as sample offsets [Start, End).
+type Segment struct {
+	Start int
+	End   int
+}
+
+// StartTime returns the offset of the segment in the audio.
+func (s Segment) StartTime(sampleRate int) time.Duration {
+	return time.Duration(s.Start) * time.Second / time.Duration(sampleRate)
+}
+
+// Segments returns the speech segments in samples, in order.
+func Segments(samples []float32, sampleRate int, cfg Config) []Segment {
+	frame := samplesIn(cfg.Frame, sampleRate)
+	if frame == 0 || len(samples) < frame {
+		return nil
+	}
+
+	levels := make([]float64, len(samples)/frame)
+	for i := range levels {
+		levels[i] = rms(samples[i*frame : (i+1)*frame])
+	}
+	threshold := max(cfg.Threshold, noiseFloor(levels)*3)
+
+	minSilence := samplesIn(cfg.MinSilence, sampleRate) / frame
+	maxFrames := samplesIn(cfg.MaxSegment, sampleRate) / frame
+
+	// Group speech frames, bridging pauses shorter than MinSilence
+	var spans [][2]int
+	start, silent := -1, 0
+	for i, l := range levels {
+		switch {
+		case l >= threshold:
+			if start < 0 {
+				start = i
+			}
+			silent = 0
+			if maxFrames > 0 && i+1-start >= maxFrames {
+				spans = append(spans, [2]int{start, i + 1})
+				start = -1
+			}
+		case start >= 0:
+			silent++
+			if silent > minSilence {
+				spans = append(spans, [2]int{start, i + 1 - silent})
+				start, silent = -1, 0
+			}
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(levels) - silent})
+	}
+
+	minSpeech := samplesIn(cfg.MinSpeech, sampleRate)
+	pad := samplesIn(cfg.Padding, sampleRate)
+	var segs []Segment
+	for _, sp := range spans {
+		s, e := sp[0]*frame, sp[1]*frame
+		if e-s < minSpeech {
+			continue
+		}
+		s, e = max(0, s-pad), min(len(samples), e+pad)
+		if n := len(segs); n > 0 && s < segs[n-1].End {
+			s = segs[n-1].End
+		}
+		segs = append(segs, Segment{Start: s, End: e})
+	}
+	return segs
+}
+
+// HasSpeech reports whether samples contain any speech.
+func HasSpeech(samples []float32, sampleRate int, cfg Config) bool {
+	return len(Segments(samples, sampleRate, cfg)) > 0
+}
+
+// noiseFloor estimates the background level as the 10th percentile of the
+// frame levels.
+func noiseFloor(levels []float64) float64 {
+	sorted := slices.Clone(levels)
+	slices.Sort(sorted)
+	return sorted[len(sorted)/10]
+}
+
+func rms(samples []float32) float64 {
+	var sum float64
+	for _, s := range samples {
+		sum += float64(s) * float64(s)
+	}
+	return math.Sqrt(sum / float64(len(samples)))
+}
+
+func samplesIn(d time.Duration, sampleRate int) int {
+	return int(d * time.Duration(sampleRate) / time.Second)
+}
+
+// Chunk is a speech segment cut from a stream.
+type Chunk struct {
+	// Start is the offset of the chunk from the start of the stream.
+	Start time.Duration
+	// Offset is Start in samples.
+	Offset  int
+	Samples []float32
+}
+
+// Segmenter cuts a continuous stream of audio into speech chunks as soon as
+// each one is followed by enough silence, so long recordings can be
+// transcribed while they are still running.
+type Segmenter struct {
+	cfg        Config
+	sampleRate int
+	buf        []float32
+	// offset is the stream position of buf[0], in samples.
+	offset int
+}
+
+// NewSegmenter creates a Segmenter for audio at sampleRate.
+func NewSegmenter(sampleRate int, cfg Config) *Segmenter {
+	return &Segmenter{cfg: cfg, sampleRate: sampleRate}
+}
+
+// Write adds audio to the stream and returns the chunks completed by it.
+func (s *Segmenter) Write(samples []float32) []Chunk {
+	s.buf = append(s.buf, samples...)
+
+	segs := Segments(s.buf, s.sampleRate, s.cfg)
+	minSilence := samplesIn(s.cfg.MinSilence, s.sampleRate)
+	var done []Segment
+	for i, seg := range segs {
+		// The last segment may still grow, unless the speaker paused
+		if i == len(segs)-1 && len(s.buf)-seg.End < minSilence {
+			break
+		}
+		done = append(done, seg)
+	}
+
+	if len(done) == 0 {
+		// Drop silence, keeping a second in case speech is starting
+		if keep := s.sampleRate; len(segs) == 0 && len(s.buf) > 10*keep {
+			s.trim(len(s.buf) - keep)
+		}
+		return nil
+	}
+	chunks := s.chunks(done)
+	s.trim(done[len(done)-1].End)
+	return chunks
+}
+
+// Flush returns the speech left in the stream and resets it.
+func (s *Segmenter) Flush() []Chunk {
+	chunks := s.chunks(Segments(s.buf, s.sampleRate, s.cfg))
+	s.trim(len(s.buf))
+	return chunks
+}
+
+func (s *Segmenter) chunks(segs []Segment) []Chunk {
+	var chunks []Chunk
+	for _, seg := range segs {
+		chunks = append(chunks, Chunk{
+			Start:   Segment{Start: s.offset + seg.Start}.StartTime(s.sampleRate),
+			Offset:  s.offset + seg.Start,
+			Samples: slices.Clone(s.buf[seg.Start:seg.End]),
+		})
+	}
+	return chunks
+}
+
+func (s *Segmenter) trim(n int) {
+	s.buf = slices.Clone(s.buf[n:])
+	s.offset += n
+}
+
+// Offset returns the stream position, in samples, of the audio still
+// buffered. The chunks of later writes start at or after it.
+func (s *Segmenter) Offset() int {
+	return s.offset
+}
+
+// Pending returns a copy of the buffered audio from the start of the speech
+// still in progress, or nil if there's none. Use it for partial results
+// before Write completes the chunk.
+func (s *Segmenter) Pending() []float32 {
+	segs := Segments(s.buf, s.sampleRate, s.cfg)
+	if len(segs) == 0 {
+		return nil
+	}
+	return slices.Clone(s.buf[segs[0].Start:])
+}
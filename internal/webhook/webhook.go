@@ -0,0 +1,133 @@
+// Package webhook delivers JSON event payloads to HTTP endpoints, signing
+// them with HMAC-SHA256 and retrying failed deliveries.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// SignatureHeader carries the hex HMAC-SHA256 of the request body, prefixed
+// with "sha256=", when a secret is configured.
+const SignatureHeader = "X-Lunartlk-Signature"
+
+// EventHeader names the event that triggered the delivery.
+const EventHeader = "X-Lunartlk-Event"
+
+// Notifier posts payloads to a fixed set of webhook URLs.
+type Notifier struct {
+	urls    []string
+	secret  string
+	retries int
+	backoff time.Duration
+	http    *http.Client
+}
+
+// Option configures a Notifier.
+type Option func(*Notifier)
+
+// WithSecret signs every payload with an HMAC-SHA256 of the body.
+func WithSecret(secret string) Option {
+	return func(n *Notifier) { n.secret = secret }
+}
+
+// WithRetries sets how many times a failed delivery is retried (default: 3).
+func WithRetries(retries int) Option {
+	return func(n *Notifier) { n.retries = retries }
+}
+
+// WithBackoff sets the delay before the first retry. It doubles on every
+// subsequent attempt (default: 1s).
+func WithBackoff(d time.Duration) Option {
+	return func(n *Notifier) { n.backoff = d }
+}
+
+// New creates a Notifier for the given URLs.
+func New(urls []string, opts ...Option) *Notifier {
+	n := &Notifier{
+		urls:    urls,
+		retries: 3,
+		backoff: time.Second,
+		http:    &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	return n
+}
+
+// Notify delivers payload to every URL in the background. Failures are
+// logged once all retries are exhausted.
+func (n *Notifier) Notify(event string, payload any) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("[webhook] marshal %s payload: %v", event, err)
+		return
+	}
+	for _, url := range n.urls {
+		go func() {
+			if err := n.deliver(url, event, body); err != nil {
+				log.Printf("[webhook] %s: %v", url, err)
+			}
+		}()
+	}
+}
+
+func (n *Notifier) deliver(url, event string, body []byte) error {
+	delay := n.backoff
+	var err error
+	for attempt := 0; attempt <= n.retries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(delay)
+			delay *= 2
+		}
+		var retry bool
+		if retry, err = n.post(url, event, body); err == nil || !retry {
+			return err
+		}
+	}
+	return fmt.Errorf("giving up after %d attempts: %w", n.retries+1, err)
+}
+
+// post sends a single delivery. The returned bool reports whether a failure
+// is worth retrying (network errors, 429 and 5xx responses).
+func (n *Notifier) post(url, event string, body []byte) (bool, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, event)
+	if n.secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(n.secret, body))
+	}
+
+	resp, err := n.http.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("HTTP %d", resp.StatusCode)
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of body using secret. Receivers
+// can compare it against the SignatureHeader value to authenticate deliveries.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
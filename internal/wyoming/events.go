@@ -0,0 +1,77 @@
+package wyoming
+
+// Event types used by speech-to-text services.
+const (
+	TypeDescribe   = "describe"
+	TypeInfo       = "info"
+	TypeTranscribe = "transcribe"
+	TypeAudioStart = "audio-start"
+	TypeAudioChunk = "audio-chunk"
+	TypeAudioStop  = "audio-stop"
+	TypeTranscript = "transcript"
+	TypeError      = "error"
+)
+
+// AudioFormat is the data of audio-start and audio-chunk events. Width is
+// the sample size in bytes; samples are little-endian PCM.
+type AudioFormat struct {
+	Rate     int `json:"rate"`
+	Width    int `json:"width"`
+	Channels int `json:"channels"`
+}
+
+// Transcribe is the data of a transcribe event, which precedes the audio.
+// Both fields are optional.
+type Transcribe struct {
+	Name     string `json:"name,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+// Transcript is the data of a transcript event.
+type Transcript struct {
+	Text     string `json:"text"`
+	Language string `json:"language,omitempty"`
+}
+
+// Error is the data of an error event.
+type Error struct {
+	Text string `json:"text"`
+	Code string `json:"code,omitempty"`
+}
+
+// Attribution credits the authors of a program or model.
+type Attribution struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// ASRModel is a speech-to-text model offered by an ASRProgram.
+type ASRModel struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Attribution Attribution `json:"attribution"`
+	Installed   bool        `json:"installed"`
+	Version     string      `json:"version,omitempty"`
+	Languages   []string    `json:"languages"`
+}
+
+// ASRProgram is a speech-to-text service.
+type ASRProgram struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Attribution Attribution `json:"attribution"`
+	Installed   bool        `json:"installed"`
+	Version     string      `json:"version,omitempty"`
+	Models      []ASRModel  `json:"models"`
+}
+
+// Info is the data of the info event sent in reply to describe. Clients
+// expect the lists of the other service kinds to be present, even if
+// empty.
+type Info struct {
+	ASR    []ASRProgram `json:"asr"`
+	TTS    []any        `json:"tts"`
+	Handle []any        `json:"handle"`
+	Intent []any        `json:"intent"`
+	Wake   []any        `json:"wake"`
+}
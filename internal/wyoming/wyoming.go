@@ -0,0 +1,157 @@
+// Package wyoming reads and writes events of the Wyoming protocol, which
+// Home Assistant uses to talk to voice services such as speech-to-text.
+//
+// An event is a JSON header line, followed by optional JSON data and an
+// optional binary payload whose lengths are given in the header.
+package wyoming
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Version is the protocol version sent in event headers.
+const Version = "1.5.3"
+
+// maxHeader bounds the header line so a bad peer can't grow it forever.
+const maxHeader = 1 << 20
+
+// Event is a single protocol message.
+type Event struct {
+	Type    string
+	Data    json.RawMessage
+	Payload []byte
+}
+
+type header struct {
+	Type          string          `json:"type"`
+	Version       string          `json:"version,omitempty"`
+	Data          json.RawMessage `json:"data,omitempty"`
+	DataLength    int             `json:"data_length,omitempty"`
+	PayloadLength int             `json:"payload_length,omitempty"`
+}
+
+// NewEvent returns an event of type typ with data marshalled as JSON.
+func NewEvent(typ string, data any) (*Event, error) {
+	e := &Event{Type: typ}
+	if data != nil {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return nil, fmt.Errorf("marshal %s: %w", typ, err)
+		}
+		e.Data = b
+	}
+	return e, nil
+}
+
+// Decode unmarshals the event data into v. Events without data leave v
+// untouched.
+func (e *Event) Decode(v any) error {
+	if len(e.Data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("decode %s: %w", e.Type, err)
+	}
+	return nil
+}
+
+// Read reads the next event from r. Data may be inline in the header, in
+// a separate section, or both (older and newer peers differ); both are
+// merged. Events whose data or payload is longer than maxLength bytes are
+// rejected before they're read, as the lengths come from the peer.
+func Read(r *bufio.Reader, maxLength int) (*Event, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	var h header
+	if err := json.Unmarshal(line, &h); err != nil {
+		return nil, fmt.Errorf("bad header: %w", err)
+	}
+	if h.Type == "" {
+		return nil, fmt.Errorf("bad header: missing type")
+	}
+	if h.DataLength < 0 || h.PayloadLength < 0 {
+		return nil, fmt.Errorf("bad header: negative length")
+	}
+	if h.DataLength > maxLength || h.PayloadLength > maxLength {
+		return nil, fmt.Errorf("%s too long: the limit is %d bytes", h.Type, maxLength)
+	}
+
+	e := &Event{Type: h.Type, Data: h.Data}
+	if h.DataLength > 0 {
+		data := make([]byte, h.DataLength)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("read %s data: %w", h.Type, err)
+		}
+		if e.Data, err = mergeData(e.Data, data); err != nil {
+			return nil, fmt.Errorf("%s data: %w", h.Type, err)
+		}
+	}
+	if h.PayloadLength > 0 {
+		e.Payload = make([]byte, h.PayloadLength)
+		if _, err := io.ReadFull(r, e.Payload); err != nil {
+			return nil, fmt.Errorf("read %s payload: %w", h.Type, err)
+		}
+	}
+	return e, nil
+}
+
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxHeader {
+			return nil, fmt.Errorf("header too long")
+		}
+		if !isPrefix {
+			return line, nil
+		}
+	}
+}
+
+// mergeData adds the fields of the data section to the inline data.
+func mergeData(inline, section []byte) (json.RawMessage, error) {
+	if len(inline) == 0 {
+		return section, nil
+	}
+	var a, b map[string]json.RawMessage
+	if err := json.Unmarshal(inline, &a); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(section, &b); err != nil {
+		return nil, err
+	}
+	for k, v := range b {
+		a[k] = v
+	}
+	return json.Marshal(a)
+}
+
+// Write writes e to w, with its data in a separate section.
+func Write(w io.Writer, e *Event) error {
+	h := header{
+		Type:          e.Type,
+		Version:       Version,
+		DataLength:    len(e.Data),
+		PayloadLength: len(e.Payload),
+	}
+	line, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, 0, len(line)+1+len(e.Data)+len(e.Payload))
+	buf = append(buf, line...)
+	buf = append(buf, '\n')
+	buf = append(buf, e.Data...)
+	buf = append(buf, e.Payload...)
+	_, err = w.Write(buf)
+	return err
+}
@@ -0,0 +1,43 @@
+package wyoming
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadRejectsLongSections(t *testing.T) {
+	for _, line := range []string{
+		`{"type":"audio-chunk","payload_length":9000000000000000000}`,
+		`{"type":"audio-chunk","data_length":2048}`,
+	} {
+		r := bufio.NewReader(strings.NewReader(line + "\n"))
+		if _, err := Read(r, 1024); err == nil {
+			t.Errorf("Read(%s) succeeded, want an error", line)
+		}
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	e, err := NewEvent(TypeAudioChunk, AudioFormat{Rate: 16000, Width: 2, Channels: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Payload = []byte{1, 2, 3, 4}
+	var buf bytes.Buffer
+	if err := Write(&buf, e); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Read(bufio.NewReader(&buf), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f AudioFormat
+	if err := got.Decode(&f); err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != TypeAudioChunk || f.Rate != 16000 || !bytes.Equal(got.Payload, e.Payload) {
+		t.Errorf("got %+v %+v, want %+v", got, f, e)
+	}
+}
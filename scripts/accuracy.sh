@@ -0,0 +1,15 @@
+#!/usr/bin/env bash
+# Checks the word error rate of each engine against testdata/corpus.
+# Extra arguments are passed to lunartlk-server accuracy, e.g. -max-wer 0.15.
+set -euo pipefail
+
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+PROJECT_DIR="$(cd "$SCRIPT_DIR/.." && pwd)"
+SERVER="$PROJECT_DIR/bin/lunartlk-server"
+
+if [ ! -x "$SERVER" ]; then
+    echo "ERROR: $SERVER not found, run scripts/build.sh first" >&2
+    exit 1
+fi
+
+exec "$SERVER" accuracy "$@" "$PROJECT_DIR/testdata/corpus"
@@ -298,11 +298,14 @@ build_binaries() {
     go get github.com/gordonklaus/portaudio
     go mod tidy
 
+    local version
+    version=$(git -C "$PROJECT_DIR" describe --tags --always --dirty 2>/dev/null || echo dev)
+
     info "Building lunartlk-client..."
-    go build -o bin/lunartlk-client ./cmd/lunartlk-client
+    go build -ldflags "-X main.version=$version" -o bin/lunartlk-client ./cmd/lunartlk-client
 
     info "Building lunartlk-server..."
-    go build -o bin/lunartlk-server.bin ./cmd/lunartlk-server
+    go build -ldflags "-X main.version=$version" -o bin/lunartlk-server.bin ./cmd/lunartlk-server
 
     info "Creating self-extracting server bundle..."
     local staging
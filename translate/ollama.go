@@ -41,7 +41,9 @@ func WithPrompt(prompt string) OllamaOption {
 	return func(o *OllamaTranslator) { o.prompt = prompt }
 }
 
-func ollamaDefaultHost() string {
+// DefaultHost returns the Ollama server URL from $OLLAMA_HOST, or
+// http://localhost:11434 when unset.
+func DefaultHost() string {
 	if h := os.Getenv("OLLAMA_HOST"); h != "" {
 		return normalizeHost(h)
 	}
@@ -61,7 +63,7 @@ func normalizeHost(h string) string {
 // NewOllama creates an OllamaTranslator. A model must be provided via WithModel.
 func NewOllama(opts ...OllamaOption) *OllamaTranslator {
 	o := &OllamaTranslator{
-		host:   ollamaDefaultHost(),
+		host:   DefaultHost(),
 		prompt: defaultPrompt,
 		http:   http.DefaultClient,
 	}
@@ -81,11 +83,11 @@ var translationSchema = map[string]any{
 }
 
 type chatRequest struct {
-	Model    string           `json:"model"`
-	Messages []chatMessage    `json:"messages"`
-	Format   map[string]any   `json:"format"`
-	Stream   bool             `json:"stream"`
-	Options  map[string]any   `json:"options,omitempty"`
+	Model    string         `json:"model"`
+	Messages []chatMessage  `json:"messages"`
+	Format   map[string]any `json:"format,omitempty"`
+	Stream   bool           `json:"stream"`
+	Options  map[string]any `json:"options,omitempty"`
 }
 
 type chatMessage struct {
@@ -97,6 +99,7 @@ type chatResponse struct {
 	Message struct {
 		Content string `json:"content"`
 	} `json:"message"`
+	Done bool `json:"done"`
 }
 
 type translationResult struct {
@@ -155,3 +158,70 @@ func (o *OllamaTranslator) Translate(ctx context.Context, text, toLang string) (
 
 	return result.Translation, nil
 }
+
+// TranslateStream translates text into toLang like Translate, calling fn
+// with the translation so far as Ollama generates it. It returns the
+// whole translation.
+//
+// Streamed output can't be held to a JSON schema, so the model is trusted
+// to return only the translation, as the prompt asks.
+func (o *OllamaTranslator) TranslateStream(ctx context.Context, text, toLang string, fn func(sofar string)) (string, error) {
+	if o.model == "" {
+		return "", fmt.Errorf("ollama: model not set")
+	}
+
+	req := chatRequest{
+		Model: o.model,
+		Messages: []chatMessage{
+			{Role: "user", Content: fmt.Sprintf(o.prompt, toLang, text)},
+		},
+		Stream:  true,
+		Options: map[string]any{"temperature": 0},
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("ollama: marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", o.host+"/api/chat", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("ollama: create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := o.http.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("ollama: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("ollama: server returned %d: %s", resp.StatusCode, string(b))
+	}
+
+	// The response is a JSON object per line, each with the next piece of
+	// the message
+	var sb strings.Builder
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var chunk chatResponse
+		if err := dec.Decode(&chunk); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return "", fmt.Errorf("ollama: decode response: %w", err)
+		}
+		if chunk.Message.Content != "" {
+			sb.WriteString(chunk.Message.Content)
+			if fn != nil {
+				fn(strings.TrimSpace(sb.String()))
+			}
+		}
+		if chunk.Done {
+			break
+		}
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
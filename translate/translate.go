@@ -6,3 +6,10 @@ import "context"
 type Translator interface {
 	Translate(ctx context.Context, text, toLang string) (string, error)
 }
+
+// StreamTranslator is a Translator that can report a translation while
+// it's being generated.
+type StreamTranslator interface {
+	Translator
+	TranslateStream(ctx context.Context, text, toLang string, fn func(sofar string)) (string, error)
+}